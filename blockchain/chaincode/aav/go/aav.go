@@ -6,7 +6,6 @@
 package main
 
 import (
-	"bytes"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -15,7 +14,9 @@ import (
 	"time"
 
 	"cryptoFunc"
+	"wire"
 
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
 )
@@ -30,6 +31,16 @@ type aav struct {
 	AavVal     string `json:"aavVal"`
 }
 
+// verification is the record written by verify, keyed by transaction ID.
+// It must not contain any value of the proof, which would make two verifications of the same user linkable
+type verification struct {
+	ObjectType string `json:"docType"`
+	TxID       string `json:"txID"`
+	Timestamp  string `json:"timestamp"` //timestamp of the transaction, RFC 3339
+	SP         string `json:"sp"`        //MSP ID and client ID of the SP which submitted the verification
+	Verify     string `json:"verify"`    //verdict, always "true" since a failed verification fails the transaction
+}
+
 // ===================================================================================
 // Main
 // ===================================================================================
@@ -41,8 +52,37 @@ func main() {
 }
 
 // Init initializes chaincode
+// Instantiated with {"Args":["init","<adminMSP>","iv=<MSP ID>,...","cp=<MSP ID>,...","sp=<MSP ID>,..."]}, it stores the MSP ID
+// allowed to manage the issuer registry and the MSP IDs allowed for each role, see setRoleMSPs. A role without MSP ID is held by nobody.
+// Other arguments are ignored, the registry then stays read only
 // ===========================
 func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	function, args := stub.GetFunctionAndParameters()
+	if function != "init" || len(args) < 1 || len(args[0]) <= 0 {
+		return shim.Success(nil)
+	}
+	for _, arg := range args[1:] {
+		if !strings.Contains(arg, "=") {
+			return shim.Success(nil)
+		}
+	}
+	key, err := adminMSPKey(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(key, []byte(args[0]))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, arg := range args[1:] {
+		role, msps, err := parseRoleMSPs(arg)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if err := putRoleMSPsState(stub, role, msps); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
 	return shim.Success(nil)
 }
 
@@ -52,11 +92,48 @@ func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 	function, args := stub.GetFunctionAndParameters()
 	fmt.Println("invoke is running " + function)
 
+	// Role based access control, see policy
+	if err := checkAccess(stub, function); err != nil {
+		return shim.Error(err.Error())
+	}
+
 	// Handle different functions
 	if function == "initAav" { //create a new aav
 		return t.initAav(stub, args)
 	} else if function == "verify" { //start anonymous on chain verification
 		return t.verify(stub, args)
+	} else if function == "initAccumulator" { //publish the revocation accumulator of a CP
+		return t.initAccumulator(stub, args)
+	} else if function == "revoke" { //publish an accumulator update
+		return t.revoke(stub, args)
+	} else if function == "getAccumulator" {
+		return t.getAccumulator(stub, args)
+	} else if function == "getAccumulatorUpdates" {
+		return t.getAccumulatorUpdates(stub, args)
+	} else if function == "registerIssuer" { //register the public key of a CP, admin only
+		return t.registerIssuer(stub, args)
+	} else if function == "updateIssuer" {
+		return t.updateIssuer(stub, args)
+	} else if function == "deactivateIssuer" {
+		return t.deactivateIssuer(stub, args)
+	} else if function == "getIssuer" {
+		return t.getIssuer(stub, args)
+	} else if function == "setRoleMSPs" { //replace the MSPs allowed for a role, admin only
+		return t.setRoleMSPs(stub, args)
+	} else if function == "getRoleMSPs" {
+		return t.getRoleMSPs(stub, args)
+	} else if function == "issueChallenge" { //issue a nonce for the next verify of the SP
+		return t.issueChallenge(stub, args)
+	} else if function == "getAav" { //read an aav
+		return t.getAav(stub, args)
+	} else if function == "getAavsByRange" {
+		return t.getAavsByRange(stub, args)
+	} else if function == "queryByDocType" { //rich queries, CouchDB only
+		return t.queryByDocType(stub, args)
+	} else if function == "queryAavs" {
+		return t.queryAavs(stub, args)
+	} else if function == "getHistoryForAav" {
+		return t.getHistoryForAav(stub, args)
 	}
 
 	fmt.Println("invoke did not find func: " + function) //error
@@ -109,6 +186,9 @@ func (t *SimpleChaincode) initAav(stub shim.ChaincodeStubInterface, args []strin
 	if err != nil {
 		return shim.Error(err.Error())
 	}
+	if err := setEvent(stub, &aavEvent{Type: eventAavCreated, Subject: aavKey}); err != nil {
+		return shim.Error(err.Error())
+	}
 
 	fmt.Println("- end init aav")
 	return shim.Success(nil)
@@ -118,26 +198,159 @@ func (t *SimpleChaincode) initAav(stub shim.ChaincodeStubInterface, args []strin
 // ================================================================================================
 // verify: on chain anonymous attribute verifications
 // This function will be executed from the java orchestrator module with the right parameters
+// It returns the verification record as JSON, and fails the transaction if the input is malformed or the proof is invalid
 // ============================================================================================
 
 func (t *SimpleChaincode) verify(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 
-	blindCommit, _ := hexToByte(args[0])
-	blindCertificate, _ := hexToByte(args[1])
-	blindPubG1CP, _ := hexToByte(args[2])
-	blindPubG2User, _ := hexToByte(args[3])
-	blindGenerator, _ := hexToByte(args[4])
+	//   0                1                  2               3                 4                 5                 6           7              8        9
+	// "blindCommit", "blindCertificate", "blindPubG1CP", "blindPubG2User", "blindGenerator", "attributeCount", "issuerID", "issuerProof", "nonce", "membershipProof"
+	// issuerProof proves that blindPubG1CP is derived from the registered key of the active issuer issuerID.
+	// It is bound to nonce, a challenge issued to the submitting SP by issueChallenge, which is consumed by the verification
+	// membershipProof is required when the issuer has an accumulator: the certificate must not be revoked in it
+	// The keys, points and proofs are hexadecimal, in their legacy form or in the versioned format of the wire package
+	if len(args) != 9 && len(args) != 10 {
+		return shim.Error("Incorrect number of arguments. Expecting 9 or 10")
+	}
+
+	// ==== Input sanitation ====
+	argNames := []string{"1st", "2nd", "3rd", "4th", "5th"}
+	argTypes := []wire.Type{wire.BlindCommitment, wire.Certificate, wire.IssuerPublicKey, wire.HolderPublicKey, wire.G1Point}
+	decoded := make([][]byte, 5)
+	for i := 0; i < 5; i++ {
+		var err error
+		decoded[i], err = wire.Parse(args[i], argTypes[i])
+		if err != nil || len(args[i]) <= 0 {
+			return shim.Error(argNames[i] + " argument must be a non-empty hexadecimal string")
+		}
+	}
+	blindCommit, blindCertificate, blindPubG1CP, blindPubG2User, blindGenerator := decoded[0], decoded[1], decoded[2], decoded[3], decoded[4]
+	attributeCount, err := strconv.Atoi(args[5])
+	if err != nil {
+		return shim.Error("6th argument must be a numeric string")
+	}
+	iss, err := getIssuerState(stub, args[6])
+	if err != nil {
+		return shim.Error("Failed to get issuer: " + err.Error())
+	} else if iss == nil {
+		return shim.Error("Issuer does not exist: " + args[6])
+	} else if !iss.Active {
+		return shim.Error("Issuer is not active: " + args[6])
+	}
+	issuerProof, err := wire.Parse(args[7], wire.IssuerProof)
+	if err != nil {
+		return shim.Error("8th argument must be an hexadecimal string")
+	}
+	nonce, err := hexToByte(args[8])
+	if err != nil || len(args[8]) <= 0 {
+		return shim.Error("9th argument must be a non-empty hexadecimal string")
+	}
+	var membershipProof []byte
+	var acc *accumulator
+	if iss.AccumulatorID != "" {
+		if len(args) != 10 {
+			return shim.Error("Issuer has an accumulator, expecting a membership proof")
+		}
+		membershipProof, err = wire.Parse(args[9], wire.MembershipProof)
+		if err != nil {
+			return shim.Error("10th argument must be an hexadecimal string")
+		}
+		acc, err = getAccumulatorState(stub, iss.AccumulatorID)
+		if err != nil {
+			return shim.Error("Failed to get accumulator: " + err.Error())
+		} else if acc == nil {
+			return shim.Error("Accumulator does not exist: " + iss.AccumulatorID)
+		}
+	} else if len(args) == 10 {
+		return shim.Error("Issuer has no accumulator, unexpected membership proof")
+	}
+
+	// ==== Replay protection: the challenge must be fresh and the presentation must not have been verified yet ====
+	sp, err := clientIdentity(stub)
+	if err != nil {
+		return shim.Error("Failed to get the identity of the SP: " + err.Error())
+	}
+	c, msg := checkChallenge(stub, args[8], sp)
+	if c == nil {
+		return shim.Error(msg)
+	}
+	digest, err := cryptoFunc.PresentationDigest(blindCommit, attributeCount, blindCertificate, blindPubG1CP, blindPubG2User, blindGenerator)
+	if err != nil {
+		return shim.Error("Malformed proof: " + err.Error())
+	}
+	spent, err := isSpent(stub, digest)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if spent {
+		return shim.Error("Presentation already used: " + hex.EncodeToString(digest))
+	}
 
 	start := time.Now()
-	b, err := cryptoFunc.VerifyBlindCertificate(blindCommit, blindCertificate, blindPubG1CP, blindPubG2User, blindGenerator)
+	issuerKey, _ := wire.Parse(iss.PublicKey, wire.IssuerPublicKey)
+	b, err := cryptoFunc.VerifyIssuerProof(digest, blindPubG1CP, blindGenerator, issuerKey, issuerProof, nonce, []byte(c.Context))
+	if err == nil && b {
+		b, err = cryptoFunc.VerifyBlindCertificate(blindCommit, attributeCount, blindCertificate, blindPubG1CP, blindPubG2User, blindGenerator)
+	}
+	if err == nil && b && acc != nil {
+		value, _ := wire.Parse(acc.Value, wire.AccumulatorValue)
+		publicKey, _ := wire.Parse(acc.PublicKey, wire.AccumulatorPublicKey)
+		b, err = cryptoFunc.VerifyBlindMembership(blindCommit, blindGenerator, value, publicKey, membershipProof)
+	}
 	end := time.Now()
 	elapsed := end.Sub(start)
 	fmt.Println("VerifyBlindSignature time: ", elapsed)
 	if err != nil {
-		fmt.Println(err)
+		return shim.Error("Malformed proof: " + err.Error())
+	} else if !b {
+		return shim.Error("Verification failed")
 	}
-	fmt.Println(b)
-	return shim.Success(nil)
+
+	err = spend(stub, args[8], digest)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// ==== Record the verdict, without anything which could link two verifications of the same user ====
+	now, err := txTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	record := &verification{
+		ObjectType: "verification",
+		TxID:       stub.GetTxID(),
+		Timestamp:  now.Format(time.RFC3339),
+		SP:         sp,
+		Verify:     "true",
+	}
+	recordJSONasBytes, err := json.Marshal(record)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	recordKey, err := stub.CreateCompositeKey("verification", []string{record.TxID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(recordKey, recordJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := setEvent(stub, &aavEvent{Type: eventVerified, Verify: record.Verify}); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(recordJSONasBytes)
+}
+
+// clientIdentity returns the identity of the client which submits the transaction: its MSP ID and its client ID
+func clientIdentity(stub shim.ChaincodeStubInterface) (string, error) {
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return "", err
+	}
+	id, err := cid.GetID(stub)
+	if err != nil {
+		return "", err
+	}
+	return mspID + "/" + id, nil
 }
 
 //HexToByte converts the string containing an hexa decimal value into a byte representation
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"ledgerstub"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// adminMSP is the MSP given at instantiation, its members manage the issuer registry
+const adminMSP = "Org1MSP"
+
+// clients are the identities of the tests, with their role in the attribute aav.role of their certificate
+type clients struct {
+	admin, iv, cp, sp, sp2, none *ledgerstub.Identity
+}
+
+func newIdentity(t *testing.T, mspID string, name string, role string) *ledgerstub.Identity {
+	attrs := map[string]string{}
+	if role != "" {
+		attrs[roleAttribute] = role
+	}
+	id, err := ledgerstub.NewIdentity(mspID, name, attrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// newLedger instantiates the chaincode on an empty ledger, with the MSPs of the identities allowed for their role
+func newLedger(t *testing.T) (*ledgerstub.Ledger, *clients) {
+	c := &clients{
+		admin: newIdentity(t, adminMSP, "admin", ""),
+		iv:    newIdentity(t, "IVMSP", "iv1", roleIV),
+		cp:    newIdentity(t, "CPMSP", "cp1", roleCP),
+		sp:    newIdentity(t, "SPMSP", "sp1", roleSP),
+		sp2:   newIdentity(t, "SP2MSP", "sp2", roleSP),
+		none:  newIdentity(t, "SPMSP", "user1", ""),
+	}
+	l := ledgerstub.New("aav", new(SimpleChaincode))
+	if res := l.Init(c.admin, "init", adminMSP, "iv=IVMSP", "cp=CPMSP,CP2MSP", "sp=SPMSP,SP2MSP"); res.Status != shim.OK {
+		t.Fatal(res.Message)
+	}
+	return l, c
+}
+
+// mustSucceed fails the test if the transaction failed
+func mustSucceed(t *testing.T, res pb.Response) []byte {
+	t.Helper()
+	if res.Status != shim.OK {
+		t.Fatal(res.Message)
+	}
+	return res.Payload
+}
+
+// mustFail fails the test if the transaction succeeded or failed with another message
+func mustFail(t *testing.T, res pb.Response, prefix string) {
+	t.Helper()
+	if res.Status == shim.OK {
+		t.Fatalf("Transaction succeeded, expecting %q", prefix)
+	}
+	if !strings.HasPrefix(res.Message, prefix) {
+		t.Fatalf("Transaction failed with %q, expecting %q", res.Message, prefix)
+	}
+}
+
+// lastEvent returns the payload of the last committed event, which must be name
+func lastEvent(t *testing.T, l *ledgerstub.Ledger, name string) *aavEvent {
+	t.Helper()
+	events := l.Events()
+	if len(events) == 0 {
+		t.Fatal("No event")
+	}
+	last := events[len(events)-1]
+	if last.EventName != name {
+		t.Fatalf("Last event is %s, expecting %s", last.EventName, name)
+	}
+	e := new(aavEvent)
+	if err := json.Unmarshal(last.Payload, e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Type != name || e.TxID != last.TxId {
+		t.Fatalf("Wrong event: %s", last.Payload)
+	}
+	return e
+}
+
+func TestInitAav(t *testing.T) {
+	l, c := newLedger(t)
+
+	mustSucceed(t, l.Invoke(c.iv, "initAav", "user1-age", "hash1"))
+	mustSucceed(t, l.Invoke(c.cp, "initAav", "user2-age", "hash2"))
+	mustFail(t, l.Invoke(c.iv, "initAav", "user1-age", "hash3"), "This aav exists: user1-age")
+	mustFail(t, l.Invoke(c.sp, "initAav", "user3-age", "hash3"), "Access denied: initAav requires the role iv or cp")
+	mustFail(t, l.Invoke(c.none, "initAav", "user3-age", "hash3"), "Access denied")
+	mustFail(t, l.Invoke(c.iv, "initAav", "user3-age"), "Incorrect number of arguments")
+	mustFail(t, l.Invoke(c.iv, "initAav", "", "hash3"), "1st argument must be a non-empty string")
+
+	e := lastEvent(t, l, eventAavCreated)
+	if e.Subject != "user2-age" || !strings.HasPrefix(e.Submitter, "CPMSP/") {
+		t.Fatalf("Wrong event: %+v", e)
+	}
+
+	a := new(aav)
+	if err := json.Unmarshal(mustSucceed(t, l.Query(c.sp, "getAav", "user1-age")), a); err != nil {
+		t.Fatal(err)
+	}
+	if a.ObjectType != "aav" || a.AavVal != "hash1" {
+		t.Fatalf("Wrong aav: %+v", a)
+	}
+	mustFail(t, l.Query(c.sp, "getAav", "user3-age"), "Aav does not exist")
+}
+
+func TestQueries(t *testing.T) {
+	l, c := newLedger(t)
+	v := loadVectors(t)
+	for _, key := range []string{"a1", "a2", "a3"} {
+		mustSucceed(t, l.Invoke(c.iv, "initAav", key, "value-"+key))
+	}
+	mustSucceed(t, l.Invoke(c.admin, "registerIssuer", "cp1", v.Issuer))
+
+	var all []struct {
+		Key    string
+		Record aav
+	}
+	if err := json.Unmarshal(mustSucceed(t, l.Query(c.sp, "getAavsByRange", "", "")), &all); err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 || all[0].Key != "a1" || all[2].Record.AavVal != "value-a3" {
+		t.Fatalf("Wrong range, composite keys must not be in it: %+v", all)
+	}
+
+	var page struct {
+		Results          []json.RawMessage
+		ResponseMetadata struct {
+			RecordsCount int
+			Bookmark     string
+		}
+	}
+	if err := json.Unmarshal(mustSucceed(t, l.Query(c.sp, "getAavsByRange", "", "", "2")), &page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Results) != 2 || page.ResponseMetadata.RecordsCount != 2 || page.ResponseMetadata.Bookmark == "" {
+		t.Fatalf("Wrong first page: %+v", page)
+	}
+	if err := json.Unmarshal(mustSucceed(t, l.Query(c.sp, "getAavsByRange", "", "", "2", page.ResponseMetadata.Bookmark)), &page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Results) != 1 {
+		t.Fatalf("Wrong second page: %+v", page)
+	}
+	mustFail(t, l.Query(c.sp, "getAavsByRange", "", "", "0"), "3rd argument must be a positive numeric string")
+
+	var docs []json.RawMessage
+	if err := json.Unmarshal(mustSucceed(t, l.Query(c.sp, "queryByDocType", "issuer")), &docs); err != nil || len(docs) != 1 {
+		t.Fatalf("Wrong issuers: %v %s", err, docs)
+	}
+	if err := json.Unmarshal(mustSucceed(t, l.Query(c.sp, "queryAavs", `{"selector":{"docType":"aav","aavVal":"value-a2"}}`)), &docs); err != nil || len(docs) != 1 {
+		t.Fatalf("Wrong rich query: %v %s", err, docs)
+	}
+
+	var history []struct {
+		TxId     string
+		Value    *aav
+		IsDelete bool
+	}
+	if err := json.Unmarshal(mustSucceed(t, l.Query(c.sp, "getHistoryForAav", "a2")), &history); err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].Value.AavVal != "value-a2" || history[0].IsDelete {
+		t.Fatalf("Wrong history: %+v", history)
+	}
+}
+
+func TestInitWithoutAdmin(t *testing.T) {
+	l := ledgerstub.New("aav", new(SimpleChaincode))
+	admin := newIdentity(t, adminMSP, "admin", "")
+	// the sample arguments of the network scripts are accepted, the registry then stays read only
+	mustSucceed(t, l.Init(admin, "init", "a", "100", "b", "200"))
+	mustFail(t, l.Invoke(admin, "registerIssuer", "cp1", loadVectors(t).Issuer), "No admin MSP configured")
+	mustFail(t, l.Invoke(admin, "unknown"), "Received unknown function invocation")
+}
+
+func TestRoleMSPs(t *testing.T) {
+	l, c := newLedger(t)
+	v := loadVectors(t)
+
+	// the role of a certificate is only accepted from the MSPs allowed for it
+	rogue := newIdentity(t, "RogueMSP", "cp9", roleCP)
+	mustFail(t, l.Invoke(rogue, "initAccumulator", "acc1", v.Accumulator.PublicKey, v.Accumulator.Value), "Access denied: the role cp is not allowed for the clients of RogueMSP")
+	mustFail(t, l.Invoke(newIdentity(t, "CPMSP", "sp9", roleSP), "issueChallenge"), "Access denied: the role sp is not allowed for the clients of CPMSP")
+
+	// the admin changes them
+	mustFail(t, l.Invoke(c.cp, "setRoleMSPs", "cp", "CPMSP", "RogueMSP"), "Access denied")
+	mustFail(t, l.Invoke(c.admin, "setRoleMSPs", "admin", "RogueMSP"), "1st argument must be iv, cp or sp")
+	mustSucceed(t, l.Invoke(c.admin, "setRoleMSPs", "cp", "CPMSP", "RogueMSP"))
+	if e := lastEvent(t, l, eventRoleMSPsUpdated); e.Subject != "cp" {
+		t.Fatalf("Wrong event: %+v", e)
+	}
+	var msps []string
+	if err := json.Unmarshal(mustSucceed(t, l.Query(c.sp, "getRoleMSPs", "cp")), &msps); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(msps, ",") != "CPMSP,RogueMSP" {
+		t.Fatalf("Wrong MSPs: %v", msps)
+	}
+	mustSucceed(t, l.Invoke(rogue, "initAccumulator", "acc1", v.Accumulator.PublicKey, v.Accumulator.Value))
+	mustSucceed(t, l.Invoke(c.cp, "initAccumulator", "acc2", v.Accumulator.PublicKey, v.Accumulator.Value))
+}
+
+func TestInitRoleMSPs(t *testing.T) {
+	admin := newIdentity(t, adminMSP, "admin", "")
+	l := ledgerstub.New("aav", new(SimpleChaincode))
+	mustFail(t, l.Init(admin, "init", adminMSP, "admin=Org1MSP"), "Unknown role admin")
+	mustFail(t, l.Init(admin, "init", adminMSP, "cp=CPMSP,"), "MSP IDs of the role cp must be non-empty strings")
+
+	// a role which is not configured is held by nobody
+	mustSucceed(t, l.Init(admin, "init", adminMSP, "cp=CPMSP"))
+	mustFail(t, l.Invoke(newIdentity(t, "IVMSP", "iv1", roleIV), "initAav", "user1-age", "hash1"), "Access denied: the role iv is not allowed for the clients of IVMSP")
+	mustSucceed(t, l.Invoke(newIdentity(t, "CPMSP", "cp1", roleCP), "initAav", "user1-age", "hash1"))
+}
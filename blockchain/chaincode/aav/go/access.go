@@ -0,0 +1,193 @@
+/*
+ Role based access control of the aav chaincode.
+ The role of a client is the attribute aav.role of its enrollment certificate, set when it is registered at the Fabric CA:
+   fabric-ca-client register --id.attrs 'aav.role=sp:ecert' ...
+ The CA of an MSP only vouches for the roles of its own members: a role is only accepted from the MSPs allowed for it,
+ given at instantiation and changed by the admin with setRoleMSPs.
+ The admin role is not an attribute: it is granted to the members of the admin MSP given at instantiation
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// roleAttribute is the name of the certificate attribute holding the role of the client
+const roleAttribute = "aav.role"
+
+const (
+	roleIV    = "iv"    //identity validator, writes attribute anchors
+	roleCP    = "cp"    //certificate provider, writes attribute anchors and manages its accumulator
+	roleSP    = "sp"    //service provider, verifies presentations
+	roleAdmin = "admin" //manages the issuer registry
+)
+
+// policy gives the roles allowed to call each function. Functions which are not listed, the read functions, are open to every member of the channel
+var policy = map[string][]string{
+	"initAav":          {roleIV, roleCP},
+	"initAccumulator":  {roleCP},
+	"revoke":           {roleCP},
+	"issueChallenge":   {roleSP},
+	"verify":           {roleSP},
+	"registerIssuer":   {roleAdmin},
+	"updateIssuer":     {roleAdmin},
+	"deactivateIssuer": {roleAdmin},
+	"setRoleMSPs":      {roleAdmin},
+}
+
+// isAttributeRole returns true if role is a role of the attribute aav.role, whose MSPs are configured
+func isAttributeRole(role string) bool {
+	return role == roleIV || role == roleCP || role == roleSP
+}
+
+// roleMSPsKey returns the state key of the MSP IDs allowed for role
+func roleMSPsKey(stub shim.ChaincodeStubInterface, role string) (string, error) {
+	return stub.CreateCompositeKey("config", []string{"roleMSPs", role})
+}
+
+// getRoleMSPsState returns the MSP IDs allowed for role, none if they are not configured
+func getRoleMSPsState(stub shim.ChaincodeStubInterface, role string) ([]string, error) {
+	key, err := roleMSPsKey(stub, role)
+	if err != nil {
+		return nil, err
+	}
+	mspsAsBytes, err := stub.GetState(key)
+	if err != nil || mspsAsBytes == nil {
+		return []string{}, err
+	}
+	var msps []string
+	if err := json.Unmarshal(mspsAsBytes, &msps); err != nil {
+		return nil, err
+	}
+	return msps, nil
+}
+
+// putRoleMSPsState writes the MSP IDs allowed for role
+func putRoleMSPsState(stub shim.ChaincodeStubInterface, role string, msps []string) error {
+	key, err := roleMSPsKey(stub, role)
+	if err != nil {
+		return err
+	}
+	mspsJSONasBytes, err := json.Marshal(msps)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(key, mspsJSONasBytes)
+}
+
+// parseRoleMSPs parses the argument "<role>=<MSP ID>,<MSP ID>..." of the instantiation
+func parseRoleMSPs(arg string) (string, []string, error) {
+	i := strings.Index(arg, "=")
+	role := arg[:i]
+	if !isAttributeRole(role) {
+		return "", nil, errors.New("Unknown role " + role + ", expecting iv, cp or sp")
+	}
+	msps := strings.Split(arg[i+1:], ",")
+	for _, msp := range msps {
+		if len(msp) <= 0 {
+			return "", nil, errors.New("MSP IDs of the role " + role + " must be non-empty strings")
+		}
+	}
+	return role, msps, nil
+}
+
+// checkAccess returns an error if the client is not allowed to call function
+func checkAccess(stub shim.ChaincodeStubInterface, function string) error {
+	roles, ok := policy[function]
+	if !ok {
+		return nil
+	}
+	if len(roles) == 1 && roles[0] == roleAdmin {
+		return checkAdmin(stub)
+	}
+
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return errors.New("Access denied: cannot read the MSP ID of the client: " + err.Error())
+	}
+	role, found, err := cid.GetAttributeValue(stub, roleAttribute)
+	if err != nil {
+		return errors.New("Access denied: cannot read the attributes of the client: " + err.Error())
+	}
+	for _, r := range roles {
+		if found && role == r {
+			return checkRoleMSP(stub, role, mspID)
+		}
+	}
+	if !found {
+		role = "none"
+	}
+	return errors.New("Access denied: " + function + " requires the role " + strings.Join(roles, " or ") +
+		", the client of " + mspID + " has the role " + role)
+}
+
+// checkRoleMSP returns an error if the role is not allowed for the clients of mspID
+func checkRoleMSP(stub shim.ChaincodeStubInterface, role string, mspID string) error {
+	msps, err := getRoleMSPsState(stub, role)
+	if err != nil {
+		return errors.New("Access denied: cannot read the MSPs of the role " + role + ": " + err.Error())
+	}
+	for _, msp := range msps {
+		if msp == mspID {
+			return nil
+		}
+	}
+	return errors.New("Access denied: the role " + role + " is not allowed for the clients of " + mspID)
+}
+
+// ============================================================
+// setRoleMSPs - replace the MSP IDs allowed for a role, admin MSP only. Without MSP ID, nobody holds the role
+// ============================================================
+func (t *SimpleChaincode) setRoleMSPs(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//   0       1          ...
+	// "role", "MSP ID", ...
+	if len(args) < 1 {
+		return shim.Error("Incorrect number of arguments. Expecting at least 1")
+	}
+	if !isAttributeRole(args[0]) {
+		return shim.Error("1st argument must be iv, cp or sp")
+	}
+	msps := args[1:]
+	for _, msp := range msps {
+		if len(msp) <= 0 {
+			return shim.Error("MSP IDs must be non-empty strings")
+		}
+	}
+	if err := putRoleMSPsState(stub, args[0], msps); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := setEvent(stub, &aavEvent{Type: eventRoleMSPsUpdated, Subject: args[0]}); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// ============================================================
+// getRoleMSPs - return the MSP IDs allowed for a role
+// ============================================================
+func (t *SimpleChaincode) getRoleMSPs(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//   0
+	// "role"
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+	if !isAttributeRole(args[0]) {
+		return shim.Error("1st argument must be iv, cp or sp")
+	}
+	msps, err := getRoleMSPsState(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	mspsJSONasBytes, err := json.Marshal(msps)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(mspsJSONasBytes)
+}
@@ -0,0 +1,248 @@
+/*
+ Revocation of the certificates with the accumulator published by the certificate provider (CP).
+ Only the client which published an accumulator revokes with it
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"cryptoFunc"
+	"wire"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// accumulator is the current revocation accumulator of a CP
+type accumulator struct {
+	ObjectType    string `json:"docType"` //docType is used to distinguish the various types of objects in state database
+	AccumulatorID string `json:"accumulatorID"`
+	PublicKey     string `json:"publicKey"` //Q = alpha*G2, hex encoded
+	Value         string `json:"value"`     //V in G1, hex encoded
+	Version       int    `json:"version"`   //number of revocations
+	Creator       string `json:"creator"`   //MSP ID and client ID of the CP which published the accumulator
+}
+
+// accumulatorUpdate is published for each revocation, holders replay them to update their witness
+type accumulatorUpdate struct {
+	ObjectType    string `json:"docType"`
+	AccumulatorID string `json:"accumulatorID"`
+	Version       int    `json:"version"` //version of the accumulator after the update
+	Revoked       string `json:"revoked"` //revoked handle y = H(C), hex encoded
+	Value         string `json:"value"`   //accumulator value after the update
+}
+
+// updateKeyVersion formats the version in the composite key of an update, so that updates are ordered
+func updateKeyVersion(version int) string {
+	return fmt.Sprintf("%010d", version)
+}
+
+// getAccumulatorState reads the accumulator from the state, it returns nil if it does not exist
+func getAccumulatorState(stub shim.ChaincodeStubInterface, accumulatorID string) (*accumulator, error) {
+	key, err := stub.CreateCompositeKey("accumulator", []string{accumulatorID})
+	if err != nil {
+		return nil, err
+	}
+	accAsBytes, err := stub.GetState(key)
+	if err != nil || accAsBytes == nil {
+		return nil, err
+	}
+	acc := new(accumulator)
+	if err := json.Unmarshal(accAsBytes, acc); err != nil {
+		return nil, err
+	}
+	return acc, nil
+}
+
+// putAccumulatorState writes the accumulator in the state
+func putAccumulatorState(stub shim.ChaincodeStubInterface, acc *accumulator) error {
+	key, err := stub.CreateCompositeKey("accumulator", []string{acc.AccumulatorID})
+	if err != nil {
+		return err
+	}
+	accJSONasBytes, err := json.Marshal(acc)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(key, accJSONasBytes)
+}
+
+// ============================================================
+// initAccumulator - publish the initial accumulator of a CP
+// ============================================================
+func (t *SimpleChaincode) initAccumulator(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//   0                1            2
+	// "accumulatorID", "publicKey", "value"
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+
+	acc, err := getAccumulatorState(stub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get accumulator: " + err.Error())
+	} else if acc != nil {
+		return shim.Error("This accumulator exists: " + args[0])
+	}
+
+	publicKey, err := wire.Parse(args[1], wire.AccumulatorPublicKey)
+	if err != nil {
+		return shim.Error("2nd argument must be an hexadecimal string")
+	}
+	value, err := wire.Parse(args[2], wire.AccumulatorValue)
+	if err != nil {
+		return shim.Error("3rd argument must be an hexadecimal string")
+	}
+	if !cryptoFunc.IsAccumulator(value, publicKey) {
+		return shim.Error("Accumulator value or public key is not a valid point")
+	}
+	creator, err := clientIdentity(stub)
+	if err != nil {
+		return shim.Error("Failed to get the identity of the CP: " + err.Error())
+	}
+
+	acc = &accumulator{"accumulator", args[0], args[1], args[2], 0, creator}
+	if err := putAccumulatorState(stub, acc); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := setEvent(stub, &aavEvent{Type: eventAccumulatorCreated, Subject: acc.AccumulatorID}); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// ============================================================
+// revoke - publish the accumulator value without a revoked handle
+// Only the creator of the accumulator revokes. The update is checked against the public key of the accumulator,
+// so only a value computed with the secret of the CP (or with the witness of the revoked handle) is accepted
+// ============================================================
+func (t *SimpleChaincode) revoke(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//   0                1          2
+	// "accumulatorID", "revoked", "value"
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+
+	acc, err := getAccumulatorState(stub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get accumulator: " + err.Error())
+	} else if acc == nil {
+		return shim.Error("Accumulator does not exist: " + args[0])
+	}
+	submitter, err := clientIdentity(stub)
+	if err != nil {
+		return shim.Error("Failed to get the identity of the CP: " + err.Error())
+	}
+	if submitter != acc.Creator {
+		return shim.Error("Access denied: only the creator of the accumulator " + acc.AccumulatorID + " revokes with it")
+	}
+
+	oldValue, _ := wire.Parse(acc.Value, wire.AccumulatorValue)
+	publicKey, _ := wire.Parse(acc.PublicKey, wire.AccumulatorPublicKey)
+	revoked, err := wire.Parse(args[1], wire.RevocationHandle)
+	if err != nil {
+		return shim.Error("2nd argument must be an hexadecimal string")
+	}
+	newValue, err := wire.Parse(args[2], wire.AccumulatorValue)
+	if err != nil {
+		return shim.Error("3rd argument must be an hexadecimal string")
+	}
+	ok, err := cryptoFunc.VerifyAccumulatorUpdate(oldValue, newValue, revoked, publicKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if !ok {
+		return shim.Error("Accumulator update does not verify")
+	}
+
+	acc.Version++
+	acc.Value = args[2]
+	update := &accumulatorUpdate{"accumulatorUpdate", acc.AccumulatorID, acc.Version, args[1], args[2]}
+	updateKey, err := stub.CreateCompositeKey("accumulatorUpdate", []string{acc.AccumulatorID, updateKeyVersion(acc.Version)})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	updateJSONasBytes, err := json.Marshal(update)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := stub.PutState(updateKey, updateJSONasBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := putAccumulatorState(stub, acc); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := setEvent(stub, &aavEvent{Type: eventCertificateRevoked, Subject: acc.AccumulatorID, Version: acc.Version}); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// ============================================================
+// getAccumulator - return the current accumulator of a CP
+// ============================================================
+func (t *SimpleChaincode) getAccumulator(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//   0
+	// "accumulatorID"
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+	acc, err := getAccumulatorState(stub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get accumulator: " + err.Error())
+	} else if acc == nil {
+		return shim.Error("Accumulator does not exist: " + args[0])
+	}
+	accJSONasBytes, err := json.Marshal(acc)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(accJSONasBytes)
+}
+
+// ============================================================
+// getAccumulatorUpdates - return the updates published after a version, in order.
+// Holders replay them with cryptolib.UpdateWitness
+// ============================================================
+func (t *SimpleChaincode) getAccumulatorUpdates(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//   0                1
+	// "accumulatorID", "fromVersion"
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+	fromVersion, err := strconv.Atoi(args[1])
+	if err != nil {
+		return shim.Error("2nd argument must be a numeric string")
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("accumulatorUpdate", []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	updates := []accumulatorUpdate{}
+	for resultsIterator.HasNext() {
+		kv, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		var update accumulatorUpdate
+		if err := json.Unmarshal(kv.Value, &update); err != nil {
+			return shim.Error(err.Error())
+		}
+		if update.Version > fromVersion {
+			updates = append(updates, update)
+		}
+	}
+	updatesJSONasBytes, err := json.Marshal(updates)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(updatesJSONasBytes)
+}
@@ -0,0 +1,57 @@
+/*
+ Chaincode events emitted by the write functions, delivered to the clients listening on the channel once the transaction is committed.
+ Fabric keeps a single event per transaction, so each function sets its event last, after every state update succeeded
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Names of the events, a listener filters them with the regular expression "aav\..*"
+const (
+	eventAavCreated         = "aav.aavCreated"
+	eventVerified           = "aav.verified"
+	eventIssuerRegistered   = "aav.issuerRegistered"
+	eventIssuerUpdated      = "aav.issuerUpdated"
+	eventIssuerDeactivated  = "aav.issuerDeactivated"
+	eventAccumulatorCreated = "aav.accumulatorCreated"
+	eventCertificateRevoked = "aav.certificateRevoked"
+	eventRoleMSPsUpdated    = "aav.roleMSPsUpdated"
+)
+
+// aavEvent is the payload of every event, as JSON.
+// Like the verification record, it must not contain any value of a proof
+type aavEvent struct {
+	Type      string `json:"type"` //name of the event
+	TxID      string `json:"txID"`
+	Timestamp string `json:"timestamp"`         //timestamp of the transaction, RFC 3339
+	Submitter string `json:"submitter"`         //MSP ID and client ID of the submitter, the SP for aav.verified
+	Subject   string `json:"subject"`           //aavKey, issuerID, accumulatorID or role written by the transaction, empty for aav.verified
+	Verify    string `json:"verify,omitempty"`  //verdict of aav.verified
+	Version   int    `json:"version,omitempty"` //version of the accumulator for aav.certificateRevoked
+}
+
+// setEvent sets the event of the transaction. The timestamp and the submitter are filled from the transaction
+func setEvent(stub shim.ChaincodeStubInterface, e *aavEvent) error {
+	now, err := txTime(stub)
+	if err != nil {
+		return err
+	}
+	submitter, err := clientIdentity(stub)
+	if err != nil {
+		return err
+	}
+	e.TxID = stub.GetTxID()
+	e.Timestamp = now.Format(time.RFC3339)
+	e.Submitter = submitter
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return stub.SetEvent(e.Type, payload)
+}
@@ -0,0 +1,283 @@
+/*
+ Read functions of the aav chaincode: point lookup, range and rich queries, key history.
+ Rich queries need CouchDB as state database, the indexes are in META-INF/statedb/couchdb/indexes
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================
+// getAav - read an aav from chaincode state
+// ============================================================
+func (t *SimpleChaincode) getAav(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//   0
+	// "aavKey"
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	aavAsBytes, err := stub.GetState(args[0])
+	if err != nil {
+		return shim.Error("Failed to get aav: " + err.Error())
+	} else if aavAsBytes == nil {
+		return shim.Error("Aav does not exist: " + args[0])
+	}
+	return shim.Success(aavAsBytes)
+}
+
+// ============================================================
+// getAavsByRange - read the aavs whose key is in [startKey, endKey)
+// An empty endKey reads until the last key. With pageSize, the result is paginated:
+// the bookmark returned in the metadata is passed to get the next page
+// ============================================================
+func (t *SimpleChaincode) getAavsByRange(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//   0           1         2           3
+	// "startKey", "endKey", "pageSize", "bookmark"
+	// pageSize and bookmark are optional
+	if len(args) < 2 || len(args) > 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 2 to 4")
+	}
+
+	if len(args) == 2 {
+		resultsIterator, err := stub.GetStateByRange(args[0], args[1])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		defer resultsIterator.Close()
+
+		buffer, err := constructQueryResponseFromIterator(resultsIterator)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		fmt.Printf("- getAavsByRange queryResult:\n%s\n", buffer.String())
+		return shim.Success(buffer.Bytes())
+	}
+
+	pageSize, err := strconv.ParseInt(args[2], 10, 32)
+	if err != nil || pageSize <= 0 {
+		return shim.Error("3rd argument must be a positive numeric string")
+	}
+	bookmark := ""
+	if len(args) == 4 {
+		bookmark = args[3]
+	}
+
+	resultsIterator, responseMetadata, err := stub.GetStateByRangeWithPagination(args[0], args[1], int32(pageSize), bookmark)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	buffer, err := constructQueryResponseFromIterator(resultsIterator)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	bufferWithPaginationInfo := addPaginationMetadataToQueryResults(buffer, responseMetadata)
+	fmt.Printf("- getAavsByRange queryResult:\n%s\n", bufferWithPaginationInfo.String())
+	return shim.Success(bufferWithPaginationInfo.Bytes())
+}
+
+// ============================================================
+// queryByDocType - read the records of a docType ("aav", "verification", "issuer"...)
+// It uses the docType index of CouchDB
+// ============================================================
+func (t *SimpleChaincode) queryByDocType(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//   0          1           2
+	// "docType", "pageSize", "bookmark"
+	// pageSize and bookmark are optional
+	if len(args) < 1 || len(args) > 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 1 to 3")
+	}
+
+	selector := map[string]interface{}{
+		"selector":  map[string]string{"docType": args[0]},
+		"use_index": []string{"_design/indexDocTypeDoc", "indexDocType"},
+	}
+	queryString, err := json.Marshal(selector)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return t.queryAavs(stub, append([]string{string(queryString)}, args[1:]...))
+}
+
+// ============================================================
+// queryAavs - ad hoc rich query with a CouchDB selector,
+// e.g. {"selector":{"docType":"aav","aavVal":"value"}}
+// Rich queries are not re-executed at validation time, so the result is not part of the read set:
+// they are meant for reads, not for updates
+// ============================================================
+func (t *SimpleChaincode) queryAavs(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//   0              1           2
+	// "queryString", "pageSize", "bookmark"
+	// pageSize and bookmark are optional
+	if len(args) < 1 || len(args) > 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 1 to 3")
+	}
+
+	if len(args) == 1 {
+		resultsIterator, err := stub.GetQueryResult(args[0])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		defer resultsIterator.Close()
+
+		buffer, err := constructQueryResponseFromIterator(resultsIterator)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		fmt.Printf("- queryAavs queryResult:\n%s\n", buffer.String())
+		return shim.Success(buffer.Bytes())
+	}
+
+	pageSize, err := strconv.ParseInt(args[1], 10, 32)
+	if err != nil || pageSize <= 0 {
+		return shim.Error("2nd argument must be a positive numeric string")
+	}
+	bookmark := ""
+	if len(args) == 3 {
+		bookmark = args[2]
+	}
+
+	resultsIterator, responseMetadata, err := stub.GetQueryResultWithPagination(args[0], int32(pageSize), bookmark)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	buffer, err := constructQueryResponseFromIterator(resultsIterator)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	bufferWithPaginationInfo := addPaginationMetadataToQueryResults(buffer, responseMetadata)
+	fmt.Printf("- queryAavs queryResult:\n%s\n", bufferWithPaginationInfo.String())
+	return shim.Success(bufferWithPaginationInfo.Bytes())
+}
+
+// ============================================================
+// getHistoryForAav - return the successive values of an aav, with the transaction which wrote them
+// ============================================================
+func (t *SimpleChaincode) getHistoryForAav(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//   0
+	// "aavKey"
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	resultsIterator, err := stub.GetHistoryForKey(args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	// buffer is a JSON array containing historic values for the aav
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+
+	bArrayMemberAlreadyWritten := false
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		// Add a comma before array members, suppress it for the first array member
+		if bArrayMemberAlreadyWritten == true {
+			buffer.WriteString(",")
+		}
+		buffer.WriteString("{\"TxId\":")
+		buffer.WriteString("\"")
+		buffer.WriteString(response.TxId)
+		buffer.WriteString("\"")
+
+		buffer.WriteString(", \"Value\":")
+		// if it was a delete operation on given key, then we need to set the
+		// corresponding value null. Else, we will write the response.Value
+		// as-is (as the Value itself a JSON aav)
+		if response.IsDelete {
+			buffer.WriteString("null")
+		} else {
+			buffer.WriteString(string(response.Value))
+		}
+
+		buffer.WriteString(", \"Timestamp\":")
+		buffer.WriteString("\"")
+		buffer.WriteString(time.Unix(response.Timestamp.Seconds, int64(response.Timestamp.Nanos)).UTC().Format(time.RFC3339))
+		buffer.WriteString("\"")
+
+		buffer.WriteString(", \"IsDelete\":")
+		buffer.WriteString(strconv.FormatBool(response.IsDelete))
+
+		buffer.WriteString("}")
+		bArrayMemberAlreadyWritten = true
+	}
+	buffer.WriteString("]")
+
+	fmt.Printf("- getHistoryForAav returning:\n%s\n", buffer.String())
+	return shim.Success(buffer.Bytes())
+}
+
+// ===========================================================================================
+// constructQueryResponseFromIterator constructs a JSON array containing query results from
+// a given result iterator
+// ===========================================================================================
+func constructQueryResponseFromIterator(resultsIterator shim.StateQueryIteratorInterface) (*bytes.Buffer, error) {
+	// buffer is a JSON array containing QueryResults
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+
+	bArrayMemberAlreadyWritten := false
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		// Add a comma before array members, suppress it for the first array member
+		if bArrayMemberAlreadyWritten == true {
+			buffer.WriteString(",")
+		}
+		// the key is escaped, composite keys contain U+0000 separators
+		key, err := json.Marshal(queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+		buffer.WriteString("{\"Key\":")
+		buffer.Write(key)
+
+		buffer.WriteString(", \"Record\":")
+		// Record is a JSON object, so we write as-is
+		buffer.WriteString(string(queryResponse.Value))
+		buffer.WriteString("}")
+		bArrayMemberAlreadyWritten = true
+	}
+	buffer.WriteString("]")
+
+	return &buffer, nil
+}
+
+// ===========================================================================================
+// addPaginationMetadataToQueryResults wraps the constructed query results with the pagination info:
+// {"Results":[...], "ResponseMetadata":{"RecordsCount":n, "Bookmark":"..."}}
+// ===========================================================================================
+func addPaginationMetadataToQueryResults(buffer *bytes.Buffer, responseMetadata *pb.QueryResponseMetadata) *bytes.Buffer {
+	bookmark, _ := json.Marshal(responseMetadata.Bookmark)
+
+	var res bytes.Buffer
+	res.WriteString("{\"Results\":")
+	res.Write(buffer.Bytes())
+	res.WriteString(", \"ResponseMetadata\":{\"RecordsCount\":")
+	res.WriteString(strconv.Itoa(int(responseMetadata.FetchedRecordsCount)))
+	res.WriteString(", \"Bookmark\":")
+	res.Write(bookmark)
+	res.WriteString("}}")
+
+	return &res
+}
@@ -0,0 +1,215 @@
+/*
+ Registry of the public keys of the certificate providers (CP) trusted by verify.
+ Only the admin MSP given at instantiation can register, update or deactivate a CP, see policy in access.go
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+
+	"cryptoFunc"
+	"wire"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// issuer is a CP whose certificates are accepted by verify while it is active
+type issuer struct {
+	ObjectType    string `json:"docType"` //docType is used to distinguish the various types of objects in state database
+	IssuerID      string `json:"issuerID"`
+	PublicKey     string `json:"publicKey"`               //pubG1CP, hex encoded
+	AccumulatorID string `json:"accumulatorID,omitempty"` //revocation accumulator of the CP, if any
+	Active        bool   `json:"active"`
+}
+
+// adminMSPKey returns the state key of the admin MSP ID. A composite key cannot collide with the key of an aav
+func adminMSPKey(stub shim.ChaincodeStubInterface) (string, error) {
+	return stub.CreateCompositeKey("config", []string{"adminMSP"})
+}
+
+// checkAdmin returns an error if the submitter of the transaction is not a member of the admin MSP.
+// It is the check of the admin role of the policy
+func checkAdmin(stub shim.ChaincodeStubInterface) error {
+	key, err := adminMSPKey(stub)
+	if err != nil {
+		return err
+	}
+	adminMSP, err := stub.GetState(key)
+	if err != nil {
+		return err
+	} else if adminMSP == nil {
+		return errors.New("No admin MSP configured, instantiate the chaincode with {\"Args\":[\"init\",\"<adminMSP>\"]}")
+	}
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return err
+	}
+	if mspID != string(adminMSP) {
+		return errors.New("Access denied: " + mspID + " is not the admin MSP")
+	}
+	return nil
+}
+
+// getIssuerState reads the issuer from the state, it returns nil if it does not exist
+func getIssuerState(stub shim.ChaincodeStubInterface, issuerID string) (*issuer, error) {
+	key, err := stub.CreateCompositeKey("issuer", []string{issuerID})
+	if err != nil {
+		return nil, err
+	}
+	issuerAsBytes, err := stub.GetState(key)
+	if err != nil || issuerAsBytes == nil {
+		return nil, err
+	}
+	iss := new(issuer)
+	if err := json.Unmarshal(issuerAsBytes, iss); err != nil {
+		return nil, err
+	}
+	return iss, nil
+}
+
+// putIssuerState writes the issuer in the state
+func putIssuerState(stub shim.ChaincodeStubInterface, iss *issuer) error {
+	key, err := stub.CreateCompositeKey("issuer", []string{iss.IssuerID})
+	if err != nil {
+		return err
+	}
+	issuerJSONasBytes, err := json.Marshal(iss)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(key, issuerJSONasBytes)
+}
+
+// issuerArgs checks the arguments of registerIssuer and updateIssuer and returns the accumulator ID, possibly empty
+func issuerArgs(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	//   0           1            2
+	// "issuerID", "publicKey", "accumulatorID"
+	// accumulatorID is optional, when given the holders must prove that their certificate is not revoked in this accumulator
+	if len(args) != 2 && len(args) != 3 {
+		return "", errors.New("Incorrect number of arguments. Expecting 2 or 3")
+	}
+	if len(args[0]) <= 0 {
+		return "", errors.New("1st argument must be a non-empty string")
+	}
+	publicKey, err := wire.Parse(args[1], wire.IssuerPublicKey)
+	if err != nil || !cryptoFunc.IsIssuerKey(publicKey) {
+		return "", errors.New("2nd argument must be an hexadecimal G1 point")
+	}
+	if len(args) == 2 {
+		return "", nil
+	}
+	acc, err := getAccumulatorState(stub, args[2])
+	if err != nil {
+		return "", errors.New("Failed to get accumulator: " + err.Error())
+	} else if acc == nil {
+		return "", errors.New("Accumulator does not exist: " + args[2])
+	}
+	return args[2], nil
+}
+
+// ============================================================
+// registerIssuer - register the public key of a CP, admin MSP only
+// ============================================================
+func (t *SimpleChaincode) registerIssuer(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	accumulatorID, err := issuerArgs(stub, args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	iss, err := getIssuerState(stub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get issuer: " + err.Error())
+	} else if iss != nil {
+		return shim.Error("This issuer exists: " + args[0])
+	}
+
+	iss = &issuer{"issuer", args[0], args[1], accumulatorID, true}
+	if err := putIssuerState(stub, iss); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := setEvent(stub, &aavEvent{Type: eventIssuerRegistered, Subject: iss.IssuerID}); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// ============================================================
+// updateIssuer - replace the public key or the accumulator of a CP, admin MSP only.
+// Certificates issued with the previous key are not accepted anymore
+// ============================================================
+func (t *SimpleChaincode) updateIssuer(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	accumulatorID, err := issuerArgs(stub, args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	iss, err := getIssuerState(stub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get issuer: " + err.Error())
+	} else if iss == nil {
+		return shim.Error("Issuer does not exist: " + args[0])
+	}
+
+	iss.PublicKey = args[1]
+	iss.AccumulatorID = accumulatorID
+	if err := putIssuerState(stub, iss); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := setEvent(stub, &aavEvent{Type: eventIssuerUpdated, Subject: iss.IssuerID}); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// ============================================================
+// deactivateIssuer - stop accepting the certificates of a CP, admin MSP only
+// ============================================================
+func (t *SimpleChaincode) deactivateIssuer(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//   0
+	// "issuerID"
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	iss, err := getIssuerState(stub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get issuer: " + err.Error())
+	} else if iss == nil {
+		return shim.Error("Issuer does not exist: " + args[0])
+	}
+
+	iss.Active = false
+	if err := putIssuerState(stub, iss); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := setEvent(stub, &aavEvent{Type: eventIssuerDeactivated, Subject: iss.IssuerID}); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// ============================================================
+// getIssuer - return a registered CP
+// ============================================================
+func (t *SimpleChaincode) getIssuer(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//   0
+	// "issuerID"
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+	iss, err := getIssuerState(stub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get issuer: " + err.Error())
+	} else if iss == nil {
+		return shim.Error("Issuer does not exist: " + args[0])
+	}
+	issuerJSONasBytes, err := json.Marshal(iss)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(issuerJSONasBytes)
+}
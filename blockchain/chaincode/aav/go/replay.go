@@ -0,0 +1,171 @@
+/*
+ Replay protection of verify: challenges issued to the SPs and set of the presentations already verified
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// challengeLifetime is the time during which a challenge can be answered by a presentation
+const challengeLifetime = 5 * time.Minute
+
+// challenge is a nonce issued to a SP, which the holder binds into the issuer proof of its presentation.
+// It can only be used once, by the SP which requested it
+type challenge struct {
+	ObjectType string `json:"docType"`
+	Nonce      string `json:"nonce"`
+	SP         string `json:"sp"`      //MSP ID and client ID of the SP which requested the challenge
+	Context    string `json:"context"` //application context, bound into the proof with the nonce
+	Expires    string `json:"expires"` //RFC 3339
+}
+
+// spentPresentation marks a presentation as verified, so that it cannot be submitted again
+type spentPresentation struct {
+	ObjectType string `json:"docType"`
+	Digest     string `json:"digest"` //cryptoFunc.PresentationDigest of the blinded presentation, hex encoded
+	TxID       string `json:"txID"`   //transaction which verified the presentation
+}
+
+// txTime returns the timestamp of the transaction, which is the same on every endorser
+func txTime(stub shim.ChaincodeStubInterface) (time.Time, error) {
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(txTimestamp.Seconds, int64(txTimestamp.Nanos)).UTC(), nil
+}
+
+// ============================================================
+// issueChallenge - issue a nonce for the next presentation verified by the SP
+// The nonce is derived from the transaction ID so that every endorser computes the same one
+// ============================================================
+func (t *SimpleChaincode) issueChallenge(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//   0
+	// "context"
+	// context is optional
+	if len(args) > 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 0 or 1")
+	}
+	context := ""
+	if len(args) == 1 {
+		context = args[0]
+	}
+
+	sp, err := clientIdentity(stub)
+	if err != nil {
+		return shim.Error("Failed to get the identity of the SP: " + err.Error())
+	}
+	now, err := txTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	nonce := sha256.Sum256([]byte("challenge" + stub.GetTxID()))
+	c := &challenge{
+		ObjectType: "challenge",
+		Nonce:      hex.EncodeToString(nonce[:]),
+		SP:         sp,
+		Context:    context,
+		Expires:    now.Add(challengeLifetime).Format(time.RFC3339),
+	}
+	challengeJSONasBytes, err := json.Marshal(c)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	key, err := challengeKey(stub, c.Nonce)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(key, challengeJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(challengeJSONasBytes)
+}
+
+// challengeKey returns the key of the challenge of nonce
+func challengeKey(stub shim.ChaincodeStubInterface, nonce string) (string, error) {
+	return stub.CreateCompositeKey("challenge", []string{nonce})
+}
+
+// checkChallenge checks that the nonce has been issued to the SP, has not been used and has not expired.
+// It returns the challenge, or a message explaining why it cannot be used
+func checkChallenge(stub shim.ChaincodeStubInterface, nonce string, sp string) (*challenge, string) {
+	key, err := challengeKey(stub, nonce)
+	if err != nil {
+		return nil, err.Error()
+	}
+	challengeAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, "Failed to get challenge: " + err.Error()
+	} else if challengeAsBytes == nil {
+		return nil, "Unknown or already used challenge: " + nonce
+	}
+	c := new(challenge)
+	if err := json.Unmarshal(challengeAsBytes, c); err != nil {
+		return nil, err.Error()
+	}
+	if c.SP != sp {
+		return nil, "Challenge has been issued to another SP: " + nonce
+	}
+	now, err := txTime(stub)
+	if err != nil {
+		return nil, err.Error()
+	}
+	expires, err := time.Parse(time.RFC3339, c.Expires)
+	if err != nil {
+		return nil, err.Error()
+	}
+	if now.After(expires) {
+		return nil, "Challenge has expired: " + nonce
+	}
+	return c, ""
+}
+
+// spentPresentationKey returns the key of the presentation in the spent set
+func spentPresentationKey(stub shim.ChaincodeStubInterface, digest []byte) (string, error) {
+	return stub.CreateCompositeKey("spentPresentation", []string{hex.EncodeToString(digest)})
+}
+
+// isSpent returns true if the presentation has already been verified.
+// Two transactions verifying the same presentation in the same block both read the key, the second one fails the MVCC check
+func isSpent(stub shim.ChaincodeStubInterface, digest []byte) (bool, error) {
+	key, err := spentPresentationKey(stub, digest)
+	if err != nil {
+		return false, err
+	}
+	spentAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return false, err
+	}
+	return spentAsBytes != nil, nil
+}
+
+// spend consumes the challenge of nonce and adds the presentation to the spent set.
+// It is called once the presentation is verified, so that a failed verification leaves the challenge usable
+func spend(stub shim.ChaincodeStubInterface, nonce string, digest []byte) error {
+	key, err := challengeKey(stub, nonce)
+	if err != nil {
+		return err
+	}
+	err = stub.DelState(key)
+	if err != nil {
+		return err
+	}
+	key, err = spentPresentationKey(stub, digest)
+	if err != nil {
+		return err
+	}
+	spentJSONasBytes, err := json.Marshal(&spentPresentation{"spentPresentation", hex.EncodeToString(digest), stub.GetTxID()})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(key, spentJSONasBytes)
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"strconv"
+	"strings"
+	"testing"
+
+	"ledgerstub"
+	"wire"
+
+	"golang.org/x/crypto/bn256"
+)
+
+// presentationVector holds the arguments of verify for a presentation computed by cryptolib, hex encoded
+type presentationVector struct {
+	ChallengeTxID   string `json:"challengeTxID"` // transaction of issueChallenge whose nonce is bound into the issuer proof
+	Nonce           string `json:"nonce"`
+	Commitment      string `json:"blindCommitment"`
+	Certificate     string `json:"blindCertificate"`
+	IssuerKey       string `json:"blindPubG1CP"`
+	HolderKey       string `json:"blindPubG2User"`
+	Generator       string `json:"blindGenerator"`
+	AttributeCount  int    `json:"attributeCount"`
+	IssuerProof     string `json:"issuerProof"`
+	MembershipProof string `json:"membershipProof"`
+}
+
+// vectors is a CP with an accumulator, a valid presentation and a presentation of a revoked certificate.
+// testdata/vectors.json is written by TestChaincodeVectors of goService/src/cryptolib
+type vectors struct {
+	Issuer      string `json:"issuer"`
+	OtherIssuer string `json:"otherIssuer"`
+	Context     string `json:"context"`
+	Accumulator struct {
+		PublicKey    string `json:"publicKey"`
+		Value        string `json:"value"`
+		Revoked      string `json:"revoked"`
+		UpdatedValue string `json:"updatedValue"`
+	} `json:"accumulator"`
+	Valid   presentationVector `json:"valid"`
+	Revoked presentationVector `json:"revoked"`
+}
+
+func loadVectors(t *testing.T) *vectors {
+	b, err := ioutil.ReadFile("testdata/vectors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := new(vectors)
+	if err := json.Unmarshal(b, v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// args returns the arguments of verify for the presentation p of the certificate of issuerID
+func (p *presentationVector) args(issuerID string) []string {
+	return []string{"verify", p.Commitment, p.Certificate, p.IssuerKey, p.HolderKey, p.Generator,
+		strconv.Itoa(p.AttributeCount), issuerID, p.IssuerProof, p.Nonce, p.MembershipProof}
+}
+
+// setupIssuer publishes the accumulator of the CP, revokes the certificate of v.Revoked and registers the CP as cp1
+func setupIssuer(t *testing.T, l *ledgerstub.Ledger, c *clients, v *vectors) {
+	mustSucceed(t, l.Invoke(c.cp, "initAccumulator", "acc1", v.Accumulator.PublicKey, v.Accumulator.Value))
+	if e := lastEvent(t, l, eventAccumulatorCreated); e.Subject != "acc1" {
+		t.Fatalf("Wrong event: %+v", e)
+	}
+	mustFail(t, l.Invoke(c.cp, "revoke", "acc1", v.Accumulator.Revoked, v.Accumulator.Value), "Accumulator update does not verify")
+	mustSucceed(t, l.Invoke(c.cp, "revoke", "acc1", v.Accumulator.Revoked, v.Accumulator.UpdatedValue))
+	if e := lastEvent(t, l, eventCertificateRevoked); e.Subject != "acc1" || e.Version != 1 {
+		t.Fatalf("Wrong event: %+v", e)
+	}
+
+	mustFail(t, l.Invoke(c.sp, "registerIssuer", "cp1", v.Issuer, "acc1"), "Access denied")
+	mustSucceed(t, l.Invoke(c.admin, "registerIssuer", "cp1", v.Issuer, "acc1"))
+	if e := lastEvent(t, l, eventIssuerRegistered); e.Subject != "cp1" || !strings.HasPrefix(e.Submitter, adminMSP+"/") {
+		t.Fatalf("Wrong event: %+v", e)
+	}
+}
+
+func TestRevokeByAnotherCP(t *testing.T) {
+	l, c := newLedger(t)
+	v := loadVectors(t)
+	mustSucceed(t, l.Invoke(c.cp, "initAccumulator", "acc1", v.Accumulator.PublicKey, v.Accumulator.Value))
+	acc := new(accumulator)
+	if err := json.Unmarshal(mustSucceed(t, l.Query(c.sp, "getAccumulator", "acc1")), acc); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(acc.Creator, "CPMSP/") {
+		t.Fatalf("Wrong creator: %+v", acc)
+	}
+
+	// another CP, of another MSP or of the same one, cannot revoke with the accumulator
+	for _, cp := range []*ledgerstub.Identity{newIdentity(t, "CP2MSP", "cp2", roleCP), newIdentity(t, "CPMSP", "cp3", roleCP)} {
+		mustFail(t, l.Invoke(cp, "revoke", "acc1", v.Accumulator.Revoked, v.Accumulator.UpdatedValue), "Access denied: only the creator of the accumulator acc1")
+	}
+	mustSucceed(t, l.Invoke(c.cp, "revoke", "acc1", v.Accumulator.Revoked, v.Accumulator.UpdatedValue))
+}
+
+// issueChallenge issues the challenge of the presentation p to sp and checks its nonce
+func issueChallenge(t *testing.T, l *ledgerstub.Ledger, sp *ledgerstub.Identity, v *vectors, p *presentationVector) {
+	c := new(challenge)
+	if err := json.Unmarshal(mustSucceed(t, l.InvokeTx(p.ChallengeTxID, sp, "issueChallenge", v.Context)), c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Nonce != p.Nonce || c.Context != v.Context {
+		t.Fatalf("Wrong challenge: %+v", c)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	l, c := newLedger(t)
+	v := loadVectors(t)
+	setupIssuer(t, l, c, v)
+	issueChallenge(t, l, c.sp, v, &v.Valid)
+
+	record := new(verification)
+	if err := json.Unmarshal(mustSucceed(t, l.Invoke(c.sp, v.Valid.args("cp1")...)), record); err != nil {
+		t.Fatal(err)
+	}
+	if record.Verify != "true" || !strings.HasPrefix(record.SP, "SPMSP/") {
+		t.Fatalf("Wrong verification record: %+v", record)
+	}
+	e := lastEvent(t, l, eventVerified)
+	if e.TxID != record.TxID || e.Submitter != record.SP || e.Verify != "true" || e.Subject != "" {
+		t.Fatalf("Wrong event: %+v", e)
+	}
+
+	// the challenge is consumed, and the presentation cannot be verified again with a new challenge
+	mustFail(t, l.Invoke(c.sp, v.Valid.args("cp1")...), "Unknown or already used challenge")
+	issueChallenge(t, l, c.sp, v, &v.Valid)
+	mustFail(t, l.Invoke(c.sp, v.Valid.args("cp1")...), "Presentation already used")
+}
+
+func TestVerifyRejects(t *testing.T) {
+	l, c := newLedger(t)
+	v := loadVectors(t)
+	setupIssuer(t, l, c, v)
+	issueChallenge(t, l, c.sp, v, &v.Valid)
+	issueChallenge(t, l, c.sp, v, &v.Revoked)
+	valid := v.Valid.args("cp1")
+
+	replace := func(args []string, i int, value string) []string {
+		res := append([]string(nil), args...)
+		res[i] = value
+		return res
+	}
+	// other presentation with the issuer proof of the valid one
+	stolenProof := replace(v.Revoked.args("cp1"), 8, v.Valid.IssuerProof)
+	// presentation blinded with b = 0, whose points are at infinity, with an issuer proof which holds for any CP
+	w := big.NewInt(12345)
+	issuerKey, err := hex.DecodeString(v.Issuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubG1CP, ok := new(bn256.G1).Unmarshal(issuerKey)
+	if !ok {
+		t.Fatal("Not a G1 point: " + v.Issuer)
+	}
+	g1, g2 := strings.Repeat("00", 64), strings.Repeat("00", 128)
+	identity := append([]string{"verify", strings.Repeat("00", 31) + "01", g2, g1, g2, g1}, valid[6:]...)
+	identity[8] = hex.EncodeToString(new(bn256.G1).ScalarBaseMult(w).Marshal()) +
+		hex.EncodeToString(new(bn256.G1).ScalarMult(pubG1CP, w).Marshal()) + hex.EncodeToString(w.FillBytes(make([]byte, 32)))
+
+	for _, tc := range []struct {
+		name    string
+		client  *ledgerstub.Identity
+		args    []string
+		message string
+	}{
+		{"not a SP", c.iv, valid, "Access denied: verify requires the role sp"},
+		{"challenge of another SP", c.sp2, valid, "Challenge has been issued to another SP"},
+		{"unknown issuer", c.sp, v.Valid.args("cp2"), "Issuer does not exist: cp2"},
+		{"missing membership proof", c.sp, valid[:10], "Issuer has an accumulator, expecting a membership proof"},
+		{"malformed commitment", c.sp, replace(valid, 1, "zz"), "1st argument must be a non-empty hexadecimal string"},
+		{"malformed attribute count", c.sp, replace(valid, 6, "two"), "6th argument must be a numeric string"},
+		{"unknown challenge", c.sp, replace(valid, 9, strings.Repeat("ab", 32)), "Unknown or already used challenge"},
+		{"revoked certificate", c.sp, v.Revoked.args("cp1"), "Verification failed"},
+		{"issuer proof of another presentation", c.sp, stolenProof, "Verification failed"},
+		{"presentation at infinity", c.sp, identity, "Malformed proof: Point of the blinded presentation is at infinity"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mustFail(t, l.Invoke(tc.client, tc.args...), tc.message)
+		})
+	}
+
+	// a key which is not the one of the certificate, then a deactivated issuer
+	mustSucceed(t, l.Invoke(c.admin, "updateIssuer", "cp1", v.OtherIssuer, "acc1"))
+	lastEvent(t, l, eventIssuerUpdated)
+	mustFail(t, l.Invoke(c.sp, valid...), "Verification failed")
+	mustSucceed(t, l.Invoke(c.admin, "updateIssuer", "cp1", v.Issuer, "acc1"))
+	mustSucceed(t, l.Invoke(c.admin, "deactivateIssuer", "cp1"))
+	lastEvent(t, l, eventIssuerDeactivated)
+	mustFail(t, l.Invoke(c.sp, valid...), "Issuer is not active: cp1")
+	mustSucceed(t, l.Invoke(c.admin, "updateIssuer", "cp1", v.Issuer, "acc1"))
+	mustFail(t, l.Invoke(c.sp, valid...), "Issuer is not active: cp1")
+
+	// a failed verification leaves the challenge usable, until it expires
+	mustSucceed(t, l.Invoke(c.admin, "registerIssuer", "cp3", v.Issuer, "acc1"))
+	l.Advance(challengeLifetime + 1)
+	mustFail(t, l.Invoke(c.sp, v.Valid.args("cp3")...), "Challenge has expired")
+	issueChallenge(t, l, c.sp, v, &v.Valid)
+	mustSucceed(t, l.Invoke(c.sp, v.Valid.args("cp3")...))
+}
+
+// encode returns the hexadecimal value s in the versioned format
+func encode(t *testing.T, typ wire.Type, s string) string {
+	payload, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := wire.EncodeToString(typ, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestVerifyEncoded(t *testing.T) {
+	l, c := newLedger(t)
+	v := loadVectors(t)
+	mustSucceed(t, l.Invoke(c.cp, "initAccumulator", "acc1", encode(t, wire.AccumulatorPublicKey, v.Accumulator.PublicKey),
+		encode(t, wire.AccumulatorValue, v.Accumulator.Value)))
+	mustSucceed(t, l.Invoke(c.cp, "revoke", "acc1", encode(t, wire.RevocationHandle, v.Accumulator.Revoked), v.Accumulator.UpdatedValue))
+	mustFail(t, l.Invoke(c.admin, "registerIssuer", "cp1", encode(t, wire.G1Point, v.Issuer), "acc1"), "2nd argument must be an hexadecimal G1 point")
+	mustSucceed(t, l.Invoke(c.admin, "registerIssuer", "cp1", encode(t, wire.IssuerPublicKey, v.Issuer), "acc1"))
+	issueChallenge(t, l, c.sp, v, &v.Valid)
+
+	// the arguments of verify mix the two forms
+	p := v.Valid
+	args := p.args("cp1")
+	args[1] = encode(t, wire.BlindCommitment, p.Commitment)
+	args[2] = encode(t, wire.Certificate, p.Certificate)
+	args[5] = encode(t, wire.G1Point, p.Generator)
+	args[8] = encode(t, wire.IssuerProof, p.IssuerProof)
+	args[10] = encode(t, wire.MembershipProof, p.MembershipProof)
+	mustFail(t, l.Invoke(c.sp, append(args[:2:2], append([]string{encode(t, wire.G2Point, p.Certificate)}, args[3:]...)...)...),
+		"2nd argument must be a non-empty hexadecimal string")
+	mustSucceed(t, l.Invoke(c.sp, args...))
+}
+
+// compressG1 returns the hexadecimal G1 point s in compressed form
+func compressG1(t *testing.T, s string) string {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, ok := new(bn256.G1).Unmarshal(b)
+	if !ok {
+		t.Fatalf("Not a G1 point: %s", s)
+	}
+	return hex.EncodeToString(p.MarshalCompressed())
+}
+
+// compressG2 returns the hexadecimal G2 point s in compressed form
+func compressG2(t *testing.T, s string) string {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, ok := new(bn256.G2).Unmarshal(b)
+	if !ok {
+		t.Fatalf("Not a G2 point: %s", s)
+	}
+	return hex.EncodeToString(p.MarshalCompressed())
+}
+
+func TestVerifyCompressed(t *testing.T) {
+	l, c := newLedger(t)
+	v := loadVectors(t)
+	mustSucceed(t, l.Invoke(c.cp, "initAccumulator", "acc1", compressG2(t, v.Accumulator.PublicKey), compressG1(t, v.Accumulator.Value)))
+	mustSucceed(t, l.Invoke(c.cp, "revoke", "acc1", v.Accumulator.Revoked, encode(t, wire.AccumulatorValue, compressG1(t, v.Accumulator.UpdatedValue))))
+	mustSucceed(t, l.Invoke(c.admin, "registerIssuer", "cp1", compressG1(t, v.Issuer), "acc1"))
+	issueChallenge(t, l, c.sp, v, &v.Valid)
+
+	p := v.Valid
+	args := p.args("cp1")
+	args[2] = compressG2(t, p.Certificate)
+	args[3] = compressG1(t, p.IssuerKey)
+	args[4] = encode(t, wire.HolderPublicKey, compressG2(t, p.HolderKey))
+	args[5] = compressG1(t, p.Generator)
+	// the issuer proof is AGenerator, AIssuer (G1) || S, the membership proof b*W, b*V (G1) || b*Q, b*G2 (G2)
+	args[8] = compressG1(t, p.IssuerProof[:128]) + compressG1(t, p.IssuerProof[128:256]) + p.IssuerProof[256:]
+	args[10] = compressG1(t, p.MembershipProof[:128]) + compressG1(t, p.MembershipProof[128:256]) +
+		compressG2(t, p.MembershipProof[256:512]) + compressG2(t, p.MembershipProof[512:])
+	if len(args[8]) != 2*98 || len(args[10]) != 2*196 {
+		t.Fatalf("Wrong compressed proofs: %d and %d digits", len(args[8]), len(args[10]))
+	}
+
+	// x³+3 is not a square for x = 2, the compressed generator is not a point of the curve
+	bad := append([]string(nil), args...)
+	bad[5] = "02" + strings.Repeat("00", 31) + "02"
+	mustFail(t, l.Invoke(c.sp, bad...), "Malformed proof: Error during unmarshal generator")
+	mustSucceed(t, l.Invoke(c.sp, args...))
+
+	// the uncompressed form of the same presentation has the same digest
+	issueChallenge(t, l, c.sp, v, &v.Valid)
+	mustFail(t, l.Invoke(c.sp, p.args("cp1")...), "Presentation already used")
+}
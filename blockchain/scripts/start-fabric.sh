@@ -109,13 +109,15 @@ function installChainCodeOnAllPeers {
    done
 }
 
+#The roles iv, cp and sp of the chaincode are accepted from the clients of every peer org
 function instantiateChainCode {
+   makeRoleMSPs
    local COUNT=1
    for ORG in $PEER_ORGS; do
       initPeerVars $ORG $COUNT
       switchToAdminIdentity
       logr "Instantiating chaincode on $PEER_HOST ..."
-      peer chaincode instantiate -C $CHANNEL_NAME -n $CC_NAME -l "$CC_LANGUAGE" -v $CC_VERSION -c '{"Args":["testAavKey","testAavVal"]}' -P "$POLICY" $ORDERER_CONN_ARGS
+      peer chaincode instantiate -C $CHANNEL_NAME -n $CC_NAME -l "$CC_LANGUAGE" -v $CC_VERSION -c '{"Args":["init","'$ORG_MSP_ID'","iv='$ROLE_MSPS'","cp='$ROLE_MSPS'","sp='$ROLE_MSPS'"]}' -P "$POLICY" $ORDERER_CONN_ARGS
    done
 }
 
@@ -201,6 +203,18 @@ function makePolicy  {
    log "policy: $POLICY"
 }
 
+function makeRoleMSPs {
+   ROLE_MSPS=""
+   for ORG in $PEER_ORGS; do
+      initOrgVars $ORG
+      if [ -n "$ROLE_MSPS" ]; then
+         ROLE_MSPS="${ROLE_MSPS},"
+      fi
+      ROLE_MSPS="${ROLE_MSPS}${ORG_MSP_ID}"
+   done
+   log "role MSPs: $ROLE_MSPS"
+}
+
 function installChaincode {
    switchToAdminIdentity
    logr "Installing chaincode on $PEER_HOST ..."
@@ -0,0 +1,111 @@
+package cryptoFunc
+
+import (
+	"errors"
+	"math/big"
+
+	"golang.org/x/crypto/bn256"
+)
+
+//membershipProofSize is the size in bytes of the membership proof: b*W, b*V (G1) || b*Q, b*G2 (G2)
+func membershipProofSize(g1, g2 int) int {
+	return 2*g1 + 2*g2
+}
+
+//pairEqual returns true if e(a, b) == e(c, d), ie e(a, b) * e(-c, d) == 1 with a single final exponentiation
+func pairEqual(a *bn256.G1, b *bn256.G2, c *bn256.G1, d *bn256.G2) bool {
+	return bn256.PairingCheck([]*bn256.G1{a, new(bn256.G1).Neg(c)}, []*bn256.G2{b, d})
+}
+
+//unmarshalAccumulator converts the accumulator value (G1) and public key (G2) of a CP
+func unmarshalAccumulator(value []byte, publicKey []byte) (*bn256.G1, *bn256.G2, error) {
+	v, b := unmarshalG1(value)
+	if b != true {
+		return nil, nil, errors.New("Error during unmarshal accumulator value")
+	}
+	q, b := unmarshalG2(publicKey)
+	if b != true {
+		return nil, nil, errors.New("Error during unmarshal accumulator public key")
+	}
+	return v, q, nil
+}
+
+//IsAccumulator returns true if value and publicKey can be used as the accumulator of a CP
+func IsAccumulator(value []byte, publicKey []byte) bool {
+	_, _, err := unmarshalAccumulator(value, publicKey)
+	return err == nil
+}
+
+//VerifyAccumulatorUpdate verifies that newValue is oldValue without the revoked handle y
+// ie e(V', y*G2 + Q) == e(V, G2)
+func VerifyAccumulatorUpdate(oldValue []byte, newValue []byte, revoked []byte, publicKey []byte) (bool, error) {
+	oldV, q, err := unmarshalAccumulator(oldValue, publicKey)
+	if err != nil {
+		return false, err
+	}
+	newV, b := unmarshalG1(newValue)
+	if b != true {
+		return false, errors.New("Error during unmarshal new accumulator value")
+	}
+
+	right := new(bn256.G2).ScalarBaseMult(new(big.Int).SetBytes(revoked))
+	right = right.Add(right, q)
+	g2 := new(bn256.G2).ScalarBaseMult(big.NewInt(1))
+
+	return pairEqual(newV, right, oldV, g2), nil
+}
+
+//VerifyBlindMembership verifies that the certificate of a blinded presentation has not been revoked, ie its handle y = H(C) is in the accumulator
+/* blindCommitment is b*y and blindGenerator is b*G, as given to VerifyBlindCertificate
+ * accumulatorValue V and publicKey Q are the current accumulator of the CP
+ * membershipProof is b*W || b*V || b*Q || b*G2, W being the witness of the holder, with uncompressed or compressed points
+ *
+ * It checks e(b*G, G2) == e(G, b*G2), e(b*G, Q) == e(G, b*Q), e(b*V, G2) == e(V, b*G2) and e(b*W, b*y*G2 + b*Q) == e(b*V, b*G2)
+ */
+func VerifyBlindMembership(blindCommitment []byte, blindGenerator []byte, accumulatorValue []byte, publicKey []byte, membershipProof []byte) (bool, error) {
+	g1Len, g2Len, ok := pointSizes(len(membershipProof), membershipProofSize)
+	if !ok {
+		return false, errors.New("Membership proof must be 384 bytes, or 196 bytes if compressed")
+	}
+	v, q, err := unmarshalAccumulator(accumulatorValue, publicKey)
+	if err != nil {
+		return false, err
+	}
+	blindGeneratorPoint, b := unmarshalG1(blindGenerator)
+	if b != true {
+		return false, errors.New("Error during unmarshal generator")
+	}
+	blindWitness, b := unmarshalG1(membershipProof[:g1Len])
+	if b != true {
+		return false, errors.New("Error during unmarshal blinded witness")
+	}
+	blindValue, b := unmarshalG1(membershipProof[g1Len : 2*g1Len])
+	if b != true {
+		return false, errors.New("Error during unmarshal blinded accumulator value")
+	}
+	blindKey, b := unmarshalG2(membershipProof[2*g1Len : 2*g1Len+g2Len])
+	if b != true {
+		return false, errors.New("Error during unmarshal blinded accumulator key")
+	}
+	blindG2, b := unmarshalG2(membershipProof[2*g1Len+g2Len:])
+	if b != true {
+		return false, errors.New("Error during unmarshal blinded G2 generator")
+	}
+
+	g1 := new(bn256.G1).ScalarBaseMult(big.NewInt(1))
+	g2 := new(bn256.G2).ScalarBaseMult(big.NewInt(1))
+	if !pairEqual(blindGeneratorPoint, g2, g1, blindG2) {
+		return false, nil
+	}
+	if !pairEqual(blindGeneratorPoint, q, g1, blindKey) {
+		return false, nil
+	}
+	if !pairEqual(blindValue, g2, v, blindG2) {
+		return false, nil
+	}
+
+	//b*y*G2 + b*Q
+	right := new(bn256.G2).ScalarBaseMult(new(big.Int).SetBytes(blindCommitment))
+	right = right.Add(right, blindKey)
+	return pairEqual(blindWitness, right, blindValue, blindG2), nil
+}
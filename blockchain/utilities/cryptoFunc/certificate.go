@@ -1,47 +1,121 @@
 package cryptoFunc
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
 	"errors"
 	"math/big"
-	"strings"
 
 	"golang.org/x/crypto/bn256"
 )
 
-//VerifyBlindCertificate verifies that the blinded certificate is correct
-// ie e(b*H(C)*G + b*pubG1CP, b*certificate) == e(b*G, b*pubG2User)
-func VerifyBlindCertificate(blindCommitment []byte, blindCertificate []byte, blindPubG1Byte []byte, blindPubG2Byte []byte, blindGenerator []byte) (bool, error) {
+var (
+	errAttributeCount  = errors.New("Attribute count must be strictly positive")
+	errBlindCommitment = errors.New("Blinded commitment must be in [1, Order)")
+	errBlindInfinity   = errors.New("Point of the blinded presentation is at infinity")
+)
+
+//attributeCountHash returns H("attributeCount" || n) mod the order of the group.
+//It must stay identical to the one used by the certificate provider in cryptolib
+func attributeCountHash(attributeCount int) *big.Int {
+	var count [4]byte
+	binary.BigEndian.PutUint32(count[:], uint32(attributeCount))
+	h := sha256.New()
+	h.Write([]byte("attributeCount"))
+	h.Write(count[:])
+	hash := new(big.Int).SetBytes(h.Sum(nil))
+	return hash.Mod(hash, bn256.Order)
+}
+
+//checkBlinded verifies that the blinded values cannot come from a blinding factor b = 0: b*H(C) in [1, Order) and no point
+//at infinity. With b = 0, the equality of VerifyBlindCertificate and the issuer proof hold for any registered CP and any nonce
+func checkBlinded(blindCommitment *big.Int, blindPubG1 *bn256.G1, blindGenerator *bn256.G1, blindPubG2 *bn256.G2, blindCertificate *bn256.G2) error {
+	if blindCommitment.Sign() == 0 || blindCommitment.Cmp(bn256.Order) >= 0 {
+		return errBlindCommitment
+	}
+	if blindPubG1.IsInfinity() || blindGenerator.IsInfinity() || blindPubG2.IsInfinity() || blindCertificate.IsInfinity() {
+		return errBlindInfinity
+	}
+	return nil
+}
+
+//VerifyBlindCertificate verifies that the blinded certificate is correct for attributeCount attributes
+// ie e(b*H(C)*G + H(n)*b*G + b*pubG1CP, b*certificate) == e(b*G, b*pubG2User)
+func VerifyBlindCertificate(blindCommitment []byte, attributeCount int, blindCertificate []byte, blindPubG1Byte []byte, blindPubG2Byte []byte, blindGenerator []byte) (bool, error) {
+	if attributeCount < 1 {
+		return false, errAttributeCount
+	}
 
 	/****** Convert []byte to G1 and G2 bn256 point *****/
-	blindPubG1, b := new(bn256.G1).Unmarshal(blindPubG1Byte)
+	blindPubG1, b := unmarshalG1(blindPubG1Byte)
 	if b != true {
 		return false, errors.New("Error during unmarshal pubG1")
 	}
-	blindGeneratorPoint, b := new(bn256.G1).Unmarshal(blindGenerator)
+	blindGeneratorPoint, b := unmarshalG1(blindGenerator)
 	if b != true {
 		return false, errors.New("Error during unmarshal generator")
 	}
-	blindPubG2, b := new(bn256.G2).Unmarshal(blindPubG2Byte)
+	blindPubG2, b := unmarshalG2(blindPubG2Byte)
 	if b != true {
 		return false, errors.New("Error during unmarshal pubG2")
 	}
-	blindCertificatePoint, b := new(bn256.G2).Unmarshal(blindCertificate)
+	blindCertificatePoint, b := unmarshalG2(blindCertificate)
 	if b != true {
 		return false, errors.New("Error during unmarshal certificate")
 	}
+	blindCommitmentInt := new(big.Int).SetBytes(blindCommitment)
+	if err := checkBlinded(blindCommitmentInt, blindPubG1, blindGeneratorPoint, blindPubG2, blindCertificatePoint); err != nil {
+		return false, err
+	}
 
 	//Compute b*H(C)*G1
-	blindCommitmentInt := new(big.Int).SetBytes(blindCommitment)
 	leftG1 := new(bn256.G1).ScalarBaseMult(blindCommitmentInt)
 	//Compute b*H(C) + b*pubG1CP)
 	leftG1 = leftG1.Add(leftG1, blindPubG1)
+	//Compute b*H(C) + H(n)*b*G + b*pubG1CP
+	countG1 := new(bn256.G1).ScalarMult(blindGeneratorPoint, attributeCountHash(attributeCount))
+	leftG1 = leftG1.Add(leftG1, countG1)
 
-	left := bn256.Pair(leftG1, blindCertificatePoint)
-	right := bn256.Pair(blindGeneratorPoint, blindPubG2)
+	//e(leftG1, b*certificate) == e(b*G, b*pubG2User)
+	return pairEqual(leftG1, blindCertificatePoint, blindGeneratorPoint, blindPubG2), nil
+}
 
-	if strings.Compare(left.String(), right.String()) != 0 {
-		return false, nil
+//PresentationDigest returns the SHA-256 hash of the blinded presentation, in the format of cryptolib BlindedPresentation.Marshal:
+//attributeCount (4 bytes) || blindCommitment (32 bytes) || blindCertificate || blindPubG1CP || blindPubG2User || blindGenerator
+//The points are marshalled again so that two encodings of the same presentation have the same digest
+func PresentationDigest(blindCommitment []byte, attributeCount int, blindCertificate []byte, blindPubG1Byte []byte, blindPubG2Byte []byte, blindGenerator []byte) ([]byte, error) {
+	if attributeCount < 1 {
+		return nil, errAttributeCount
+	}
+	blindCertificatePoint, b := unmarshalG2(blindCertificate)
+	if b != true {
+		return nil, errors.New("Error during unmarshal certificate")
+	}
+	blindPubG1, b := unmarshalG1(blindPubG1Byte)
+	if b != true {
+		return nil, errors.New("Error during unmarshal pubG1")
+	}
+	blindPubG2, b := unmarshalG2(blindPubG2Byte)
+	if b != true {
+		return nil, errors.New("Error during unmarshal pubG2")
+	}
+	blindGeneratorPoint, b := unmarshalG1(blindGenerator)
+	if b != true {
+		return nil, errors.New("Error during unmarshal generator")
+	}
+	blindCommitmentInt := new(big.Int).SetBytes(blindCommitment)
+	if err := checkBlinded(blindCommitmentInt, blindPubG1, blindGeneratorPoint, blindPubG2, blindCertificatePoint); err != nil {
+		return nil, err
 	}
 
-	return true, nil
+	res := make([]byte, 4+32)
+	binary.BigEndian.PutUint32(res, uint32(attributeCount))
+	commitBytes := blindCommitmentInt.Bytes()
+	copy(res[4+32-len(commitBytes):], commitBytes)
+	res = append(res, blindCertificatePoint.Marshal()...)
+	res = append(res, blindPubG1.Marshal()...)
+	res = append(res, blindPubG2.Marshal()...)
+	res = append(res, blindGeneratorPoint.Marshal()...)
+	h := sha256.Sum256(res)
+	return h[:], nil
 }
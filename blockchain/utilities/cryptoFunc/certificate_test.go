@@ -0,0 +1,42 @@
+package cryptoFunc
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bn256"
+)
+
+//A presentation blinded with b = 0 has every point at infinity: it satisfies the pairing equality and an issuer proof
+//with AGenerator = w*G, AIssuer = w*pubG1CP and S = w for any CP, so it must be refused
+func TestBlindedAtInfinity(t *testing.T) {
+	g1 := make([]byte, g1Size)
+	g2 := make([]byte, g2Size)
+	one := make([]byte, 32)
+	one[31] = 1
+	if _, err := VerifyBlindCertificate(one, 1, g2, g1, g2, g1); err != errBlindInfinity {
+		t.Fatalf("Presentation at infinity: %v", err)
+	}
+	if _, err := PresentationDigest(one, 1, g2, g1, g2, g1); err != errBlindInfinity {
+		t.Fatalf("Digest of a presentation at infinity: %v", err)
+	}
+
+	pubG1CP := new(bn256.G1).ScalarBaseMult(big.NewInt(42))
+	w := big.NewInt(12345)
+	proof := append(new(bn256.G1).ScalarBaseMult(w).Marshal(), new(bn256.G1).ScalarMult(pubG1CP, w).Marshal()...)
+	proof = append(proof, w.FillBytes(make([]byte, 32))...)
+	if ok, err := VerifyIssuerProof(make([]byte, 32), g1, g1, pubG1CP.Marshal(), proof, []byte("nonce"), []byte("context")); ok || err != errBlindInfinity {
+		t.Fatalf("Issuer proof of a presentation at infinity: %v %v", ok, err)
+	}
+
+	//a null blinded commitment is refused even with points which are not at infinity
+	g := new(bn256.G1).ScalarBaseMult(big.NewInt(1)).Marshal()
+	h := new(bn256.G2).ScalarBaseMult(big.NewInt(1)).Marshal()
+	if _, err := PresentationDigest(make([]byte, 32), 1, h, g, h, g); err != errBlindCommitment {
+		t.Fatalf("Null blinded commitment: %v", err)
+	}
+	if _, err := VerifyBlindCertificate([]byte(strings.Repeat("\xff", 32)), 1, h, g, h, g); err != errBlindCommitment {
+		t.Fatalf("Blinded commitment above the order: %v", err)
+	}
+}
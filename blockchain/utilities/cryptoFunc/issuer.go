@@ -0,0 +1,99 @@
+package cryptoFunc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"golang.org/x/crypto/bn256"
+)
+
+//issuerProofSize is the size in bytes of the issuer proof: w*G, w*pubG1CP (G1) || S
+func issuerProofSize(g1, g2 int) int {
+	return 2*g1 + 32
+}
+
+//issuerChallenge computes the Fiat-Shamir challenge of the issuer proof of the presentation of digest digest.
+//It must stay identical to the one used by the holder in cryptolib
+func issuerChallenge(issuer *bn256.G1, digest []byte, AGenerator *bn256.G1, AIssuer *bn256.G1, nonce []byte, context []byte) *big.Int {
+	h := sha256.New()
+	fields := [][]byte{
+		[]byte("issuer"),
+		new(bn256.G1).ScalarBaseMult(big.NewInt(1)).Marshal(),
+		issuer.Marshal(),
+		digest,
+		AGenerator.Marshal(),
+		AIssuer.Marshal(),
+		nonce,
+		context,
+	}
+	for _, field := range fields {
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], uint32(len(field)))
+		h.Write(size[:])
+		h.Write(field)
+	}
+	e := new(big.Int).SetBytes(h.Sum(nil))
+	return e.Mod(e, bn256.Order)
+}
+
+//IsIssuerKey returns true if publicKey can be registered as the G1 public key of a CP
+func IsIssuerKey(publicKey []byte) bool {
+	_, b := unmarshalG1(publicKey)
+	return b
+}
+
+//VerifyIssuerProof verifies that blindPubG1CP = b*pubG1CP and blindGenerator = b*G for the same b,
+//ie that the blinded certificate has been issued by the registered CP of key pubG1CP
+// S*G == AGenerator + e*(b*G) and S*pubG1CP == AIssuer + e*(b*pubG1CP)
+//digest is the PresentationDigest of the blinded presentation, nonce and context the challenge of the verifier the proof is bound to.
+//b*G and b*pubG1CP at infinity are refused: with b = 0 the proof holds for any registered CP
+func VerifyIssuerProof(digest []byte, blindPubG1Byte []byte, blindGenerator []byte, pubG1Byte []byte, proof []byte, nonce []byte, context []byte) (bool, error) {
+	g1, _, ok := pointSizes(len(proof), issuerProofSize)
+	if !ok {
+		return false, errors.New("Issuer proof must be 160 bytes, or 98 bytes if compressed")
+	}
+	blindPubG1, b := unmarshalG1(blindPubG1Byte)
+	if b != true {
+		return false, errors.New("Error during unmarshal pubG1")
+	}
+	blindGeneratorPoint, b := unmarshalG1(blindGenerator)
+	if b != true {
+		return false, errors.New("Error during unmarshal generator")
+	}
+	if blindPubG1.IsInfinity() || blindGeneratorPoint.IsInfinity() {
+		return false, errBlindInfinity
+	}
+	pubG1, b := unmarshalG1(pubG1Byte)
+	if b != true {
+		return false, errors.New("Error during unmarshal registered pubG1")
+	}
+	AGenerator, b := unmarshalG1(proof[:g1])
+	if b != true {
+		return false, errors.New("Error during unmarshal issuer proof")
+	}
+	AIssuer, b := unmarshalG1(proof[g1 : 2*g1])
+	if b != true {
+		return false, errors.New("Error during unmarshal issuer proof")
+	}
+	s := new(big.Int).SetBytes(proof[2*g1:])
+
+	e := issuerChallenge(pubG1, digest, AGenerator, AIssuer, nonce, context)
+
+	left := new(bn256.G1).ScalarBaseMult(s)
+	right := new(bn256.G1).ScalarMult(blindGeneratorPoint, e)
+	right = right.Add(right, AGenerator)
+	if !bytes.Equal(left.Marshal(), right.Marshal()) {
+		return false, nil
+	}
+
+	left = new(bn256.G1).ScalarMult(pubG1, s)
+	right = new(bn256.G1).ScalarMult(blindPubG1, e)
+	right = right.Add(right, AIssuer)
+	if !bytes.Equal(left.Marshal(), right.Marshal()) {
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,42 @@
+package cryptoFunc
+
+import (
+	"golang.org/x/crypto/bn256"
+)
+
+//Size in bytes of the bn256 points, uncompressed (Marshal) or compressed (MarshalCompressed)
+const (
+	g1Size           = 64
+	g2Size           = 128
+	g1CompressedSize = 33
+	g2CompressedSize = 65
+)
+
+//unmarshalG1 converts a G1 point of 64 bytes, or of 33 bytes if it is compressed
+func unmarshalG1(m []byte) (*bn256.G1, bool) {
+	if len(m) == g1CompressedSize {
+		return new(bn256.G1).UnmarshalCompressed(m)
+	}
+	return new(bn256.G1).Unmarshal(m)
+}
+
+//unmarshalG2 converts a G2 point of 128 bytes, or of 65 bytes if it is compressed.
+//A compressed point is also checked to be in G2
+func unmarshalG2(m []byte) (*bn256.G2, bool) {
+	if len(m) == g2CompressedSize {
+		return new(bn256.G2).UnmarshalCompressed(m)
+	}
+	return new(bn256.G2).Unmarshal(m)
+}
+
+//pointSizes returns the sizes of the G1 and G2 points of a value of n bytes whose size is layout(g1, g2).
+//The points of a value are either all uncompressed or all compressed
+func pointSizes(n int, layout func(g1, g2 int) int) (int, int, bool) {
+	if n == layout(g1Size, g2Size) {
+		return g1Size, g2Size, true
+	}
+	if n == layout(g1CompressedSize, g2CompressedSize) {
+		return g1CompressedSize, g2CompressedSize, true
+	}
+	return 0, 0, false
+}
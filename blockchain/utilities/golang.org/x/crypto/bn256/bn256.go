@@ -95,6 +95,11 @@ func (e *G1) Neg(a *G1) *G1 {
 	return e
 }
 
+// IsInfinity returns true if e is the point at infinity, the identity of G₁.
+func (e *G1) IsInfinity() bool {
+	return e.p.IsInfinity()
+}
+
 // Marshal converts n to a byte slice.
 func (e *G1) Marshal() []byte {
 	// Each value is a 256-bit number.
@@ -207,6 +212,20 @@ func (e *G2) Add(a, b *G2) *G2 {
 	return e
 }
 
+// Neg sets e to -a and then returns e.
+func (e *G2) Neg(a *G2) *G2 {
+	if e.p == nil {
+		e.p = newTwistPoint(nil)
+	}
+	e.p.Negative(a.p, new(bnPool))
+	return e
+}
+
+// IsInfinity returns true if e is the point at infinity, the identity of G₂.
+func (e *G2) IsInfinity() bool {
+	return e.p.IsInfinity()
+}
+
 // Marshal converts n into a byte slice.
 func (n *G2) Marshal() []byte {
 	// Each value is a 256-bit number.
@@ -233,7 +252,8 @@ func (n *G2) Marshal() []byte {
 }
 
 // Unmarshal sets e to the result of converting the output of Marshal back into
-// a group element and then returns e.
+// a group element and then returns e. It fails if the point is not on the twist
+// or not in G₂.
 func (e *G2) Unmarshal(m []byte) (*G2, bool) {
 	// Each value is a 256-bit number.
 	const numBytes = 256 / 8
@@ -263,7 +283,7 @@ func (e *G2) Unmarshal(m []byte) (*G2, bool) {
 		e.p.z.SetOne()
 		e.p.t.SetOne()
 
-		if !e.p.IsOnCurve() {
+		if !e.p.IsOnCurve() || !e.p.InG2(new(bnPool)) {
 			return nil, false
 		}
 	}
@@ -380,6 +400,57 @@ func Pair(g1 *G1, g2 *G2) *GT {
 	return &GT{optimalAte(g2.p, g1.p, new(bnPool))}
 }
 
+// PairingCheck calculates the Optimal Ate pairing for a set of points and
+// returns true if the product of the pairings, e(a[0], b[0]) * ... *
+// e(a[n-1], b[n-1]), is the identity of GT. The Miller loops of the pairs
+// share a single final exponentiation. An equality e(a, b) == e(c, d) is
+// checked with PairingCheck([]*G1{a, -c}, []*G2{b, d}).
+func PairingCheck(a []*G1, b []*G2) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	pool := new(bnPool)
+	acc := newGFp12(pool)
+	acc.SetOne()
+	for i := range a {
+		if a[i].p.IsInfinity() || b[i].p.IsInfinity() {
+			continue
+		}
+		m := miller(b[i].p, a[i].p, pool)
+		acc.Mul(acc, m, pool)
+		m.Put(pool)
+	}
+	ret := finalExponentiation(acc, pool)
+	acc.Put(pool)
+	return ret.IsOne()
+}
+
+// Miller applies Miller's algorithm, which is a bilinear function from the
+// source groups to F_p^12. Miller(g1, g2).Finalize() is equivalent to
+// Pair(g1, g2). The results of several Miller loops can be multiplied with
+// Add before a single, shared Finalize.
+func Miller(g1 *G1, g2 *G2) *GT {
+	if g1.p.IsInfinity() || g2.p.IsInfinity() {
+		return &GT{newGFp12(nil).SetOne()}
+	}
+	return &GT{miller(g2.p, g1.p, new(bnPool))}
+}
+
+// Finalize applies the final exponentiation of the pairing to e, which maps
+// an output of Miller into GT. It sets e to the result and then returns e.
+func (e *GT) Finalize() *GT {
+	pool := new(bnPool)
+	ret := finalExponentiation(e.p, pool)
+	e.p.Set(ret)
+	ret.Put(pool)
+	return e
+}
+
+// IsOne returns true if e is the identity of GT.
+func (e *GT) IsOne() bool {
+	return e.p.IsOne()
+}
+
 // bnPool implements a tiny cache of *big.Int objects that's used to reduce the
 // number of allocations made during processing.
 type bnPool struct {
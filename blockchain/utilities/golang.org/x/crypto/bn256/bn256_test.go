@@ -259,6 +259,9 @@ func TestG1Identity(t *testing.T) {
 	if !g.p.IsInfinity() {
 		t.Error("failure")
 	}
+	if !g.IsInfinity() || new(G1).ScalarBaseMult(big.NewInt(1)).IsInfinity() {
+		t.Error("IsInfinity failure")
+	}
 }
 
 func TestG2Identity(t *testing.T) {
@@ -266,6 +269,23 @@ func TestG2Identity(t *testing.T) {
 	if !g.p.IsInfinity() {
 		t.Error("failure")
 	}
+	if !g.IsInfinity() || new(G2).ScalarBaseMult(big.NewInt(1)).IsInfinity() {
+		t.Error("IsInfinity failure")
+	}
+}
+
+func TestG2Neg(t *testing.T) {
+	_, g, err := RandomG2(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !new(G2).Add(g, new(G2).Neg(g)).IsInfinity() {
+		t.Error("a + -a is not ∞")
+	}
+	minusOne := new(big.Int).Sub(Order, big.NewInt(1))
+	if !bytes.Equal(new(G2).Neg(g).Marshal(), new(G2).ScalarMult(g, minusOne).Marshal()) {
+		t.Error("-a is not (Order-1)·a")
+	}
 }
 
 func TestTripartiteDiffieHellman(t *testing.T) {
@@ -297,6 +317,70 @@ func TestTripartiteDiffieHellman(t *testing.T) {
 	}
 }
 
+func TestMillerFinalize(t *testing.T) {
+	a, _ := rand.Int(rand.Reader, Order)
+	b, _ := rand.Int(rand.Reader, Order)
+	pa := new(G1).ScalarBaseMult(a)
+	qb := new(G2).ScalarBaseMult(b)
+
+	if !bytes.Equal(Miller(pa, qb).Finalize().Marshal(), Pair(pa, qb).Marshal()) {
+		t.Error("Miller and Finalize differ from Pair")
+	}
+
+	// e(a*G1, b*G2) * e(-(a*b)*G1, G2) is the identity, with one final exponentiation
+	ab := new(big.Int).Mul(a, b)
+	neg := new(G1).Neg(new(G1).ScalarBaseMult(ab))
+	product := Miller(pa, qb)
+	product.Add(product, Miller(neg, &G2{twistGen}))
+	if !product.Finalize().IsOne() {
+		t.Error("product of pairings is not the identity")
+	}
+	product = Miller(pa, qb)
+	product.Add(product, Miller(&G1{curveGen}, &G2{twistGen}))
+	if product.Finalize().IsOne() {
+		t.Error("product of pairings is the identity")
+	}
+	if !Miller(new(G1).ScalarBaseMult(new(big.Int)), qb).Finalize().IsOne() {
+		t.Error("pairing with the point at infinity is not the identity")
+	}
+}
+
+func TestPairingCheck(t *testing.T) {
+	a, _ := rand.Int(rand.Reader, Order)
+	b, _ := rand.Int(rand.Reader, Order)
+	pa := new(G1).ScalarBaseMult(a)
+	qb := new(G2).ScalarBaseMult(b)
+	ab := new(big.Int).Mul(a, b)
+
+	// e(a*G1, b*G2) == e(a*b*G1, G2)
+	neg := new(G1).Neg(new(G1).ScalarBaseMult(ab))
+	if !PairingCheck([]*G1{pa, neg}, []*G2{qb, &G2{twistGen}}) {
+		t.Error("e(a*G1, b*G2) * e(-a*b*G1, G2) is not the identity")
+	}
+	if PairingCheck([]*G1{pa, neg}, []*G2{&G2{twistGen}, qb}) {
+		t.Error("e(a*G1, G2) * e(-a*b*G1, b*G2) is the identity")
+	}
+	if !PairingCheck([]*G1{pa, new(G1).Neg(pa), neg, new(G1).ScalarBaseMult(ab)}, []*G2{qb, qb, qb, qb}) {
+		t.Error("product of four pairings is not the identity")
+	}
+	if PairingCheck([]*G1{pa}, []*G2{qb}) {
+		t.Error("e(a*G1, b*G2) is the identity")
+	}
+	if !PairingCheck(nil, nil) || !PairingCheck([]*G1{new(G1).ScalarBaseMult(new(big.Int))}, []*G2{qb}) {
+		t.Error("empty product is not the identity")
+	}
+	if PairingCheck([]*G1{pa}, nil) {
+		t.Error("points of different lengths accepted")
+	}
+}
+
+func BenchmarkPairingCheck(b *testing.B) {
+	neg := new(G1).Neg(&G1{curveGen})
+	for i := 0; i < b.N; i++ {
+		PairingCheck([]*G1{&G1{curveGen}, neg}, []*G2{&G2{twistGen}, &G2{twistGen}})
+	}
+}
+
 func BenchmarkPairing(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		Pair(&G1{curveGen}, &G2{twistGen})
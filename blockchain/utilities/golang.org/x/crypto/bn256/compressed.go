@@ -0,0 +1,302 @@
+package bn256
+
+import (
+	"math/big"
+)
+
+// The compressed form of a point is a prefix byte followed by its x
+// coordinate. The prefix is compressedEven or compressedOdd according to the
+// sign of y, which is recovered with a square root on decompression. The point
+// at infinity is a zero prefix followed by zeros.
+const (
+	compressedInfinity = 0
+	compressedEven     = 2
+	compressedOdd      = 3
+)
+
+// pMinus3Over4 and pMinus1Over2 are the exponents of the square roots, which
+// rely on p ≡ 3 mod 4.
+var (
+	pMinus3Over4 = new(big.Int).Rsh(p, 2)
+	pMinus1Over2 = new(big.Int).Rsh(p, 1)
+)
+
+// twistCofactor is 2p-Order, the number of points of the twist divided by
+// Order.
+var twistCofactor = new(big.Int).Sub(new(big.Int).Lsh(p, 1), Order)
+
+// MarshalCompressed converts e to a byte slice of 33 bytes: the prefix of the
+// sign of y followed by x.
+func (e *G1) MarshalCompressed() []byte {
+	// Each value is a 256-bit number.
+	const numBytes = 256 / 8
+
+	ret := make([]byte, 1+numBytes)
+	if e.p.IsInfinity() {
+		return ret
+	}
+
+	e.p.MakeAffine(nil)
+
+	xBytes := new(big.Int).Mod(e.p.x, p).Bytes()
+	y := new(big.Int).Mod(e.p.y, p)
+
+	ret[0] = compressedEven + byte(y.Bit(0))
+	copy(ret[1+numBytes-len(xBytes):], xBytes)
+
+	return ret
+}
+
+// UnmarshalCompressed sets e to the result of converting the output of
+// MarshalCompressed back into a group element and then returns e. It fails if
+// x is not reduced or is not the coordinate of a point of the curve. Every
+// point of the curve is in G₁.
+func (e *G1) UnmarshalCompressed(m []byte) (*G1, bool) {
+	// Each value is a 256-bit number.
+	const numBytes = 256 / 8
+
+	if len(m) != 1+numBytes {
+		return nil, false
+	}
+
+	x := new(big.Int).SetBytes(m[1:])
+	if m[0] == compressedInfinity {
+		if x.Sign() != 0 {
+			return nil, false
+		}
+		if e.p == nil {
+			e.p = newCurvePoint(nil)
+		}
+		e.p.x.SetInt64(0)
+		e.p.y.SetInt64(1)
+		e.p.z.SetInt64(0)
+		e.p.t.SetInt64(0)
+		return e, true
+	}
+	if (m[0] != compressedEven && m[0] != compressedOdd) || x.Cmp(p) >= 0 {
+		return nil, false
+	}
+
+	// y² = x³ + 3
+	y := new(big.Int).Mul(x, x)
+	y.Mul(y, x)
+	y.Add(y, curveB)
+	y.Mod(y, p)
+	if y.ModSqrt(y, p) == nil {
+		return nil, false
+	}
+	if y.Bit(0) != uint(m[0]-compressedEven) {
+		y.Sub(p, y)
+	}
+
+	c := newCurvePoint(nil)
+	c.x.Set(x)
+	c.y.Set(y)
+	c.z.SetInt64(1)
+	c.t.SetInt64(1)
+	if !c.IsOnCurve() {
+		return nil, false
+	}
+
+	e.p = c
+	return e, true
+}
+
+// MarshalCompressed converts n to a byte slice of 65 bytes: the prefix of the
+// sign of y followed by x, the imaginary part first as in Marshal.
+func (n *G2) MarshalCompressed() []byte {
+	// Each value is a 256-bit number.
+	const numBytes = 256 / 8
+
+	ret := make([]byte, 1+2*numBytes)
+	if n.p.IsInfinity() {
+		return ret
+	}
+
+	n.p.MakeAffine(nil)
+
+	xxBytes := new(big.Int).Mod(n.p.x.x, p).Bytes()
+	xyBytes := new(big.Int).Mod(n.p.x.y, p).Bytes()
+	y := newGFp2(nil).Set(n.p.y)
+	y.Minimal()
+
+	ret[0] = compressedEven + gfP2Sign(y)
+	copy(ret[1+numBytes-len(xxBytes):], xxBytes)
+	copy(ret[1+2*numBytes-len(xyBytes):], xyBytes)
+
+	return ret
+}
+
+// UnmarshalCompressed sets e to the result of converting the output of
+// MarshalCompressed back into a group element and then returns e. It fails if
+// x is not reduced, is not the coordinate of a point of the twist, or if the
+// point is not in G₂, the subgroup of order Order of the twist.
+func (e *G2) UnmarshalCompressed(m []byte) (*G2, bool) {
+	// Each value is a 256-bit number.
+	const numBytes = 256 / 8
+
+	if len(m) != 1+2*numBytes {
+		return nil, false
+	}
+
+	x := newGFp2(nil)
+	x.x.SetBytes(m[1 : 1+numBytes])
+	x.y.SetBytes(m[1+numBytes:])
+	if m[0] == compressedInfinity {
+		if !x.IsZero() {
+			return nil, false
+		}
+		if e.p == nil {
+			e.p = newTwistPoint(nil)
+		}
+		e.p.x.SetZero()
+		e.p.y.SetOne()
+		e.p.z.SetZero()
+		e.p.t.SetZero()
+		return e, true
+	}
+	if (m[0] != compressedEven && m[0] != compressedOdd) || x.x.Cmp(p) >= 0 || x.y.Cmp(p) >= 0 {
+		return nil, false
+	}
+
+	pool := new(bnPool)
+	// y² = x³ + 3/ξ
+	yy := newGFp2(pool).Square(x, pool)
+	yy.Mul(yy, x, pool)
+	yy.Add(yy, twistB)
+	yy.Minimal()
+	y := gfP2Sqrt(yy, pool)
+	if y == nil {
+		return nil, false
+	}
+	if gfP2Sign(y) != m[0]-compressedEven {
+		y.Negative(y)
+		y.Minimal()
+	}
+
+	c := newTwistPoint(nil)
+	c.x.Set(x)
+	c.y.Set(y)
+	c.z.SetOne()
+	c.t.SetOne()
+	if !c.IsOnCurve() {
+		return nil, false
+	}
+	// The twist has points outside of G₂, which are rejected.
+	if !c.InG2(pool) {
+		return nil, false
+	}
+
+	e.p = c
+	return e, true
+}
+
+// MapToG2 returns the point of G₂ derived from the point of the twist of
+// abscissa x and of even y by clearing the cofactor. x is 64 bytes, the
+// imaginary part first as in Marshal. It fails if x is not reduced, is not the
+// coordinate of a point of the twist, or if the result is ∞. Hashing to x and
+// incrementing until MapToG2 succeeds gives points of G₂ whose discrete log is
+// unknown.
+func MapToG2(x []byte) (*G2, bool) {
+	// Each value is a 256-bit number.
+	const numBytes = 256 / 8
+
+	if len(x) != 2*numBytes {
+		return nil, false
+	}
+	a := newGFp2(nil)
+	a.x.SetBytes(x[:numBytes])
+	a.y.SetBytes(x[numBytes:])
+	if a.x.Cmp(p) >= 0 || a.y.Cmp(p) >= 0 {
+		return nil, false
+	}
+
+	pool := new(bnPool)
+	// y² = x³ + 3/ξ
+	yy := newGFp2(pool).Square(a, pool)
+	yy.Mul(yy, a, pool)
+	yy.Add(yy, twistB)
+	yy.Minimal()
+	y := gfP2Sqrt(yy, pool)
+	if y == nil {
+		return nil, false
+	}
+	if gfP2Sign(y) != 0 {
+		y.Negative(y)
+		y.Minimal()
+	}
+
+	c := newTwistPoint(nil)
+	c.x.Set(a)
+	c.y.Set(y)
+	c.z.SetOne()
+	c.t.SetOne()
+	if !c.IsOnCurve() {
+		return nil, false
+	}
+	e := &G2{newTwistPoint(nil).Mul(c, twistCofactor, pool)}
+	if e.p.IsInfinity() {
+		return nil, false
+	}
+	return e, true
+}
+
+// gfP2Sign returns the parity of the real part of the reduced element a, or
+// the parity of its imaginary part if the real part is zero. The sign of -a
+// is the opposite of the sign of a non-zero a.
+func gfP2Sign(a *gfP2) byte {
+	if a.y.Sign() != 0 {
+		return byte(a.y.Bit(0))
+	}
+	return byte(a.x.Bit(0))
+}
+
+// gfP2Sqrt returns a square root of a in GF(p²), or nil if a is not a
+// square. See "Square root computation over even extension fields",
+// Adj and Rodríguez-Henríquez, algorithm 9, for p ≡ 3 mod 4.
+// http://eprint.iacr.org/2012/685.pdf
+func gfP2Sqrt(a *gfP2, pool *bnPool) *gfP2 {
+	if a.IsZero() {
+		return newGFp2(pool).SetZero()
+	}
+
+	a1 := newGFp2(pool).Exp(a, pMinus3Over4, pool)
+	alpha := newGFp2(pool).Mul(a1, a, pool)
+	x0 := newGFp2(pool).Set(alpha)
+	alpha.Mul(alpha, a1, pool)
+
+	// α^(p+1) is the norm of α, it is -1 iff a is not a square.
+	minusOne := newGFp2(pool).SetOne()
+	minusOne.Negative(minusOne)
+	minusOne.Minimal()
+	a0 := newGFp2(pool).Conjugate(alpha)
+	a0.Mul(a0, alpha, pool)
+	if gfP2Equal(a0, minusOne) {
+		return nil
+	}
+
+	ret := newGFp2(pool)
+	if gfP2Equal(alpha, minusOne) {
+		// i·x0
+		ret.x.Set(x0.y)
+		ret.y.Neg(x0.x)
+	} else {
+		b := newGFp2(pool).SetOne()
+		b.Add(b, alpha)
+		b.Exp(b, pMinus1Over2, pool)
+		ret.Mul(b, x0, pool)
+	}
+	ret.Minimal()
+
+	check := newGFp2(pool).Square(ret, pool)
+	check.Minimal()
+	if !gfP2Equal(check, a) {
+		return nil
+	}
+	return ret
+}
+
+// gfP2Equal returns true if the reduced elements a and b are equal.
+func gfP2Equal(a, b *gfP2) bool {
+	return a.x.Cmp(b.x) == 0 && a.y.Cmp(b.y) == 0
+}
@@ -0,0 +1,294 @@
+package bn256
+
+import (
+	"bytes"
+	"crypto/rand"
+	"math/big"
+	"testing"
+)
+
+func TestG1MarshalCompressed(t *testing.T) {
+	for i := 0; i < 16; i++ {
+		_, g, err := RandomG1(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, h := range []*G1{g, new(G1).Neg(g)} {
+			form := h.MarshalCompressed()
+			if len(form) != 33 {
+				t.Fatalf("compressed form of %d bytes", len(form))
+			}
+			h2, ok := new(G1).UnmarshalCompressed(form)
+			if !ok {
+				t.Fatalf("failed to unmarshal")
+			}
+			if !bytes.Equal(h2.Marshal(), h.Marshal()) {
+				t.Fatalf("%x unmarshaled incorrectly", form)
+			}
+		}
+		if g.MarshalCompressed()[0] == new(G1).Neg(g).MarshalCompressed()[0] {
+			t.Fatalf("same sign for g and -g")
+		}
+	}
+
+	inf := new(G1).ScalarBaseMult(Order)
+	g, ok := new(G1).UnmarshalCompressed(inf.MarshalCompressed())
+	if !ok {
+		t.Fatalf("failed to unmarshal ∞")
+	}
+	if !g.p.IsInfinity() {
+		t.Fatalf("∞ unmarshaled incorrectly")
+	}
+}
+
+func TestG1UnmarshalCompressedRejects(t *testing.T) {
+	form := new(G1).ScalarBaseMult(big.NewInt(1)).MarshalCompressed()
+
+	// x³+3 is not a square for x = 2.
+	nonResidue := make([]byte, 33)
+	nonResidue[0], nonResidue[32] = compressedEven, 2
+	unreduced := make([]byte, 33)
+	unreduced[0] = compressedEven
+	copy(unreduced[1:], new(big.Int).Add(p, big.NewInt(1)).Bytes())
+	badInfinity := make([]byte, 33)
+	badInfinity[32] = 1
+
+	for name, m := range map[string][]byte{
+		"prefix":       append([]byte{4}, form[1:]...),
+		"length":       form[:32],
+		"uncompressed": new(G1).ScalarBaseMult(big.NewInt(1)).Marshal(),
+		"non-residue":  nonResidue,
+		"x ≥ p":        unreduced,
+		"∞ with x":     badInfinity,
+	} {
+		if _, ok := new(G1).UnmarshalCompressed(m); ok {
+			t.Errorf("%s: %x accepted", name, m)
+		}
+	}
+}
+
+func TestG2MarshalCompressed(t *testing.T) {
+	for i := 0; i < 4; i++ {
+		k, g, err := RandomG2(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		neg := new(G2).ScalarBaseMult(new(big.Int).Sub(Order, k))
+		for _, h := range []*G2{g, neg} {
+			form := h.MarshalCompressed()
+			if len(form) != 65 {
+				t.Fatalf("compressed form of %d bytes", len(form))
+			}
+			h2, ok := new(G2).UnmarshalCompressed(form)
+			if !ok {
+				t.Fatalf("failed to unmarshal")
+			}
+			if !bytes.Equal(h2.Marshal(), h.Marshal()) {
+				t.Fatalf("%x unmarshaled incorrectly", form)
+			}
+		}
+		if g.MarshalCompressed()[0] == neg.MarshalCompressed()[0] {
+			t.Fatalf("same sign for g and -g")
+		}
+	}
+
+	inf := new(G2).ScalarBaseMult(Order)
+	g, ok := new(G2).UnmarshalCompressed(inf.MarshalCompressed())
+	if !ok {
+		t.Fatalf("failed to unmarshal ∞")
+	}
+	if !g.p.IsInfinity() {
+		t.Fatalf("∞ unmarshaled incorrectly")
+	}
+}
+
+func TestGFp2Sqrt(t *testing.T) {
+	pool := new(bnPool)
+	squares, nonSquares := 0, 0
+	for i := int64(1); i < 32; i++ {
+		a := &gfP2{big.NewInt(i), big.NewInt(i * i)}
+		r := gfP2Sqrt(a, pool)
+		if r == nil {
+			nonSquares++
+			continue
+		}
+		squares++
+		r.Square(r, pool)
+		r.Minimal()
+		if !gfP2Equal(r, a) {
+			t.Fatalf("wrong square root of %s", a)
+		}
+	}
+	if squares == 0 || nonSquares == 0 {
+		t.Fatalf("%d squares and %d non-squares", squares, nonSquares)
+	}
+}
+
+// twistPointOutsideG2 returns the compressed form of a point of the twist
+// which is not in G₂.
+func twistPointOutsideG2(t *testing.T) []byte {
+	pool := new(bnPool)
+	for i := int64(1); i < 64; i++ {
+		x := &gfP2{big.NewInt(1), big.NewInt(i)}
+		yy := newGFp2(pool).Square(x, pool)
+		yy.Mul(yy, x, pool)
+		yy.Add(yy, twistB)
+		yy.Minimal()
+		y := gfP2Sqrt(yy, pool)
+		if y == nil {
+			continue
+		}
+		c := &twistPoint{x, y, newGFp2(nil).SetOne(), newGFp2(nil).SetOne()}
+		if !c.IsOnCurve() || newTwistPoint(pool).Mul(c, Order, pool).IsInfinity() {
+			continue
+		}
+		m := make([]byte, 65)
+		m[0] = compressedEven + gfP2Sign(y)
+		m[32] = 1
+		m[64] = byte(i)
+		return m
+	}
+	t.Fatal("no point of the twist outside of G₂")
+	return nil
+}
+
+func TestInG2(t *testing.T) {
+	pool := new(bnPool)
+	for i := 0; i < 4; i++ {
+		_, g, err := RandomG2(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !g.p.MakeAffine(pool).InG2(pool) {
+			t.Fatal("point of G₂ rejected")
+		}
+	}
+	if !new(G2).ScalarBaseMult(Order).p.InG2(pool) {
+		t.Fatal("∞ rejected")
+	}
+
+	// The test agrees with Order·c = ∞ on the points of the twist, most of
+	// which are outside of G₂.
+	outside := 0
+	for i := int64(1); i < 64; i++ {
+		x := &gfP2{big.NewInt(3), big.NewInt(i)}
+		yy := newGFp2(pool).Square(x, pool)
+		yy.Mul(yy, x, pool)
+		yy.Add(yy, twistB)
+		yy.Minimal()
+		y := gfP2Sqrt(yy, pool)
+		if y == nil {
+			continue
+		}
+		c := &twistPoint{x, y, newGFp2(nil).SetOne(), newGFp2(nil).SetOne()}
+		in := newTwistPoint(pool).Mul(c, Order, pool).IsInfinity()
+		if c.InG2(pool) != in {
+			t.Fatalf("wrong membership of %s", c)
+		}
+		if !in {
+			outside++
+			if _, ok := new(G2).Unmarshal((&G2{c}).Marshal()); ok {
+				t.Errorf("%s accepted outside of G₂", c)
+			}
+		}
+	}
+	if outside == 0 {
+		t.Fatal("no point of the twist outside of G₂")
+	}
+}
+
+func TestG2UnmarshalCompressedRejects(t *testing.T) {
+	form := new(G2).ScalarBaseMult(big.NewInt(1)).MarshalCompressed()
+
+	unreduced := append([]byte(nil), form...)
+	copy(unreduced[1:33], p.Bytes())
+	badInfinity := make([]byte, 65)
+	badInfinity[64] = 1
+
+	for name, m := range map[string][]byte{
+		"prefix":     append([]byte{1}, form[1:]...),
+		"length":     form[:64],
+		"x ≥ p":      unreduced,
+		"∞ with x":   badInfinity,
+		"outside G₂": twistPointOutsideG2(t),
+	} {
+		if _, ok := new(G2).UnmarshalCompressed(m); ok {
+			t.Errorf("%s: %x accepted", name, m)
+		}
+	}
+
+	// Without a square root, no prefix is accepted.
+	for i := int64(1); i < 64; i++ {
+		x := &gfP2{big.NewInt(2), big.NewInt(i)}
+		yy := newGFp2(nil).Square(x, new(bnPool))
+		yy.Mul(yy, x, new(bnPool))
+		yy.Add(yy, twistB)
+		yy.Minimal()
+		if gfP2Sqrt(yy, new(bnPool)) != nil {
+			continue
+		}
+		m := make([]byte, 65)
+		m[0], m[32], m[64] = compressedOdd, 2, byte(i)
+		if _, ok := new(G2).UnmarshalCompressed(m); ok {
+			t.Errorf("%x accepted without a square root", m)
+		}
+		return
+	}
+	t.Error("no x without a square root")
+}
+
+func BenchmarkG2UnmarshalCompressed(b *testing.B) {
+	_, g, _ := RandomG2(rand.Reader)
+	form := g.MarshalCompressed()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		new(G2).UnmarshalCompressed(form)
+	}
+}
+
+func BenchmarkG2Unmarshal(b *testing.B) {
+	_, g, _ := RandomG2(rand.Reader)
+	form := g.Marshal()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		new(G2).Unmarshal(form)
+	}
+}
+
+func TestMapToG2(t *testing.T) {
+	pool := new(bnPool)
+	mapped := 0
+	for i := 1; i < 16; i++ {
+		x := make([]byte, 64)
+		x[31], x[63] = 5, byte(i)
+		e, ok := MapToG2(x)
+		if !ok {
+			continue
+		}
+		mapped++
+		if !e.p.MakeAffine(pool).InG2(pool) {
+			t.Fatalf("%x mapped outside of G₂", x)
+		}
+		if _, ok := new(G2).UnmarshalCompressed(e.MarshalCompressed()); !ok {
+			t.Fatalf("%x mapped to a point which does not unmarshal", x)
+		}
+		again, _ := MapToG2(x)
+		if !bytes.Equal(again.Marshal(), e.Marshal()) {
+			t.Fatalf("%x mapped to two points", x)
+		}
+	}
+	if mapped == 0 {
+		t.Fatal("no x mapped to G₂")
+	}
+
+	unreduced := make([]byte, 64)
+	copy(unreduced[32:], p.Bytes())
+	for name, x := range map[string][]byte{
+		"length": make([]byte, 63),
+		"x ≥ p":  unreduced,
+	} {
+		if _, ok := MapToG2(x); ok {
+			t.Errorf("%s: %x mapped", name, x)
+		}
+	}
+}
@@ -22,6 +22,9 @@ var p = bigFromBase10("650005496956466037327964387423599057428253581076230035718
 // Order is the number of elements in both G₁ and G₂: 36u⁴+36u³+18u²+6u+1.
 var Order = bigFromBase10("65000549695646603732796438742359905742570406053903786389881062969044166799969")
 
+// sixUSquared is 6u² = p-Order, the eigenvalue of the endomorphism ψ of the twist on G₂.
+var sixUSquared = bigFromBase10("254952053719217181996082057820017271814")
+
 // xiToPMinus1Over6 is ξ^((p-1)/6) where ξ = i+3.
 var xiToPMinus1Over6 = &gfP2{bigFromBase10("8669379979083712429711189836753509758585994370025260553045152614783263110636"), bigFromBase10("19998038925833620163537568958541907098007303196759855091367510456613536016040")}
 
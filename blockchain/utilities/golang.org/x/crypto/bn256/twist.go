@@ -256,3 +256,39 @@ func (c *twistPoint) Negative(a *twistPoint, pool *bnPool) {
 	c.z.Set(a.z)
 	c.t.SetZero()
 }
+
+// Psi sets c to ψ(a), the endomorphism of the twist which maps it to the full
+// GF(p¹²) group, applies the Frobenius there and maps it back, as in the Miller
+// loop. It multiplies the points of G₂ by p. a must be affine.
+func (c *twistPoint) Psi(a *twistPoint, pool *bnPool) *twistPoint {
+	c.x.Conjugate(a.x)
+	c.x.Mul(c.x, xiToPMinus1Over3, pool)
+	c.y.Conjugate(a.y)
+	c.y.Mul(c.y, xiToPMinus1Over2, pool)
+	c.z.SetOne()
+	c.t.SetOne()
+	return c
+}
+
+// InG2 returns true if the affine point c of the twist is in G₂, the subgroup
+// of order Order. Since p = 6u² mod Order, the points of G₂ satisfy
+// ψ(c) = 6u²·c and, on BN curves, no other point of the twist does. The test
+// takes a scalar of 128 bits instead of the 256 bits of Order·c = ∞.
+func (c *twistPoint) InG2(pool *bnPool) bool {
+	if c.IsInfinity() {
+		return true
+	}
+	psi := newTwistPoint(pool).Psi(c, pool)
+	defer psi.Put(pool)
+	m := newTwistPoint(pool).Mul(c, sixUSquared, pool)
+	defer m.Put(pool)
+	if m.IsInfinity() {
+		return false
+	}
+	m.MakeAffine(pool)
+	psi.x.Sub(psi.x, m.x)
+	psi.y.Sub(psi.y, m.y)
+	psi.x.Minimal()
+	psi.y.Minimal()
+	return psi.x.IsZero() && psi.y.IsZero()
+}
@@ -0,0 +1,76 @@
+package ledgerstub
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/protos/msp"
+)
+
+//attributesOID is the extension of the enrollment certificates in which the Fabric CA writes the attributes, read by lib/cid
+var attributesOID = asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}
+
+//Identity is a client of the channel, as enrolled by the Fabric CA of its organization
+type Identity struct {
+	MSPID string
+	Name  string
+	Attrs map[string]string
+
+	creator []byte //serialized msp identity, returned by GetCreator
+}
+
+//NewIdentity enrolls the client name of mspID with the attributes attrs, e.g. {"aav.role": "sp"}.
+//Its certificate is self-signed: the chaincode reads it with lib/cid but nothing validates it, as the peer would
+func NewIdentity(mspID string, name string, attrs map[string]string) (*Identity, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	subject := pkix.Name{CommonName: name, Organization: []string{mspID}}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      subject,
+		Issuer:       subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	if len(attrs) > 0 {
+		value, err := json.Marshal(map[string]map[string]string{"attrs": attrs})
+		if err != nil {
+			return nil, err
+		}
+		template.ExtraExtensions = []pkix.Extension{{Id: attributesOID, Value: value}}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	creator, err := proto.Marshal(&msp.SerializedIdentity{
+		Mspid:   mspID,
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{MSPID: mspID, Name: name, Attrs: attrs, creator: creator}, nil
+}
+
+//Creator returns the serialized identity, as the creator of the transactions of the client
+func (id *Identity) Creator() []byte {
+	return append([]byte(nil), id.creator...)
+}
@@ -0,0 +1,176 @@
+/*
+ Package ledgerstub runs a chaincode against an in-memory ledger, without peer nor Docker, so that it can be tested with go test.
+ Each Init, Invoke or Query is a transaction executed by a single peer. Like on the peer, the chaincode reads the committed state,
+ and its writes and its event are committed only if it succeeds. Queries are executed the same way but never committed.
+ The state, the history of the keys and the events can be inspected by the tests
+*/
+
+package ledgerstub
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+//txInterval is the time between two transactions, so that each one has its own timestamp
+const txInterval = time.Millisecond
+
+//Ledger is the state of a chaincode on a channel
+type Ledger struct {
+	Name      string //name of the chaincode, set in its events
+	ChannelID string
+
+	cc      shim.Chaincode
+	mu      sync.Mutex
+	state   map[string][]byte
+	private map[string]map[string][]byte //private data, by collection
+	history map[string][]*queryresult.KeyModification
+	events  []*pb.ChaincodeEvent
+	now     time.Time
+	txCount int
+}
+
+//New returns the empty ledger of the chaincode cc, named name on the channel "mychannel"
+func New(name string, cc shim.Chaincode) *Ledger {
+	return &Ledger{
+		Name:      name,
+		ChannelID: "mychannel",
+		cc:        cc,
+		state:     make(map[string][]byte),
+		private:   make(map[string]map[string][]byte),
+		history:   make(map[string][]*queryresult.KeyModification),
+		now:       time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+//Now returns the timestamp of the next transaction
+func (l *Ledger) Now() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.now
+}
+
+//Advance moves the clock of the ledger forward, e.g. to let a challenge expire
+func (l *Ledger) Advance(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.now = l.now.Add(d)
+}
+
+//Init instantiates or upgrades the chaincode, args are the function and its parameters
+func (l *Ledger) Init(id *Identity, args ...string) pb.Response {
+	return l.execute(true, "", id, args, true)
+}
+
+//Invoke submits a transaction with a fresh transaction ID
+func (l *Ledger) Invoke(id *Identity, args ...string) pb.Response {
+	return l.execute(false, "", id, args, true)
+}
+
+//InvokeTx submits a transaction with the given ID, for the functions which derive values from it
+func (l *Ledger) InvokeTx(txID string, id *Identity, args ...string) pb.Response {
+	return l.execute(false, txID, id, args, true)
+}
+
+//Query executes a transaction without committing it, like a client which only evaluates it
+func (l *Ledger) Query(id *Identity, args ...string) pb.Response {
+	return l.execute(false, "", id, args, false)
+}
+
+//execute runs a transaction and commits it if it succeeds and commit is true
+func (l *Ledger) execute(init bool, txID string, id *Identity, args []string, commit bool) pb.Response {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.txCount++
+	if txID == "" {
+		h := sha256.Sum256([]byte(l.Name + "/" + strconv.Itoa(l.txCount)))
+		txID = hex.EncodeToString(h[:])
+	}
+	stub := newStub(l, txID, id, args)
+	l.now = l.now.Add(txInterval)
+
+	var res pb.Response
+	if init {
+		res = l.cc.Init(stub)
+	} else {
+		res = l.cc.Invoke(stub)
+	}
+	if commit && res.Status < shim.ERRORTHRESHOLD {
+		l.commit(stub)
+	}
+	return res
+}
+
+//commit applies the write set and the event of the transaction
+func (l *Ledger) commit(stub *Stub) {
+	keys := make([]string, 0, len(stub.writes))
+	for key := range stub.writes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		w := stub.writes[key]
+		if w.isDelete {
+			delete(l.state, key)
+		} else {
+			l.state[key] = w.value
+		}
+		l.history[key] = append(l.history[key], &queryresult.KeyModification{
+			TxId:      stub.txID,
+			Value:     w.value,
+			Timestamp: stub.timestamp,
+			IsDelete:  w.isDelete,
+		})
+	}
+	for collection, writes := range stub.privateWrites {
+		if l.private[collection] == nil {
+			l.private[collection] = make(map[string][]byte)
+		}
+		for key, w := range writes {
+			if w.isDelete {
+				delete(l.private[collection], key)
+			} else {
+				l.private[collection][key] = w.value
+			}
+		}
+	}
+	if stub.event != nil {
+		l.events = append(l.events, stub.event)
+	}
+}
+
+//State returns the committed value of key, nil if it does not exist
+func (l *Ledger) State(key string) []byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.state[key]
+}
+
+//History returns the committed modifications of key, from the oldest to the newest like Fabric 1.4
+func (l *Ledger) History(key string) []*queryresult.KeyModification {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]*queryresult.KeyModification(nil), l.history[key]...)
+}
+
+//Events returns the events of the committed transactions, in their order
+func (l *Ledger) Events() []*pb.ChaincodeEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]*pb.ChaincodeEvent(nil), l.events...)
+}
+
+//toTimestamp converts t to the protobuf timestamp of the transactions
+func toTimestamp(t time.Time) *timestamp.Timestamp {
+	return &timestamp.Timestamp{Seconds: t.Unix(), Nanos: int32(t.Nanosecond())}
+}
@@ -0,0 +1,185 @@
+package ledgerstub
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+//kvChaincode writes its arguments, fails on demand, and returns what it reads
+type kvChaincode struct{}
+
+func (kvChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success(nil)
+}
+
+func (kvChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	function, args := stub.GetFunctionAndParameters()
+	switch function {
+	case "put": //key, value, and "fail" to fail after the write
+		stub.PutState(args[0], []byte(args[1]))
+		stub.SetEvent("put", []byte(args[0]))
+		if len(args) == 3 {
+			return shim.Error("failed")
+		}
+		value, _ := stub.GetState(args[0])
+		return shim.Success(value)
+	case "del":
+		stub.DelState(args[0])
+		return shim.Success(nil)
+	case "putComposite":
+		key, err := stub.CreateCompositeKey(args[0], args[1:len(args)-1])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		stub.PutState(key, []byte(args[len(args)-1]))
+		return shim.Success(nil)
+	case "whoami":
+		mspID, _ := cid.GetMSPID(stub)
+		role, _, _ := cid.GetAttributeValue(stub, "aav.role")
+		return shim.Success([]byte(mspID + "/" + role))
+	}
+	return shim.Error("unknown function")
+}
+
+//keys returns the keys of the results, nil if the query failed
+func keys(it shim.StateQueryIteratorInterface, err error) []string {
+	if err != nil {
+		return nil
+	}
+	defer it.Close()
+	res := []string{}
+	for it.HasNext() {
+		kv, err := it.Next()
+		if err != nil {
+			return nil
+		}
+		res = append(res, kv.Key)
+	}
+	return res
+}
+
+func TestLedger(t *testing.T) {
+	l := New("kv", kvChaincode{})
+	sp, err := NewIdentity("SPMSP", "sp1", map[string]string{"aav.role": "sp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := l.Init(sp); res.Status != shim.OK {
+		t.Fatal(res.Message)
+	}
+
+	//the writes of a transaction are not visible to its reads, and are committed if it succeeds
+	if res := l.Invoke(sp, "put", "a", "1"); res.Status != shim.OK || res.Payload != nil {
+		t.Fatalf("Uncommitted write visible: %v", res)
+	}
+	if string(l.State("a")) != "1" {
+		t.Fatal("Write not committed")
+	}
+	if res := l.Invoke(sp, "put", "a", "2", "fail"); res.Status == shim.OK || string(l.State("a")) != "1" {
+		t.Fatal("Write of a failed transaction committed")
+	}
+	if res := l.Query(sp, "put", "a", "3"); string(res.Payload) != "1" || string(l.State("a")) != "1" {
+		t.Fatal("Write of a query committed")
+	}
+	before := l.Now()
+	l.Advance(time.Hour)
+	l.InvokeTx("tx-b", sp, "put", "b", "1")
+	l.Invoke(sp, "del", "a")
+	if l.State("a") != nil {
+		t.Fatal("Delete not committed")
+	}
+
+	history := l.History("a")
+	if len(history) != 2 || string(history[0].Value) != "1" || !history[1].IsDelete {
+		t.Fatalf("Wrong history: %v", history)
+	}
+	if b := l.History("b"); b[0].TxId != "tx-b" || b[0].Timestamp.Seconds < before.Add(time.Hour).Unix() {
+		t.Fatalf("Wrong transaction of the history: %v", b)
+	}
+
+	//one event per committed transaction
+	events := l.Events()
+	if len(events) != 2 || string(events[0].Payload) != "a" || events[1].TxId != "tx-b" || events[1].ChaincodeId != "kv" {
+		t.Fatalf("Wrong events: %v", events)
+	}
+
+	if res := l.Invoke(sp, "whoami"); string(res.Payload) != "SPMSP/sp" {
+		t.Fatalf("Wrong identity: %s", res.Payload)
+	}
+	if res := l.Invoke(nil, "whoami"); string(res.Payload) != "/" {
+		t.Fatalf("Identity without creator: %s", res.Payload)
+	}
+}
+
+func TestQueries(t *testing.T) {
+	l := New("kv", kvChaincode{})
+	for _, kv := range [][]string{
+		{"put", "k1", `{"docType":"aav","aavVal":"x","n":1}`},
+		{"put", "k2", `{"docType":"aav","aavVal":"y","n":2}`},
+		{"put", "k3", `{"docType":"other","sub":{"n":3}}`},
+		{"putComposite", "issuer", "cp1", `{"docType":"issuer"}`},
+		{"putComposite", "issuer", "cp2", `{"docType":"issuer"}`},
+	} {
+		if res := l.Invoke(nil, kv...); res.Status != shim.OK {
+			t.Fatal(res.Message)
+		}
+	}
+	stub := newStub(l, "q", nil, nil)
+
+	if got := keys(stub.GetStateByRange("", "")); len(got) != 3 {
+		t.Fatalf("Composite keys in a range: %q", got)
+	}
+	if got := keys(stub.GetStateByRange("k2", "k3")); len(got) != 1 || got[0] != "k2" {
+		t.Fatalf("Wrong range: %q", got)
+	}
+	if _, err := stub.GetStateByRange("\x00issuer", ""); err == nil {
+		t.Fatal("Range of composite keys accepted")
+	}
+	if got := keys(stub.GetStateByPartialCompositeKey("issuer", nil)); len(got) != 2 {
+		t.Fatalf("Wrong partial composite key: %q", got)
+	}
+	objectType, attributes, _ := stub.SplitCompositeKey(keys(stub.GetStateByPartialCompositeKey("issuer", []string{"cp2"}))[0])
+	if objectType != "issuer" || len(attributes) != 1 || attributes[0] != "cp2" {
+		t.Fatal("Wrong split of a composite key")
+	}
+	if _, err := stub.CreateCompositeKey("issuer", []string{"a\x00b"}); err == nil {
+		t.Fatal("Separator accepted in a composite key")
+	}
+
+	for query, want := range map[string]int{
+		`{"selector":{"docType":"aav"}}`:                                   2,
+		`{"selector":{"docType":"aav","aavVal":"y"}}`:                      1,
+		`{"selector":{"n":{"$gte":2}}}`:                                    1,
+		`{"selector":{"sub.n":3}}`:                                         1,
+		`{"selector":{"docType":{"$in":["issuer","other"]}}}`:              3,
+		`{"selector":{"$or":[{"aavVal":"x"},{"docType":"other"}]}}`:        2,
+		`{"selector":{"n":{"$exists":false}},"use_index":["_design/a"]}`: 3,
+	} {
+		if got := keys(stub.GetQueryResult(query)); len(got) != want {
+			t.Fatalf("%s: %q", query, got)
+		}
+	}
+	if _, err := stub.GetQueryResult(`{"selector":{"n":{"$regex":"a"}}}`); err == nil {
+		t.Fatal("Unsupported operator accepted")
+	}
+
+	//pages of 2 over the 3 simple keys: the bookmark of the first page is the first key of the second one
+	page, metadata, err := stub.GetStateByRangeWithPagination("", "", 2, "")
+	if got := keys(page, err); len(got) != 2 || metadata.FetchedRecordsCount != 2 || metadata.Bookmark != "k3" {
+		t.Fatalf("Wrong first page: %q %v", got, metadata)
+	}
+	page, metadata, err = stub.GetStateByRangeWithPagination("", "", 2, metadata.Bookmark)
+	if got := keys(page, err); len(got) != 1 || metadata.Bookmark != "" {
+		t.Fatalf("Wrong last page: %q %v", got, metadata)
+	}
+
+	var doc map[string]interface{}
+	if json.Unmarshal(l.State("k3"), &doc) != nil {
+		t.Fatal("Value not committed as written")
+	}
+}
@@ -0,0 +1,284 @@
+package ledgerstub
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+//kvIterator iterates over a snapshot of keys, ordered like the state database
+type kvIterator struct {
+	kvs []*queryresult.KV
+	i   int
+}
+
+func (it *kvIterator) HasNext() bool {
+	return it.i < len(it.kvs)
+}
+
+func (it *kvIterator) Next() (*queryresult.KV, error) {
+	if !it.HasNext() {
+		return nil, errors.New("no more results")
+	}
+	it.i++
+	return it.kvs[it.i-1], nil
+}
+
+func (it *kvIterator) Close() error {
+	return nil
+}
+
+//historyIterator iterates over the modifications of a key
+type historyIterator struct {
+	modifications []*queryresult.KeyModification
+	i             int
+}
+
+func (it *historyIterator) HasNext() bool {
+	return it.i < len(it.modifications)
+}
+
+func (it *historyIterator) Next() (*queryresult.KeyModification, error) {
+	if !it.HasNext() {
+		return nil, errors.New("no more results")
+	}
+	it.i++
+	return it.modifications[it.i-1], nil
+}
+
+func (it *historyIterator) Close() error {
+	return nil
+}
+
+//newIterator returns the keys of state accepted by filter, in the order of the keys
+func newIterator(state map[string][]byte, filter func(key string, value []byte) bool) *kvIterator {
+	keys := []string{}
+	for key, value := range state {
+		if filter(key, value) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	it := &kvIterator{}
+	for _, key := range keys {
+		it.kvs = append(it.kvs, &queryresult.KV{Key: key, Value: state[key]})
+	}
+	return it
+}
+
+//newRangeIterator returns the simple keys in [startKey, endKey). The composite keys, which start with U+0000, are never in a range
+func newRangeIterator(state map[string][]byte, startKey, endKey string) *kvIterator {
+	return newIterator(state, func(key string, value []byte) bool {
+		return !strings.HasPrefix(key, compositeKeyNamespace) && key >= startKey && (endKey == "" || key < endKey)
+	})
+}
+
+//newPrefixIterator returns the composite keys starting with prefix
+func newPrefixIterator(state map[string][]byte, prefix string) *kvIterator {
+	return newIterator(state, func(key string, value []byte) bool {
+		return strings.HasPrefix(key, prefix)
+	})
+}
+
+//newQueryIterator returns the JSON values of state matched by the selector of the CouchDB query.
+//The other fields of the query (use_index, fields, sort...) are ignored
+func newQueryIterator(state map[string][]byte, query string) (*kvIterator, error) {
+	var q struct {
+		Selector map[string]interface{} `json:"selector"`
+	}
+	if err := json.Unmarshal([]byte(query), &q); err != nil {
+		return nil, errors.New("invalid query: " + err.Error())
+	}
+	if q.Selector == nil {
+		return nil, errors.New("invalid query: no selector")
+	}
+	var err error
+	it := newIterator(state, func(key string, value []byte) bool {
+		var doc map[string]interface{}
+		if json.Unmarshal(value, &doc) != nil {
+			return false
+		}
+		ok, e := match(doc, q.Selector)
+		if e != nil {
+			err = e
+		}
+		return ok
+	})
+	return it, err
+}
+
+//paginate returns the page of pageSize results which starts at the key bookmark, or at the first result if bookmark is empty.
+//The bookmark of the next page is the key following the page, empty after the last page
+func paginate(it *kvIterator, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	if pageSize <= 0 {
+		return nil, nil, errors.New("pageSize must be positive")
+	}
+	start := 0
+	if bookmark != "" {
+		start = sort.Search(len(it.kvs), func(i int) bool { return it.kvs[i].Key >= bookmark })
+	}
+	end := start + int(pageSize)
+	if end > len(it.kvs) {
+		end = len(it.kvs)
+	}
+	next := ""
+	if end < len(it.kvs) {
+		next = it.kvs[end].Key
+	}
+	page := &kvIterator{kvs: it.kvs[start:end]}
+	return page, &pb.QueryResponseMetadata{FetchedRecordsCount: int32(end - start), Bookmark: next}, nil
+}
+
+//match evaluates a CouchDB selector on doc. It supports the implicit equality, the dotted field names,
+//the operators $eq, $ne, $gt, $gte, $lt, $lte, $in, $nin, $exists, and the combinations $and, $or, $not
+func match(doc map[string]interface{}, selector map[string]interface{}) (bool, error) {
+	for field, cond := range selector {
+		var ok bool
+		var err error
+		switch field {
+		case "$and", "$or":
+			ok, err = matchCombination(doc, field, cond)
+		case "$not":
+			sub, isMap := cond.(map[string]interface{})
+			if !isMap {
+				return false, errors.New("invalid query: $not expects a selector")
+			}
+			ok, err = match(doc, sub)
+			ok = !ok
+		default:
+			value, found := lookup(doc, field)
+			ok, err = matchCondition(value, found, cond)
+		}
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+//matchCombination evaluates $and or $or on their array of selectors
+func matchCombination(doc map[string]interface{}, operator string, cond interface{}) (bool, error) {
+	selectors, isArray := cond.([]interface{})
+	if !isArray {
+		return false, errors.New("invalid query: " + operator + " expects an array")
+	}
+	for _, s := range selectors {
+		sub, isMap := s.(map[string]interface{})
+		if !isMap {
+			return false, errors.New("invalid query: " + operator + " expects selectors")
+		}
+		ok, err := match(doc, sub)
+		if err != nil {
+			return false, err
+		}
+		if operator == "$or" && ok {
+			return true, nil
+		}
+		if operator == "$and" && !ok {
+			return false, nil
+		}
+	}
+	return operator == "$and", nil
+}
+
+//matchCondition evaluates the condition of a field: a value for equality, or an object of operators
+func matchCondition(value interface{}, found bool, cond interface{}) (bool, error) {
+	operators, isMap := cond.(map[string]interface{})
+	if !isMap || len(operators) == 0 || !isOperator(operators) {
+		return found && reflect.DeepEqual(value, cond), nil
+	}
+	for operator, arg := range operators {
+		var ok bool
+		switch operator {
+		case "$eq":
+			ok = found && reflect.DeepEqual(value, arg)
+		case "$ne":
+			ok = !found || !reflect.DeepEqual(value, arg)
+		case "$gt", "$gte", "$lt", "$lte":
+			c, comparable := compare(value, arg)
+			ok = found && comparable && ((operator == "$gt" && c > 0) || (operator == "$gte" && c >= 0) ||
+				(operator == "$lt" && c < 0) || (operator == "$lte" && c <= 0))
+		case "$in", "$nin":
+			values, isArray := arg.([]interface{})
+			if !isArray {
+				return false, errors.New("invalid query: " + operator + " expects an array")
+			}
+			in := false
+			for _, v := range values {
+				if found && reflect.DeepEqual(value, v) {
+					in = true
+				}
+			}
+			ok = in == (operator == "$in")
+		case "$exists":
+			exists, isBool := arg.(bool)
+			if !isBool {
+				return false, errors.New("invalid query: $exists expects a boolean")
+			}
+			ok = found == exists
+		default:
+			return false, errors.New("invalid query: unsupported operator " + operator)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+//isOperator returns true if the keys of the object are operators, and not the fields of a sub-document
+func isOperator(object map[string]interface{}) bool {
+	for key := range object {
+		if !strings.HasPrefix(key, "$") {
+			return false
+		}
+	}
+	return true
+}
+
+//lookup returns the value of the dotted field name in doc
+func lookup(doc map[string]interface{}, field string) (interface{}, bool) {
+	var value interface{} = doc
+	for _, name := range strings.Split(field, ".") {
+		object, isMap := value.(map[string]interface{})
+		if !isMap {
+			return nil, false
+		}
+		var found bool
+		value, found = object[name]
+		if !found {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+//compare orders two numbers or two strings, it returns false if they cannot be compared
+func compare(a, b interface{}) (int, bool) {
+	switch x := a.(type) {
+	case float64:
+		y, ok := b.(float64)
+		if !ok {
+			return 0, false
+		}
+		if x < y {
+			return -1, true
+		} else if x > y {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(x, y), true
+	}
+	return 0, false
+}
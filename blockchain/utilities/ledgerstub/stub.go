@@ -0,0 +1,371 @@
+package ledgerstub
+
+import (
+	"crypto/sha256"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+//Composite keys are in their own namespace, they start with U+0000 and their attributes are separated by U+0000
+const (
+	compositeKeyNamespace = "\x00"
+	minUnicodeRuneValue   = rune(0)
+	maxUnicodeRuneValue   = utf8.MaxRune
+)
+
+//ErrNotSupported is returned by the functions of the stub which need other chaincodes or a real proposal
+var ErrNotSupported = errors.New("ledgerstub: not supported")
+
+//write is a pending update of the write set
+type write struct {
+	value    []byte
+	isDelete bool
+}
+
+//Stub is the shim.ChaincodeStubInterface given to the chaincode for one transaction
+type Stub struct {
+	ledger        *Ledger
+	txID          string
+	args          [][]byte
+	creator       []byte
+	timestamp     *timestamp.Timestamp
+	writes        map[string]write
+	privateWrites map[string]map[string]write
+	validation    map[string][]byte //key level endorsement policies, keys of private data are prefixed by their collection
+	event         *pb.ChaincodeEvent
+}
+
+var _ shim.ChaincodeStubInterface = (*Stub)(nil)
+
+//newStub prepares the transaction txID of the client id
+func newStub(l *Ledger, txID string, id *Identity, args []string) *Stub {
+	stub := &Stub{
+		ledger:        l,
+		txID:          txID,
+		timestamp:     toTimestamp(l.now),
+		writes:        make(map[string]write),
+		privateWrites: make(map[string]map[string]write),
+		validation:    make(map[string][]byte),
+	}
+	if id != nil {
+		stub.creator = id.Creator()
+	}
+	for _, arg := range args {
+		stub.args = append(stub.args, []byte(arg))
+	}
+	return stub
+}
+
+//GetArgs returns the arguments of the transaction, the function first
+func (s *Stub) GetArgs() [][]byte {
+	return s.args
+}
+
+//GetStringArgs returns the arguments as strings
+func (s *Stub) GetStringArgs() []string {
+	strargs := make([]string, 0, len(s.args))
+	for _, arg := range s.args {
+		strargs = append(strargs, string(arg))
+	}
+	return strargs
+}
+
+//GetFunctionAndParameters returns the first argument as the function and the others as its parameters
+func (s *Stub) GetFunctionAndParameters() (string, []string) {
+	allargs := s.GetStringArgs()
+	function := ""
+	params := []string{}
+	if len(allargs) >= 1 {
+		function = allargs[0]
+		params = allargs[1:]
+	}
+	return function, params
+}
+
+//GetArgsSlice returns the arguments concatenated
+func (s *Stub) GetArgsSlice() ([]byte, error) {
+	res := []byte{}
+	for _, arg := range s.args {
+		res = append(res, arg...)
+	}
+	return res, nil
+}
+
+//GetTxID returns the ID of the transaction
+func (s *Stub) GetTxID() string {
+	return s.txID
+}
+
+//GetChannelID returns the channel of the ledger
+func (s *Stub) GetChannelID() string {
+	return s.ledger.ChannelID
+}
+
+//InvokeChaincode is not supported, the ledger holds a single chaincode
+func (s *Stub) InvokeChaincode(chaincodeName string, args [][]byte, channel string) pb.Response {
+	return shim.Error(ErrNotSupported.Error())
+}
+
+//GetState returns the committed value of key: like on the peer, the writes of the transaction are not visible
+func (s *Stub) GetState(key string) ([]byte, error) {
+	return s.ledger.state[key], nil
+}
+
+//PutState adds the value of key to the write set
+func (s *Stub) PutState(key string, value []byte) error {
+	if key == "" {
+		return errors.New("key must not be an empty string")
+	}
+	s.writes[key] = write{value: value}
+	return nil
+}
+
+//DelState adds the deletion of key to the write set
+func (s *Stub) DelState(key string) error {
+	if key == "" {
+		return errors.New("key must not be an empty string")
+	}
+	s.writes[key] = write{isDelete: true}
+	return nil
+}
+
+//SetStateValidationParameter records the endorsement policy of key, it is not enforced
+func (s *Stub) SetStateValidationParameter(key string, ep []byte) error {
+	s.validation[key] = ep
+	return nil
+}
+
+//GetStateValidationParameter returns the endorsement policy of key set by the transaction
+func (s *Stub) GetStateValidationParameter(key string) ([]byte, error) {
+	return s.validation[key], nil
+}
+
+//GetStateByRange returns the simple keys in [startKey, endKey), an empty endKey is the end of the state
+func (s *Stub) GetStateByRange(startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	if err := validateSimpleKeys(startKey, endKey); err != nil {
+		return nil, err
+	}
+	return newRangeIterator(s.ledger.state, startKey, endKey), nil
+}
+
+//GetStateByRangeWithPagination returns a page of GetStateByRange, bookmark is the first key of the page
+func (s *Stub) GetStateByRangeWithPagination(startKey, endKey string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	if err := validateSimpleKeys(startKey, endKey); err != nil {
+		return nil, nil, err
+	}
+	return paginate(newRangeIterator(s.ledger.state, startKey, endKey), pageSize, bookmark)
+}
+
+//GetStateByPartialCompositeKey returns the composite keys of objectType starting with the attributes keys
+func (s *Stub) GetStateByPartialCompositeKey(objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	prefix, err := s.CreateCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, err
+	}
+	return newPrefixIterator(s.ledger.state, prefix), nil
+}
+
+//GetStateByPartialCompositeKeyWithPagination returns a page of GetStateByPartialCompositeKey
+func (s *Stub) GetStateByPartialCompositeKeyWithPagination(objectType string, keys []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	prefix, err := s.CreateCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	return paginate(newPrefixIterator(s.ledger.state, prefix), pageSize, bookmark)
+}
+
+//CreateCompositeKey returns the key of objectType and attributes, in the format of the shim
+func (s *Stub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	if err := validateCompositeKeyAttribute(objectType); err != nil {
+		return "", err
+	}
+	ck := compositeKeyNamespace + objectType + string(minUnicodeRuneValue)
+	for _, att := range attributes {
+		if err := validateCompositeKeyAttribute(att); err != nil {
+			return "", err
+		}
+		ck += att + string(minUnicodeRuneValue)
+	}
+	return ck, nil
+}
+
+//SplitCompositeKey returns the object type and the attributes of compositeKey
+func (s *Stub) SplitCompositeKey(compositeKey string) (string, []string, error) {
+	if !strings.HasPrefix(compositeKey, compositeKeyNamespace) {
+		return "", nil, errors.New("not a composite key: " + compositeKey)
+	}
+	components := strings.Split(compositeKey[1:], string(minUnicodeRuneValue))
+	if len(components) < 2 {
+		return "", nil, errors.New("not a composite key: " + compositeKey)
+	}
+	return components[0], components[1 : len(components)-1], nil
+}
+
+//GetQueryResult executes a CouchDB query on the state, see match for the supported selectors
+func (s *Stub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	it, err := newQueryIterator(s.ledger.state, query)
+	if err != nil {
+		return nil, err
+	}
+	return it, nil
+}
+
+//GetQueryResultWithPagination returns a page of GetQueryResult
+func (s *Stub) GetQueryResultWithPagination(query string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	it, err := newQueryIterator(s.ledger.state, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	return paginate(it, pageSize, bookmark)
+}
+
+//GetHistoryForKey returns the committed modifications of key, from the oldest to the newest
+func (s *Stub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	return &historyIterator{modifications: s.ledger.history[key]}, nil
+}
+
+//GetPrivateData returns the committed value of key in collection
+func (s *Stub) GetPrivateData(collection, key string) ([]byte, error) {
+	if collection == "" {
+		return nil, errors.New("collection must not be an empty string")
+	}
+	return s.ledger.private[collection][key], nil
+}
+
+//GetPrivateDataHash returns the hash of the committed value of key in collection, nil if it does not exist
+func (s *Stub) GetPrivateDataHash(collection, key string) ([]byte, error) {
+	value, err := s.GetPrivateData(collection, key)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	h := sha256.Sum256(value)
+	return h[:], nil
+}
+
+//PutPrivateData adds the value of key in collection to the write set
+func (s *Stub) PutPrivateData(collection string, key string, value []byte) error {
+	return s.writePrivate(collection, key, write{value: value})
+}
+
+//DelPrivateData adds the deletion of key in collection to the write set
+func (s *Stub) DelPrivateData(collection, key string) error {
+	return s.writePrivate(collection, key, write{isDelete: true})
+}
+
+func (s *Stub) writePrivate(collection, key string, w write) error {
+	if collection == "" {
+		return errors.New("collection must not be an empty string")
+	}
+	if key == "" {
+		return errors.New("key must not be an empty string")
+	}
+	if s.privateWrites[collection] == nil {
+		s.privateWrites[collection] = make(map[string]write)
+	}
+	s.privateWrites[collection][key] = w
+	return nil
+}
+
+//SetPrivateDataValidationParameter records the endorsement policy of key in collection, it is not enforced
+func (s *Stub) SetPrivateDataValidationParameter(collection, key string, ep []byte) error {
+	s.validation[collection+compositeKeyNamespace+key] = ep
+	return nil
+}
+
+//GetPrivateDataValidationParameter returns the endorsement policy of key in collection set by the transaction
+func (s *Stub) GetPrivateDataValidationParameter(collection, key string) ([]byte, error) {
+	return s.validation[collection+compositeKeyNamespace+key], nil
+}
+
+//GetPrivateDataByRange returns the keys of collection in [startKey, endKey)
+func (s *Stub) GetPrivateDataByRange(collection, startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	if err := validateSimpleKeys(startKey, endKey); err != nil {
+		return nil, err
+	}
+	return newRangeIterator(s.ledger.private[collection], startKey, endKey), nil
+}
+
+//GetPrivateDataByPartialCompositeKey returns the composite keys of collection of objectType starting with the attributes keys
+func (s *Stub) GetPrivateDataByPartialCompositeKey(collection, objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	prefix, err := s.CreateCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, err
+	}
+	return newPrefixIterator(s.ledger.private[collection], prefix), nil
+}
+
+//GetPrivateDataQueryResult executes a CouchDB query on collection
+func (s *Stub) GetPrivateDataQueryResult(collection, query string) (shim.StateQueryIteratorInterface, error) {
+	it, err := newQueryIterator(s.ledger.private[collection], query)
+	if err != nil {
+		return nil, err
+	}
+	return it, nil
+}
+
+//GetCreator returns the serialized identity of the client, nil if the transaction has no identity
+func (s *Stub) GetCreator() ([]byte, error) {
+	return s.creator, nil
+}
+
+//GetTransient returns an empty transient map
+func (s *Stub) GetTransient() (map[string][]byte, error) {
+	return map[string][]byte{}, nil
+}
+
+//GetBinding is not supported, there is no proposal
+func (s *Stub) GetBinding() ([]byte, error) {
+	return nil, ErrNotSupported
+}
+
+//GetDecorations returns no decoration
+func (s *Stub) GetDecorations() map[string][]byte {
+	return map[string][]byte{}
+}
+
+//GetSignedProposal is not supported, there is no proposal
+func (s *Stub) GetSignedProposal() (*pb.SignedProposal, error) {
+	return nil, ErrNotSupported
+}
+
+//GetTxTimestamp returns the timestamp of the transaction, given by the clock of the ledger
+func (s *Stub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return s.timestamp, nil
+}
+
+//SetEvent sets the event of the transaction, a second call replaces it like on the peer
+func (s *Stub) SetEvent(name string, payload []byte) error {
+	if name == "" {
+		return errors.New("event name can not be nil string")
+	}
+	s.event = &pb.ChaincodeEvent{ChaincodeId: s.ledger.Name, TxId: s.txID, EventName: name, Payload: payload}
+	return nil
+}
+
+//validateSimpleKeys rejects the composite keys in the range queries
+func validateSimpleKeys(simpleKeys ...string) error {
+	for _, key := range simpleKeys {
+		if len(key) > 0 && key[0] == compositeKeyNamespace[0] {
+			return errors.New("first character of the key [" + key + "] contains a null character which is not allowed")
+		}
+	}
+	return nil
+}
+
+//validateCompositeKeyAttribute rejects the attributes which are not valid UTF-8 or contain the separator
+func validateCompositeKeyAttribute(str string) error {
+	if !utf8.ValidString(str) {
+		return errors.New("not a valid utf8 string: [" + str + "]")
+	}
+	for _, r := range str {
+		if r == minUnicodeRuneValue || r == maxUnicodeRuneValue {
+			return errors.New("U+0000 and U+10FFFF are not allowed in the input attribute of a composite key")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package wire
+
+import "errors"
+
+//Major types of CBOR (RFC 8949) used by the encoding
+const (
+	majorUnsigned = 0
+	majorBytes    = 2
+	majorArray    = 4
+	majorTag      = 6
+)
+
+//selfDescribeTag is the CBOR tag 55799, which marks the data as CBOR. Its encoding d9 d9 f7 starts every encoded value
+const selfDescribeTag = 55799
+
+var (
+	errTruncated    = errors.New("wire: truncated value")
+	errNonCanonical = errors.New("wire: non canonical encoding")
+	errIndefinite   = errors.New("wire: indefinite lengths are not allowed")
+	errUnexpected   = errors.New("wire: unexpected CBOR item")
+)
+
+//appendHead appends the head of a CBOR item of the major type, with the argument n in its shortest form
+func appendHead(b []byte, major byte, n uint64) []byte {
+	m := major << 5
+	switch {
+	case n < 24:
+		return append(b, m|byte(n))
+	case n <= 0xff:
+		return append(b, m|24, byte(n))
+	case n <= 0xffff:
+		return append(b, m|25, byte(n>>8), byte(n))
+	case n <= 0xffffffff:
+		return append(b, m|26, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(b, m|27, byte(n>>56), byte(n>>48), byte(n>>40), byte(n>>32), byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+//decoder reads CBOR items from a buffer and rejects everything but the canonical encoding of the expected items
+type decoder struct {
+	b []byte
+}
+
+//head reads the head of an item which must be of the major type, and returns its argument
+func (d *decoder) head(major byte) (uint64, error) {
+	if len(d.b) == 0 {
+		return 0, errTruncated
+	}
+	if d.b[0]>>5 != major {
+		return 0, errUnexpected
+	}
+	info := d.b[0] & 0x1f
+	d.b = d.b[1:]
+	if info < 24 {
+		return uint64(info), nil
+	}
+	if info == 31 {
+		return 0, errIndefinite
+	}
+	if info > 27 {
+		return 0, errUnexpected
+	}
+	size := 1 << (info - 24)
+	if len(d.b) < size {
+		return 0, errTruncated
+	}
+	var n uint64
+	for _, c := range d.b[:size] {
+		n = n<<8 | uint64(c)
+	}
+	d.b = d.b[size:]
+	//the argument must not fit in a shorter head
+	if (size == 1 && n < 24) || (size > 1 && n < 1<<(4*uint(size))) {
+		return 0, errNonCanonical
+	}
+	return n, nil
+}
+
+//bytes reads a byte string
+func (d *decoder) bytes() ([]byte, error) {
+	n, err := d.head(majorBytes)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(d.b)) < n {
+		return nil, errTruncated
+	}
+	res := append([]byte(nil), d.b[:n]...)
+	d.b = d.b[n:]
+	return res, nil
+}
@@ -0,0 +1,312 @@
+//Package wire is the versioned, self-describing encoding of the keys, commitments, proofs and certificates
+//exchanged by the go service and the chaincode.
+//
+//A value is the CBOR (RFC 8949) data item
+//  55799([version, type, curve, payload])
+//where the self-describe tag 55799 marks the data as CBOR, version is Version, type and curve identify what the value is
+//and which curve it belongs to, and payload is the legacy binary form of the value, ie the output of its Marshal function.
+//The bn256 points of a payload may instead be compressed, the output of MarshalCompressed, which halves the size of
+//the presentations. The decoding is strict: only the canonical encoding of this item is accepted, with nothing after it,
+//and the payload must have the size of its type, uncompressed or compressed.
+//
+//In JSON and in the chaincode arguments a value is hexadecimal. Parse accepts both the encoded value and the legacy
+//hexadecimal form of the payload, and tells them apart by the type it expects. An encoded value starts with d9d9f7.
+//The legacy points, proofs and credentials never do: they start with a coordinate lower than the prime of bn256, with
+//the prefix of a compressed or uncompressed point, or with an attribute count. A legacy scalar may, a P-256 scalar or
+//a scalar whose leading zeros were trimmed, but it is never longer than its size while an encoded scalar always is.
+//The legacy form of a disclosure starts with its mask, and is read as such when it does not decode.
+package wire
+
+import (
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+//Version is the version of the encoding
+const Version = 1
+
+//Curve identifies the curve of a value
+type Curve uint
+
+//Curves of the values
+const (
+	//BN256 is the pairing friendly curve of golang.org/x/crypto/bn256, of the certificates and of the accumulators
+	BN256 Curve = 1
+	//P256 is the NIST curve of the commitments, of the zero knowledge proofs and of the signatures of the IV
+	P256 Curve = 2
+)
+
+//Type identifies what a value is
+type Type uint
+
+//Types of the values of the BN256 curve
+const (
+	//IssuerKey is the private key of a CP (scalar)
+	IssuerKey Type = 1
+	//IssuerPublicKey is the public key of a CP (G1), or its blinded form in a presentation
+	IssuerPublicKey Type = 2
+	//HolderKey is the pairing private key of a user (scalar)
+	HolderKey Type = 3
+	//HolderPublicKey is the pairing public key of a user (G2), or its blinded form in a presentation
+	HolderPublicKey Type = 4
+	//Certificate is a certificate issued by a CP (G2), or its blinded form in a presentation
+	Certificate Type = 5
+	//Credential is a certificate with its commitment and attribute count
+	Credential Type = 6
+	//BlindedPresentation is a blinded certificate with its blinded keys and generator
+	BlindedPresentation Type = 7
+	//BlindingSecret is the blinding factor and the blinded private key of a presentation
+	BlindingSecret Type = 8
+	//PresentationProof is the proof of knowledge of a presentation, followed by its issuer proof
+	PresentationProof Type = 9
+	//IssuerProof proves that the blinded issuer key of a presentation is derived from a registered CP
+	IssuerProof Type = 10
+	//MembershipProof proves that a certificate is not revoked in an accumulator
+	MembershipProof Type = 11
+	//AccumulatorPublicKey is the public key of an accumulator (G2)
+	AccumulatorPublicKey Type = 12
+	//AccumulatorValue is the value of an accumulator, or a witness (G1)
+	AccumulatorValue Type = 13
+	//RevocationHandle is the handle of a certificate in an accumulator (scalar)
+	RevocationHandle Type = 14
+	//BlindCommitment is the blinded hash of the commitment of a presentation (scalar)
+	BlindCommitment Type = 15
+	//G1Point is another point of G1, such as the blinded generator of a presentation
+	G1Point Type = 16
+	//G2Point is another point of G2
+	G2Point Type = 17
+	//AttributeKeyProof proves that an attribute key, certified instead of the public key of a user, holds the attributes of a commitment
+	AttributeKeyProof Type = 18
+	//AttributeProof proves that disclosed attributes are certified in a presentation of an attribute key, followed by its issuer proof
+	AttributeProof Type = 19
+	//Disclosure is a disclosure mask with its disclosed attributes and their attribute proof. It replaces the type 39,
+	//which sent the commitment of the attributes in clear
+	Disclosure Type = 20
+)
+
+//Types of the values of the P256 curve
+const (
+	//PrivateKey is an ECDSA private key (scalar)
+	PrivateKey Type = 32
+	//PublicKey is an ECDSA public key or another point, uncompressed
+	PublicKey Type = 33
+	//Commitment is a Pedersen commitment of attributes or of a value (point)
+	Commitment Type = 34
+	//Scalar is a random, a secret or the response of a proof of knowledge
+	Scalar Type = 35
+	//OpeningProof proves the knowledge of the opening of a commitment
+	OpeningProof Type = 36
+	//DisclosureProof proves that attributes are committed in a commitment
+	DisclosureProof Type = 37
+	//RangeProof proves that an integer attribute of a commitment is above a threshold
+	RangeProof Type = 38
+)
+
+//typeInfo describes a type: its name, its curve and the size of its payload, 0 if it is variable.
+//compressed is the size of the payload with compressed bn256 points, 0 if the type has no such form
+type typeInfo struct {
+	name       string
+	curve      Curve
+	size       int
+	compressed int
+	scalar     bool
+}
+
+var types = map[Type]typeInfo{
+	IssuerKey:            {"IssuerKey", BN256, 32, 0, true},
+	IssuerPublicKey:      {"IssuerPublicKey", BN256, 64, 33, false},
+	HolderKey:            {"HolderKey", BN256, 32, 0, true},
+	HolderPublicKey:      {"HolderPublicKey", BN256, 128, 65, false},
+	Certificate:          {"Certificate", BN256, 128, 65, false},
+	Credential:           {"Credential", BN256, 0, 0, false},
+	BlindedPresentation:  {"BlindedPresentation", BN256, 4 + 32 + 2*64 + 2*128, 4 + 32 + 2*33 + 2*65, false},
+	BlindingSecret:       {"BlindingSecret", BN256, 2 * 32, 0, false},
+	PresentationProof:    {"PresentationProof", BN256, 64 + 128 + 2*32 + 2*64 + 32, 33 + 65 + 2*32 + 2*33 + 32, false},
+	IssuerProof:          {"IssuerProof", BN256, 2*64 + 32, 2*33 + 32, false},
+	MembershipProof:      {"MembershipProof", BN256, 2*64 + 2*128, 2*33 + 2*65, false},
+	AccumulatorPublicKey: {"AccumulatorPublicKey", BN256, 128, 65, false},
+	AccumulatorValue:     {"AccumulatorValue", BN256, 64, 33, false},
+	RevocationHandle:     {"RevocationHandle", BN256, 32, 0, true},
+	BlindCommitment:      {"BlindCommitment", BN256, 32, 0, true},
+	G1Point:              {"G1Point", BN256, 64, 33, false},
+	G2Point:              {"G2Point", BN256, 128, 65, false},
+	AttributeKeyProof:    {"AttributeKeyProof", BN256, 0, 0, false},
+	AttributeProof:       {"AttributeProof", BN256, 0, 0, false},
+	Disclosure:           {"Disclosure", BN256, 0, 0, false},
+	PrivateKey:           {"PrivateKey", P256, 32, 0, true},
+	PublicKey:            {"PublicKey", P256, 65, 0, false},
+	Commitment:           {"Commitment", P256, 65, 0, false},
+	Scalar:               {"Scalar", P256, 32, 0, true},
+	OpeningProof:         {"OpeningProof", P256, 0, 0, false},
+	DisclosureProof:      {"DisclosureProof", P256, 0, 0, false},
+	RangeProof:           {"RangeProof", P256, 0, 0, false},
+}
+
+func (t Type) String() string {
+	if info, ok := types[t]; ok {
+		return info.name
+	}
+	return "Type(" + strconv.FormatUint(uint64(t), 10) + ")"
+}
+
+//Curve returns the curve of the values of type t
+func (t Type) Curve() Curve {
+	return types[t].curve
+}
+
+func (c Curve) String() string {
+	switch c {
+	case BN256:
+		return "BN256"
+	case P256:
+		return "P256"
+	}
+	return "Curve(" + strconv.FormatUint(uint64(c), 10) + ")"
+}
+
+//prefix is the hexadecimal encoding of the self-describe tag, which starts every encoded value
+const prefix = "d9d9f7"
+
+var (
+	errVersion     = errors.New("wire: unsupported version")
+	errUnknownType = errors.New("wire: unknown type")
+	errSize        = errors.New("wire: payload has a wrong size")
+	errTrailing    = errors.New("wire: data after the value")
+	errOddLength   = errors.New("wire: odd number of digits in a value of a fixed size")
+)
+
+//Marshal encodes payload, the binary form of a value of type t. A scalar shorter than its size is padded with zeros
+func Marshal(t Type, payload []byte) ([]byte, error) {
+	info, ok := types[t]
+	if !ok {
+		return nil, errUnknownType
+	}
+	if info.scalar && len(payload) < info.size {
+		payload = append(make([]byte, info.size-len(payload)), payload...)
+	}
+	if err := checkSize(info, payload); err != nil {
+		return nil, err
+	}
+	res := appendHead(make([]byte, 0, 16+len(payload)), majorTag, selfDescribeTag)
+	res = appendHead(res, majorArray, 4)
+	res = appendHead(res, majorUnsigned, Version)
+	res = appendHead(res, majorUnsigned, uint64(t))
+	res = appendHead(res, majorUnsigned, uint64(info.curve))
+	res = appendHead(res, majorBytes, uint64(len(payload)))
+	return append(res, payload...), nil
+}
+
+//Decode decodes the value m and returns its type and payload. The curve of m must be the one of its type
+func Decode(m []byte) (Type, []byte, error) {
+	d := decoder{m}
+	if tag, err := d.head(majorTag); err != nil {
+		return 0, nil, err
+	} else if tag != selfDescribeTag {
+		return 0, nil, errUnexpected
+	}
+	if n, err := d.head(majorArray); err != nil {
+		return 0, nil, err
+	} else if n != 4 {
+		return 0, nil, errUnexpected
+	}
+	var fields [3]uint64
+	for i := range fields {
+		var err error
+		if fields[i], err = d.head(majorUnsigned); err != nil {
+			return 0, nil, err
+		}
+	}
+	if fields[0] != Version {
+		return 0, nil, errVersion
+	}
+	t := Type(fields[1])
+	info, ok := types[t]
+	if !ok || uint64(t) != fields[1] {
+		return 0, nil, errUnknownType
+	}
+	if Curve(fields[2]) != info.curve || uint64(info.curve) != fields[2] {
+		return 0, nil, errors.New("wire: " + t.String() + " is not a value of " + Curve(fields[2]).String())
+	}
+	payload, err := d.bytes()
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(d.b) != 0 {
+		return 0, nil, errTrailing
+	}
+	if err := checkSize(info, payload); err != nil {
+		return 0, nil, err
+	}
+	return t, payload, nil
+}
+
+//Unmarshal decodes the value m, which must be of type t, and returns its payload
+func Unmarshal(m []byte, t Type) ([]byte, error) {
+	got, payload, err := Decode(m)
+	if err != nil {
+		return nil, err
+	}
+	if got != t {
+		return nil, errors.New("wire: expecting " + t.String() + ", got " + got.String())
+	}
+	return payload, nil
+}
+
+//checkSize checks the size of the payload of a value
+func checkSize(info typeInfo, payload []byte) error {
+	if (info.size != 0 && len(payload) != info.size && len(payload) != info.compressed) || len(payload) == 0 {
+		return errSize
+	}
+	return nil
+}
+
+//EncodeToString returns the hexadecimal encoding of the value of type t
+func EncodeToString(t Type, payload []byte) (string, error) {
+	m, err := Marshal(t, payload)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(m), nil
+}
+
+//IsEncoded returns true if the hexadecimal string s is an encoded value, and not a legacy one
+func IsEncoded(s string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+//Parse returns the payload of the hexadecimal string s, which is either an encoded value of type t or the legacy
+//hexadecimal form of the payload. The encoded value is decoded strictly. The legacy form is read as before, except that
+//a value of a fixed size must have an even number of digits: the others are padded with a leading zero
+func Parse(s string, t Type) ([]byte, error) {
+	info := types[t]
+	if !IsEncoded(s) {
+		return legacyHexToByte(s, info)
+	}
+	m, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	//an encoded scalar is longer than its size, a legacy one starting with the prefix is not
+	if info.scalar && len(m) <= info.size {
+		return m, nil
+	}
+	payload, err := Unmarshal(m, t)
+	if err != nil && t == Disclosure {
+		//the mask of a legacy disclosure may start with the prefix
+		return m, nil
+	}
+	return payload, err
+}
+
+//legacyHexToByte converts the legacy hexadecimal form of a value of type info, like HexToByte of converterhex and util
+func legacyHexToByte(s string, info typeInfo) ([]byte, error) {
+	if len(s)%2 == 1 {
+		if info.size != 0 {
+			return nil, errOddLength
+		}
+		s = "0" + s
+	}
+	return hex.DecodeString(s)
+}
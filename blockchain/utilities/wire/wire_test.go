@@ -0,0 +1,187 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+//the encoding of the version 1 must never change: values encoded today are decoded by the later versions
+func TestGolden(t *testing.T) {
+	scalar := bytes.Repeat([]byte{0x01}, 32)
+	for _, tc := range []struct {
+		t       Type
+		payload []byte
+		want    string
+	}{
+		{IssuerKey, scalar, "d9d9f7840101015820" + strings.Repeat("01", 32)},
+		{IssuerKey, []byte{0x2a}, "d9d9f7840101015820" + strings.Repeat("00", 31) + "2a"},
+		{Commitment, append([]byte{4}, make([]byte, 64)...), "d9d9f784011822025841" + "04" + strings.Repeat("00", 64)},
+		{HolderPublicKey, make([]byte, 128), "d9d9f7840104015880" + strings.Repeat("00", 128)},
+		{Credential, make([]byte, 300), "d9d9f78401060159012c" + strings.Repeat("00", 300)},
+	} {
+		got, err := EncodeToString(tc.t, tc.payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Fatalf("Wrong encoding of %v:\n%s\n%s", tc.t, got, tc.want)
+		}
+		payload, err := Parse(got, tc.t)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(payload) != len(tc.payload) && tc.t != IssuerKey {
+			t.Fatalf("Wrong payload of %v", tc.t)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for typ, info := range types {
+		size := info.size
+		if size == 0 {
+			size = 1000
+		}
+		payload := bytes.Repeat([]byte{byte(typ)}, size)
+		m, err := Marshal(typ, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, decoded, err := Decode(m)
+		if err != nil || got != typ || !bytes.Equal(decoded, payload) {
+			t.Fatalf("%v: %v", typ, err)
+		}
+		if typ.Curve() != info.curve || typ.String() != info.name {
+			t.Fatalf("Wrong description of %v", typ)
+		}
+		if _, err := Marshal(typ, append(payload, 0)); info.size != 0 && err == nil {
+			t.Fatalf("%v: payload of a wrong size accepted", typ)
+		}
+		//the compressed form of the points, and only of the points
+		compressed := make([]byte, info.compressed)
+		if _, err := Marshal(typ, append(compressed, 1)); info.size != 0 && !info.scalar && err == nil {
+			t.Fatalf("%v: payload of a wrong size accepted", typ)
+		}
+		if info.compressed == 0 {
+			continue
+		}
+		if _, err := Marshal(typ, compressed); err != nil {
+			t.Fatalf("%v: compressed payload rejected: %v", typ, err)
+		}
+	}
+	if _, err := Marshal(Type(99), []byte{1}); err == nil {
+		t.Fatal("Unknown type accepted")
+	}
+	if _, err := Marshal(Credential, nil); err == nil {
+		t.Fatal("Empty payload accepted")
+	}
+}
+
+func TestStrictDecoding(t *testing.T) {
+	valid := "d9d9f7840101015820" + strings.Repeat("01", 32)
+	for name, s := range map[string]string{
+		"truncated":          valid[:len(valid)-2],
+		"trailing data":      valid + "00",
+		"other tag":          "d9d9f6" + valid[6:],
+		"no tag":             valid[6:],
+		"array of 3":         "d9d9f783010101" + "5820" + strings.Repeat("01", 32),
+		"version 2":          "d9d9f7840201015820" + strings.Repeat("01", 32),
+		"unknown type":       "d9d9f784011863015820" + strings.Repeat("01", 32),
+		"wrong curve":        "d9d9f7840101025820" + strings.Repeat("01", 32),
+		"non canonical int":  "d9d9f784180101015820" + strings.Repeat("01", 32),
+		"non canonical size": "d9d9f78401010159002" + "0" + strings.Repeat("01", 32),
+		"indefinite bytes":   "d9d9f7840101015f5820" + strings.Repeat("01", 32) + "ff",
+		"indefinite array":   "d9d9f79f0101015820" + strings.Repeat("01", 32) + "ff",
+		"short scalar":       "d9d9f784010101581f" + strings.Repeat("01", 31),
+		"text payload":       "d9d9f7840101017820" + strings.Repeat("01", 32),
+	} {
+		m, err := hex.DecodeString(s)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, _, err := Decode(m); err == nil {
+			t.Fatalf("%s: accepted", name)
+		}
+	}
+	if _, err := Parse(valid, IssuerPublicKey); err == nil {
+		t.Fatal("Value of another type accepted")
+	}
+	if _, err := Parse(valid[:7], IssuerKey); err == nil {
+		t.Fatal("Odd number of digits accepted in an encoded value")
+	}
+}
+
+//the legacy hexadecimal form is still accepted, as it was read before
+func TestLegacy(t *testing.T) {
+	for s, want := range map[string]string{
+		"":       "",
+		"0a1b":   "0a1b",
+		"304455": "304455",
+	} {
+		got, err := Parse(s, Scalar)
+		if err != nil || hex.EncodeToString(got) != want {
+			t.Fatalf("%q: %x %v", s, got, err)
+		}
+		if IsEncoded(s) {
+			t.Fatalf("%q is encoded", s)
+		}
+	}
+	if _, err := Parse("0g", Scalar); err == nil {
+		t.Fatal("Invalid digit accepted")
+	}
+	//only the values of a variable size are padded
+	if got, err := Parse("A1B", OpeningProof); err != nil || hex.EncodeToString(got) != "0a1b" {
+		t.Fatalf("Odd number of digits: %x %v", got, err)
+	}
+	for _, typ := range []Type{Scalar, IssuerKey, Commitment, Certificate} {
+		if _, err := Parse("A1B", typ); err == nil {
+			t.Fatalf("Odd number of digits accepted in a %v", typ)
+		}
+	}
+	if !IsEncoded("D9D9F7") {
+		t.Fatal("Upper case encoded value not recognized")
+	}
+}
+
+//a legacy scalar or disclosure may start with the prefix of the encoded values
+func TestLegacyPrefix(t *testing.T) {
+	scalar := "d9d9f7" + strings.Repeat("01", 29)
+	for _, typ := range []Type{Scalar, PrivateKey, HolderKey, RevocationHandle} {
+		for _, s := range []string{scalar, scalar[:20]} {
+			got, err := Parse(s, typ)
+			if err != nil || hex.EncodeToString(got) != s {
+				t.Fatalf("Legacy %v %s: %x %v", typ, s, got, err)
+			}
+		}
+		encoded, err := EncodeToString(typ, bytes.Repeat([]byte{0x01}, 32))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := Parse(encoded, typ); err != nil || !bytes.Equal(got, bytes.Repeat([]byte{0x01}, 32)) {
+			t.Fatalf("Encoded %v: %x %v", typ, got, err)
+		}
+		//longer than a scalar, it is an encoded value which must decode
+		if _, err := Parse(scalar+"0101010101", typ); err == nil {
+			t.Fatalf("Malformed encoded %v accepted", typ)
+		}
+	}
+
+	//a disclosure of 32 attributes starts with its mask
+	disclosure := "d9d9f7ff" + strings.Repeat("00", 100)
+	if got, err := Parse(disclosure, Disclosure); err != nil || hex.EncodeToString(got) != disclosure {
+		t.Fatalf("Legacy disclosure: %x %v", got, err)
+	}
+	encoded, err := EncodeToString(Disclosure, []byte{0xd9, 0xd9, 0xf7, 0xff})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := Parse(encoded, Disclosure); err != nil || hex.EncodeToString(got) != "d9d9f7ff" {
+		t.Fatalf("Encoded disclosure: %x %v", got, err)
+	}
+	//the other legacy values never start with the prefix
+	if _, err := Parse("d9d9f7"+strings.Repeat("00", 61), Commitment); err == nil {
+		t.Fatal("Malformed encoded commitment accepted")
+	}
+}
@@ -15,16 +15,22 @@ import java.security.spec.EncodedKeySpec;
 import java.security.spec.InvalidKeySpecException;
 import java.security.spec.PKCS8EncodedKeySpec;
 import java.util.Collection;
+import java.util.HashMap;
 import java.util.LinkedList;
+import java.util.Map;
 import java.util.Properties;
 import java.util.concurrent.CompletableFuture;
 import java.util.concurrent.CompletionException;
 import java.util.concurrent.TimeUnit;
+import java.util.regex.Pattern;
 
 import org.apache.commons.codec.binary.Base64;
 import org.apache.commons.io.FileUtils;
+import org.apache.http.entity.StringEntity;
 import org.apache.log4j.Logger;
 import org.hyperledger.fabric.sdk.BlockEvent;
+import org.hyperledger.fabric.sdk.ChaincodeEvent;
+import org.hyperledger.fabric.sdk.ChaincodeEventListener;
 import org.hyperledger.fabric.sdk.ChaincodeID;
 import org.hyperledger.fabric.sdk.ChaincodeResponse.Status;
 import org.hyperledger.fabric.sdk.Channel;
@@ -40,6 +46,7 @@ import org.hyperledger.fabric.sdk.exception.InvalidArgumentException;
 import org.hyperledger.fabric.sdk.exception.ProposalException;
 import org.hyperledger.fabric.sdk.exception.TransactionException;
 import org.hyperledger.fabric.sdk.security.CryptoSuite;
+import org.hyperledger.fabric_ca.sdk.Attribute;
 import org.hyperledger.fabric_ca.sdk.HFCAClient;
 import org.hyperledger.fabric_ca.sdk.RegistrationRequest;
 
@@ -63,6 +70,9 @@ public class BlockhainCommunicator {
     private static final String ORG1_MSP = "Org1MSP"; 
     private static final String ADMIN_LOGIN = "rca-org0-admin"; 
     private static final String ADMIN_PASSWORD= "rca-org0-adminpw"; 
+    // Role of the orchestrator in the access policy of the chaincode, read from the attribute aav.role of its certificate
+    private static final String ROLE_ATTRIBUTE = "aav.role";
+    private static final String USER_ROLE = "sp";
     
 	
 
@@ -95,7 +105,8 @@ public class BlockhainCommunicator {
 	return res2;
     }
 
-    public static void invokeBlockChain(HFClient client, String chainCodeName, String fonctionName, String[] argsList) {
+    // invokeBlockChain submits the transaction and returns the payload returned by the chaincode
+    public static String invokeBlockChain(HFClient client, String chainCodeName, String fonctionName, String[] argsList) {
 
 	ChaincodeID chaincodeID = ChaincodeID.newBuilder().setName(chainCodeName).build();
 	Channel channel = client.getChannel(CHANNEL_NAME);
@@ -133,6 +144,7 @@ public class BlockhainCommunicator {
 	    } else {
 		LOG.error("Transaction tx: " + event.getTransactionID() + " is invalid.");
 	    }
+	    return new String(successful.iterator().next().getChaincodeActionResponsePayload());
 
 	} catch (Exception e) {
 	    LOG.debug("Error while sending a transaction ... ");
@@ -140,6 +152,38 @@ public class BlockhainCommunicator {
 	}
     }
 
+    // relayChaincodeEvents posts the events of the chaincode to the relay of the go service, which forwards them
+    // to the webhooks of the SPs. Only the events of valid transactions are relayed. It returns the handle of the listener
+    public static String relayChaincodeEvents(HFClient client, String chainCodeName, final String relayUrl)
+	    throws InvalidArgumentException {
+	Channel channel = client.getChannel(CHANNEL_NAME);
+	return channel.registerChaincodeEventListener(Pattern.compile("^" + Pattern.quote(chainCodeName) + "$"),
+		Pattern.compile("^aav\\..*"), new ChaincodeEventListener() {
+		    @Override
+		    public void received(String handle, BlockEvent blockEvent, ChaincodeEvent chaincodeEvent) {
+			boolean valid = false;
+			for (BlockEvent.TransactionEvent tx : blockEvent.getTransactionEvents()) {
+			    if (tx.getTransactionID().equals(chaincodeEvent.getTxId())) {
+				valid = tx.isValid();
+			    }
+			}
+			if (!valid) {
+			    return;
+			}
+			Map<String, String> data = new HashMap<>();
+			data.put("eventName", chaincodeEvent.getEventName());
+			data.put("payload", new String(chaincodeEvent.getPayload(), StandardCharsets.UTF_8));
+			try {
+			    HTTPClient.post(relayUrl, new StringEntity(new ObjectMapper().writeValueAsString(data),
+				    "application/json", "UTF-8"), 30);
+			} catch (Exception e) {
+			    LOG.error("Cannot relay the event " + chaincodeEvent.getEventName() + " of tx "
+				    + chaincodeEvent.getTxId(), e);
+			}
+		    }
+		});
+    }
+
     static Channel getChannel(HFClient client) throws InvalidArgumentException, TransactionException {
 	Peer peer = client.newPeer(PEER1_NAME, PEER1_URL);
 	Orderer orderer = client.newOrderer(ORDERER_NAME, ORDERER_URL);
@@ -162,6 +206,8 @@ public class BlockhainCommunicator {
 	AppUser appUser = tryDeserialize(userId, cryptosuite);
 	if (appUser == null) {
 	    RegistrationRequest rr = new RegistrationRequest(userId, ORG1_NAME);
+	    // ecert = true puts the attribute in the enrollment certificate, where the chaincode reads it
+	    rr.addAttribute(new Attribute(ROLE_ATTRIBUTE, USER_ROLE, true));
 	    String enrollmentSecret = caClient.register(rr, registrar);
 	    Enrollment enrollment = caClient.enroll(userId, enrollmentSecret);
 	    appUser = new AppUser(userId, ORG1_NAME, ORG1_MSP, enrollment);
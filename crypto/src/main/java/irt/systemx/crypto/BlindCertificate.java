@@ -6,18 +6,18 @@ public class BlindCertificate {
     String blindCertificate; 
     String blindPubG1CP; 
     String blindPubG2User;
-    String blindPrivUser;
     String blindGenerator;
-    String blindFactor;
+    String proof;
+    String issuerProof;
     
     public BlindCertificate() {
 	this.setBlindCommitment("-1"); 
 	this.setBlindCertificate("-1"); 
 	this.setBlindPubG1CP("-1"); 
 	this.setBlindPubG2User("-1");
-	this.setBlindPrivUser("-1");
 	this.setBlindGenerator("-1");
-	this.setBlindFactor("-1");
+	this.setProof("-1");
+	this.setIssuerProof("-1");
     }
     
     public String getBlindCommitment() {
@@ -44,23 +44,23 @@ public class BlindCertificate {
     public void setBlindPubG2User(String blindPubG2User) {
         this.blindPubG2User = blindPubG2User;
     }
-    public String getBlindPrivUser() {
-        return blindPrivUser;
-    }
-    public void setBlindPrivUser(String blindPrivUser) {
-        this.blindPrivUser = blindPrivUser;
-    }
     public String getBlindGenerator() {
         return blindGenerator;
     }
     public void setBlindGenerator(String blindGenerator) {
         this.blindGenerator = blindGenerator;
     }
-    public String getBlindFactor() {
-        return blindFactor;
+    public String getProof() {
+        return proof;
+    }
+    public void setProof(String proof) {
+        this.proof = proof;
+    }
+    public String getIssuerProof() {
+        return issuerProof;
     }
-    public void setBlindFactor(String blindFactor) {
-        this.blindFactor = blindFactor;
+    public void setIssuerProof(String issuerProof) {
+        this.issuerProof = issuerProof;
     }
     
     
@@ -33,6 +33,7 @@ public class MainProtocol {
     private static final String COMMITMENT_API_URL = MAIN_URL + "/user/commitment";
     private static final String IV_SIGN_API_URL = MAIN_URL + "/iv/signCommitment";
     private static final String IV_VERIFY_API_URL = MAIN_URL + "/iv/verifySignature";
+    private static final String CHALLENGE_API_URL = MAIN_URL + "/CP/challenge";
     private static final String GENERATE_ZKP_RANDOM_API_URL = MAIN_URL + "/user/generateZKP/random";
     private static final String GENERATE_ZKP_AGE_API_URL = MAIN_URL + "/user/generateZKP/age";
     private static final String VERIFY_PROOF_RANDOM_API_URL = MAIN_URL + "/CP/verifyProof/random";
@@ -40,11 +41,15 @@ public class MainProtocol {
     private static final String GENERATE_KEY_PAIRING_API_URL = MAIN_URL + "/user/generateKeyPairing";
     private static final String GENERATE_CERTIFICATE_API_URL = MAIN_URL + "/CP/generateCertificate";
     private static final String VERIFY_CERTIFICATE_API_URL = MAIN_URL + "/user/verifyCertificate";
-    private static final String BLIND_CERTIFICATE_API_URL = MAIN_URL + "/user/blindCertificate";
-    private static final String VERIFY_BLIND_CERTIFICATE_API_URL = MAIN_URL + "/SP/verifyBlindCertificate";
+    private static final String SP_CHALLENGE_API_URL = MAIN_URL + "/SP/challenge";
+    private static final String PRESENT_CERTIFICATE_API_URL = MAIN_URL + "/user/presentCertificate";
+    private static final String VERIFY_PRESENTATION_API_URL = MAIN_URL + "/SP/verifyPresentation";
+    private static final String EVENT_RELAY_API_URL = MAIN_URL + "/events";
     private static final String CHANNEL_NAME = "mychannel";
     private static final String CHAINCODE_NAME = "aav";//anonymous-attribute-verifier";
     private static final String CHAINCODE_FUNCTION = "verify";//Verify before granting access 
+    private static final String REGISTER_ISSUER_FUNCTION = "registerIssuer";
+    private static final String ISSUE_CHALLENGE_FUNCTION = "issueChallenge";
 
     public static void main(String[] args) throws UnsupportedEncodingException, Exception {
 
@@ -69,16 +74,23 @@ public class MainProtocol {
 	// The user verifies that the signature is authentic
 	ivVerify(sign.getSign(), sign.getRand(), ivKeys.getPubKey(), com.getCommit(), IV_VERIFY_API_URL);
 
+	// The Certificate Provider sends a fresh nonce for each proof, so that proofs cannot be replayed
+	Map<String, Object> challengeRand = getChallenge("commitment random", CHALLENGE_API_URL);
+	Map<String, Object> challengeAge = getChallenge("commitment age", CHALLENGE_API_URL);
+
 	// Generating a ZKP for the random number used in the commitment phase
-	ZKP zkRand = generateZKP(com.getRand(), userKeys.getPubKey(), GENERATE_ZKP_RANDOM_API_URL);
+	ZKP zkRand = generateZKP(com.getRand(), userKeys.getPubKey(), challengeRand.get("nonce").toString(),
+		challengeRand.get("context").toString(), GENERATE_ZKP_RANDOM_API_URL);
 
 	// Generating a ZKP for the age attribute used in the commitment phase
-	ZKP zkAge = generateZKP(age, userKeys.getPubKey(), GENERATE_ZKP_AGE_API_URL);
+	ZKP zkAge = generateZKP(age, userKeys.getPubKey(), challengeAge.get("nonce").toString(),
+		challengeAge.get("context").toString(), GENERATE_ZKP_AGE_API_URL);
 
 	// The Certificate Provider checks the validity of the above proofs
 	verifyProof(zkRand.getA(), zkRand.getT(), userKeys.getPubKey(), zkRand.getPubSecret(),
-		VERIFY_PROOF_RANDOM_API_URL);
-	verifyProof(zkAge.getA(), zkAge.getT(), userKeys.getPubKey(), zkAge.getPubSecret(), VERIFY_PROOF_AGE_API_URL);
+		challengeRand.get("nonce").toString(), VERIFY_PROOF_RANDOM_API_URL);
+	verifyProof(zkAge.getA(), zkAge.getT(), userKeys.getPubKey(), zkAge.getPubSecret(),
+		challengeAge.get("nonce").toString(), VERIFY_PROOF_AGE_API_URL);
 
 	// The certificate Provider generates a certificate for the User using the
 	// Blinded attributes of the user
@@ -88,21 +100,52 @@ public class MainProtocol {
 	// The User checks the validity of the certificate
 	verifyCertificate(com.getCommit(), certificate, kpCP.getG1Pub(), kpUser.getG2Pub(), VERIFY_CERTIFICATE_API_URL);
 
-	// The User self blinds his certificate
-	BlindCertificate bc = blindCertificate(com.getCommit(), certificate, kpCP.getG1Pub(), kpUser.getG2Pub(),
-		kpUser.getPrivPairing(), BLIND_CERTIFICATE_API_URL);
+	HFClient client = BlockhainCommunicator.prepareClient();
+	Channel channel = client.getChannel(CHANNEL_NAME);
+
+	// The chaincode events are relayed to the go service, which notifies the Service Providers through their webhooks
+	BlockhainCommunicator.relayChaincodeEvents(client, CHAINCODE_NAME, EVENT_RELAY_API_URL);
+
+	// The Certificate Provider is registered by the admin MSP (Org1MSP, given at instantiation),
+	// verify only accepts the certificates of registered providers
+	String issuerID = "CP-" + kpCP.getG1Pub().substring(0, 16);
+	BlockhainCommunicator.invokeBlockChain(client, CHAINCODE_NAME, REGISTER_ISSUER_FUNCTION,
+		new String[] { issuerID, kpCP.getG1Pub() });
+
+	// The Service Provider gets a challenge from the chaincode, the presentation is bound to it
+	// so that it can be verified only once, and only by this Service Provider
+	String challengeJson = BlockhainCommunicator.invokeBlockChain(client, CHAINCODE_NAME, ISSUE_CHALLENGE_FUNCTION,
+		new String[] { "age verification" });
+	Map<String, Object> chainChallenge = mapper.readValue(challengeJson, new TypeReference<Map<String, Object>>() {
+	});
+
+	// The Service Provider sends a fresh nonce. The User self blinds his certificate and proves that he knows
+	// the blinding secret for this nonce: neither the blinding factor nor the blinded private key are returned
+	Map<String, Object> spChallenge = getChallenge("age verification", SP_CHALLENGE_API_URL);
+	BlindCertificate bc = presentCertificate(com.getCommit(), certificate, kpCP.getG1Pub(), kpUser.getPrivPairing(),
+		spChallenge.get("nonce").toString(), spChallenge.get("context").toString(), PRESENT_CERTIFICATE_API_URL);
+
+	// The Service Provider checks the presentation, and that the certificate has been issued by the Certificate Provider
+	verifyPresentation(bc, spChallenge.get("nonce").toString(), kpCP.getG1Pub(), VERIFY_PRESENTATION_API_URL);
 
-	// The Service Provider checks the validity of the User's certificate
-	verifyBlindCertificate(bc.getBlindCommitment(), bc.getBlindPubG1CP(), bc.getBlindPubG2User(),
-		bc.getBlindCertificate(), bc.getBlindGenerator(), VERIFY_BLIND_CERTIFICATE_API_URL);
+	// The presentation verified on chain is bound to the challenge of the chaincode: the User presents his
+	// certificate again, with another blinding factor, so that the two verifications cannot be linked
+	BlindCertificate chainBc = presentCertificate(com.getCommit(), certificate, kpCP.getG1Pub(),
+		kpUser.getPrivPairing(), chainChallenge.get("nonce").toString(), chainChallenge.get("context").toString(),
+		PRESENT_CERTIFICATE_API_URL);
 
 	// A Blockchain call is made to check the validity of the User's certificate on
 	// chain
-	HFClient client = BlockhainCommunicator.prepareClient();
-	Channel channel = client.getChannel(CHANNEL_NAME);
-	BlockhainCommunicator.invokeBlockChain(client, CHAINCODE_NAME, CHAINCODE_FUNCTION,
-		new String[] { bc.getBlindCommitment(), bc.getBlindCertificate(), bc.getBlindPubG1CP(),
-			bc.getBlindPubG2User(), bc.getBlindGenerator() });
+	String record = BlockhainCommunicator.invokeBlockChain(client, CHAINCODE_NAME, CHAINCODE_FUNCTION,
+		new String[] { chainBc.getBlindCommitment(), chainBc.getBlindCertificate(), chainBc.getBlindPubG1CP(),
+			chainBc.getBlindPubG2User(), chainBc.getBlindGenerator(), "1", issuerID, chainBc.getIssuerProof(),
+			chainChallenge.get("nonce").toString() });
+	LOG.info(" verification record : " + record);
+
+	// Read back the registered Certificate Provider and the first page of the verifications
+	BlockhainCommunicator.queryBlockChain(client, CHAINCODE_NAME, "getIssuer", new String[] { issuerID });
+	BlockhainCommunicator.queryBlockChain(client, CHAINCODE_NAME, "queryByDocType",
+		new String[] { "verification", "10" });
     }
 
     public static Key getKeys(String api) {
@@ -188,7 +231,21 @@ public class MainProtocol {
 	return isValid;
     }
 
-    public static ZKP generateZKP(String secret, String userPubKey, String api)
+    public static Map<String, Object> getChallenge(String context, String api)
+	    throws UnsupportedEncodingException, Exception {
+	String res = "";
+	JSONObject data = new JSONObject();
+	data.put("context", context);
+
+	res = HTTPClient.post(api, new StringEntity(data.toJSONString(), "application/json", "UTF-8"), 600);
+
+	Map<String, Object> map = mapper.readValue(res, new TypeReference<Map<String, Object>>() {
+	});
+	LOG.info(" challenge nonce " + map.get("nonce"));
+	return map;
+    }
+
+    public static ZKP generateZKP(String secret, String userPubKey, String nonce, String context, String api)
 	    throws UnsupportedEncodingException, Exception {
 	ZKP zk = new ZKP();
 
@@ -196,6 +253,8 @@ public class MainProtocol {
 	JSONObject data = new JSONObject();
 	data.put("secret", secret);
 	data.put("pub", userPubKey);
+	data.put("nonce", nonce);
+	data.put("context", context);
 
 	res = HTTPClient.post(api, new StringEntity(data.toJSONString(), "application/json", "UTF-8"), 600);
 
@@ -216,7 +275,7 @@ public class MainProtocol {
 	return zk;
     }
 
-    public static String verifyProof(String A, String t, String userPubKey, String pubSecret, String api)
+    public static String verifyProof(String A, String t, String userPubKey, String pubSecret, String nonce, String api)
 	    throws UnsupportedEncodingException, Exception {
 	String isValid = "";
 	String res = "";
@@ -225,6 +284,7 @@ public class MainProtocol {
 	data.put("t", t);
 	data.put("pub", userPubKey);
 	data.put("pubSecret", pubSecret);
+	data.put("nonce", nonce);
 
 	res = HTTPClient.post(api, new StringEntity(data.toJSONString(), "application/json", "UTF-8"), 600);
 
@@ -296,8 +356,8 @@ public class MainProtocol {
 	return isValid;
     }
 
-    public static BlindCertificate blindCertificate(String commitment, String certificate, String pubG1CP,
-	    String pubG2User, String privUser, String api) throws Exception {
+    public static BlindCertificate presentCertificate(String commitment, String certificate, String pubG1CP,
+	    String privUser, String nonce, String context, String api) throws Exception {
 	BlindCertificate bc = new BlindCertificate();
 
 	String res = "";
@@ -305,8 +365,9 @@ public class MainProtocol {
 	data.put("commitment", commitment);
 	data.put("certificate", certificate);
 	data.put("pubG1CP", pubG1CP);
-	data.put("pubG2User", pubG2User);
 	data.put("privUser", privUser);
+	data.put("nonce", nonce);
+	data.put("context", context);
 
 	res = HTTPClient.post(api, new StringEntity(data.toJSONString(), "application/json", "UTF-8"), 600);
 
@@ -316,31 +377,34 @@ public class MainProtocol {
 	bc.setBlindCertificate(map.get("blindCertificate").toString());
 	bc.setBlindPubG1CP(map.get("blindPubG1CP").toString());
 	bc.setBlindPubG2User(map.get("blindPubG2User").toString());
-	bc.setBlindPrivUser(map.get("blindPrivUser").toString());
 	bc.setBlindGenerator(map.get("blindGenerator").toString());
-	bc.setBlindFactor(map.get("blindFactor").toString());
+	bc.setProof(map.get("proof").toString());
+	bc.setIssuerProof(map.get("issuerProof").toString());
 
 	LOG.info(" bc.getBlindCommitment() : " + bc.getBlindCommitment());
 	LOG.info(" bc.getBlindCertificate() : " + bc.getBlindCertificate());
 	LOG.info(" bc.getBlindPubG1CP() : " + bc.getBlindPubG1CP());
 	LOG.info(" bc.getBlindPubG2User() : " + bc.getBlindPubG2User());
-	LOG.info(" bc.getBlindPrivUser() : " + bc.getBlindPrivUser());
 	LOG.info(" bc.getBlindGenerator() : " + bc.getBlindGenerator());
-	LOG.info(" bc.getBlindFactor() : " + bc.getBlindFactor());
+	LOG.info(" bc.getProof() : " + bc.getProof());
+	LOG.info(" bc.getIssuerProof() : " + bc.getIssuerProof());
 
 	return bc;
     }
 
-    public static String verifyBlindCertificate(String blindCommitment, String blindPubG1CP, String blindPubG2User,
-	    String blindCertificate, String blindGenerator, String api) throws UnsupportedEncodingException, Exception {
+    public static String verifyPresentation(BlindCertificate bc, String nonce, String pubG1CP, String api)
+	    throws UnsupportedEncodingException, Exception {
 	String isValid = "";
 	String res = "";
 	JSONObject data = new JSONObject();
-	data.put("blindCommitment", blindCommitment);
-	data.put("blindPubG1CP", blindPubG1CP);
-	data.put("blindPubG2User", blindPubG2User);
-	data.put("blindCertificate", blindCertificate);
-	data.put("blindGenerator", blindGenerator);
+	data.put("blindCommitment", bc.getBlindCommitment());
+	data.put("blindPubG1CP", bc.getBlindPubG1CP());
+	data.put("blindPubG2User", bc.getBlindPubG2User());
+	data.put("blindCertificate", bc.getBlindCertificate());
+	data.put("blindGenerator", bc.getBlindGenerator());
+	data.put("proof", bc.getProof());
+	data.put("nonce", nonce);
+	data.put("pubG1CP", pubG1CP);
 
 	res = HTTPClient.post(api, new StringEntity(data.toJSONString(), "application/json", "UTF-8"), 600);
 
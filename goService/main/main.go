@@ -1,10 +1,17 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"os"
 
 	"apipoc"
+	"auth"
+	"cryptolib"
+	"eventlistener"
+	"keystore"
+	"telemetry"
 
 	"github.com/gorilla/mux"
 )
@@ -12,7 +19,34 @@ import (
 // main function to boot up everything
 func main() {
 	apipoc.Init()
+
+	//the private keys are kept in the keystore AAV_KEYSTORE, encrypted with a key derived from AAV_KEYSTORE_PASSPHRASE,
+	//and the routes take their ID. Without a keystore, the routes take the private keys in the requests
+	var keys *keystore.Store
+	if path := os.Getenv("AAV_KEYSTORE"); path != "" {
+		var err error
+		if keys, err = keystore.OpenOrCreate(path, os.Getenv("AAV_KEYSTORE_PASSPHRASE")); err != nil {
+			log.Fatal(err)
+		}
+		apipoc.SetKeystore(keys)
+	}
+	if err := configureSigners(); err != nil {
+		log.Fatal(err)
+	}
+
+	//the spans are exported over OTLP when OTEL_EXPORTER_OTLP_ENDPOINT is set. The service only stops with log.Fatal,
+	//so the spans not exported yet are not flushed
+	if _, err := telemetry.Setup(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	cryptolib.SetObserver(telemetry.ObservePrimitive)
+
 	router := mux.NewRouter()
+	router.Use(telemetry.Middleware)
+
+	//return the metrics of the routes and of the cryptographic primitives in the Prometheus exposition format
+	router.Handle("/metrics", telemetry.Handler()).Methods("GET")
+
 	router.HandleFunc("/people", apipoc.GetPeople).Methods("GET")
 	router.HandleFunc("/people/{id}", apipoc.GetPerson).Methods("GET")
 	router.HandleFunc("/people/{id}", apipoc.CreatePerson).Methods("POST")
@@ -21,53 +55,139 @@ func main() {
 	//return {"pub":"string", "priv":"string"}
 	router.HandleFunc("/user/generateKey", apipoc.GenerateKey).Methods("GET")
 
-	//input {"pub":"string", "value":int}
+	//input {"attributes":["string", ...]} or {"age":"string"}
+	//return {"commitment":"string", "random":"string", "attributeCount":int}
 	router.HandleFunc("/user/commitment", apipoc.Commitment).Methods("POST")
 
-	//input {"commitment":"string", "priv":"string"} priv is the private key of the IV
+	//input {"commitment":"string", "priv":"string", "pub":"string"} priv is the private key of the IV, or {"commitment":"string", "keyID":"string"} with a keystore, or {"commitment":"string"} with a signer of the IV
 	router.HandleFunc("/iv/signCommitment", apipoc.SignCommitment).Methods("POST")
 
 	//input {"s": string, "r": string, "pub": string, "commitment":string} pub is the public key of the IV
 	//return {"verify":"true"} or {"verify":"false"}
 	router.HandleFunc("/iv/verifySignature", apipoc.VerifySignature).Methods("POST")
 
-	//input {"secret":"string", "pub":"string"}
+	//input {"context":"string"}
+	//return {"nonce":"string", "context":"string"}
+	router.HandleFunc("/CP/challenge", apipoc.GetChallenge).Methods("POST")
+
+	//input {"secret":"string", "nonce":"string", "context":"string"}
 	//return {"A":"string", "t": "string", "pubSecret":"string"}
 	router.HandleFunc("/user/generateZKP/random", apipoc.GenerateZKPRandom).Methods("POST")
 
-	//input {"secret":"string"}
-	//return {"A":"string", "t": "string", "pubSecret":"string"}
+	//removed: answers 410 route_removed, use /user/generateZKP/ageRange
 	router.HandleFunc("/user/generateZKP/age", apipoc.GenerateZKPAge).Methods("POST")
 
-	//input {"A":"string", "t":"string", "pub":"string", "pubSecret":"string"}
+	//input {"A":"string", "t":"string", "pubSecret":"string", "nonce":"string"}
 	//return {"verify":"true"} or {"verify":"false"}
 	router.HandleFunc("/CP/verifyProof/random", apipoc.VerifyProofRandom).Methods("POST")
 
-	//input {"A":"string", "t":"string", "pubSecret":"string"}
-	//return {"verify":"true"} or {"verify":"false"}
+	//removed: answers 410 route_removed, use /CP/verifyProof/ageRange
 	router.HandleFunc("/CP/verifyProof/age", apipoc.VerifyProofAge).Methods("POST")
 
-	//input {"commitment":"string", "pubSecretAge":"string", "pubSecretRandom":"string"}
+	//input {"attributes":["string", ...], "ageIndex":int, "random":"string", "commitment":"string", "threshold":int, "nonce":"string", "context":"string"} the age is the attribute "int:<age>"
+	//return {"proof":"string", "threshold":int}
+	router.HandleFunc("/user/generateZKP/ageRange", apipoc.GenerateZKPAgeRange).Methods("POST")
+
+	//input {"commitment":"string", "attributeCount":int, "ageIndex":int, "proof":"string", "threshold":int, "nonce":"string"}
 	//return {"verify":"true"} or {"verify":"false"}
+	router.HandleFunc("/CP/verifyProof/ageRange", apipoc.VerifyProofAgeRange).Methods("POST")
+
+	//input {"attributes":["string", ...], "random":"string", "commitment":"string", "nonce":"string", "context":"string"}
+	//return {"proof":"string"}
+	router.HandleFunc("/user/generateZKP/commitment", apipoc.GenerateZKPCommitment).Methods("POST")
+
+	//input {"commitment":"string", "attributeCount":int, "proof":"string", "nonce":"string"}
+	//return {"verify":"true"} or {"verify":"false"}
+	router.HandleFunc("/CP/verifyProof/commitment", apipoc.VerifyCommitment).Methods("POST")
+
+	//input {"attributes", "random", "commitment", "privUser", "nonce", "context"} keyID instead of privUser with a keystore
+	//return {"attributeKey", "proof"}
+	router.HandleFunc("/user/generateZKP/attributeKey", apipoc.GenerateZKPAttributeKey).Methods("POST")
+
+	//input {"commitment", "attributeCount", "pubG2User", "proof", "nonce"}
+	//return {"verify":"true", "attributeKey"} or {"verify":"false"}
+	router.HandleFunc("/CP/verifyProof/attributeKey", apipoc.VerifyProofAttributeKey).Methods("POST")
 
 	//return {"priv":"string", "g1Pub":"string" "g2Pub":"string"}
 	router.HandleFunc("/user/generateKeyPairing", apipoc.GeneratePairingKey).Methods("GET")
 
-	//input {"commitment":"string", "privCP":"string", "pubG2User":"string"}
+	//input {"commitment":"string", "attributeCount":int, "privCP":"string", "pubG2User":"string"} keyID instead of privCP with a keystore, neither with an issuer of the CP
 	//return {"certificate":"string"} (if verification of some parameter fail, certificate is set to "false")
 	router.HandleFunc("/CP/generateCertificate", apipoc.GenerateCertificate).Methods("POST")
 
-	//input {"commitment":"string", "certificate":"string", "pubG1CP":"string", "pubG2User":"string"}
+	//input {"commitment":"string", "attributeCount":int, "certificate":"string", "pubG1CP":"string", "pubG2User":"string"}
 	//return {"verify":"true"} or {"verify":"false"}
 	router.HandleFunc("/user/verifyCertificate", apipoc.VerifyCertificate).Methods("POST")
 
-	//input {"commitment", "certificate", "pubG1CP", "pubG2User", "privUser"}
-	//return {"blindCommitment", "blindCertificate", "blindPubG1CP", "blindPubG2User", "blindPrivUser", "blindGenerator", "blindFactor"}
+	//input {"commitment", "attributeCount", "certificate", "pubG1CP", "pubG2User", "privUser"} keyID instead of privUser with a keystore
+	//return {"blindCommitment", "blindCertificate", "blindPubG1CP", "blindPubG2User", "blindGenerator", "attributeCount", "issuerProof"}
 	router.HandleFunc("/user/blindCertificate", apipoc.BlindCertificate).Methods("POST")
 
-	//input {"blindCommitment", "blindPubG1CP", "blindPubG2User", "blindCertificate", "blindGenerator"}
+	//input {"blindCommitment", "blindPubG1CP", "blindPubG2User", "blindCertificate", "blindGenerator", "attributeCount"}
 	//return {"verify":"true"} or {"verify":"false"}
+	//deprecated: without proof of knowledge of the blinding secret, use /SP/verifyPresentation, which also takes the disclosure mask
 	router.HandleFunc("/SP/verifyBlindCertificate", apipoc.VerifyBlindedCertificate).Methods("POST")
 
+	//input {"certificates":[{"blindCommitment", "blindPubG1CP", "blindPubG2User", "blindCertificate", "blindGenerator", "attributeCount"}]}
+	//return {"verify":"true", "invalid":[]} or {"verify":"false", "invalid":[indices of the invalid certificates]}
+	router.HandleFunc("/SP/verifyBlindCertificate/batch", apipoc.VerifyBlindedCertificates).Methods("POST")
+
+	//input {"context"}
+	//return {"nonce", "context"}
+	router.HandleFunc("/SP/challenge", apipoc.GetChallenge).Methods("POST")
+
+	//input {"commitment", "attributeCount", "certificate", "pubG1CP", "privUser", "nonce", "context"} keyID instead of privUser with a keystore
+	//optional disclosure {"attributes", "random", "disclosureMask"}
+	//return {"blindCommitment", "blindCertificate", "blindPubG1CP", "blindPubG2User", "blindGenerator", "attributeCount", "proof", "issuerProof"}
+	//or with a disclosure {..., "issuerProof", "disclosureMask", "disclosedAttributes", "disclosureProof"}
+	router.HandleFunc("/user/presentCertificate", apipoc.PresentCertificate).Methods("POST")
+
+	//input {"blindCommitment", "blindPubG1CP", "blindPubG2User", "blindCertificate", "blindGenerator", "attributeCount", "proof", "nonce"}
+	//or with a disclosure {..., "disclosureMask", "disclosedAttributes", "disclosureProof", "nonce"}
+	//return {"verify":"true"} or {"verify":"false"}
+	router.HandleFunc("/SP/verifyPresentation", apipoc.VerifyPresentation).Methods("POST")
+
+	//chaincode events, relayed by the orchestrator and forwarded to the webhooks of the SPs
+	relay := eventlistener.NewRelay()
+	listener := eventlistener.NewListener(relay)
+	listener.OnDrop = telemetry.CountDroppedEvent
+	go listener.Run(context.Background())
+
+	//input {"eventName", "payload"} the chaincode event, posted by the orchestrator. Refused without client authentication
+	router.Handle("/events", relay).Methods("POST")
+
+	//input {"url", "sp", "types", "secret"} sp, types and secret are optional, the SP is the identity of the client certificate
+	//return {"id", "url", "sp", "types"}
+	router.HandleFunc("/SP/webhooks", listener.RegisterWebhook).Methods("POST")
+
+	//return [{"id", "url", "sp", "types"}, ...] the webhooks of the client
+	router.HandleFunc("/SP/webhooks", listener.GetWebhooks).Methods("GET")
+
+	//only the SP which registered the webhook unregisters it
+	router.HandleFunc("/SP/webhooks/{id}", listener.UnregisterWebhook).Methods("DELETE")
+
+	if keys != nil {
+		//input {"id", "type", "owner"} id is optional, type is "ecdsa-p256", "bn256-issuer" or "bn256-holder"
+		//return {"id", "type", "owner", "version", "public", "versions"} without the private key
+		router.HandleFunc("/keys", keys.GenerateKey).Methods("POST")
+
+		//return [{"id", "type", "owner", "version", "public", "versions"}, ...] optional query parameter owner
+		router.HandleFunc("/keys", keys.GetKeys).Methods("GET")
+
+		router.HandleFunc("/keys/{id}", keys.GetKey).Methods("GET")
+
+		//return {"id", "type", "owner", "version", "public", "versions"} with the new version
+		router.HandleFunc("/keys/{id}/rotate", keys.RotateKey).Methods("POST")
+	}
+
+	//with AAV_TLS_CONFIG, the service is served over TLS and, with a client CA, each route is restricted to the roles
+	//of the client certificates. Without it, the service is served over plain HTTP to every client
+	if path := os.Getenv("AAV_TLS_CONFIG"); path != "" {
+		config, err := auth.LoadConfig(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Fatal(config.ListenAndServe(router))
+	}
 	log.Fatal(http.ListenAndServe(":8000", router))
 }
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+
+	"apipoc"
+	"cryptolib"
+)
+
+//configureSigners gives the keys of the IV and of the CP of the service to the routes, from the environment.
+//The key of the IV is read from the PEM file AAV_IV_KEY_FILE, or kept in the PKCS#11 token AAV_PKCS11_TOKEN of the module
+//AAV_PKCS11_MODULE, under the label AAV_PKCS11_KEY, with the PIN AAV_PKCS11_PIN.
+//The pairing key of the CP is read from the hexadecimal file AAV_CP_KEY_FILE, or kept by the remote signer whose
+//route /CP/generateCertificate is AAV_CP_REMOTE_URL, as the key AAV_CP_REMOTE_KEY_ID of its keystore, of public key AAV_CP_REMOTE_PUBLIC.
+//Without them, the routes take the keys in the requests or in the keystore
+func configureSigners() error {
+	if path := os.Getenv("AAV_IV_KEY_FILE"); path != "" {
+		s, err := cryptolib.LoadFileSigner(path)
+		if err != nil {
+			return err
+		}
+		apipoc.SetSigner(s)
+	} else if module := os.Getenv("AAV_PKCS11_MODULE"); module != "" {
+		s, err := cryptolib.OpenPKCS11Signer(cryptolib.PKCS11Config{Module: module, Token: os.Getenv("AAV_PKCS11_TOKEN"),
+			PIN: os.Getenv("AAV_PKCS11_PIN"), Key: os.Getenv("AAV_PKCS11_KEY")})
+		if err != nil {
+			return err
+		}
+		apipoc.SetSigner(s)
+	}
+
+	if path := os.Getenv("AAV_CP_KEY_FILE"); path != "" {
+		k, err := cryptolib.LoadFileIssuer(path)
+		if err != nil {
+			return err
+		}
+		apipoc.SetIssuer(k)
+	} else if url := os.Getenv("AAV_CP_REMOTE_URL"); url != "" {
+		pub, err := hex.DecodeString(os.Getenv("AAV_CP_REMOTE_PUBLIC"))
+		if err != nil {
+			return errors.New("AAV_CP_REMOTE_PUBLIC must be the hexadecimal public key of the CP")
+		}
+		key := new(cryptolib.IssuerPublicKey)
+		if err := key.Unmarshal(pub); err != nil {
+			return err
+		}
+		apipoc.SetIssuer(&cryptolib.RemoteIssuer{URL: url, KeyID: os.Getenv("AAV_CP_REMOTE_KEY_ID"), Key: key})
+	}
+	return nil
+}
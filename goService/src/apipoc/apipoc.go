@@ -1,26 +1,36 @@
 package apipoc
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"math/big"
 	"net/http"
-	"time"
 
-	"converterhex"
 	"cryptolib"
+	"telemetry"
+	"wire"
 
 	"github.com/gorilla/mux"
 )
 
 var curve = elliptic.P256()
 
+//errAttributeCount refuses attributes which are not the attributes of the certificate
+var errAttributeCount = errors.New("The number of attributes is not attributeCount")
+
+//errAgeIndex refuses an index of the age which is not in the commitment
+var errAgeIndex = errors.New("ageIndex is not the index of an attribute of the commitment")
+
+//errCommitmentInClear refuses the commitment of the attributes in a presentation
+var errCommitmentInClear = errors.New("The commitment is not sent with a presentation: disclose the attributes with /user/presentCertificate and /SP/verifyPresentation")
+
 //Person is a struct containing the information of an individu
 type Person struct {
 	ID        string   `json:"id,omitempty"`
@@ -89,7 +99,8 @@ func DeletePerson(w http.ResponseWriter, r *http.Request) {
  * @apiName GenerateKey
  * @apiGroup User
  *
- * @apiDescription Return ECDSA private and public key for an user
+ * @apiDescription Return ECDSA private and public key for an user.
+ * When the service has a keystore, the keys are generated with POST /keys instead and this route returns 403
  *
  * @apiSuccess {String} pub Return the publi key of the user
  * @apiSuccess {String} priv Return the private key of the user
@@ -101,32 +112,85 @@ func DeletePerson(w http.ResponseWriter, r *http.Request) {
  *			"priv": "72616e646f6d"
  *		}
  *
+ * @apiUse RequestError
+ *
  */
 func GenerateKey(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
+	if keys != nil {
+		writeError(w, errKeysInKeystore)
+		return
+	}
 	type Return struct {
 		Pub  string `json:"pub"`
 		Priv string `json:"priv"`
 	}
-	priv, _ := ecdsa.GenerateKey(curve, rand.Reader)
+	priv, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
 	pubByte := elliptic.Marshal(priv.Curve, priv.PublicKey.X, priv.PublicKey.Y)
 	ret := Return{Pub: hex.EncodeToString(pubByte), Priv: priv.D.Text(16)}
 	retByte, _ := json.Marshal(ret)
 	w.Header().Set("content-type", "application/json")
 	w.Write(retByte)
 
-	end := time.Now()
-	elapsed := end.Sub(start)
-	fmt.Println("GenerateKey: ", elapsed)
 	return
 }
 
-//Pubic generator used to generate the ZKP and the commitment.
-//This value is public and known by all the generator and verifier of proofs.
-const (
-	gx = "55126828932999412942359357557609819057251331021666655435427634109588796591969"
-	gy = "63544379041443090754421963879511225825336925190710611664440074306356880601047"
-)
+//Public generators used to generate the ZKP and the commitment.
+//They are derived from domain labels by cryptolib (hash to curve), so nobody knows their discrete logs
+//and the user cannot open a commitment to another value.
+
+//maxAttributes is the maximum number of attributes in a commitment
+const maxAttributes = 32
+
+//ageRangeBits is the size of the range proven for the age: age - threshold must be in [0, 2^ageRangeBits)
+const ageRangeBits = 8
+
+//generators returns the blinding generator H and the n first attribute generators
+func generators(n int) (*ecdsa.PublicKey, []ecdsa.PublicKey, error) {
+	if n < 1 || n > maxAttributes {
+		return nil, nil, fmt.Errorf("Number of attributes must be between 1 and %d", maxAttributes)
+	}
+	return cryptolib.CommitmentGenerators(curve, n)
+}
+
+//keyGenerators returns the generators of the attribute keys of n attributes
+func keyGenerators(n int) (*cryptolib.AttributeKeyGenerators, error) {
+	if n < 1 || n > maxAttributes {
+		return nil, fmt.Errorf("Number of attributes must be between 1 and %d", maxAttributes)
+	}
+	return cryptolib.DeriveAttributeKeyGenerators(n)
+}
+
+//attributesToMessage converts the attributes to the list of messages to commit. Requests without attributes commit the age only
+func attributesToMessage(attributes []string, age string) [][]byte {
+	if len(attributes) == 0 {
+		attributes = []string{age}
+	}
+	message := make([][]byte, len(attributes))
+	for i, attribute := range attributes {
+		message[i] = []byte(attribute)
+	}
+	return message
+}
+
+//attributeCount returns the number of attributes covered by a certificate. Requests without it are single attribute ones
+func attributeCount(n int) int {
+	if n == 0 {
+		return 1
+	}
+	return n
+}
+
+//span starts the span of the cryptolib operation name, child of the span of the request r, and returns the function ending it
+func span(r *http.Request, name string) func() {
+	_, s := telemetry.Start(r.Context(), name)
+	return func() {
+		s.End()
+	}
+}
 
 /**
  * @api {post} /user/commitment Commitment Computing
@@ -134,65 +198,75 @@ const (
  * @apiName Commitment
  * @apiGroup User
  *
- * @apiDescription Return the Pedersen commitment for a given message
+ * @apiDescription Return the Pedersen commitment for a given list of attributes. Each attribute is committed with its own generator
  *
- * @apiParam {String} pub ECDSA public key associated to the user (hexa decimal string)
- * @apiParam {String} value Value to be committed
+ * @apiParam {String[]} attributes Values to be committed (birthdate, nationality, licence class, expiry...)
+ * @apiParam {String} [age] Single value to be committed, used when attributes is empty
  *
  * @apiParamExample {json} Request-Example:
  *   {
- *		"pub": "04123456ABDE...",
- *		"value": "21"
+ *		"attributes": ["1990-01-31", "FR", "B", "2030-12-31"]
  *	 }
  *
  * @apiSuccess {String} commitment Return the hexadecimal string representing the commitment of a given price and value.
  * @apiSuccess {String} random Return the haxadecimal string representing the random value used to compute the commitment.
+ * @apiSuccess {Number} attributeCount Return the number of committed attributes
  *
  * @apiSuccessExample Success-Response:
  *	HTTP/1.1 200 OK
  *		{
  *	 		"commitment": "012345...DEF",
- *			"random": "72616e646f6d"
+ *			"random": "72616e646f6d",
+ *			"attributeCount": 4
  *		}
  *
+ * @apiUse RequestError
+ *
  */
 func Commitment(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
 	type Input struct {
-		Pub string `json:"pub"`
-		Age string `json:"age"`
+		Age        string   `json:"age"`
+		Attributes []string `json:"attributes"`
 	}
-	body, _ := ioutil.ReadAll(r.Body)
 	var in Input
-	json.Unmarshal(body, &in)
-	pubByte, _ := converterhex.HexToByte(in.Pub)
-
-	X, Y := elliptic.Unmarshal(curve, pubByte)
-	pub := ecdsa.PublicKey{Curve: curve, X: X, Y: Y}
-
-	gxInt, _ := new(big.Int).SetString(gx, 10)
-	gyInt, _ := new(big.Int).SetString(gy, 10)
+	if err := decode(r, &in); err != nil {
+		writeError(w, err)
+		return
+	}
+	var p parser
+	message := p.attributes("attributes", in.Attributes, in.Age)
+	if p.err != nil {
+		writeError(w, p.err)
+		return
+	}
 
-	gen := ecdsa.PublicKey{Curve: curve, X: gxInt, Y: gyInt}
-	random := make([]byte, 16)
-	rand.Read(random)
-	commit, err := cryptolib.Commit([][]byte{[]byte(in.Age)}, &pub, []ecdsa.PublicKey{gen}, random)
+	h, gen, err := generators(len(message))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	random, err := rand.Int(rand.Reader, curve.Params().N)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	end := span(r, "cryptolib.Commit")
+	commit, err := cryptolib.Commit(message, h, gen, random.Bytes())
+	end()
 	if err != nil {
-		fmt.Println(err)
+		writeError(w, err)
 		return
 	}
 
 	type Ret struct {
-		Commitment string `json:"commitment"`
-		Random     string `json:"random"`
+		Commitment     string `json:"commitment"`
+		Random         string `json:"random"`
+		AttributeCount int    `json:"attributeCount"`
 	}
-	res := Ret{Commitment: hex.EncodeToString(commit), Random: hex.EncodeToString(random)}
+	res := Ret{Commitment: hex.EncodeToString(commit), Random: hex.EncodeToString(random.Bytes()), AttributeCount: len(message)}
 	retByte, _ := json.Marshal(res)
 	w.Header().Set("content-type", "application/json")
 	w.Write(retByte)
-	end := time.Now()
-	elapsed := end.Sub(start)
-	fmt.Println("Commitment: ", elapsed)
 	return
 }
 
@@ -202,10 +276,13 @@ func Commitment(w http.ResponseWriter, r *http.Request) {
  * @apiName SignCommitment
  * @apiGroup IV
  *
- * @apiDescription Return the ECDSA signature of the commitment
+ * @apiDescription Return the ECDSA signature of the commitment.
+ * When the service has a signer for the IV (a key file or a PKCS#11 token), it signs with it and the request gives neither priv nor keyID
  *
  * @apiParam {String} commitment Commitment to be signed
- * @apiParam {String} priv Private key of the signer
+ * @apiParam {String} [priv] Private key of the signer, refused when the service has a keystore
+ * @apiParam {String} [pub] Public key of the signer, with priv
+ * @apiParam {String} [keyID] ID of the key of the signer in the keystore, owned by the IV. "id@version" selects a previous version
  *
  * @apiParamExample {json} Request-Example:
  *   {
@@ -223,29 +300,44 @@ func Commitment(w http.ResponseWriter, r *http.Request) {
  *			"s": "7302616DEe6AA46f6d..."
  *		}
  *
+ * @apiUse RequestError
+ *
  */
 func SignCommitment(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
 	type Input struct {
 		Commitment string `json:"commitment"`
 		Priv       string `json:"priv"`
 		Pub        string `json:"pub"`
+		KeyID      string `json:"keyID"`
 	}
-	body, _ := ioutil.ReadAll(r.Body)
 	var in Input
-	json.Unmarshal(body, &in)
-	commit, _ := converterhex.HexToByte(in.Commitment)
-	pubByte, _ := converterhex.HexToByte(in.Pub)
-	x, y := elliptic.Unmarshal(curve, pubByte)
-	pubKey := ecdsa.PublicKey{Curve: curve, X: x, Y: y}
-	privD, _ := new(big.Int).SetString(in.Priv, 16)
-	privKey := ecdsa.PrivateKey{PublicKey: pubKey, D: privD}
+	if err := decode(r, &in); err != nil {
+		writeError(w, err)
+		return
+	}
+	var p parser
+	commit := p.point("commitment", in.Commitment, wire.Commitment)
+	if p.err != nil {
+		writeError(w, p.err)
+		return
+	}
+	privKey, err := signingKey(in.KeyID, in.Priv, in.Pub)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
 
 	h := sha256.New()
 	h.Write(commit)
 	hash := h.Sum(nil)
 
-	rSign, sSign, _ := ecdsa.Sign(rand.Reader, &privKey, hash)
+	end := span(r, "cryptolib.Signer.Sign")
+	rSign, sSign, err := privKey.Sign(rand.Reader, hash)
+	end()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
 
 	type Ret struct {
 		R string `json:"r"`
@@ -255,9 +347,6 @@ func SignCommitment(w http.ResponseWriter, r *http.Request) {
 	retByte, _ := json.Marshal(ret)
 	w.Header().Set("content-type", "application/json")
 	w.Write(retByte)
-	end := time.Now()
-	elapsed := end.Sub(start)
-	fmt.Println("SignCommitment: ", elapsed)
 	return
 
 }
@@ -291,30 +380,38 @@ func SignCommitment(w http.ResponseWriter, r *http.Request) {
  *	 		"verify": "true"
  *		}
  *
+ * @apiUse RequestError
+ *
  */
 func VerifySignature(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
 	type Input struct {
 		R          string `json:"r"`
 		S          string `json:"s"`
 		Commitment string `json:"commitment"`
 		Pub        string `json:"pub"`
 	}
-	body, _ := ioutil.ReadAll(r.Body)
 	var in Input
-	json.Unmarshal(body, &in)
-	commit, _ := converterhex.HexToByte(in.Commitment)
-	pubByte, _ := converterhex.HexToByte(in.Pub)
-	x, y := elliptic.Unmarshal(curve, pubByte)
-	pubKey := ecdsa.PublicKey{Curve: curve, X: x, Y: y}
-	rInt, _ := new(big.Int).SetString(in.R, 16)
-	sInt, _ := new(big.Int).SetString(in.S, 16)
+	if err := decode(r, &in); err != nil {
+		writeError(w, err)
+		return
+	}
+	var p parser
+	commit := p.point("commitment", in.Commitment, wire.Commitment)
+	pubKey := p.publicKey("pub", in.Pub, wire.PublicKey)
+	rInt := p.integer("r", in.R, 16)
+	sInt := p.integer("s", in.S, 16)
+	if p.err != nil {
+		writeError(w, p.err)
+		return
+	}
 
 	h := sha256.New()
 	h.Write(commit)
 	hash := h.Sum(nil)
 
-	b := ecdsa.Verify(&pubKey, hash, rInt, sInt)
+	end := span(r, "ecdsa.Verify")
+	b := ecdsa.Verify(pubKey, hash, rInt, sInt)
+	end()
 	type Ret struct {
 		Verify string `json:"verify"`
 	}
@@ -327,9 +424,6 @@ func VerifySignature(w http.ResponseWriter, r *http.Request) {
 	retByte, _ := json.Marshal(ret)
 	w.Header().Set("content-type", "application/json")
 	w.Write(retByte)
-	end := time.Now()
-	elapsed := end.Sub(start)
-	fmt.Println("VerifySignature: ", elapsed)
 	return
 }
 
@@ -342,17 +436,19 @@ func VerifySignature(w http.ResponseWriter, r *http.Request) {
  * @apiDescription Generate a ZKP for the random member of the commitment
  *
  * @apiParam {String} secret Secret to hide: random value used in commitment
- * @apiParam {String} pub Public key of the user
+ * @apiParam {String} nonce Nonce returned by /CP/challenge
+ * @apiParam {String} context Application context returned by /CP/challenge
  *
  * @apiParamExample {json} Request-Example:
  *   {
  *		"secret": "04123456ABDE...",
- *		"pub": "04000242400FF21ADC22..."
+ *		"nonce": "01234ABC...",
+ *		"context": "age verification for service X"
  *	 }
  *
  * @apiSuccess {String} A Random value used to compute and verify ZKP
  * @apiSuccess {String} t Public value containing the secret used to verify the ZKP
- * @apiSuccess {String} pubSecret Public generator value multiply by a secret which is secret*Generator
+ * @apiSuccess {String} pubSecret Public value which is secret*H (H is the blinding generator of the commitment)
  *
  * @apiSuccessExample Success-Response:
  *	HTTP/1.1 200 OK
@@ -362,24 +458,39 @@ func VerifySignature(w http.ResponseWriter, r *http.Request) {
  *	 		"pubSecret": "01234ABC...",
  *		}
  *
+ * @apiUse RequestError
+ *
  */
 func GenerateZKPRandom(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
 	type Input struct {
-		Secret string `json:"secret"`
-		Pub    string `json:"pub"`
+		Secret  string `json:"secret"`
+		Nonce   string `json:"nonce"`
+		Context string `json:"context"`
 	}
-	body, _ := ioutil.ReadAll(r.Body)
 	var in Input
-	json.Unmarshal(body, &in)
-	pubByte, _ := converterhex.HexToByte(in.Pub)
-	x, y := elliptic.Unmarshal(curve, pubByte)
-	secret, _ := converterhex.HexToByte(in.Secret)
+	if err := decode(r, &in); err != nil {
+		writeError(w, err)
+		return
+	}
+	var p parser
+	secret := p.scalar("secret", in.Secret, wire.Scalar)
+	nonce := p.nonce("nonce", in.Nonce)
+	if p.err != nil {
+		writeError(w, p.err)
+		return
+	}
+	h, _, _ := generators(1)
+	x, y := h.X, h.Y
 
-	random := make([]byte, 16)
-	rand.Read(random)
+	random, err := rand.Int(rand.Reader, curve.Params().N)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
 
-	a, t := cryptolib.GenerateProof(curve, random, x, y, secret)
+	end := span(r, "cryptolib.GenerateProof")
+	a, t := cryptolib.GenerateProof(curve, random.Bytes(), x, y, secret, nonce, []byte(in.Context))
+	end()
 	pubSecretX, pubSecretY := curve.ScalarMult(x, y, secret)
 
 	type Ret struct {
@@ -397,75 +508,33 @@ func GenerateZKPRandom(w http.ResponseWriter, r *http.Request) {
 	retByte, _ := json.Marshal(ret)
 	w.Header().Set("content-type", "application/json")
 	w.Write(retByte)
-	end := time.Now()
-	elapsed := end.Sub(start)
-	fmt.Println("GenerateZKP: ", elapsed)
 	return
 }
 
+//errAgeProofRemoved answers the routes of the proof of knowledge of age*G: it proves that the user knows a scalar,
+//not that the committed age is above a threshold, so it is answered by none of them
+var errAgeProofRemoved = &requestError{http.StatusGone, CodeRouteRemoved, "",
+	errors.New("The proof of knowledge of age*G does not prove the age, use /user/generateZKP/ageRange and /CP/verifyProof/ageRange")}
+
 /**
  * @api {post} /user/generateZKP/age Generate ZKP for the committed value
  *
  * @apiName GenerateZKPAge
  * @apiGroup User
  *
- * @apiDescription Generate a ZKP for the secret member of the commitment
- *
- * @apiParam {String} secret Secret to hide: committed value
- *
- * @apiParamExample {json} Request-Example:
- *   {
- *		"secret": "04123456ABDE...",
- *	 }
- *
- * @apiSuccess {String} A Random value used to compute and verify ZKP
- * @apiSuccess {String} t Public value containing the secret used to verify the ZKP
- * @apiSuccess {String} pubSecret Public value which is secret*G (a generator hard coded in the code. Must be public and know by the participant)
+ * @apiDescription Removed: the proof of knowledge of age*G did not prove anything about the age. The route answers 410 route_removed,
+ * use /user/generateZKP/ageRange, which proves that the committed age is greater or equal to a threshold
  *
- * @apiSuccessExample Success-Response:
- *	HTTP/1.1 200 OK
+ * @apiErrorExample Error-Response:
+ *	HTTP/1.1 410 Gone
  *		{
- *	 		"A": "01234ABC..."
- *	 		"t": "01234ABC...",
- *	 		"pubSecret": "01234ABC...",
+ *			"code": "route_removed",
+ *			"message": "The proof of knowledge of age*G does not prove the age, use /user/generateZKP/ageRange and /CP/verifyProof/ageRange"
  *		}
  *
  */
 func GenerateZKPAge(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
-	type Input struct {
-		Secret string `json:"secret"`
-	}
-	body, _ := ioutil.ReadAll(r.Body)
-	var in Input
-	json.Unmarshal(body, &in)
-	x, _ := new(big.Int).SetString(gx, 10)
-	y, _ := new(big.Int).SetString(gy, 10)
-	secret := []byte(in.Secret)
-	random := make([]byte, 16)
-	rand.Read(random)
-	a, t := cryptolib.GenerateProof(curve, random, x, y, secret)
-	pubSecretX, pubSecretY := curve.ScalarMult(x, y, secret)
-
-	type Ret struct {
-		A         string `json:"A"`
-		T         string `json:"t"`
-		PubSecret string `json:"pubSecret"`
-	}
-	var ret Ret
-	AByte := elliptic.Marshal(curve, a.X, a.Y)
-	ret.A = hex.EncodeToString(AByte)
-
-	ret.T = hex.EncodeToString(t)
-	ret.PubSecret = hex.EncodeToString(elliptic.Marshal(curve, pubSecretX, pubSecretY))
-
-	retByte, _ := json.Marshal(ret)
-	w.Header().Set("content-type", "application/json")
-	w.Write(retByte)
-	end := time.Now()
-	elapsed := end.Sub(start)
-	fmt.Println("Generate ZKP Age: ", elapsed)
-	return
+	writeError(w, errAgeProofRemoved)
 }
 
 /**
@@ -478,15 +547,15 @@ func GenerateZKPAge(w http.ResponseWriter, r *http.Request) {
  *
  * @apiParam {String} A Random generated during the proof generation
  * @apiParam {String} t Public containing hidden generated during proof generation
- * @apiParam {String} pub Public key of the owner of the proof
  * @apiParam {String} pubSecret Public generator multiply by the secret value during the generation of the proof
+ * @apiParam {String} nonce Nonce returned by /CP/challenge and used in the proof. It is consumed by the verification
  *
  * @apiParamExample {json} Request-Example:
  *   {
  *	 		"A": "01234ABC...",
  *	 		"t": "01234ABC...",
- *			"pub": "0123EEADCD...",
  *	 		"pubSecret": "01234ABC...",
+ *	 		"nonce": "01234ABC...",
  *	 }
  *
  * @apiSuccess {String} verify Return "true" if proof is OK, "false" else
@@ -497,32 +566,36 @@ func GenerateZKPAge(w http.ResponseWriter, r *http.Request) {
  *	 		"verify": "true"
  *		}
  *
+ * @apiUse RequestError
+ *
  */
 func VerifyProofRandom(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
 	type Input struct {
 		A         string `json:"A"`
 		T         string `json:"t"`
-		Pub       string `json:"pub"`
 		PubSecret string `json:"pubSecret"`
+		Nonce     string `json:"nonce"`
 	}
-	body, _ := ioutil.ReadAll(r.Body)
 	var in Input
-	json.Unmarshal(body, &in)
-	t, _ := converterhex.HexToByte(in.T)
-	pubByte, _ := converterhex.HexToByte(in.Pub)
-	x, y := elliptic.Unmarshal(curve, pubByte)
-	pubKey := ecdsa.PublicKey{Curve: curve, X: x, Y: y}
-
-	AByte, _ := converterhex.HexToByte(in.A)
-	Ax, Ay := elliptic.Unmarshal(curve, AByte)
-	AKey := ecdsa.PublicKey{Curve: curve, X: Ax, Y: Ay}
-
-	pubSecretByte, _ := converterhex.HexToByte(in.PubSecret)
-	xSecret, ySecret := elliptic.Unmarshal(curve, pubSecretByte)
-	pubSecretKey := ecdsa.PublicKey{Curve: curve, X: xSecret, Y: ySecret}
+	if err := decode(r, &in); err != nil {
+		writeError(w, err)
+		return
+	}
+	var p parser
+	AKey := p.publicKey("A", in.A, wire.PublicKey)
+	t := p.scalar("t", in.T, wire.Scalar)
+	pubSecretKey := p.publicKey("pubSecret", in.PubSecret, wire.PublicKey)
+	nonce := p.nonce("nonce", in.Nonce)
+	if p.err != nil {
+		writeError(w, p.err)
+		return
+	}
+	context, issued := consumeChallenge(in.Nonce)
+	pubKey, _, _ := generators(1)
 
-	b := cryptolib.VerifyProof(curve, t, &AKey, &pubKey, &pubSecretKey)
+	end := span(r, "cryptolib.VerifyProof")
+	b := issued && cryptolib.VerifyProof(curve, t, AKey, pubKey, pubSecretKey, nonce, []byte(context))
+	end()
 
 	type Ret struct {
 		Verify string `json:"verify"`
@@ -536,9 +609,6 @@ func VerifyProofRandom(w http.ResponseWriter, r *http.Request) {
 	retByte, _ := json.Marshal(ret)
 	w.Header().Set("content-type", "application/json")
 	w.Write(retByte)
-	end := time.Now()
-	elapsed := end.Sub(start)
-	fmt.Println("VerifyProofRandom: ", elapsed)
 	return
 }
 
@@ -548,17 +618,135 @@ func VerifyProofRandom(w http.ResponseWriter, r *http.Request) {
  * @apiName VerifyProofAge
  * @apiGroup CP
  *
- * @apiDescription Verify the ZKP for the committed value
+ * @apiDescription Removed with /user/generateZKP/age. The route answers 410 route_removed, use /CP/verifyProof/ageRange
  *
- * @apiParam {String} A Random generated during the proof generation
- * @apiParam {String} t Public containing hidden generated during proof generation
- * @apiParam {String} pubSecret Public generator multiply by the secret value during the generation of the proof
+ * @apiErrorExample Error-Response:
+ *	HTTP/1.1 410 Gone
+ *		{
+ *			"code": "route_removed",
+ *			"message": "The proof of knowledge of age*G does not prove the age, use /user/generateZKP/ageRange and /CP/verifyProof/ageRange"
+ *		}
+ *
+ */
+func VerifyProofAge(w http.ResponseWriter, r *http.Request) {
+	writeError(w, errAgeProofRemoved)
+}
+
+/**
+ * @api {post} /user/generateZKP/ageRange Generate a range proof for the age
+ *
+ * @apiName GenerateZKPAgeRange
+ * @apiGroup User
+ *
+ * @apiDescription Prove that the age committed in the commitment of the attributes is greater or equal to the threshold, for the nonce of the CP,
+ * without revealing the age nor the other attributes. The age is committed as an integer attribute, "int:" followed by its decimal value,
+ * so that the proof is about the attribute that the CP certifies
+ *
+ * @apiParam {String[]} attributes Committed values, the age written "int:21"
+ * @apiParam {Number} [ageIndex=0] Index of the age in the attributes
+ * @apiParam {String} random Random returned by /user/commitment
+ * @apiParam {String} commitment Commitment returned by /user/commitment
+ * @apiParam {Number} threshold Minimal age asked by the SP
+ * @apiParam {String} nonce Nonce returned by /CP/challenge
+ * @apiParam {String} [context] Application context returned with the nonce
  *
  * @apiParamExample {json} Request-Example:
  *   {
- *	 		"A": "01234ABC...",
- *	 		"t": "01234ABC...",
- *	 		"pubSecret": "01234ABC...",
+ *		"attributes": ["FR", "int:21", "B"],
+ *		"ageIndex": 1,
+ *		"random": "2390913AD...",
+ *		"commitment": "0123456789ABC...",
+ *		"threshold": 18,
+ *		"nonce": "01234ABC...",
+ *		"context": "age verification for service X"
+ *	 }
+ *
+ * @apiSuccess {String} proof Proof that the committed age is greater or equal to the threshold
+ * @apiSuccess {Number} threshold Threshold used in the proof
+ *
+ * @apiSuccessExample Success-Response:
+ *	HTTP/1.1 200 OK
+ *		{
+ *	 		"proof": "01234ABC...",
+ *	 		"threshold": 18
+ *		}
+ *
+ * @apiUse RequestError
+ *
+ */
+func GenerateZKPAgeRange(w http.ResponseWriter, r *http.Request) {
+	type Input struct {
+		Attributes []string `json:"attributes"`
+		AgeIndex   int      `json:"ageIndex"`
+		Random     string   `json:"random"`
+		Commitment string   `json:"commitment"`
+		Threshold  int64    `json:"threshold"`
+		Nonce      string   `json:"nonce"`
+		Context    string   `json:"context"`
+	}
+	var in Input
+	if err := decode(r, &in); err != nil {
+		writeError(w, err)
+		return
+	}
+	var p parser
+	message := p.attributes("attributes", in.Attributes, "")
+	random := p.scalar("random", in.Random, wire.Scalar)
+	commit := p.point("commitment", in.Commitment, wire.Commitment)
+	nonce := p.nonce("nonce", in.Nonce)
+	if p.err != nil {
+		writeError(w, p.err)
+		return
+	}
+
+	h, gen, err := generators(len(message))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	end := span(r, "cryptolib.GenerateRangeProof")
+	proof, err := cryptolib.GenerateRangeProof(message, h, gen, random, commit, in.AgeIndex, big.NewInt(in.Threshold), ageRangeBits, nonce, []byte(in.Context))
+	end()
+	if err != nil {
+		//the age is not an integer attribute, is below the threshold or too far above it
+		writeError(w, cryptoError("attributes", err))
+		return
+	}
+
+	type Ret struct {
+		Proof     string `json:"proof"`
+		Threshold int64  `json:"threshold"`
+	}
+	ret := Ret{Proof: hex.EncodeToString(proof), Threshold: in.Threshold}
+	retByte, _ := json.Marshal(ret)
+	w.Header().Set("content-type", "application/json")
+	w.Write(retByte)
+	return
+}
+
+/**
+ * @api {post} /CP/verifyProof/ageRange Verify the range proof for the age
+ *
+ * @apiName VerifyProofAgeRange
+ * @apiGroup CP
+ *
+ * @apiDescription Verify that the age committed in the commitment of the attributes is greater or equal to the threshold
+ *
+ * @apiParam {String} commitment The commitment of the attributes
+ * @apiParam {Number} [attributeCount=1] The number of attributes in the commitment
+ * @apiParam {Number} [ageIndex=0] Index of the age in the attributes
+ * @apiParam {String} proof Range proof computed by the user
+ * @apiParam {Number} threshold Minimal age asked by the SP
+ * @apiParam {String} nonce Nonce returned by /CP/challenge and used in the proof. It is consumed by the verification
+ *
+ * @apiParamExample {json} Request-Example:
+ *   {
+ *	 		"commitment": "01234ABC...",
+ *	 		"attributeCount": 3,
+ *	 		"ageIndex": 1,
+ *	 		"proof": "01234ABC...",
+ *	 		"threshold": 18,
+ *	 		"nonce": "01234ABC..."
  *	 }
  *
  * @apiSuccess {String} verify Return "true" if proof is OK, "false" else
@@ -569,47 +757,70 @@ func VerifyProofRandom(w http.ResponseWriter, r *http.Request) {
  *	 		"verify": "true"
  *		}
  *
+ * @apiUse RequestError
+ *
  */
-func VerifyProofAge(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
+func VerifyProofAgeRange(w http.ResponseWriter, r *http.Request) {
 	type Input struct {
-		A         string `json:"A"`
-		T         string `json:"t"`
-		PubSecret string `json:"pubSecret"`
+		Commitment     string `json:"commitment"`
+		AttributeCount int    `json:"attributeCount"`
+		AgeIndex       int    `json:"ageIndex"`
+		Proof          string `json:"proof"`
+		Threshold      int64  `json:"threshold"`
+		Nonce          string `json:"nonce"`
 	}
-	body, _ := ioutil.ReadAll(r.Body)
 	var in Input
-	json.Unmarshal(body, &in)
-	t, _ := converterhex.HexToByte(in.T)
-	x, _ := new(big.Int).SetString(gx, 10)
-	y, _ := new(big.Int).SetString(gy, 10)
-	pubKey := ecdsa.PublicKey{Curve: curve, X: x, Y: y}
-
-	AByte, _ := converterhex.HexToByte(in.A)
-	Ax, Ay := elliptic.Unmarshal(curve, AByte)
-	AKey := ecdsa.PublicKey{Curve: curve, X: Ax, Y: Ay}
+	if err := decode(r, &in); err != nil {
+		writeError(w, err)
+		return
+	}
+	var p parser
+	commit := p.point("commitment", in.Commitment, wire.Commitment)
+	count := p.attributeCount("attributeCount", in.AttributeCount)
+	proof := p.value("proof", in.Proof, wire.RangeProof)
+	nonce := p.nonce("nonce", in.Nonce)
+	if p.err == nil && (in.AgeIndex < 0 || in.AgeIndex >= count) {
+		p.fail(badRequest(CodeInvalidValue, "ageIndex", errAgeIndex))
+	}
+	if p.err != nil {
+		writeError(w, p.err)
+		return
+	}
 
-	pubSecretByte, _ := converterhex.HexToByte(in.PubSecret)
-	xSecret, ySecret := elliptic.Unmarshal(curve, pubSecretByte)
-	pubSecretKey := ecdsa.PublicKey{Curve: curve, X: xSecret, Y: ySecret}
+	h, gen, err := generators(count)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
 
-	b := cryptolib.VerifyProof(curve, t, &AKey, &pubKey, &pubSecretKey)
+	//the request is well formed: the nonce is consumed, whether the proof verifies or not
+	context, issued := consumeChallenge(in.Nonce)
+	b := false
+	if issued {
+		end := span(r, "cryptolib.VerifyRangeProof")
+		b, err = cryptolib.VerifyRangeProof(h, gen, commit, in.AgeIndex, big.NewInt(in.Threshold), proof, nonce, []byte(context))
+		end()
+		if err != nil {
+			writeError(w, cryptoError("proof", err))
+			return
+		}
+	}
 
 	type Ret struct {
 		Verify string `json:"verify"`
 	}
 	var ret Ret
-	if b == true {
-		ret.Verify = "true"
-	} else {
+	if b != true {
 		ret.Verify = "false"
+		retByte, _ := json.Marshal(ret)
+		w.Header().Set("content-type", "application/json")
+		w.Write(retByte)
+		return
 	}
+	ret.Verify = "true"
 	retByte, _ := json.Marshal(ret)
 	w.Header().Set("content-type", "application/json")
 	w.Write(retByte)
-	end := time.Now()
-	elapsed := end.Sub(start)
-	fmt.Println("VerifyProofAge: ", elapsed)
 	return
 }
 
@@ -619,7 +830,8 @@ func VerifyProofAge(w http.ResponseWriter, r *http.Request) {
  * @apiName GeneratePairingKey
  * @apiGroup User
  *
- * @apiDescription Generate a private key and two public keys. Pairing goes from G1 x G2 -> GT. We need a public key for G1 and another for G2
+ * @apiDescription Generate a private key and two public keys. Pairing goes from G1 x G2 -> GT. We need a public key for G1 and another for G2.
+ * When the service has a keystore, the keys are generated with POST /keys instead and this route returns 403
  *
  * @apiSuccess {String} priv Private pairing key
  * @apiSuccess {String} g1Pub Public key for the first member
@@ -633,164 +845,505 @@ func VerifyProofAge(w http.ResponseWriter, r *http.Request) {
  *	 		"g2Pub": "01234ABC...",
  *		}
  *
+ * @apiUse RequestError
+ *
  */
 func GeneratePairingKey(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
+	if keys != nil {
+		writeError(w, errKeysInKeystore)
+		return
+	}
 	type Ret struct {
 		Priv  string `json:"priv"`
 		G1Pub string `json:"g1Pub"`
 		G2Pub string `json:"g2Pub"`
 	}
 
-	privByte, g1PubByte, g2PubByte, _ := cryptolib.GeneratePairingKey()
+	end := span(r, "cryptolib.GeneratePairingKey")
+	privByte, g1PubByte, g2PubByte, err := cryptolib.GeneratePairingKey()
+	end()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
 
 	ret := Ret{Priv: hex.EncodeToString(privByte), G1Pub: hex.EncodeToString(g1PubByte), G2Pub: hex.EncodeToString(g2PubByte)}
 	retByte, _ := json.Marshal(ret)
 	w.Header().Set("content-type", "application/json")
 	w.Write(retByte)
-	end := time.Now()
-	elapsed := end.Sub(start)
-	fmt.Println("GeneratePairingKey: ", elapsed)
 	return
 }
 
 /**
- * @api {post} /user/commitment Commitment Verification
+ * @api {post} /user/generateZKP/commitment Generate a proof of opening of the commitment
  *
- * @apiName Commitment
+ * @apiName GenerateZKPCommitment
  * @apiGroup User
  *
- * @apiDescription Verify that the commited values has been used in the commitment construction.
+ * @apiDescription Generate a ZKP of the knowledge of the committed attributes and of the random used in the commitment, without revealing any of them,
+ * for the nonce of the CP
  *
- * @apiParam {String} pubSecretAge commited age value
- * @apiParam {String} pubSecretRandom commited random value
- * @apiParam {String} commitment commitment value
+ * @apiParam {String[]} attributes Committed values
+ * @apiParam {String} [age] Single committed value, used when attributes is empty
+ * @apiParam {String} random Random returned by /user/commitment
+ * @apiParam {String} commitment Commitment returned by /user/commitment
+ * @apiParam {String} nonce Nonce returned by /CP/challenge
+ * @apiParam {String} [context] Application context returned with the nonce
  *
  * @apiParamExample {json} Request-Example:
  *	{
- *
- *		"pubSecretAge": "27",
- *		"pubSecretRandom": "2390913AD...",
+ *		"attributes": ["1990-01-31", "FR"],
+ *		"random": "2390913AD...",
  *		"commitment": "0123456789ABC...",
+ *		"nonce": "01234ABC...",
+ *		"context": "issuance of the driving licence"
  *	}
  *
- * @apiSuccess {String} verify true if the commitment is well construct, false else
+ * @apiSuccess {String} proof The proof of opening
  *
  * @apiSuccessExample Success-Response:
  *	HTTP/1.1 200 OK
  *		{
- *			"verify": "true"
+ *			"proof": "01234ABC..."
  *		}
  *
+ * @apiUse RequestError
+ *
  */
-func VerifyCommitment(w http.ResponseWriter, r *http.Request) {
+func GenerateZKPCommitment(w http.ResponseWriter, r *http.Request) {
 	type Input struct {
-		PubSecretAge    string `json:"pubSecretAge"`
-		PubSecretRandom string `json:"pubSecretRandom"`
-		Commitment      string `json:"commitment"`
+		Age        string   `json:"age"`
+		Attributes []string `json:"attributes"`
+		Random     string   `json:"random"`
+		Commitment string   `json:"commitment"`
+		Nonce      string   `json:"nonce"`
+		Context    string   `json:"context"`
 	}
-
-	body, _ := ioutil.ReadAll(r.Body)
 	var in Input
-	json.Unmarshal(body, &in)
-	commit, _ := converterhex.HexToByte(in.Commitment)
-
-	pubSecretAgeByte, _ := converterhex.HexToByte(in.PubSecretAge)
-	xSecretAge, ySecretAge := elliptic.Unmarshal(curve, pubSecretAgeByte)
-	pubSecretAgeKey := ecdsa.PublicKey{Curve: curve, X: xSecretAge, Y: ySecretAge}
-
-	pubSecretRandomByte, _ := converterhex.HexToByte(in.PubSecretRandom)
-	xSecretRandom, ySecretRandom := elliptic.Unmarshal(curve, pubSecretRandomByte)
-	pubSecretRandomKey := ecdsa.PublicKey{Curve: curve, X: xSecretRandom, Y: ySecretRandom}
-
-	commitX, commitY := elliptic.Unmarshal(curve, commit)
-
-	tmpX, tmpY := curve.Add(pubSecretAgeKey.X, pubSecretRandomKey.X, pubSecretAgeKey.Y, pubSecretRandomKey.Y)
+	if err := decode(r, &in); err != nil {
+		writeError(w, err)
+		return
+	}
+	var p parser
+	message := p.attributes("attributes", in.Attributes, in.Age)
+	random := p.scalar("random", in.Random, wire.Scalar)
+	commit := p.point("commitment", in.Commitment, wire.Commitment)
+	nonce := p.nonce("nonce", in.Nonce)
+	if p.err != nil {
+		writeError(w, p.err)
+		return
+	}
 
 	type Ret struct {
-		Verified string `json:"verify"`
+		Proof string `json:"proof"`
 	}
 	var ret Ret
 
-	if (tmpX.Cmp(commitX) != 0) || (tmpY.Cmp(commitY) != 0) {
-		ret.Verified = "false"
-		retByte, _ := json.Marshal(ret)
-		w.Header().Set("content-type", "application/json")
-		w.Write(retByte)
-
+	h, gen, err := generators(len(message))
+	if err != nil {
+		writeError(w, err)
 		return
 	}
-	ret.Verified = "true"
+	end := span(r, "cryptolib.GenerateOpeningProof")
+	proof, err := cryptolib.GenerateOpeningProof(message, h, gen, random, commit, nonce, []byte(in.Context))
+	end()
+	if err != nil {
+		writeError(w, cryptoError("", err))
+		return
+	}
+
+	ret.Proof = hex.EncodeToString(proof)
 	retByte, _ := json.Marshal(ret)
 	w.Header().Set("content-type", "application/json")
 	w.Write(retByte)
-
 	return
 }
 
 /**
- * @api {post} /CP/generateCertificate Generate a certificate
+ * @api {post} /CP/verifyProof/commitment Commitment Verification
  *
- * @apiName GenerateCertificate
+ * @apiName VerifyCommitment
  * @apiGroup CP
  *
- * @apiDescription Generate a certificate used in the protocol
+ * @apiDescription Verify the proof that the user knows the committed values and the random used in the commitment construction,
+ * for a nonce issued by /CP/challenge.
  *
- * @apiParam {String} commitment The committed attribute of the user
- * @apiParam {String} privCP The private pairing key of the certificate provider, used to compute the certificate
- * @apiParam {String} pubG2User The public key of the user. Second member public key is used
+ * @apiParam {String} commitment commitment value
+ * @apiParam {Number} [attributeCount=1] The number of attributes in the commitment
+ * @apiParam {String} proof Proof of opening returned by /user/generateZKP/commitment
+ * @apiParam {String} nonce Nonce used in the proof. It is consumed by the verification
  *
  * @apiParamExample {json} Request-Example:
- *   {
- *	 		"commitment": "01234ABC...",
- *	 		"privCP": "01234ABC...",
- *	 		"pubG2User": "01234ABC...",
- *	 }
+ *	{
+ *		"commitment": "0123456789ABC...",
+ *		"attributeCount": 2,
+ *		"proof": "01234ABC...",
+ *		"nonce": "01234ABC..."
+ *	}
  *
- * @apiSuccess {String} certificate Return the certificate of the user for the committed attributes
+ * @apiSuccess {String} verify true if the proof is correct, false else
  *
  * @apiSuccessExample Success-Response:
  *	HTTP/1.1 200 OK
  *		{
- *	 		"certificate": "1929422ABE"
+ *			"verify": "true"
  *		}
  *
+ * @apiUse RequestError
+ *
  */
-func GenerateCertificate(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
+func VerifyCommitment(w http.ResponseWriter, r *http.Request) {
 	type Input struct {
-		Commitment string `json:"commitment"`
-		PubG2      string `json:"pubG2User"`
-		PrivCP     string `json:"privCP"`
+		Commitment     string `json:"commitment"`
+		AttributeCount int    `json:"attributeCount"`
+		Proof          string `json:"proof"`
+		Nonce          string `json:"nonce"`
 	}
-	body, _ := ioutil.ReadAll(r.Body)
+
 	var in Input
-	json.Unmarshal(body, &in)
-	commit, _ := converterhex.HexToByte(in.Commitment)
-	pubByte, _ := converterhex.HexToByte(in.PubG2)
-	priv, _ := converterhex.HexToByte(in.PrivCP)
+	if err := decode(r, &in); err != nil {
+		writeError(w, err)
+		return
+	}
+	var p parser
+	commit := p.point("commitment", in.Commitment, wire.Commitment)
+	count := p.attributeCount("attributeCount", in.AttributeCount)
+	proof := p.value("proof", in.Proof, wire.OpeningProof)
+	nonce := p.nonce("nonce", in.Nonce)
+	if p.err != nil {
+		writeError(w, p.err)
+		return
+	}
 
 	type Ret struct {
-		Certificate string `json:"certificate"`
+		Verified string `json:"verify"`
 	}
 	var ret Ret
 
-	cert, err := cryptolib.GenerateCertificate(commit, priv, pubByte)
+	h, gen, err := generators(count)
 	if err != nil {
-		ret.Certificate = "false"
-		certByte, _ := json.Marshal(ret)
+		writeError(w, err)
+		return
+	}
+
+	//the request is well formed: the nonce is consumed, whether the proof verifies or not
+	context, issued := consumeChallenge(in.Nonce)
+	b := false
+	if issued {
+		end := span(r, "cryptolib.VerifyOpeningProof")
+		b, err = cryptolib.VerifyOpeningProof(h, gen, commit, proof, nonce, []byte(context))
+		end()
+		if err != nil {
+			writeError(w, cryptoError("proof", err))
+			return
+		}
+	}
+	if b != true {
+		ret.Verified = "false"
+		retByte, _ := json.Marshal(ret)
 		w.Header().Set("content-type", "application/json")
-		w.Write(certByte)
+		w.Write(retByte)
+		return
+	}
+	ret.Verified = "true"
+	retByte, _ := json.Marshal(ret)
+	w.Header().Set("content-type", "application/json")
+	w.Write(retByte)
+	return
+}
+
+/**
+ * @api {post} /user/generateZKP/attributeKey Generate the proof of the attribute key
+ *
+ * @apiName GenerateZKPAttributeKey
+ * @apiGroup User
+ *
+ * @apiDescription Compute the attribute key of the user, the key that the CP certifies instead of pubG2User so that the attributes can be disclosed
+ * from a presentation without the commitment, and a ZKP that it holds the committed attributes and that the user knows its private pairing key,
+ * for the nonce of the CP. The proof has 256 bit proofs per attribute: it takes one to two seconds and 180 KB of hexadecimal per attribute
+ *
+ * @apiParam {String[]} attributes Committed values
+ * @apiParam {String} [age] Single committed value, used when attributes is empty
+ * @apiParam {String} random Random returned by /user/commitment
+ * @apiParam {String} commitment Commitment returned by /user/commitment
+ * @apiParam {String} [privUser] The private pairing key of the user. Refused when the service has a keystore
+ * @apiParam {String} [keyID] ID of the pairing key of the user in the keystore, owned by the holder
+ * @apiParam {String} nonce Nonce returned by /CP/challenge
+ * @apiParam {String} [context] Application context returned with the nonce
+ *
+ * @apiParamExample {json} Request-Example:
+ *	{
+ *		"attributes": ["1990-01-31", "FR", "B"],
+ *		"random": "2390913AD...",
+ *		"commitment": "0123456789ABC...",
+ *		"privUser": "01234ABC...",
+ *		"nonce": "01234ABC...",
+ *		"context": "issuance of the driving licence"
+ *	}
+ *
+ * @apiSuccess {String} attributeKey The attribute key
+ * @apiSuccess {String} proof The proof that the attribute key holds the committed attributes
+ *
+ * @apiSuccessExample Success-Response:
+ *	HTTP/1.1 200 OK
+ *		{
+ *			"attributeKey": "0123456789ABC...",
+ *			"proof": "01234ABC..."
+ *		}
+ *
+ * @apiUse RequestError
+ *
+ */
+func GenerateZKPAttributeKey(w http.ResponseWriter, r *http.Request) {
+	type Input struct {
+		Age        string   `json:"age"`
+		Attributes []string `json:"attributes"`
+		Random     string   `json:"random"`
+		Commitment string   `json:"commitment"`
+		PrivUser   string   `json:"privUser"`
+		KeyID      string   `json:"keyID"`
+		Nonce      string   `json:"nonce"`
+		Context    string   `json:"context"`
+	}
+	var in Input
+	if err := decode(r, &in); err != nil {
+		writeError(w, err)
+		return
+	}
+	var p parser
+	message := p.attributes("attributes", in.Attributes, in.Age)
+	random := p.scalar("random", in.Random, wire.Scalar)
+	commit := p.point("commitment", in.Commitment, wire.Commitment)
+	nonce := p.nonce("nonce", in.Nonce)
+	if p.err != nil {
+		writeError(w, p.err)
+		return
+	}
+	holder, err := holderKey(in.KeyID, in.PrivUser)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	h, gen, err := generators(len(message))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	keyGen, err := keyGenerators(len(message))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	key, err := keyGen.Key(&holder.HolderPublicKey, message, random)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	end := span(r, "cryptolib.GenerateAttributeKeyProof")
+	proof, err := cryptolib.GenerateAttributeKeyProof(rand.Reader, message, h, gen, random, commit, keyGen, holder, nonce, []byte(in.Context))
+	end()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	type Ret struct {
+		AttributeKey string `json:"attributeKey"`
+		Proof        string `json:"proof"`
+	}
+	ret := Ret{AttributeKey: hex.EncodeToString(key.Marshal()), Proof: hex.EncodeToString(proof.Marshal())}
+	retByte, _ := json.Marshal(ret)
+	w.Header().Set("content-type", "application/json")
+	w.Write(retByte)
+	return
+}
+
+/**
+ * @api {post} /CP/verifyProof/attributeKey Verify the proof of the attribute key
+ *
+ * @apiName VerifyProofAttributeKey
+ * @apiGroup CP
+ *
+ * @apiDescription Verify the proof that the attribute key of the user holds the committed attributes and that the user knows the private key of pubG2User,
+ * and return the key.
+ * The CP then gives it as pubG2User to /CP/generateCertificate, so that the user can disclose attributes with /user/presentCertificate
+ *
+ * @apiParam {String} commitment The commitment of the attributes
+ * @apiParam {Number} [attributeCount=1] The number of attributes in the commitment
+ * @apiParam {String} pubG2User The public pairing key of the user
+ * @apiParam {String} proof The proof returned by /user/generateZKP/attributeKey
+ * @apiParam {String} nonce Nonce returned by /CP/challenge and used in the proof. It is consumed by the verification
+ *
+ * @apiParamExample {json} Request-Example:
+ *	{
+ *		"commitment": "0123456789ABC...",
+ *		"attributeCount": 3,
+ *		"pubG2User": "01234ABC...",
+ *		"proof": "01234ABC...",
+ *		"nonce": "01234ABC..."
+ *	}
+ *
+ * @apiSuccess {String} verify true if the proof is correct, false else
+ * @apiSuccess {String} [attributeKey] The attribute key to certify, when the proof is correct
+ *
+ * @apiSuccessExample Success-Response:
+ *	HTTP/1.1 200 OK
+ *		{
+ *			"verify": "true",
+ *			"attributeKey": "0123456789ABC..."
+ *		}
+ *
+ * @apiUse RequestError
+ *
+ */
+func VerifyProofAttributeKey(w http.ResponseWriter, r *http.Request) {
+	type Input struct {
+		Commitment     string `json:"commitment"`
+		AttributeCount int    `json:"attributeCount"`
+		PubG2User      string `json:"pubG2User"`
+		Proof          string `json:"proof"`
+		Nonce          string `json:"nonce"`
+	}
+	var in Input
+	if err := decode(r, &in); err != nil {
+		writeError(w, err)
 		return
 	}
+	var p parser
+	commit := p.point("commitment", in.Commitment, wire.Commitment)
+	count := p.attributeCount("attributeCount", in.AttributeCount)
+	holder := p.holderPublicKey("pubG2User", in.PubG2User)
+	proofByte := p.value("proof", in.Proof, wire.AttributeKeyProof)
+	nonce := p.nonce("nonce", in.Nonce)
+	if p.err != nil {
+		writeError(w, p.err)
+		return
+	}
+	var proof cryptolib.AttributeKeyProof
+	if err := proof.Unmarshal(proofByte); err != nil {
+		writeError(w, cryptoError("proof", err))
+		return
+	}
+
+	h, gen, err := generators(count)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	keyGen, err := keyGenerators(count)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	//the request is well formed: the nonce is consumed, whether the proof verifies or not
+	context, issued := consumeChallenge(in.Nonce)
+	var key *cryptolib.HolderPublicKey
+	b := false
+	if issued {
+		end := span(r, "cryptolib.VerifyAttributeKeyProof")
+		key, b, err = cryptolib.VerifyAttributeKeyProof(h, gen, commit, keyGen, holder, &proof, nonce, []byte(context))
+		end()
+		if err != nil {
+			writeError(w, cryptoError("proof", err))
+			return
+		}
+	}
+
+	type Ret struct {
+		Verify       string `json:"verify"`
+		AttributeKey string `json:"attributeKey,omitempty"`
+	}
+	ret := Ret{Verify: "false"}
+	if b {
+		ret = Ret{Verify: "true", AttributeKey: hex.EncodeToString(key.Marshal())}
+	}
+	retByte, _ := json.Marshal(ret)
+	w.Header().Set("content-type", "application/json")
+	w.Write(retByte)
+	return
+}
 
-	ret.Certificate = hex.EncodeToString(cert)
+/**
+ * @api {post} /CP/generateCertificate Generate a certificate
+ *
+ * @apiName GenerateCertificate
+ * @apiGroup CP
+ *
+ * @apiDescription Generate a certificate used in the protocol.
+ * When the service has an issuer for the CP (a key file or a remote signer), it issues with it and the request gives neither privCP nor keyID
+ *
+ * @apiParam {String} commitment The committed attributes of the user
+ * @apiParam {Number} [attributeCount=1] The number of attributes in the commitment
+ * @apiParam {String} [privCP] The private pairing key of the certificate provider, used to compute the certificate. Refused when the service has a keystore
+ * @apiParam {String} [keyID] ID of the pairing key of the certificate provider in the keystore, owned by the CP
+ * @apiParam {String} pubG2User The public key of the user. Second member public key is used
+ *
+ * @apiParamExample {json} Request-Example:
+ *   {
+ *	 		"commitment": "01234ABC...",
+ *	 		"attributeCount": 4,
+ *	 		"privCP": "01234ABC...",
+ *	 		"pubG2User": "01234ABC...",
+ *	 }
+ *
+ * @apiSuccess {String} certificate Return the certificate of the user for the committed attributes
+ *
+ * @apiSuccessExample Success-Response:
+ *	HTTP/1.1 200 OK
+ *		{
+ *	 		"certificate": "1929422ABE"
+ *		}
+ *
+ * @apiUse RequestError
+ *
+ */
+func GenerateCertificate(w http.ResponseWriter, r *http.Request) {
+	type Input struct {
+		Commitment     string `json:"commitment"`
+		AttributeCount int    `json:"attributeCount"`
+		PubG2          string `json:"pubG2User"`
+		PrivCP         string `json:"privCP"`
+		KeyID          string `json:"keyID"`
+	}
+	var in Input
+	if err := decode(r, &in); err != nil {
+		writeError(w, err)
+		return
+	}
+	var p parser
+	commit := p.point("commitment", in.Commitment, wire.Commitment)
+	count := p.attributeCount("attributeCount", in.AttributeCount)
+	holder := p.holderPublicKey("pubG2User", in.PubG2)
+	if p.err != nil {
+		writeError(w, p.err)
+		return
+	}
+	issuer, err := issuerKey(in.KeyID, in.PrivCP)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	type Ret struct {
+		Certificate string `json:"certificate"`
+	}
+	var ret Ret
+
+	//the inputs are valid: an error of the issuer, which may be remote, is an error of the service
+	end := span(r, "cryptolib.Issuer.Issue")
+	cred, err := issuer.Issue(commit, count, holder)
+	end()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	ret.Certificate = hex.EncodeToString(cred.Certificate.Marshal())
 	certByte, _ := json.Marshal(ret)
 	w.Header().Set("content-type", "application/json")
 	w.Write(certByte)
-	end := time.Now()
-	elapsed := end.Sub(start)
-	fmt.Println("GenerateCertificate: ", elapsed)
 	return
 }
 
@@ -802,7 +1355,8 @@ func GenerateCertificate(w http.ResponseWriter, r *http.Request) {
  *
  * @apiDescription Verify a classic certificate with the public parameter. Used by the user to check if the CP is honest
  *
- * @apiParam {String} commitment The committed attribute of the user
+ * @apiParam {String} commitment The committed attributes of the user
+ * @apiParam {Number} [attributeCount=1] The number of attributes in the commitment
  * @apiParam {String} certificate The certificate
  * @apiParam {String} pubG1CP The public key of the cetificate provider. First member is used
  * @apiParam {String} pubG2User The public key of the user. Second member public key is used
@@ -810,6 +1364,7 @@ func GenerateCertificate(w http.ResponseWriter, r *http.Request) {
  * @apiParamExample {json} Request-Example:
  *   {
  *	 		"commitment": "01234ABC...",
+ *	 		"attributeCount": 4,
  *	 		"certificate": "01234ABC...",
  *	 		"pubG1CP": "01234ABC...",
  *	 		"pubG2User": "01234ABC...",
@@ -823,30 +1378,50 @@ func GenerateCertificate(w http.ResponseWriter, r *http.Request) {
  *	 		"verify": "true"
  *		}
  *
+ * @apiUse RequestError
+ *
  */
 func VerifyCertificate(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
 	type Input struct {
-		Commitment  string `json:"commitment"`
-		Certificate string `json:"certificate"`
-		PubG1CP     string `json:"pubG1CP"`
-		PubG2User   string `json:"pubG2User"`
+		Commitment     string `json:"commitment"`
+		AttributeCount int    `json:"attributeCount"`
+		Certificate    string `json:"certificate"`
+		PubG1CP        string `json:"pubG1CP"`
+		PubG2User      string `json:"pubG2User"`
 	}
-	body, _ := ioutil.ReadAll(r.Body)
 	var in Input
-	json.Unmarshal(body, &in)
-	commit, _ := converterhex.HexToByte(in.Commitment)
-	certificate, _ := converterhex.HexToByte(in.Certificate)
-	pubG1CP, _ := converterhex.HexToByte(in.PubG1CP)
-	pubG2User, _ := converterhex.HexToByte(in.PubG2User)
+	if err := decode(r, &in); err != nil {
+		writeError(w, err)
+		return
+	}
+	var p parser
+	commit := p.point("commitment", in.Commitment, wire.Commitment)
+	count := p.attributeCount("attributeCount", in.AttributeCount)
+	certificate := p.value("certificate", in.Certificate, wire.Certificate)
+	issuer := p.issuerPublicKey("pubG1CP", in.PubG1CP)
+	holder := p.holderPublicKey("pubG2User", in.PubG2User)
+	if p.err != nil {
+		writeError(w, p.err)
+		return
+	}
 
 	type Ret struct {
 		Verify string `json:"verify"`
 	}
 	var ret Ret
-	b, err := cryptolib.VerifyCertificate(commit, certificate, pubG1CP, pubG2User)
-	if err != nil || b != true {
-		fmt.Println(err)
+	cred, err := cryptolib.NewCredential(commit, count, certificate)
+	if err != nil {
+		writeError(w, cryptoError("certificate", err))
+		return
+	}
+	end := span(r, "cryptolib.Credential.Verify")
+	b, err := cred.Verify(issuer, holder)
+	end()
+	if err != nil {
+		writeError(w, cryptoError("certificate", err))
+		return
+	}
+	if b != true {
 		ret.Verify = "false"
 		retByte, _ := json.Marshal(ret)
 		w.Header().Set("content-type", "application/json")
@@ -857,9 +1432,6 @@ func VerifyCertificate(w http.ResponseWriter, r *http.Request) {
 	retByte, _ := json.Marshal(ret)
 	w.Header().Set("content-type", "application/json")
 	w.Write(retByte)
-	end := time.Now()
-	elapsed := end.Sub(start)
-	fmt.Println("VerifyCertificate: ", elapsed)
 	return
 }
 
@@ -869,30 +1441,40 @@ func VerifyCertificate(w http.ResponseWriter, r *http.Request) {
  * @apiName BlindCertificate
  * @apiGroup User
  *
- * @apiDescription Blind the certificate, pubG2User, the hashed commitment, pubG1CP, G1 (the generator of the curve)
+ * @apiDescription Blind the certificate, pubG2User, the hashed commitment, pubG1CP, G1 (the generator of the curve).
+ * Neither the blinding factor nor the blinded private key is returned, since the private key of the user would be blindPrivUser/blindFactor.
+ * Use /user/presentCertificate to obtain a presentation with a proof of knowledge of the blinding secret to send to a SP
  *
- * @apiParam {String} commitment The committed attribute of the user. The commitment is hashed inside the function
+ * @apiParam {String} commitment The committed attributes of the user. The commitment is hashed inside the function
+ * @apiParam {Number} [attributeCount=1] The number of attributes in the commitment
  * @apiParam {String} certificate The certificate
  * @apiParam {String} pubG1CP The public key of the cetificate provider. First member is used
  * @apiParam {String} pubG2User The public key of the user. Second member public key is used
- * @apiParam {String} privUser The pairing private key of the user
+ * @apiParam {String} [privUser] The pairing private key of the user, refused when the service has a keystore
+ * @apiParam {String} [keyID] ID of the pairing key of the user in the keystore, owned by the holder. "id@version" selects the version for which the certificate was issued
+ * @apiParam {String} [nonce] Nonce of the challenge returned by the issueChallenge function of the chaincode, bound into issuerProof
+ * @apiParam {String} [context] Context of the challenge
  *
  * @apiParamExample {json} Request-Example:
  *   {
  *	 		"commitment": "01234ABC...",
+ *	 		"attributeCount": 4,
  *	 		"certificate": "01234ABC...",
  *	 		"pubG1CP": "01234ABC...",
  *	 		"pubG2User": "01234ABC...",
  *	 		"privUser": "01234ABC...",
+ *	 		"nonce": "01234ABC...",
+ *	 		"context": "age verification for service X",
  *	 }
  *
  * @apiSuccess {String} blindCommitment The blinded commitment
  * @apiSuccess {String} blindCertificate The blinded certificate
  * @apiSuccess {String} blindPubG1CP The blinded public key G1 of the CP
  * @apiSuccess {String} blindPubG2User The blinded public key G2 o the user
- * @apiSuccess {String} blindPrivUser The blinded private key of ther user
  * @apiSuccess {String} blindGenerator The blinded G1 generator
- * @apiSuccess {String} blindFactor The random b which blind all the other values
+ * @apiSuccess {Number} attributeCount The number of attributes covered by the certificate
+ * @apiSuccess {String} issuerProof The proof that blindPubG1CP is derived from pubG1CP, for the challenge (nonce, context).
+ * It is checked by the verify chaincode against the registered CP
  *
  * @apiSuccessExample Success-Response:
  *	HTTP/1.1 200 OK
@@ -901,55 +1483,96 @@ func VerifyCertificate(w http.ResponseWriter, r *http.Request) {
  *	 		"blindCertificate": "01234ABC...",
  *	 		"blindPubG1CP": "01234ABC...",
  *	 		"blindPubG2User": "01234ABC...",
- *	 		"blindPrivUser": "01234ABC...",
  *			"blindGenerator": "BBBAABA11...",
- *			"blindFactor": "ABABAB113EE...",
+ *			"attributeCount": 4,
+ *			"issuerProof": "ABABAB113EE...",
  *		}
  *
+ * @apiUse RequestError
+ *
  */
 func BlindCertificate(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
 	type Input struct {
-		Commitment  string `json:"commitment"`
-		Certificate string `json:"certificate"`
-		PubG1CP     string `json:"pubG1CP"`
-		PubG2User   string `json:"pubG2User"`
-		PrivUser    string `json:"privUser"`
+		Commitment     string `json:"commitment"`
+		AttributeCount int    `json:"attributeCount"`
+		Certificate    string `json:"certificate"`
+		PubG1CP        string `json:"pubG1CP"`
+		PubG2User      string `json:"pubG2User"`
+		PrivUser       string `json:"privUser"`
+		KeyID          string `json:"keyID"`
+		Nonce          string `json:"nonce"`
+		Context        string `json:"context"`
 	}
 
-	body, _ := ioutil.ReadAll(r.Body)
 	var in Input
-	json.Unmarshal(body, &in)
+	if err := decode(r, &in); err != nil {
+		writeError(w, err)
+		return
+	}
 
-	commit, _ := converterhex.HexToByte(in.Commitment)
-	certificate, _ := converterhex.HexToByte(in.Certificate)
-	pubG1CP, _ := converterhex.HexToByte(in.PubG1CP)
-	pubG2User, _ := converterhex.HexToByte(in.PubG2User)
-	privUser, _ := converterhex.HexToByte(in.PrivUser)
+	var parse parser
+	commit := parse.point("commitment", in.Commitment, wire.Commitment)
+	count := parse.attributeCount("attributeCount", in.AttributeCount)
+	certificate := parse.value("certificate", in.Certificate, wire.Certificate)
+	issuer := parse.issuerPublicKey("pubG1CP", in.PubG1CP)
+	holderPub := parse.holderPublicKey("pubG2User", in.PubG2User)
+	var nonce []byte
+	if in.Nonce != "" {
+		nonce = parse.nonce("nonce", in.Nonce)
+	}
+	if parse.err != nil {
+		writeError(w, parse.err)
+		return
+	}
+	holder, err := holderKey(in.KeyID, in.PrivUser)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	//the certificate is verified against the public key of the private key of the user, pubG2User must be the same key
+	if !bytes.Equal(holderPub.Marshal(), holder.HolderPublicKey.Marshal()) {
+		writeError(w, badRequest(CodeInvalidValue, "pubG2User", errors.New("pubG2User is not the public key of the user")))
+		return
+	}
 
-	commitByte, certificateByte, pubG1CPByte, pubG2UserByte, privUserByte, generatorByte, randomByte :=
-		cryptolib.BlindCertificate(commit, certificate, pubG1CP, pubG2User, privUser)
+	cred, err := cryptolib.NewCredential(commit, count, certificate)
+	if err != nil {
+		writeError(w, cryptoError("certificate", err))
+		return
+	}
+	end := span(r, "cryptolib.HolderKey.Blind")
+	p, secret, err := holder.Blind(rand.Reader, cred, issuer)
+	end()
+	if err != nil {
+		//the certificate does not verify for the given number of attributes
+		writeError(w, cryptoError("certificate", err))
+		return
+	}
+	end = span(r, "cryptolib.BlindingSecret.ProveIssuer")
+	issuerProof, err := secret.ProveIssuer(rand.Reader, p, issuer, nonce, []byte(in.Context))
+	end()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
 
 	type Ret struct {
-		Commitment  string `json:"blindCommitment"`
-		Certificate string `json:"blindCertificate"`
-		PubG1CP     string `json:"blindPubG1CP"`
-		PubG2User   string `json:"blindPubG2User"`
-		PrivUser    string `json:"blindPrivUser"`
-		Generator   string `json:"blindGenerator"`
-		Random      string `json:"blindFactor"`
+		Commitment     string `json:"blindCommitment"`
+		Certificate    string `json:"blindCertificate"`
+		PubG1CP        string `json:"blindPubG1CP"`
+		PubG2User      string `json:"blindPubG2User"`
+		Generator      string `json:"blindGenerator"`
+		AttributeCount int    `json:"attributeCount"`
+		IssuerProof    string `json:"issuerProof"`
 	}
 
-	ret := Ret{Commitment: hex.EncodeToString(commitByte), Certificate: hex.EncodeToString(certificateByte), PubG1CP: hex.EncodeToString(pubG1CPByte),
-		PubG2User: hex.EncodeToString(pubG2UserByte), PrivUser: hex.EncodeToString(privUserByte),
-		Generator: hex.EncodeToString(generatorByte), Random: hex.EncodeToString(randomByte)}
+	ret := Ret{Commitment: hex.EncodeToString(p.Commitment.Bytes()), Certificate: hex.EncodeToString(p.Certificate.Marshal()), PubG1CP: hex.EncodeToString(p.IssuerKey.Marshal()),
+		PubG2User: hex.EncodeToString(p.HolderKey.Marshal()), Generator: hex.EncodeToString(p.Generator.Marshal()), AttributeCount: p.AttributeCount,
+		IssuerProof: hex.EncodeToString(issuerProof.Marshal())}
 
 	retByte, _ := json.Marshal(ret)
 	w.Header().Set("content-type", "application/json")
 	w.Write(retByte)
-	end := time.Now()
-	elapsed := end.Sub(start)
-	fmt.Println("BlindCertificate: ", elapsed)
 	return
 }
 
@@ -959,13 +1582,20 @@ func BlindCertificate(w http.ResponseWriter, r *http.Request) {
  * @apiName VerifyBlindedCertificate
  * @apiGroup SP
  *
- * @apiDescription Verify the blinded certificate with the  public parameter
+ * @apiDeprecated use now (#SP:VerifyPresentation).
+ *
+ * @apiDescription Verify the blinded certificate with the  public parameter.
+ * The presenter does not prove that it knows the blinding secret: a presentation seen once can be sent again by anyone.
+ * It takes no disclosure mask: the attributes are disclosed with /SP/verifyPresentation, which binds the disclosure proof to a nonce.
+ * Attributes are disclosed with /user/presentCertificate and /SP/verifyPresentation, without the commitment: a request with a commitment is refused.
+ * The answers carry the Deprecation header and a link to /SP/verifyPresentation
  *
  * @apiParam {String} blindCommitment The blinded commitment
  * @apiParam {String} blindCertificate The blinded certificate
  * @apiParam {String} blindPubG1CP The blinded public key G1 of the CP
  * @apiParam {String} blindPubG2User The blinded public key G2 o the user
  * @apiParam {String} blindGenerator The blinded G1 generator
+ * @apiParam {Number} [attributeCount=1] The number of attributes covered by the certificate
  *
  * @apiParamExample {json} Request-Example:
  *   {
@@ -974,7 +1604,7 @@ func BlindCertificate(w http.ResponseWriter, r *http.Request) {
  *	 		"blindPubG1CP": "01234ABC...",
  *	 		"blindPubG2User": "01234ABC...",
  *			"blindGenerator": "BBBAABA11...",
- *		}
+ *			"attributeCount": 4
  *	 }
  *
  * @apiSuccess {String} verify Return "true" if OK, "false" else
@@ -985,33 +1615,410 @@ func BlindCertificate(w http.ResponseWriter, r *http.Request) {
  *			"verify": "true"
  *		}
  *
+ * @apiUse RequestError
+ *
  */
 func VerifyBlindedCertificate(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
+	w.Header().Set("Deprecation", "true")
+	w.Header().Set("Link", `</SP/verifyPresentation>; rel="successor-version"`)
 	type Input struct {
 		BlindCommitment  string `json:"blindCommitment"`
 		BlindPubG1CP     string `json:"blindPubG1CP"`
 		BlindPubG2User   string `json:"blindPubG2User"`
 		BlindCertificate string `json:"blindCertificate"`
 		BlindGenerator   string `json:"blindGenerator"`
+		AttributeCount   int    `json:"attributeCount"`
+		Commitment       string `json:"commitment"`
 	}
-	body, _ := ioutil.ReadAll(r.Body)
 	var in Input
-	json.Unmarshal(body, &in)
+	if err := decode(r, &in); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var parse parser
+	blindCommit := parse.value("blindCommitment", in.BlindCommitment, wire.BlindCommitment)
+	blindCertificate := parse.value("blindCertificate", in.BlindCertificate, wire.Certificate)
+	blindPubG1CP := parse.value("blindPubG1CP", in.BlindPubG1CP, wire.IssuerPublicKey)
+	blindPubG2User := parse.value("blindPubG2User", in.BlindPubG2User, wire.HolderPublicKey)
+	blindGenerator := parse.value("blindGenerator", in.BlindGenerator, wire.G1Point)
+	count := parse.attributeCount("attributeCount", in.AttributeCount)
+	if in.Commitment != "" {
+		//the commitment would link the presentations of the user
+		parse.fail(badRequest(CodeInvalidValue, "commitment", errCommitmentInClear))
+	}
+	if parse.err != nil {
+		writeError(w, parse.err)
+		return
+	}
+
+	p, err := cryptolib.NewBlindedPresentation(blindCommit, count, blindCertificate, blindPubG1CP, blindPubG2User, blindGenerator)
+	if err != nil {
+		writeError(w, cryptoError("", err))
+		return
+	}
+	end := span(r, "cryptolib.BlindedPresentation.Verify")
+	b, err := p.Verify()
+	end()
+	if err != nil {
+		writeError(w, cryptoError("", err))
+		return
+	}
+	type Ret struct {
+		Verify string `json:"verify"`
+	}
+	var ret Ret
+	if b != true {
+		ret.Verify = "false"
+		retByte, _ := json.Marshal(ret)
+		w.Header().Set("content-type", "application/json")
+		w.Write(retByte)
+		return
+	}
+	ret.Verify = "true"
+	retByte, _ := json.Marshal(ret)
+	w.Header().Set("content-type", "application/json")
+	w.Write(retByte)
+	return
+}
 
-	blindCommit, _ := converterhex.HexToByte(in.BlindCommitment)
-	blindCertificate, _ := converterhex.HexToByte(in.BlindCertificate)
-	blindPubG1CP, _ := converterhex.HexToByte(in.BlindPubG1CP)
-	blindPubG2User, _ := converterhex.HexToByte(in.BlindPubG2User)
-	blindGenerator, _ := converterhex.HexToByte(in.BlindGenerator)
+/**
+ * @api {post} /user/presentCertificate Present a certificate
+ *
+ * @apiName PresentCertificate
+ * @apiGroup User
+ *
+ * @apiDescription Blind the certificate like /user/blindCertificate and prove the knowledge of the blinding factor and of the blinded private key
+ * for the nonce of the SP. Neither the blinding factor nor the blinded private key is returned.
+ * When attributes are given, the certificate is the one of the attribute key returned by /CP/verifyProof/attributeKey: the attributes selected
+ * by disclosureMask are disclosed with a proof that they are certified, which replaces proof
+ *
+ * @apiParam {String} commitment The committed attributes of the user. The commitment is hashed inside the function
+ * @apiParam {Number} [attributeCount=1] The number of attributes in the commitment
+ * @apiParam {String} certificate The certificate
+ * @apiParam {String} pubG1CP The public key of the cetificate provider. First member is used
+ * @apiParam {String} [privUser] The pairing private key of the user, refused when the service has a keystore
+ * @apiParam {String} [keyID] ID of the pairing key of the user in the keystore, owned by the holder. "id@version" selects the version for which the certificate was issued
+ * @apiParam {String} nonce Nonce returned by /SP/challenge
+ * @apiParam {String} [context] Application context returned with the nonce
+ * @apiParam {String[]} [attributes] The certified attributes, when the certificate is the one of the attribute key
+ * @apiParam {String} [random] Random returned by /user/commitment, required with attributes
+ * @apiParam {Number} [disclosureMask=0] Bit i is set if the attribute i is disclosed
+ *
+ * @apiParamExample {json} Request-Example:
+ *   {
+ *	 		"commitment": "01234ABC...",
+ *	 		"attributeCount": 4,
+ *	 		"certificate": "01234ABC...",
+ *	 		"pubG1CP": "01234ABC...",
+ *	 		"privUser": "01234ABC...",
+ *	 		"nonce": "01234ABC...",
+ *	 		"context": "age verification for service X",
+ *	 		"attributes": ["1990-01-31", "FR", "B", "2030-12-31"],
+ *	 		"random": "2390913AD...",
+ *	 		"disclosureMask": 6
+ *	 }
+ *
+ * @apiSuccess {String} blindCommitment The blinded commitment
+ * @apiSuccess {String} blindCertificate The blinded certificate
+ * @apiSuccess {String} blindPubG1CP The blinded public key G1 of the CP
+ * @apiSuccess {String} blindPubG2User The blinded public key G2 o the user
+ * @apiSuccess {String} blindGenerator The blinded G1 generator
+ * @apiSuccess {Number} attributeCount The number of attributes covered by the certificate
+ * @apiSuccess {String} [proof] The proof of knowledge of the blinding factor and of the blinded private key, followed by issuerProof. Not returned with attributes
+ * @apiSuccess {String} issuerProof The proof that blindPubG1CP is derived from pubG1CP, checked by the verify chaincode against the registered CP
+ * @apiSuccess {Number} [disclosureMask] The disclosure mask, with attributes
+ * @apiSuccess {String[]} [disclosedAttributes] The disclosed attributes, in the order of the commitment
+ * @apiSuccess {String} [disclosureProof] The proof that the disclosed attributes are certified, followed by issuerProof
+ *
+ * @apiSuccessExample Success-Response:
+ *	HTTP/1.1 200 OK
+ *		{
+ *	 		"blindCommitment": "01234ABC...",
+ *	 		"blindCertificate": "01234ABC...",
+ *	 		"blindPubG1CP": "01234ABC...",
+ *	 		"blindPubG2User": "01234ABC...",
+ *			"blindGenerator": "BBBAABA11...",
+ *			"attributeCount": 4,
+ *			"issuerProof": "ABABAB113EE...",
+ *			"disclosureMask": 6,
+ *			"disclosedAttributes": ["FR", "B"],
+ *			"disclosureProof": "ABABAB113EE..."
+ *		}
+ *
+ * @apiUse RequestError
+ *
+ */
+func PresentCertificate(w http.ResponseWriter, r *http.Request) {
+	type Input struct {
+		Commitment     string   `json:"commitment"`
+		AttributeCount int      `json:"attributeCount"`
+		Certificate    string   `json:"certificate"`
+		PubG1CP        string   `json:"pubG1CP"`
+		PrivUser       string   `json:"privUser"`
+		KeyID          string   `json:"keyID"`
+		Nonce          string   `json:"nonce"`
+		Context        string   `json:"context"`
+		Attributes     []string `json:"attributes"`
+		Random         string   `json:"random"`
+		DisclosureMask uint32   `json:"disclosureMask"`
+	}
+
+	var in Input
+	if err := decode(r, &in); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var parse parser
+	commit := parse.point("commitment", in.Commitment, wire.Commitment)
+	count := parse.attributeCount("attributeCount", in.AttributeCount)
+	certificate := parse.value("certificate", in.Certificate, wire.Certificate)
+	issuer := parse.issuerPublicKey("pubG1CP", in.PubG1CP)
+	nonce := parse.nonce("nonce", in.Nonce)
+	var message [][]byte
+	var random []byte
+	if len(in.Attributes) != 0 {
+		message = parse.attributes("attributes", in.Attributes, "")
+		random = parse.scalar("random", in.Random, wire.Scalar)
+		if parse.err == nil && len(message) != count {
+			parse.fail(badRequest(CodeInvalidValue, "attributes", errAttributeCount))
+		}
+	}
+	if parse.err != nil {
+		writeError(w, parse.err)
+		return
+	}
+	holder, err := holderKey(in.KeyID, in.PrivUser)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	cred, err := cryptolib.NewCredential(commit, count, certificate)
+	if err != nil {
+		writeError(w, cryptoError("certificate", err))
+		return
+	}
+
+	type Ret struct {
+		Commitment          string   `json:"blindCommitment"`
+		Certificate         string   `json:"blindCertificate"`
+		PubG1CP             string   `json:"blindPubG1CP"`
+		PubG2User           string   `json:"blindPubG2User"`
+		Generator           string   `json:"blindGenerator"`
+		AttributeCount      int      `json:"attributeCount"`
+		Proof               string   `json:"proof,omitempty"`
+		IssuerProof         string   `json:"issuerProof"`
+		DisclosureMask      *uint32  `json:"disclosureMask,omitempty"`
+		DisclosedAttributes []string `json:"disclosedAttributes,omitempty"`
+		DisclosureProof     string   `json:"disclosureProof,omitempty"`
+	}
+	var ret Ret
+
+	var p *cryptolib.BlindedPresentation
+	if message == nil {
+		var proof *cryptolib.PresentationProof
+		end := span(r, "cryptolib.HolderKey.Present")
+		p, proof, err = holder.Present(rand.Reader, cred, issuer, nonce, []byte(in.Context))
+		end()
+		if err != nil {
+			//the certificate does not verify for the given number of attributes
+			writeError(w, cryptoError("certificate", err))
+			return
+		}
+		ret.Proof = hex.EncodeToString(proof.Marshal())
+		ret.IssuerProof = hex.EncodeToString(proof.Issuer.Marshal())
+	} else {
+		keyGen, err := keyGenerators(count)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		var d *cryptolib.Disclosure
+		end := span(r, "cryptolib.HolderKey.PresentAttributes")
+		p, d, err = holder.PresentAttributes(rand.Reader, cred, issuer, keyGen, message, random, cryptolib.DisclosureMask(in.DisclosureMask), nonce, []byte(in.Context))
+		end()
+		if err == cryptolib.ErrInvalidCertificate {
+			//the certificate is not the one of the attribute key of these attributes
+			writeError(w, cryptoError("certificate", err))
+			return
+		}
+		if err != nil {
+			writeError(w, cryptoError("disclosureMask", err))
+			return
+		}
+		ret.DisclosureMask = &in.DisclosureMask
+		for _, attribute := range d.Attributes {
+			ret.DisclosedAttributes = append(ret.DisclosedAttributes, string(attribute))
+		}
+		ret.DisclosureProof = hex.EncodeToString(d.Proof.Marshal())
+		ret.IssuerProof = hex.EncodeToString(d.Proof.Issuer.Marshal())
+	}
+	ret.Commitment = hex.EncodeToString(p.Commitment.Bytes())
+	ret.Certificate = hex.EncodeToString(p.Certificate.Marshal())
+	ret.PubG1CP = hex.EncodeToString(p.IssuerKey.Marshal())
+	ret.PubG2User = hex.EncodeToString(p.HolderKey.Marshal())
+	ret.Generator = hex.EncodeToString(p.Generator.Marshal())
+	ret.AttributeCount = p.AttributeCount
+
+	retByte, _ := json.Marshal(ret)
+	w.Header().Set("content-type", "application/json")
+	w.Write(retByte)
+	return
+}
+
+/**
+ * @api {post} /SP/verifyPresentation Verify a presentation
+ *
+ * @apiName VerifyPresentation
+ * @apiGroup SP
+ *
+ * @apiDescription Verify the blinded certificate and the proof that the user knows its blinding secret, for a nonce issued by /SP/challenge.
+ * When disclosureProof is given instead of proof, also verify that the disclosed attributes are certified
+ *
+ * @apiParam {String} blindCommitment The blinded commitment
+ * @apiParam {String} blindCertificate The blinded certificate
+ * @apiParam {String} blindPubG1CP The blinded public key G1 of the CP
+ * @apiParam {String} blindPubG2User The blinded public key G2 o the user
+ * @apiParam {String} blindGenerator The blinded G1 generator
+ * @apiParam {Number} [attributeCount=1] The number of attributes covered by the certificate
+ * @apiParam {String} [proof] The proof returned by /user/presentCertificate, required without disclosureProof
+ * @apiParam {Number} [disclosureMask=0] The disclosure mask returned by /user/presentCertificate
+ * @apiParam {String[]} [disclosedAttributes] The disclosed attributes, in the order of the commitment
+ * @apiParam {String} [disclosureProof] The disclosure proof returned by /user/presentCertificate
+ * @apiParam {String} nonce Nonce used in the proof. It is consumed by the verification
+ * @apiParam {String} pubG1CP The public key of the CP trusted by the SP. The certificate must have been issued by this CP
+ *
+ * @apiParamExample {json} Request-Example:
+ *   {
+ *	 		"blindCommitment": "01234ABC...",
+ *	 		"blindCertificate": "01234ABC...",
+ *	 		"blindPubG1CP": "01234ABC...",
+ *	 		"blindPubG2User": "01234ABC...",
+ *			"blindGenerator": "BBBAABA11...",
+ *			"attributeCount": 4,
+ *			"proof": "ABABAB113EE...",
+ *			"nonce": "01234ABC...",
+ *			"pubG1CP": "01234ABC...",
+ *	 }
+ *
+ * @apiSuccess {String} verify Return "true" if OK, "false" else
+ *
+ * @apiSuccessExample Success-Response:
+ *	HTTP/1.1 200 OK
+ *		{
+ *			"verify": "true"
+ *		}
+ *
+ * @apiUse RequestError
+ *
+ */
+func VerifyPresentation(w http.ResponseWriter, r *http.Request) {
+	type Input struct {
+		BlindCommitment     string   `json:"blindCommitment"`
+		BlindPubG1CP        string   `json:"blindPubG1CP"`
+		BlindPubG2User      string   `json:"blindPubG2User"`
+		BlindCertificate    string   `json:"blindCertificate"`
+		BlindGenerator      string   `json:"blindGenerator"`
+		AttributeCount      int      `json:"attributeCount"`
+		Proof               string   `json:"proof"`
+		DisclosureMask      uint32   `json:"disclosureMask"`
+		DisclosedAttributes []string `json:"disclosedAttributes"`
+		DisclosureProof     string   `json:"disclosureProof"`
+		Nonce               string   `json:"nonce"`
+		PubG1CP             string   `json:"pubG1CP"`
+	}
+	var in Input
+	if err := decode(r, &in); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var parse parser
+	blindCommit := parse.value("blindCommitment", in.BlindCommitment, wire.BlindCommitment)
+	blindCertificate := parse.value("blindCertificate", in.BlindCertificate, wire.Certificate)
+	blindPubG1CP := parse.value("blindPubG1CP", in.BlindPubG1CP, wire.IssuerPublicKey)
+	blindPubG2User := parse.value("blindPubG2User", in.BlindPubG2User, wire.HolderPublicKey)
+	blindGenerator := parse.value("blindGenerator", in.BlindGenerator, wire.G1Point)
+	count := parse.attributeCount("attributeCount", in.AttributeCount)
+	var proofByte, disclosureByte []byte
+	if in.DisclosureProof == "" {
+		proofByte = parse.value("proof", in.Proof, wire.PresentationProof)
+	} else {
+		disclosureByte = parse.value("disclosureProof", in.DisclosureProof, wire.AttributeProof)
+	}
+	nonce := parse.nonce("nonce", in.Nonce)
+	//without the key of a trusted CP, any key made up by the user would verify
+	issuer := parse.issuerPublicKey("pubG1CP", in.PubG1CP)
+	if parse.err != nil {
+		writeError(w, parse.err)
+		return
+	}
+
+	p, err := cryptolib.NewBlindedPresentation(blindCommit, count, blindCertificate, blindPubG1CP, blindPubG2User, blindGenerator)
+	if err != nil {
+		writeError(w, cryptoError("", err))
+		return
+	}
+	var proof cryptolib.PresentationProof
+	var d *cryptolib.Disclosure
+	var keyGen *cryptolib.AttributeKeyGenerators
+	if disclosureByte == nil {
+		if err := proof.Unmarshal(proofByte); err != nil {
+			writeError(w, cryptoError("proof", err))
+			return
+		}
+	} else {
+		//the user discloses some of the attributes of its attribute key
+		d = &cryptolib.Disclosure{Mask: cryptolib.DisclosureMask(in.DisclosureMask), Proof: new(cryptolib.AttributeProof)}
+		for _, attribute := range in.DisclosedAttributes {
+			d.Attributes = append(d.Attributes, []byte(attribute))
+		}
+		if err := d.Proof.Unmarshal(disclosureByte); err != nil {
+			writeError(w, cryptoError("disclosureProof", err))
+			return
+		}
+		if keyGen, err = keyGenerators(count); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+
+	//the request is well formed: the nonce is consumed, whether the presentation verifies or not
+	context, issued := consumeChallenge(in.Nonce)
+	b := false
+	issuerProof := proof.Issuer
+	if issued && d == nil {
+		end := span(r, "cryptolib.BlindedPresentation.VerifyPresentation")
+		b, err = p.VerifyPresentation(&proof, nonce, []byte(context))
+		end()
+		if err != nil {
+			writeError(w, cryptoError("proof", err))
+			return
+		}
+	}
+	if issued && d != nil {
+		end := span(r, "cryptolib.BlindedPresentation.VerifyDisclosure")
+		b, err = p.VerifyDisclosure(d, keyGen, nonce, []byte(context))
+		end()
+		if err != nil {
+			writeError(w, cryptoError("disclosureProof", err))
+			return
+		}
+		issuerProof = d.Proof.Issuer
+	}
+	if b {
+		end := span(r, "cryptolib.BlindedPresentation.VerifyIssuer")
+		b = p.VerifyIssuer(issuerProof, issuer, nonce, []byte(context))
+		end()
+	}
 
-	b, err := cryptolib.VerifyBlindCertificate(blindCommit, blindCertificate, blindPubG1CP, blindPubG2User, blindGenerator)
 	type Ret struct {
 		Verify string `json:"verify"`
 	}
 	var ret Ret
-	if err != nil || b != true {
-		fmt.Println(err)
+	if b != true {
 		ret.Verify = "false"
 		retByte, _ := json.Marshal(ret)
 		w.Header().Set("content-type", "application/json")
@@ -1022,8 +2029,5 @@ func VerifyBlindedCertificate(w http.ResponseWriter, r *http.Request) {
 	retByte, _ := json.Marshal(ret)
 	w.Header().Set("content-type", "application/json")
 	w.Write(retByte)
-	end := time.Now()
-	elapsed := end.Sub(start)
-	fmt.Println("VerifyBlindCertificate: ", elapsed)
 	return
 }
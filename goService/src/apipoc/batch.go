@@ -0,0 +1,128 @@
+package apipoc
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"cryptolib"
+	"wire"
+)
+
+//maxBatchSize is the maximum number of blinded certificates verified by a request of /SP/verifyBlindCertificate/batch
+const maxBatchSize = 1000
+
+/**
+ * @api {post} /SP/verifyBlindCertificate/batch Blind certificates in batch
+ *
+ * @apiName VerifyBlindedCertificates
+ * @apiGroup SP
+ *
+ * @apiDescription Verify many blinded certificates at once, like /SP/verifyBlindCertificate.
+ * The certificates are checked together, which is about twice as fast as checking them one by one.
+ * At most 1000 certificates are accepted in a request, and a malformed certificate rejects the whole request
+ *
+ * @apiParam {Object[]} certificates The blinded certificates
+ * @apiParam {String} certificates.blindCommitment The blinded commitment
+ * @apiParam {String} certificates.blindCertificate The blinded certificate
+ * @apiParam {String} certificates.blindPubG1CP The blinded public key G1 of the CP
+ * @apiParam {String} certificates.blindPubG2User The blinded public key G2 o the user
+ * @apiParam {String} certificates.blindGenerator The blinded G1 generator
+ * @apiParam {Number} [certificates.attributeCount=1] The number of attributes covered by the certificate
+ *
+ * @apiParamExample {json} Request-Example:
+ *   {
+ *		"certificates": [
+ *			{
+ *	 			"blindCommitment": "01234ABC...",
+ *	 			"blindCertificate": "01234ABC...",
+ *	 			"blindPubG1CP": "01234ABC...",
+ *	 			"blindPubG2User": "01234ABC...",
+ *				"blindGenerator": "BBBAABA11...",
+ *				"attributeCount": 4,
+ *			},
+ *			...
+ *		]
+ *	 }
+ *
+ * @apiSuccess {String} verify Return "true" if all the certificates are valid, "false" else
+ * @apiSuccess {Number[]} invalid The indices of the certificates which do not verify
+ *
+ * @apiSuccessExample Success-Response:
+ *	HTTP/1.1 200 OK
+ *		{
+ *			"verify": "false",
+ *			"invalid": [2, 17]
+ *		}
+ *
+ * @apiUse RequestError
+ *
+ */
+func VerifyBlindedCertificates(w http.ResponseWriter, r *http.Request) {
+	type Certificate struct {
+		BlindCommitment  string `json:"blindCommitment"`
+		BlindPubG1CP     string `json:"blindPubG1CP"`
+		BlindPubG2User   string `json:"blindPubG2User"`
+		BlindCertificate string `json:"blindCertificate"`
+		BlindGenerator   string `json:"blindGenerator"`
+		AttributeCount   int    `json:"attributeCount"`
+	}
+	type Input struct {
+		Certificates []Certificate `json:"certificates"`
+	}
+	var in Input
+	if err := decode(r, &in); err != nil {
+		writeError(w, err)
+		return
+	}
+	if len(in.Certificates) > maxBatchSize {
+		writeError(w, badRequest(CodeInvalidValue, "certificates", fmt.Errorf("Expecting at most %d certificates", maxBatchSize)))
+		return
+	}
+
+	//a malformed certificate rejects the whole request, as it would be rejected by /SP/verifyBlindCertificate
+	presentations := make([]*cryptolib.BlindedPresentation, len(in.Certificates))
+	for i, c := range in.Certificates {
+		var p parser
+		field := func(name string) string {
+			return fmt.Sprintf("certificates[%d].%s", i, name)
+		}
+		blindCommit := p.value(field("blindCommitment"), c.BlindCommitment, wire.BlindCommitment)
+		blindCertificate := p.value(field("blindCertificate"), c.BlindCertificate, wire.Certificate)
+		blindPubG1CP := p.value(field("blindPubG1CP"), c.BlindPubG1CP, wire.IssuerPublicKey)
+		blindPubG2User := p.value(field("blindPubG2User"), c.BlindPubG2User, wire.HolderPublicKey)
+		blindGenerator := p.value(field("blindGenerator"), c.BlindGenerator, wire.G1Point)
+		count := p.attributeCount(field("attributeCount"), c.AttributeCount)
+		if p.err != nil {
+			writeError(w, p.err)
+			return
+		}
+		var err error
+		presentations[i], err = cryptolib.NewBlindedPresentation(blindCommit, count, blindCertificate, blindPubG1CP, blindPubG2User, blindGenerator)
+		if err != nil {
+			writeError(w, cryptoError(fmt.Sprintf("certificates[%d]", i), err))
+			return
+		}
+	}
+
+	end := span(r, "cryptolib.BatchVerify")
+	invalid, err := cryptolib.BatchVerify(rand.Reader, presentations)
+	end()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	type Ret struct {
+		Verify  string `json:"verify"`
+		Invalid []int  `json:"invalid"`
+	}
+	ret := Ret{Verify: "true", Invalid: invalid}
+	if len(invalid) > 0 {
+		ret.Verify = "false"
+	}
+	retByte, _ := json.Marshal(ret)
+	w.Header().Set("content-type", "application/json")
+	w.Write(retByte)
+	return
+}
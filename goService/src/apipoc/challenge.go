@@ -0,0 +1,166 @@
+package apipoc
+
+import (
+	"container/list"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"auth"
+)
+
+//challengeLifetime is the time during which a nonce sent by the verifier can be used in a proof
+const challengeLifetime = 5 * time.Minute
+
+//maxChallenges is the number of nonces which may be outstanding, issued and neither consumed nor expired.
+//maxClientChallenges is the number of them which may be issued to a client, when the service knows the identity of its clients
+const (
+	maxChallenges       = 100000
+	maxClientChallenges = 1000
+)
+
+//challenge is a nonce issued by the verifier, waiting for the proof which answers it
+type challenge struct {
+	nonce   string
+	context string
+	client  string
+	expires time.Time
+}
+
+//challenges contains the nonces issued and not yet consumed, and the number of them issued to each client.
+//As every nonce has the same lifetime, the queue is in the order of expiry: the expired nonces are at its front
+var challenges = struct {
+	sync.Mutex
+	m       map[string]*list.Element
+	queue   *list.List
+	clients map[string]int
+}{m: make(map[string]*list.Element), queue: list.New(), clients: make(map[string]int)}
+
+var (
+	errTooManyChallenges       = &requestError{http.StatusTooManyRequests, CodeTooManyChallenges, "", errors.New("Too many challenges are waiting for a proof, retry later")}
+	errTooManyClientChallenges = &requestError{http.StatusTooManyRequests, CodeTooManyChallenges, "", errors.New("Too many challenges issued to the client are waiting for a proof")}
+)
+
+//addChallenge adds the challenge at the back of the queue, the challenges must be locked
+func addChallenge(c *challenge) {
+	challenges.m[c.nonce] = challenges.queue.PushBack(c)
+	if c.client != "" {
+		challenges.clients[c.client]++
+	}
+}
+
+//removeChallenge removes the challenge of e, the challenges must be locked
+func removeChallenge(e *list.Element) {
+	c := challenges.queue.Remove(e).(*challenge)
+	delete(challenges.m, c.nonce)
+	if c.client == "" {
+		return
+	}
+	challenges.clients[c.client]--
+	if challenges.clients[c.client] == 0 {
+		delete(challenges.clients, c.client)
+	}
+}
+
+//newChallenge issues a new nonce for the given application context to client, "" if the client is not authenticated.
+//The expired nonces are removed first, then the nonce is refused if too many of them are outstanding
+func newChallenge(context string, client string) (string, error) {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	nonceHex := hex.EncodeToString(nonce)
+
+	challenges.Lock()
+	defer challenges.Unlock()
+	now := time.Now()
+	for e := challenges.queue.Front(); e != nil && now.After(e.Value.(*challenge).expires); e = challenges.queue.Front() {
+		removeChallenge(e)
+	}
+	if len(challenges.m) >= maxChallenges {
+		return "", errTooManyChallenges
+	}
+	if client != "" && challenges.clients[client] >= maxClientChallenges {
+		return "", errTooManyClientChallenges
+	}
+	addChallenge(&challenge{nonce: nonceHex, context: context, client: client, expires: now.Add(challengeLifetime)})
+	return nonceHex, nil
+}
+
+//consumeChallenge returns the context of the nonce and removes it, so that a nonce is only accepted once.
+//It returns false if the nonce has never been issued, has already been used or has expired
+func consumeChallenge(nonce string) (string, bool) {
+	challenges.Lock()
+	defer challenges.Unlock()
+	e, ok := challenges.m[nonce]
+	if !ok {
+		return "", false
+	}
+	c := e.Value.(*challenge)
+	removeChallenge(e)
+	if time.Now().After(c.expires) {
+		return "", false
+	}
+	return c.context, true
+}
+
+/**
+ * @api {post} /CP/challenge Get a challenge
+ *
+ * @apiName GetChallenge
+ * @apiGroup CP
+ *
+ * @apiDescription Issue a nonce that the user must bind into the next ZKP or presentation. A nonce is valid 5 minutes and can be used only once.
+ * The same handler serves /SP/challenge. At most 100000 nonces may wait for a proof, and 1000 of them for a client when the service
+ * knows the identity of its clients (mspID of AAV_TLS_CONFIG): beyond that, the route answers 429 too_many_challenges
+ *
+ * @apiParam {String} [context] Application context the proof will be computed for
+ *
+ * @apiParamExample {json} Request-Example:
+ *   {
+ *		"context": "age verification for service X"
+ *	 }
+ *
+ * @apiSuccess {String} nonce The nonce to use in the proof
+ * @apiSuccess {String} context The application context to use in the proof
+ *
+ * @apiSuccessExample Success-Response:
+ *	HTTP/1.1 200 OK
+ *		{
+ *	 		"nonce": "01234ABC...",
+ *	 		"context": "age verification for service X"
+ *		}
+ *
+ * @apiUse RequestError
+ *
+ */
+func GetChallenge(w http.ResponseWriter, r *http.Request) {
+	type Input struct {
+		Context string `json:"context"`
+	}
+	var in Input
+	if err := decode(r, &in); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	type Ret struct {
+		Nonce   string `json:"nonce"`
+		Context string `json:"context"`
+	}
+	client, _ := auth.Identity(r)
+	nonce, err := newChallenge(in.Context, client)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	ret := Ret{Nonce: nonce, Context: in.Context}
+	retByte, _ := json.Marshal(ret)
+	w.Header().Set("content-type", "application/json")
+	w.Write(retByte)
+	return
+}
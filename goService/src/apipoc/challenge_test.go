@@ -0,0 +1,140 @@
+package apipoc
+
+import (
+	"container/list"
+	"strconv"
+	"testing"
+	"time"
+)
+
+//resetChallenges empties the challenges, for the test and after it
+func resetChallenges(t *testing.T) {
+	reset := func() {
+		challenges.Lock()
+		challenges.m = make(map[string]*list.Element)
+		challenges.queue = list.New()
+		challenges.clients = make(map[string]int)
+		challenges.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestClientChallenges(t *testing.T) {
+	resetChallenges(t)
+
+	var nonces []string
+	for i := 0; i < maxClientChallenges; i++ {
+		nonce, err := newChallenge("", "MSP/client")
+		if err != nil {
+			t.Fatal(err)
+		}
+		nonces = append(nonces, nonce)
+	}
+	if _, err := newChallenge("", "MSP/client"); err != errTooManyClientChallenges {
+		t.Fatalf("Challenge beyond the limit of the client: %v", err)
+	}
+	//the other clients, and the clients without identity, are not limited by it
+	if _, err := newChallenge("", "MSP/other"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newChallenge("", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	//a consumed nonce, or an expired one, makes room for another
+	if _, ok := consumeChallenge(nonces[0]); !ok {
+		t.Fatal("Nonce not issued")
+	}
+	if _, err := newChallenge("", "MSP/client"); err != nil {
+		t.Fatalf("Challenge after a nonce is consumed: %v", err)
+	}
+	challenges.Lock()
+	challenges.m[nonces[1]].Value.(*challenge).expires = time.Now().Add(-time.Second)
+	challenges.Unlock()
+	if _, err := newChallenge("", "MSP/client"); err != nil {
+		t.Fatalf("Challenge after a nonce expired: %v", err)
+	}
+	if _, ok := consumeChallenge(nonces[1]); ok {
+		t.Fatal("Expired nonce accepted")
+	}
+	if _, err := newChallenge("", "MSP/client"); err != errTooManyClientChallenges {
+		t.Fatalf("Challenge beyond the limit of the client: %v", err)
+	}
+
+	//the nonces of the clients all expired, they no longer count for them
+	challenges.Lock()
+	for e := challenges.queue.Front(); e != nil; e = e.Next() {
+		e.Value.(*challenge).expires = time.Now().Add(-time.Second)
+	}
+	challenges.Unlock()
+	if _, err := newChallenge("", ""); err != nil {
+		t.Fatal(err)
+	}
+	challenges.Lock()
+	defer challenges.Unlock()
+	if len(challenges.clients) != 0 || challenges.queue.Len() != 1 {
+		t.Fatalf("Expired nonces still counted: %v, %d queued", challenges.clients, challenges.queue.Len())
+	}
+}
+
+func TestMaxChallenges(t *testing.T) {
+	resetChallenges(t)
+
+	challenges.Lock()
+	expires := time.Now().Add(challengeLifetime)
+	for i := 0; i < maxChallenges; i++ {
+		addChallenge(&challenge{nonce: strconv.Itoa(i), expires: expires})
+	}
+	challenges.Unlock()
+	status, ret := post(t, GetChallenge, `{}`)
+	if status != 429 || ret["code"] != string(CodeTooManyChallenges) {
+		t.Fatalf("Challenge beyond the limit: %d %v", status, ret)
+	}
+
+	//the expired nonces are removed when a nonce is issued
+	challenges.Lock()
+	challenges.m["0"].Value.(*challenge).expires = time.Now().Add(-time.Second)
+	challenges.Unlock()
+	if status, ret := post(t, GetChallenge, `{}`); status != 200 || ret["nonce"] == nil {
+		t.Fatalf("Challenge after a nonce expired: %d %v", status, ret)
+	}
+	challenges.Lock()
+	defer challenges.Unlock()
+	if _, ok := challenges.m["0"]; ok || len(challenges.m) != maxChallenges || challenges.queue.Len() != maxChallenges {
+		t.Fatalf("Expired nonce not removed, %d nonces, %d queued", len(challenges.m), challenges.queue.Len())
+	}
+}
+
+//a proof of opening is verified once, for the nonce and the context of its challenge
+func TestOpeningProofReplay(t *testing.T) {
+	resetChallenges(t)
+
+	_, commitment := post(t, Commitment, `{"attributes": ["1990-01-31", "FR"]}`)
+	_, challenge := post(t, GetChallenge, `{"context": "issuance"}`)
+	in := map[string]interface{}{"attributes": []string{"1990-01-31", "FR"}, "random": commitment["random"], "commitment": commitment["commitment"],
+		"nonce": challenge["nonce"], "context": "issuance"}
+	status, proof := post(t, GenerateZKPCommitment, jsonBody(in))
+	if status != 200 {
+		t.Fatalf("Proof of opening: %d %v", status, proof)
+	}
+	verify := jsonBody(map[string]interface{}{"commitment": commitment["commitment"], "attributeCount": 2, "proof": proof["proof"], "nonce": challenge["nonce"]})
+	if status, ret := post(t, VerifyCommitment, verify); status != 200 || ret["verify"] != "true" {
+		t.Fatalf("Proof of opening: %d %v", status, ret)
+	}
+	if status, ret := post(t, VerifyCommitment, verify); status != 200 || ret["verify"] != "false" {
+		t.Fatalf("Replayed proof of opening: %d %v", status, ret)
+	}
+
+	//a proof for another context does not verify for the nonce
+	_, challenge = post(t, GetChallenge, `{"context": "issuance"}`)
+	in["nonce"], in["context"] = challenge["nonce"], "another context"
+	_, proof = post(t, GenerateZKPCommitment, jsonBody(in))
+	verify = jsonBody(map[string]interface{}{"commitment": commitment["commitment"], "attributeCount": 2, "proof": proof["proof"], "nonce": challenge["nonce"]})
+	if status, ret := post(t, VerifyCommitment, verify); status != 200 || ret["verify"] != "false" {
+		t.Fatalf("Proof of opening for another context: %d %v", status, ret)
+	}
+	if status, ret := post(t, VerifyCommitment, `{"commitment": "`+commitment["commitment"].(string)+`", "attributeCount": 2, "proof": "`+proof["proof"].(string)+`"}`); status != 400 || ret["field"] != "nonce" {
+		t.Fatalf("Proof of opening without nonce: %d %v", status, ret)
+	}
+}
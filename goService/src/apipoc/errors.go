@@ -0,0 +1,149 @@
+package apipoc
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"cryptolib"
+	"keystore"
+)
+
+//ErrorCode is the machine readable code of an error answered by a route
+type ErrorCode string
+
+//Codes of the errors answered by the routes. A proof, a signature or a certificate which is well formed but does not
+//verify is not an error: the route answers 200 with "verify": "false"
+const (
+	//CodeMalformedRequest is answered when the body is not a JSON object of the fields of the route (400)
+	CodeMalformedRequest ErrorCode = "malformed_request"
+	//CodeMissingField is answered when a required field is missing or empty (400)
+	CodeMissingField ErrorCode = "missing_field"
+	//CodeInvalidEncoding is answered when a field is not hexadecimal, is not a wire value of its type or has a wrong size (400)
+	CodeInvalidEncoding ErrorCode = "invalid_encoding"
+	//CodeInvalidPoint is answered when a point is not on its curve or not in its subgroup (400)
+	CodeInvalidPoint ErrorCode = "invalid_point"
+	//CodeInvalidScalar is answered when a scalar or a private key is not lower than the order of its curve (400)
+	CodeInvalidScalar ErrorCode = "invalid_scalar"
+	//CodeInvalidValue is answered when a field is out of its range or inconsistent with the others,
+	//such as an attribute count or a disclosure mask (400)
+	CodeInvalidValue ErrorCode = "invalid_value"
+	//CodeInvalidCertificate is answered when the certificate to blind or to present does not verify (422)
+	CodeInvalidCertificate ErrorCode = "invalid_certificate"
+	//CodeKeyRefused is answered when the private key or the keyID of the request does not fit the keys of the service:
+	//a private key with a keystore, a keyID without it, any of them with a signer (400), or a key generated outside
+	//of the keystore (403)
+	CodeKeyRefused ErrorCode = "key_refused"
+	//CodeUnknownKey is answered when keyID is not in the keystore (404)
+	CodeUnknownKey ErrorCode = "unknown_key"
+	//CodeWrongOwner is answered when the key of keyID is owned by another role or has another type (403)
+	CodeWrongOwner ErrorCode = "wrong_owner"
+	//CodeTooManyChallenges is answered when too many nonces of /CP/challenge are waiting for a proof (429)
+	CodeTooManyChallenges ErrorCode = "too_many_challenges"
+	//CodeRouteRemoved is answered by a route which is kept only to point its clients to the route replacing it (410)
+	CodeRouteRemoved ErrorCode = "route_removed"
+	//CodeInternal is answered when the service fails (500)
+	CodeInternal ErrorCode = "internal"
+)
+
+/**
+ * @apiDefine RequestError
+ *
+ * @apiError (Error 4xx/5xx) {String} code Machine readable code of the error: malformed_request, missing_field, invalid_encoding,
+ * invalid_point, invalid_scalar, invalid_value, invalid_certificate, key_refused, unknown_key, wrong_owner, too_many_challenges,
+ * route_removed or internal
+ * @apiError (Error 4xx/5xx) {String} message Description of the error
+ * @apiError (Error 4xx/5xx) {String} [field] Field of the request at fault
+ *
+ * @apiErrorExample Error-Response:
+ *	HTTP/1.1 400 Bad Request
+ *		{
+ *			"code": "invalid_point",
+ *			"message": "Cannot Unmarshal holder public key",
+ *			"field": "pubG2User"
+ *		}
+ */
+
+//requestError is an error answering a request: its HTTP status, its code and the field of the request at fault, if any
+type requestError struct {
+	status int
+	code   ErrorCode
+	field  string
+	err    error
+}
+
+func (e *requestError) Error() string {
+	if e.field == "" {
+		return e.err.Error()
+	}
+	return e.field + ": " + e.err.Error()
+}
+
+//badRequest returns the 400 error of code on field
+func badRequest(code ErrorCode, field string, err error) error {
+	return &requestError{http.StatusBadRequest, code, field, err}
+}
+
+var (
+	errPrivateKeyInRequest = &requestError{http.StatusBadRequest, CodeKeyRefused, "", errors.New("Private keys are kept in the keystore: give the ID of the key in keyID")}
+	errNoKeystore          = &requestError{http.StatusBadRequest, CodeKeyRefused, "keyID", errors.New("keyID needs a keystore, send the private key")}
+	errKeysInKeystore      = &requestError{http.StatusForbidden, CodeKeyRefused, "", errors.New("Private keys are generated by the keystore: use POST /keys")}
+	errKeyOfService        = &requestError{http.StatusBadRequest, CodeKeyRefused, "", errors.New("The key of this role is held by the signer of the service: send neither a private key nor keyID")}
+	errMissingField        = errors.New("Missing field")
+)
+
+//storeError converts an error of the keystore on keyID to the error answering the request
+func storeError(err error) error {
+	switch err {
+	case nil:
+		return nil
+	case keystore.ErrUnknownKey:
+		return &requestError{http.StatusNotFound, CodeUnknownKey, "keyID", err}
+	case keystore.ErrWrongOwner:
+		return &requestError{http.StatusForbidden, CodeWrongOwner, "keyID", err}
+	case keystore.ErrInvalidKey:
+		return badRequest(CodeInvalidValue, "keyID", err)
+	}
+	return err
+}
+
+//cryptoError converts an error of cryptolib on the values of field, or of several fields if it is empty,
+//to the error answering the request
+func cryptoError(field string, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, cryptolib.ErrInvalidPoint):
+		return badRequest(CodeInvalidPoint, field, err)
+	case errors.Is(err, cryptolib.ErrInvalidSize):
+		return badRequest(CodeInvalidEncoding, field, err)
+	case errors.Is(err, cryptolib.ErrInvalidScalar):
+		return badRequest(CodeInvalidScalar, field, err)
+	case err == cryptolib.ErrInvalidCertificate:
+		return &requestError{http.StatusUnprocessableEntity, CodeInvalidCertificate, field, err}
+	}
+	return badRequest(CodeInvalidValue, field, err)
+}
+
+//writeError answers the request with err, as the JSON object {"code", "message", "field"}.
+//An error which is not a *requestError is an internal error. Only the internal errors are logged: the others are
+//answered to the client, and may echo its values
+func writeError(w http.ResponseWriter, err error) {
+	e, ok := err.(*requestError)
+	if !ok {
+		e = &requestError{http.StatusInternalServerError, CodeInternal, "", err}
+	}
+	if e.status >= http.StatusInternalServerError {
+		log.Println("apipoc:", e)
+	}
+	type Ret struct {
+		Code    ErrorCode `json:"code"`
+		Message string    `json:"message"`
+		Field   string    `json:"field,omitempty"`
+	}
+	retByte, _ := json.Marshal(Ret{Code: e.code, Message: e.err.Error(), Field: e.field})
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(e.status)
+	w.Write(retByte)
+}
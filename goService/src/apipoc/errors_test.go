@@ -0,0 +1,331 @@
+package apipoc
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"keystore"
+)
+
+//outsideG2 is a point of the twist of bn256 which is not in G2
+const outsideG2 = "0000000000000000000000000000000000000000000000000000000000000003" +
+	"0000000000000000000000000000000000000000000000000000000000000002" +
+	"6a48cf4edaf92dc5dc18b79be57db4155eca171c69a5351a99a8c75cad50286a" +
+	"4b3e6ae54885e14b099193266551bced2befff067e096895bad1cd6cae80a57f"
+
+//post calls the route h with the JSON body and returns the status and the decoded answer
+func post(t *testing.T, h http.HandlerFunc, body string) (int, map[string]interface{}) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h(w, req)
+	var ret map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &ret); err != nil {
+		t.Fatalf("Answer is not JSON: %q", w.Body.String())
+	}
+	return w.Code, ret
+}
+
+func TestRequestErrors(t *testing.T) {
+	params := curve.Params()
+	point := hex.EncodeToString(elliptic.Marshal(curve, params.Gx, params.Gy))
+	offCurve := "04" + hex.EncodeToString(params.Gx.Bytes()) + hex.EncodeToString(new(big.Int).Add(params.Gy, big.NewInt(1)).Bytes())
+	order := hex.EncodeToString(params.N.Bytes())
+
+	_, cp := post(t, GeneratePairingKey, "")
+	_, user := post(t, GeneratePairingKey, "")
+	_, commitment := post(t, Commitment, `{"attributes": ["1990-01-31", "FR"]}`)
+
+	tests := []struct {
+		name   string
+		h      http.HandlerFunc
+		body   string
+		status int
+		code   ErrorCode
+		field  string
+	}{
+		{"malformed JSON", SignCommitment, `{"commitment": `, 400, CodeMalformedRequest, ""},
+		{"missing field", SignCommitment, `{}`, 400, CodeMissingField, "commitment"},
+		{"invalid hex", SignCommitment, `{"commitment": "zz"}`, 400, CodeInvalidEncoding, "commitment"},
+		{"point off P-256", SignCommitment, `{"commitment": "` + offCurve + `"}`, 400, CodeInvalidPoint, "commitment"},
+		{"private key too large", SignCommitment, `{"commitment": "` + point + `", "priv": "` + order + `"}`, 400, CodeInvalidScalar, "priv"},
+		{"signature not an integer", VerifySignature, `{"commitment": "` + point + `", "pub": "` + point + `", "r": "xyz", "s": "1"}`, 400, CodeInvalidValue, "r"},
+		{"scalar too large", GenerateZKPRandom, `{"secret": "` + order + `", "nonce": "00"}`, 400, CodeInvalidScalar, "secret"},
+		{"too many attributes", VerifyCommitment, `{"commitment": "` + point + `", "attributeCount": 33, "proof": "00"}`, 400, CodeInvalidValue, "attributeCount"},
+		{"point outside G2", GenerateCertificate, `{"commitment": "` + commitment["commitment"].(string) + `", "privCP": "` + cp["priv"].(string) +
+			`", "pubG2User": "` + outsideG2 + `"}`, 400, CodeInvalidPoint, "pubG2User"},
+		{"issuer key of a holder", VerifyCertificate, `{"commitment": "` + commitment["commitment"].(string) + `", "certificate": "` + cp["g1Pub"].(string) +
+			`", "pubG1CP": "` + user["g2Pub"].(string) + `", "pubG2User": "` + user["g2Pub"].(string) + `"}`, 400, CodeInvalidEncoding, "pubG1CP"},
+		{"batch too large", VerifyBlindedCertificates, `{"certificates": [` + strings.Repeat(`{},`, maxBatchSize) + `{}]}`, 400, CodeInvalidValue, "certificates"},
+		{"malformed certificate of a batch", VerifyBlindedCertificates, `{"certificates": [{}]}`, 400, CodeMissingField, "certificates[0].blindCommitment"},
+		{"proof of knowledge of the age", GenerateZKPAge, `{"secret": "15", "nonce": "00"}`, 410, CodeRouteRemoved, ""},
+		{"verification of the knowledge of the age", VerifyProofAge, `{}`, 410, CodeRouteRemoved, ""},
+	}
+	for _, test := range tests {
+		status, ret := post(t, test.h, test.body)
+		if status != test.status || ret["code"] != string(test.code) {
+			t.Errorf("%s: got %d %v, expecting %d %s", test.name, status, ret, test.status, test.code)
+			continue
+		}
+		if field, _ := ret["field"].(string); field != test.field {
+			t.Errorf("%s: got field %q, expecting %q", test.name, field, test.field)
+		}
+		if ret["message"] == "" {
+			t.Errorf("%s: no message", test.name)
+		}
+	}
+}
+
+func TestCertificateErrors(t *testing.T) {
+	_, cp := post(t, GeneratePairingKey, "")
+	_, user := post(t, GeneratePairingKey, "")
+	_, commitment := post(t, Commitment, `{"attributes": ["1990-01-31", "FR"]}`)
+	_, cert := post(t, GenerateCertificate, `{"commitment": "`+commitment["commitment"].(string)+`", "attributeCount": 2, "privCP": "`+cp["priv"].(string)+
+		`", "pubG2User": "`+user["g2Pub"].(string)+`"}`)
+
+	in := map[string]interface{}{"commitment": commitment["commitment"], "attributeCount": 2, "certificate": cert["certificate"],
+		"pubG1CP": cp["g1Pub"], "pubG2User": user["g2Pub"], "privUser": user["priv"]}
+	body := func() string {
+		b, _ := json.Marshal(in)
+		return string(b)
+	}
+
+	//a well formed certificate which does not verify is not an error of the verification
+	in["pubG1CP"] = user["g1Pub"]
+	if status, ret := post(t, VerifyCertificate, body()); status != 200 || ret["verify"] != "false" {
+		t.Fatalf("Certificate of another CP: %d %v", status, ret)
+	}
+	//but it cannot be blinded
+	if status, ret := post(t, BlindCertificate, body()); status != 422 || ret["code"] != string(CodeInvalidCertificate) {
+		t.Fatalf("Blinding a certificate of another CP: %d %v", status, ret)
+	}
+	in["pubG1CP"] = cp["g1Pub"]
+	in["pubG2User"] = cp["g2Pub"]
+	if status, ret := post(t, BlindCertificate, body()); status != 400 || ret["field"] != "pubG2User" {
+		t.Fatalf("Blinding with the key of another user: %d %v", status, ret)
+	}
+	in["pubG2User"] = user["g2Pub"]
+	status, ret := post(t, BlindCertificate, body())
+	if status != 200 || ret["blindCertificate"] == nil {
+		t.Fatalf("Blinding: %d %v", status, ret)
+	}
+	//blindPrivUser*blindFactor^-1 would be the private key of the user
+	for _, field := range []string{"blindPrivUser", "blindFactor"} {
+		if _, ok := ret[field]; ok {
+			t.Errorf("%s returned", field)
+		}
+	}
+}
+
+func TestKeystoreErrors(t *testing.T) {
+	keystore.Iterations = 1000
+	ks, err := keystore.Create(filepath.Join(t.TempDir(), "keystore.json"), "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Generate("holder", keystore.HolderKey, keystore.RoleHolder); err != nil {
+		t.Fatal(err)
+	}
+	SetKeystore(ks)
+	defer SetKeystore(nil)
+
+	params := curve.Params()
+	point := hex.EncodeToString(elliptic.Marshal(curve, params.Gx, params.Gy))
+	tests := []struct {
+		name   string
+		h      http.HandlerFunc
+		body   string
+		status int
+		code   ErrorCode
+	}{
+		{"key generated outside of the keystore", GenerateKey, ``, 403, CodeKeyRefused},
+		{"private key in the request", SignCommitment, `{"commitment": "` + point + `", "priv": "01"}`, 400, CodeKeyRefused},
+		{"missing keyID", SignCommitment, `{"commitment": "` + point + `"}`, 400, CodeMissingField},
+		{"unknown keyID", SignCommitment, `{"commitment": "` + point + `", "keyID": "iv"}`, 404, CodeUnknownKey},
+		{"key of another role", SignCommitment, `{"commitment": "` + point + `", "keyID": "holder"}`, 403, CodeWrongOwner},
+	}
+	for _, test := range tests {
+		if status, ret := post(t, test.h, test.body); status != test.status || ret["code"] != string(test.code) {
+			t.Errorf("%s: got %d %v, expecting %d %s", test.name, status, ret, test.status, test.code)
+		}
+	}
+}
+
+//checkError checks that the answer of a route is the error code on field
+func checkError(t *testing.T, name string, status int, ret map[string]interface{}, expectedStatus int, code ErrorCode, field string) {
+	t.Helper()
+	if status != expectedStatus || ret["code"] != string(code) {
+		t.Errorf("%s: got %d %v, expecting %d %s", name, status, ret, expectedStatus, code)
+		return
+	}
+	if f, _ := ret["field"].(string); f != field {
+		t.Errorf("%s: got field %q, expecting %q", name, f, field)
+	}
+	if m, _ := ret["message"].(string); m == "" {
+		t.Errorf("%s: no message", name)
+	}
+}
+
+func TestPresentationErrors(t *testing.T) {
+	_, cp := post(t, GeneratePairingKey, "")
+	_, otherCP := post(t, GeneratePairingKey, "")
+	_, user := post(t, GeneratePairingKey, "")
+	_, commitment := post(t, Commitment, `{"attributes": ["1990-01-31", "FR"]}`)
+	_, cert := post(t, GenerateCertificate, jsonBody(map[string]interface{}{"commitment": commitment["commitment"], "attributeCount": 2,
+		"privCP": cp["priv"], "pubG2User": user["g2Pub"]}))
+
+	present := func() map[string]interface{} {
+		return map[string]interface{}{"commitment": commitment["commitment"], "attributeCount": 2, "certificate": cert["certificate"],
+			"pubG1CP": cp["g1Pub"], "privUser": user["priv"], "nonce": "0102", "context": "test"}
+	}
+	tests := []struct {
+		name   string
+		change map[string]interface{}
+		status int
+		code   ErrorCode
+		field  string
+	}{
+		{"missing certificate", map[string]interface{}{"certificate": ""}, 400, CodeMissingField, "certificate"},
+		{"certificate not in hex", map[string]interface{}{"certificate": "zz"}, 400, CodeInvalidEncoding, "certificate"},
+		{"missing nonce", map[string]interface{}{"nonce": ""}, 400, CodeMissingField, "nonce"},
+		{"missing private key", map[string]interface{}{"privUser": ""}, 400, CodeMissingField, "privUser"},
+		{"keyID without keystore", map[string]interface{}{"privUser": "", "keyID": "holder"}, 400, CodeKeyRefused, "keyID"},
+		{"certificate of another CP", map[string]interface{}{"pubG1CP": otherCP["g1Pub"]}, 422, CodeInvalidCertificate, "certificate"},
+		{"certificate of fewer attributes", map[string]interface{}{"attributeCount": 1}, 422, CodeInvalidCertificate, "certificate"},
+		{"attributes of another count", map[string]interface{}{"attributes": []string{"1990-01-31"}, "random": commitment["random"]}, 400, CodeInvalidValue, "attributes"},
+		{"disclosure without attribute key", map[string]interface{}{"attributes": []string{"1990-01-31", "FR"}, "random": commitment["random"],
+			"disclosureMask": 2}, 422, CodeInvalidCertificate, "certificate"},
+	}
+	for _, test := range tests {
+		in := present()
+		for k, v := range test.change {
+			in[k] = v
+		}
+		status, ret := post(t, PresentCertificate, jsonBody(in))
+		checkError(t, test.name, status, ret, test.status, test.code, test.field)
+	}
+
+	//a presentation verifies only once, for the nonce of a challenge
+	_, challenge := post(t, GetChallenge, `{"context": "test"}`)
+	in := present()
+	in["nonce"] = challenge["nonce"]
+	status, p := post(t, PresentCertificate, jsonBody(in))
+	if status != 200 || p["proof"] == nil || p["disclosureProof"] != nil {
+		t.Fatalf("Presentation: %d %v", status, p)
+	}
+	p["nonce"] = challenge["nonce"]
+	p["pubG1CP"] = cp["g1Pub"]
+	verify := func(change map[string]interface{}) (int, map[string]interface{}) {
+		in := make(map[string]interface{})
+		for k, v := range p {
+			in[k] = v
+		}
+		for k, v := range change {
+			in[k] = v
+		}
+		return post(t, VerifyPresentation, jsonBody(in))
+	}
+	verifyTests := []struct {
+		name   string
+		change map[string]interface{}
+		status int
+		code   ErrorCode
+		field  string
+	}{
+		{"missing proof", map[string]interface{}{"proof": ""}, 400, CodeMissingField, "proof"},
+		{"proof not in hex", map[string]interface{}{"proof": "zz"}, 400, CodeInvalidEncoding, "proof"},
+		{"truncated proof", map[string]interface{}{"proof": p["proof"].(string)[:64]}, 400, CodeInvalidEncoding, "proof"},
+		{"truncated disclosure proof", map[string]interface{}{"disclosureProof": p["proof"].(string)[:64]}, 400, CodeInvalidEncoding, "disclosureProof"},
+		{"missing nonce", map[string]interface{}{"nonce": ""}, 400, CodeMissingField, "nonce"},
+		{"missing CP key", map[string]interface{}{"pubG1CP": ""}, 400, CodeMissingField, "pubG1CP"},
+		{"blinded key outside G2", map[string]interface{}{"blindPubG2User": outsideG2}, 400, CodeInvalidPoint, ""},
+		{"too many attributes", map[string]interface{}{"attributeCount": 33}, 400, CodeInvalidValue, "attributeCount"},
+	}
+	for _, test := range verifyTests {
+		status, ret := verify(test.change)
+		checkError(t, test.name, status, ret, test.status, test.code, test.field)
+	}
+	//a malformed request does not consume the nonce
+	if status, ret := verify(nil); status != 200 || ret["verify"] != "true" {
+		t.Fatalf("Presentation: %d %v", status, ret)
+	}
+	if status, ret := verify(nil); status != 200 || ret["verify"] != "false" {
+		t.Fatalf("Presentation verifies after the nonce is consumed: %d %v", status, ret)
+	}
+}
+
+func TestBatchErrors(t *testing.T) {
+	_, cp := post(t, GeneratePairingKey, "")
+	_, user := post(t, GeneratePairingKey, "")
+	_, commitment := post(t, Commitment, `{"attributes": ["1990-01-31", "FR"]}`)
+	_, cert := post(t, GenerateCertificate, jsonBody(map[string]interface{}{"commitment": commitment["commitment"], "attributeCount": 2,
+		"privCP": cp["priv"], "pubG2User": user["g2Pub"]}))
+
+	certificates := make([]map[string]interface{}, 3)
+	for i := range certificates {
+		status, p := post(t, PresentCertificate, jsonBody(map[string]interface{}{"commitment": commitment["commitment"], "attributeCount": 2,
+			"certificate": cert["certificate"], "pubG1CP": cp["g1Pub"], "privUser": user["priv"], "nonce": "0102"}))
+		if status != 200 {
+			t.Fatalf("Presentation: %d %v", status, p)
+		}
+		certificates[i] = map[string]interface{}{"blindCommitment": p["blindCommitment"], "blindCertificate": p["blindCertificate"],
+			"blindPubG1CP": p["blindPubG1CP"], "blindPubG2User": p["blindPubG2User"], "blindGenerator": p["blindGenerator"], "attributeCount": 2}
+	}
+	batch := func() string {
+		return jsonBody(map[string]interface{}{"certificates": certificates})
+	}
+
+	status, ret := post(t, VerifyBlindedCertificates, batch())
+	if status != 200 || ret["verify"] != "true" || len(ret["invalid"].([]interface{})) != 0 {
+		t.Fatalf("Batch: %d %v", status, ret)
+	}
+	//the certificate of another blinding does not verify, and only its index is returned
+	certificates[1]["blindCertificate"] = certificates[2]["blindCertificate"]
+	status, ret = post(t, VerifyBlindedCertificates, batch())
+	if invalid, _ := ret["invalid"].([]interface{}); status != 200 || ret["verify"] != "false" || len(invalid) != 1 || invalid[0] != 1.0 {
+		t.Fatalf("Batch with an invalid certificate: %d %v", status, ret)
+	}
+
+	//a malformed certificate rejects the whole request
+	certificates[1]["blindCertificate"] = "zz"
+	status, ret = post(t, VerifyBlindedCertificates, batch())
+	checkError(t, "certificate not in hex", status, ret, 400, CodeInvalidEncoding, "certificates[1].blindCertificate")
+	certificates[1]["blindCertificate"] = certificates[2]["blindCertificate"]
+	certificates[2]["blindPubG2User"] = outsideG2
+	status, ret = post(t, VerifyBlindedCertificates, batch())
+	checkError(t, "blinded key outside G2", status, ret, 400, CodeInvalidPoint, "certificates[2]")
+	certificates[2]["attributeCount"] = 33
+	status, ret = post(t, VerifyBlindedCertificates, batch())
+	checkError(t, "too many attributes", status, ret, 400, CodeInvalidValue, "certificates[2].attributeCount")
+	status, ret = post(t, VerifyBlindedCertificates, `{"certificates": {}}`)
+	checkError(t, "certificates not an array", status, ret, 400, CodeMalformedRequest, "")
+}
+
+func TestInternalErrorsLogged(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	w := httptest.NewRecorder()
+	writeError(w, badRequest(CodeInvalidValue, "secret", errors.New("secret value")))
+	if w.Code != 400 || logged.Len() != 0 {
+		t.Fatalf("Request error: %d, logged %q", w.Code, logged.String())
+	}
+	w = httptest.NewRecorder()
+	writeError(w, errors.New("no randomness"))
+	var ret map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &ret)
+	if w.Code != 500 || ret["code"] != string(CodeInternal) || !strings.Contains(logged.String(), "no randomness") {
+		t.Fatalf("Internal error: %d %v, logged %q", w.Code, ret, logged.String())
+	}
+}
@@ -0,0 +1,148 @@
+package apipoc
+
+import (
+	"crypto/ecdsa"
+	"errors"
+
+	"cryptolib"
+	"keystore"
+	"wire"
+)
+
+//keys contains the private keys used by the routes, referenced by their ID.
+//When it is nil, the routes take the private keys in the requests, as the demo client does
+var keys *keystore.Store
+
+//ivSigner and cpIssuer hold the keys of the IV and of the CP of the service, in a HSM or a remote signer.
+//When they are set, the routes of the IV and of the CP use them instead of the keys of the requests or of the keystore
+var (
+	ivSigner cryptolib.Signer
+	cpIssuer cryptolib.Issuer
+)
+
+//SetSigner makes /iv/signCommitment sign with s
+func SetSigner(s cryptolib.Signer) {
+	ivSigner = s
+}
+
+//SetIssuer makes /CP/generateCertificate issue the certificates with i
+func SetIssuer(i cryptolib.Issuer) {
+	cpIssuer = i
+}
+
+//SetKeystore makes the routes use the private keys of ks, given by their ID in the keyID parameter.
+//The private keys sent in the requests are then refused, and the keys are only generated by the keystore
+func SetKeystore(ks *keystore.Store) {
+	keys = ks
+}
+
+//missingKeyID is the error of a route which needs the key of keyID and has none
+func missingKeyID() error {
+	return badRequest(CodeMissingField, "keyID", errMissingField)
+}
+
+//signingKey returns the signer of the IV: the signer of the service, the key of the keystore or the key priv and pub of the request
+func signingKey(keyID string, priv string, pub string) (cryptolib.Signer, error) {
+	if ivSigner != nil {
+		if keyID != "" || priv != "" {
+			return nil, errKeyOfService
+		}
+		return ivSigner, nil
+	}
+	if keys != nil {
+		if priv != "" {
+			return nil, errPrivateKeyInRequest
+		}
+		if keyID == "" {
+			return nil, missingKeyID()
+		}
+		k, err := keys.ECDSAKey(keyID, keystore.RoleIV)
+		if err != nil {
+			return nil, storeError(err)
+		}
+		return &cryptolib.MemorySigner{Key: k}, nil
+	}
+	if keyID != "" {
+		return nil, errNoKeystore
+	}
+	var p parser
+	d := p.privateKey("priv", priv)
+	if p.err != nil {
+		return nil, p.err
+	}
+	k := &ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: curve}, D: d}
+	k.X, k.Y = curve.ScalarBaseMult(d.Bytes())
+	if pub != "" {
+		pubKey := p.publicKey("pub", pub, wire.PublicKey)
+		if p.err != nil {
+			return nil, p.err
+		}
+		if pubKey.X.Cmp(k.X) != 0 || pubKey.Y.Cmp(k.Y) != 0 {
+			return nil, badRequest(CodeInvalidValue, "pub", errors.New("pub is not the public key of priv"))
+		}
+	}
+	return &cryptolib.MemorySigner{Key: k}, nil
+}
+
+//issuerKey returns the issuer of the CP: the issuer of the service, the key of the keystore or the key privCP of the request
+func issuerKey(keyID string, privCP string) (cryptolib.Issuer, error) {
+	if cpIssuer != nil {
+		if keyID != "" || privCP != "" {
+			return nil, errKeyOfService
+		}
+		return cpIssuer, nil
+	}
+	if keys != nil {
+		if privCP != "" {
+			return nil, errPrivateKeyInRequest
+		}
+		if keyID == "" {
+			return nil, missingKeyID()
+		}
+		k, err := keys.IssuerKey(keyID, keystore.RoleCP)
+		if err != nil {
+			return nil, storeError(err)
+		}
+		return k, nil
+	}
+	if keyID != "" {
+		return nil, errNoKeystore
+	}
+	var p parser
+	priv := p.value("privCP", privCP, wire.IssuerKey)
+	if p.err != nil {
+		return nil, p.err
+	}
+	k := new(cryptolib.IssuerKey)
+	if err := k.Unmarshal(priv); err != nil {
+		return nil, cryptoError("privCP", err)
+	}
+	return k, nil
+}
+
+//holderKey returns the pairing key of the user, from the keystore or from privUser
+func holderKey(keyID string, privUser string) (*cryptolib.HolderKey, error) {
+	if keys != nil {
+		if privUser != "" {
+			return nil, errPrivateKeyInRequest
+		}
+		if keyID == "" {
+			return nil, missingKeyID()
+		}
+		k, err := keys.HolderKey(keyID, keystore.RoleHolder)
+		return k, storeError(err)
+	}
+	if keyID != "" {
+		return nil, errNoKeystore
+	}
+	var p parser
+	priv := p.value("privUser", privUser, wire.HolderKey)
+	if p.err != nil {
+		return nil, p.err
+	}
+	k := new(cryptolib.HolderKey)
+	if err := k.Unmarshal(priv); err != nil {
+		return nil, cryptoError("privUser", err)
+	}
+	return k, nil
+}
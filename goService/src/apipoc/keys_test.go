@@ -0,0 +1,89 @@
+package apipoc
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"keystore"
+)
+
+//newKeystore makes the routes use a new keystore holding the pairing keys of the CP "cp" and of the holder "holder"
+func newKeystore(t *testing.T) (*keystore.Store, keystore.KeyInfo, keystore.KeyInfo) {
+	keystore.Iterations = 1000
+	ks, err := keystore.Create(filepath.Join(t.TempDir(), "keystore.json"), "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp, err := ks.Generate("cp", keystore.IssuerKey, keystore.RoleCP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	holder, err := ks.Generate("holder", keystore.HolderKey, keystore.RoleHolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetKeystore(ks)
+	return ks, cp, holder
+}
+
+//jsonBody returns the JSON encoding of in
+func jsonBody(in interface{}) string {
+	b, _ := json.Marshal(in)
+	return string(b)
+}
+
+func TestKeystoreBlindCertificate(t *testing.T) {
+	_, cp, holder := newKeystore(t)
+	defer SetKeystore(nil)
+
+	_, commitment := post(t, Commitment, `{"attributes": ["1990-01-31", "FR"]}`)
+	status, cert := post(t, GenerateCertificate, jsonBody(map[string]interface{}{"commitment": commitment["commitment"], "attributeCount": 2,
+		"keyID": "cp", "pubG2User": holder.Public}))
+	if status != 200 {
+		t.Fatalf("Certificate: %d %v", status, cert)
+	}
+	status, ret := post(t, BlindCertificate, jsonBody(map[string]interface{}{"commitment": commitment["commitment"], "attributeCount": 2,
+		"certificate": cert["certificate"], "pubG1CP": cp.Public, "pubG2User": holder.Public, "keyID": "holder"}))
+	if status != 200 || ret["blindCertificate"] == nil {
+		t.Fatalf("Blinding: %d %v", status, ret)
+	}
+	//blindPrivUser*blindFactor^-1 is the private key of the keystore
+	for _, field := range []string{"blindPrivUser", "blindFactor"} {
+		if _, ok := ret[field]; ok {
+			t.Errorf("%s returned with a keystore", field)
+		}
+	}
+}
+
+func TestKeystorePresentCertificate(t *testing.T) {
+	_, cp, holder := newKeystore(t)
+	defer SetKeystore(nil)
+
+	_, commitment := post(t, Commitment, `{"attributes": ["1990-01-31", "FR"]}`)
+	_, cert := post(t, GenerateCertificate, jsonBody(map[string]interface{}{"commitment": commitment["commitment"], "attributeCount": 2,
+		"keyID": "cp", "pubG2User": holder.Public}))
+	tests := []struct {
+		name   string
+		keyID  string
+		priv   string
+		status int
+		code   ErrorCode
+		field  string
+	}{
+		{"private key in the request", "", "01", 400, CodeKeyRefused, ""},
+		{"missing keyID", "", "", 400, CodeMissingField, "keyID"},
+		{"unknown keyID", "user", "", 404, CodeUnknownKey, "keyID"},
+		{"key of another role", "cp", "", 403, CodeWrongOwner, "keyID"},
+	}
+	for _, test := range tests {
+		status, ret := post(t, PresentCertificate, jsonBody(map[string]interface{}{"commitment": commitment["commitment"], "attributeCount": 2,
+			"certificate": cert["certificate"], "pubG1CP": cp.Public, "keyID": test.keyID, "privUser": test.priv, "nonce": "0102"}))
+		checkError(t, test.name, status, ret, test.status, test.code, test.field)
+	}
+	status, ret := post(t, PresentCertificate, jsonBody(map[string]interface{}{"commitment": commitment["commitment"], "attributeCount": 2,
+		"certificate": cert["certificate"], "pubG1CP": cp.Public, "keyID": "holder", "nonce": "0102"}))
+	if status != 200 || ret["proof"] == nil {
+		t.Fatalf("Presentation with the key of the keystore: %d %v", status, ret)
+	}
+}
@@ -0,0 +1,212 @@
+package apipoc
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+
+	"converterhex"
+	"cryptolib"
+	"wire"
+)
+
+var (
+	errCurvePoint   = errors.New("Point is not on the curve")
+	errScalarRange  = errors.New("Scalar must be lower than the order of the curve")
+	errPrivateKey   = errors.New("Private key must be in [1, order)")
+	errNotAnInteger = errors.New("Not an integer")
+)
+
+//decode reads the JSON body of the request into in. An empty body leaves in to its zero value
+func decode(r *http.Request, in interface{}) error {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return badRequest(CodeMalformedRequest, "", err)
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(body, in); err != nil {
+		return badRequest(CodeMalformedRequest, "", err)
+	}
+	return nil
+}
+
+//parser parses and validates the fields of a request. It keeps the first error, which answers the request,
+//and returns nil for the fields parsed after it
+type parser struct {
+	err error
+}
+
+//fail keeps err if it is the first error
+func (p *parser) fail(err error) {
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+//value returns the payload of the required field of type t, hexadecimal in the wire encoding or in the legacy form
+func (p *parser) value(field, s string, t wire.Type) []byte {
+	if p.err != nil {
+		return nil
+	}
+	if s == "" {
+		p.fail(badRequest(CodeMissingField, field, errMissingField))
+		return nil
+	}
+	v, err := wire.Parse(s, t)
+	if err != nil {
+		p.fail(badRequest(CodeInvalidEncoding, field, err))
+		return nil
+	}
+	return v
+}
+
+//point returns the point of P256 of field, uncompressed. It must be on the curve, which has no other subgroup
+func (p *parser) point(field, s string, t wire.Type) []byte {
+	v := p.value(field, s, t)
+	if v == nil {
+		return nil
+	}
+	if x, _ := elliptic.Unmarshal(curve, v); x == nil {
+		p.fail(badRequest(CodeInvalidPoint, field, errCurvePoint))
+		return nil
+	}
+	return v
+}
+
+//publicKey returns the point of P256 of field as a public key
+func (p *parser) publicKey(field, s string, t wire.Type) *ecdsa.PublicKey {
+	v := p.point(field, s, t)
+	if v == nil {
+		return nil
+	}
+	x, y := elliptic.Unmarshal(curve, v)
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+}
+
+//scalar returns the scalar of P256 of field, which must be lower than the order of the curve
+func (p *parser) scalar(field, s string, t wire.Type) []byte {
+	v := p.value(field, s, t)
+	if v == nil {
+		return nil
+	}
+	if new(big.Int).SetBytes(v).Cmp(curve.Params().N) >= 0 {
+		p.fail(badRequest(CodeInvalidScalar, field, errScalarRange))
+		return nil
+	}
+	return v
+}
+
+//privateKey returns the ECDSA private key of field, in [1, order)
+func (p *parser) privateKey(field, s string) *big.Int {
+	v := p.scalar(field, s, wire.PrivateKey)
+	if v == nil {
+		return nil
+	}
+	d := new(big.Int).SetBytes(v)
+	if d.Sign() == 0 {
+		p.fail(badRequest(CodeInvalidScalar, field, errPrivateKey))
+		return nil
+	}
+	return d
+}
+
+//issuerPublicKey returns the public key of a CP of field, a point of G1
+func (p *parser) issuerPublicKey(field, s string) *cryptolib.IssuerPublicKey {
+	v := p.value(field, s, wire.IssuerPublicKey)
+	if v == nil {
+		return nil
+	}
+	k := new(cryptolib.IssuerPublicKey)
+	if err := k.Unmarshal(v); err != nil {
+		p.fail(cryptoError(field, err))
+		return nil
+	}
+	return k
+}
+
+//holderPublicKey returns the pairing public key of a user of field, a point of G2
+func (p *parser) holderPublicKey(field, s string) *cryptolib.HolderPublicKey {
+	v := p.value(field, s, wire.HolderPublicKey)
+	if v == nil {
+		return nil
+	}
+	k := new(cryptolib.HolderPublicKey)
+	if err := k.Unmarshal(v); err != nil {
+		p.fail(cryptoError(field, err))
+		return nil
+	}
+	return k
+}
+
+//nonce returns the hexadecimal nonce of field
+func (p *parser) nonce(field, s string) []byte {
+	if p.err != nil {
+		return nil
+	}
+	if s == "" {
+		p.fail(badRequest(CodeMissingField, field, errMissingField))
+		return nil
+	}
+	v, err := converterhex.HexToByte(s)
+	if err != nil {
+		p.fail(badRequest(CodeInvalidEncoding, field, err))
+		return nil
+	}
+	return v
+}
+
+//required returns the text of the required field
+func (p *parser) required(field, s string) string {
+	if p.err == nil && s == "" {
+		p.fail(badRequest(CodeMissingField, field, errMissingField))
+	}
+	return s
+}
+
+//integer returns the integer of field, written in base
+func (p *parser) integer(field, s string, base int) *big.Int {
+	if p.err != nil {
+		return nil
+	}
+	if s == "" {
+		p.fail(badRequest(CodeMissingField, field, errMissingField))
+		return nil
+	}
+	v, ok := new(big.Int).SetString(s, base)
+	if !ok {
+		p.fail(badRequest(CodeInvalidValue, field, errNotAnInteger))
+		return nil
+	}
+	return v
+}
+
+//attributeCount returns the number of attributes of field, 1 if it is 0. It must be at most maxAttributes
+func (p *parser) attributeCount(field string, n int) int {
+	if n < 0 || n > maxAttributes {
+		p.fail(badRequest(CodeInvalidValue, field, fmt.Errorf("Number of attributes must be between 1 and %d", maxAttributes)))
+		return 0
+	}
+	return attributeCount(n)
+}
+
+//attributes returns the messages of the attributes of field, or of the single value age if there are none
+func (p *parser) attributes(field string, attributes []string, age string) [][]byte {
+	message := attributesToMessage(attributes, age)
+	if len(message) == 1 && len(message[0]) == 0 {
+		p.fail(badRequest(CodeMissingField, field, errMissingField))
+		return nil
+	}
+	if len(message) > maxAttributes {
+		p.fail(badRequest(CodeInvalidValue, field, fmt.Errorf("Number of attributes must be between 1 and %d", maxAttributes)))
+		return nil
+	}
+	return message
+}
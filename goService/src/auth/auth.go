@@ -0,0 +1,191 @@
+//Package auth authenticates the clients of the service with their TLS certificate and restricts each route to the roles
+//of the protocol: the holder calls /user, the IV /iv, the CP /CP and the SP /SP.
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+//Role is the role of a client in the protocol
+type Role string
+
+//Roles of the clients
+const (
+	RoleIV     Role = "iv"
+	RoleCP     Role = "cp"
+	RoleSP     Role = "sp"
+	RoleHolder Role = "holder"
+	//RoleOrchestrator is the orchestrator posting the chaincode events to /events
+	RoleOrchestrator Role = "orchestrator"
+	//RoleMonitoring is the monitoring scraping the metrics of /metrics
+	RoleMonitoring Role = "monitoring"
+)
+
+//DefaultRoutes gives the routes of each role. /keys is open to all the roles, the keystore then restricts each key to its owner
+var DefaultRoutes = []Route{
+	{Prefix: "/user/", Roles: []Role{RoleHolder}},
+	{Prefix: "/iv/", Roles: []Role{RoleIV}},
+	{Prefix: "/CP/", Roles: []Role{RoleCP}},
+	{Prefix: "/SP/", Roles: []Role{RoleSP}},
+	{Prefix: "/keys", Roles: []Role{RoleIV, RoleCP, RoleSP, RoleHolder}},
+	{Prefix: "/events", Roles: []Role{RoleOrchestrator}},
+	{Prefix: "/metrics", Roles: []Role{RoleMonitoring}},
+}
+
+//defaultRules gives to a certificate the role named by its organizational unit
+var defaultRules = []RoleRule{
+	{Role: RoleIV, OU: string(RoleIV)},
+	{Role: RoleCP, OU: string(RoleCP)},
+	{Role: RoleSP, OU: string(RoleSP)},
+	{Role: RoleHolder, OU: string(RoleHolder)},
+	{Role: RoleOrchestrator, OU: string(RoleOrchestrator)},
+	{Role: RoleMonitoring, OU: string(RoleMonitoring)},
+}
+
+type contextKey struct{}
+
+type identityKey struct{}
+
+//Roles returns the roles of the client of the request, and false if the service does not authenticate its clients
+func Roles(r *http.Request) ([]Role, bool) {
+	roles, ok := r.Context().Value(contextKey{}).([]Role)
+	return roles, ok
+}
+
+//HasRole returns true if the client of the request has the role, or if the service does not authenticate its clients
+func HasRole(r *http.Request, role Role) bool {
+	roles, ok := Roles(r)
+	if !ok {
+		return true
+	}
+	for _, c := range roles {
+		if c == role {
+			return true
+		}
+	}
+	return false
+}
+
+//Identity returns the identity of the client of the request as the chaincode records it, "<MSP ID>/<client ID>",
+//and false if the client has no certificate verified by the client CAs or the service has no MSP ID
+func Identity(r *http.Request) (string, bool) {
+	id, ok := r.Context().Value(identityKey{}).(string)
+	return id, ok
+}
+
+//Authorizer is the middleware giving its roles to the client of a request and refusing the routes of the other roles
+type Authorizer struct {
+	rules  []RoleRule
+	routes []Route
+	//MSPID is the MSP of the client certificates, it prefixes their identity. Without it, the clients have no identity
+	MSPID string
+}
+
+//NewAuthorizer returns the middleware giving the roles of rules, or the role named by the organizational unit of the
+//certificate if there is none, and restricting routes and DefaultRoutes. The longest matching prefix applies,
+//a route which matches no prefix is refused
+func NewAuthorizer(rules []RoleRule, routes []Route) *Authorizer {
+	if len(rules) == 0 {
+		rules = defaultRules
+	}
+	return &Authorizer{rules: rules, routes: append(append([]Route{}, routes...), DefaultRoutes...)}
+}
+
+//matches returns true if the subject of the certificate matches the rule
+func (rule *RoleRule) matches(cert *x509.Certificate) bool {
+	if rule.OU == "" && rule.CN == "" {
+		return false
+	}
+	if rule.CN != "" && cert.Subject.CommonName != rule.CN {
+		return false
+	}
+	if rule.OU == "" {
+		return true
+	}
+	for _, ou := range cert.Subject.OrganizationalUnit {
+		if ou == rule.OU {
+			return true
+		}
+	}
+	return false
+}
+
+//roles returns the roles of the client of the request, none if it has no certificate verified by the client CAs
+func (a *Authorizer) roles(r *http.Request) []Role {
+	roles := []Role{}
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return roles
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	for i := range a.rules {
+		if a.rules[i].matches(cert) {
+			roles = append(roles, a.rules[i].Role)
+		}
+	}
+	return roles
+}
+
+//identity returns the identity of the client of the request, as the client ID of the Fabric cid library:
+//the base64 of "x509::<subject>::<issuer>" of its certificate, prefixed by the MSP ID
+func (a *Authorizer) identity(r *http.Request) (string, bool) {
+	if a.MSPID == "" || r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return "", false
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	id := "x509::" + cert.Subject.String() + "::" + cert.Issuer.String()
+	return a.MSPID + "/" + base64.StdEncoding.EncodeToString([]byte(id)), true
+}
+
+//route returns the route of path with the longest prefix, nil if there is none
+func (a *Authorizer) route(path string) *Route {
+	var res *Route
+	for i, route := range a.routes {
+		if strings.HasPrefix(path, route.Prefix) && (res == nil || len(route.Prefix) > len(res.Prefix)) {
+			res = &a.routes[i]
+		}
+	}
+	return res
+}
+
+//Wrap returns next behind the middleware. A request without client certificate gets 401 on a route which is not public,
+//a client without a role of the route gets 403
+func (a *Authorizer) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roles := a.roles(r)
+		route := a.route(r.URL.Path)
+		if route == nil {
+			http.Error(w, "auth: no role may call this route", http.StatusForbidden)
+			return
+		}
+		if !route.Public {
+			if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+				http.Error(w, "auth: a client certificate is required", http.StatusUnauthorized)
+				return
+			}
+			if !allowed(roles, route.Roles) {
+				http.Error(w, "auth: the roles of the client may not call this route", http.StatusForbidden)
+				return
+			}
+		}
+		ctx := context.WithValue(r.Context(), contextKey{}, roles)
+		if id, ok := a.identity(r); ok {
+			ctx = context.WithValue(ctx, identityKey{}, id)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func allowed(roles []Role, routeRoles []Role) bool {
+	for _, r := range roles {
+		for _, role := range routeRoles {
+			if r == role {
+				return true
+			}
+		}
+	}
+	return false
+}
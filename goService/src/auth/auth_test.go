@@ -0,0 +1,296 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+//testCA issues the certificates of the tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "aav test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+//issue returns the PEM certificate and key of subject, for a server if server is set, for a client else
+func (ca *testCA) issue(t *testing.T, subject pkix.Name, server bool) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if server {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+//client returns a client trusting ca, with the certificate of subject if it is not empty
+func (ca *testCA) client(t *testing.T, clientCA *testCA, subject pkix.Name) *http.Client {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	config := &tls.Config{RootCAs: roots}
+	if subject.CommonName != "" {
+		certPEM, keyPEM := clientCA.issue(t, subject, false)
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+}
+
+//startServer writes the certificates and the configuration in a directory, loads it and serves the roles of the clients
+func startServer(t *testing.T, ca *testCA, config string) *httptest.Server {
+	dir := t.TempDir()
+	certPEM, keyPEM := ca.issue(t, pkix.Name{CommonName: "aav service"}, true)
+	for name, content := range map[string][]byte{"server.pem": certPEM, "server.key": keyPEM, "clients-ca.pem": ca.pem, "aav-tls.json": []byte(config)} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), content, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c, err := LoadConfig(filepath.Join(dir, "aav-tls.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig, err := c.TLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roles, _ := Roles(r)
+		for _, role := range roles {
+			w.Write([]byte(role + " "))
+		}
+	})))
+	server.TLS = tlsConfig
+	server.StartTLS()
+	return server
+}
+
+func get(t *testing.T, client *http.Client, url string) (int, string) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestAuthorizer(t *testing.T) {
+	ca := newTestCA(t)
+	server := startServer(t, ca, `{
+		"certFile": "server.pem",
+		"keyFile": "server.key",
+		"clientCAFile": "clients-ca.pem",
+		"roles": [
+			{"role": "iv", "ou": "iv"},
+			{"role": "cp", "ou": "cp"},
+			{"role": "sp", "ou": "sp", "cn": "sp.example.com"},
+			{"role": "holder", "ou": "holder"}
+		],
+		"routes": [{"prefix": "/people", "public": true}, {"prefix": "/SP/challenge", "roles": ["sp", "cp"]}]
+	}`)
+	defer server.Close()
+
+	iv := ca.client(t, ca, pkix.Name{CommonName: "iv.example.com", OrganizationalUnit: []string{"iv"}})
+	cp := ca.client(t, ca, pkix.Name{CommonName: "cp.example.com", OrganizationalUnit: []string{"cp"}})
+	sp := ca.client(t, ca, pkix.Name{CommonName: "sp.example.com", OrganizationalUnit: []string{"sp"}})
+	otherSP := ca.client(t, ca, pkix.Name{CommonName: "other.example.com", OrganizationalUnit: []string{"sp"}})
+	holder := ca.client(t, ca, pkix.Name{CommonName: "alice", OrganizationalUnit: []string{"holder"}})
+	anonymous := ca.client(t, ca, pkix.Name{})
+	//a certificate with the right OU, from another CA
+	forged := ca.client(t, newTestCA(t), pkix.Name{CommonName: "iv.example.com", OrganizationalUnit: []string{"iv"}})
+
+	for _, tc := range []struct {
+		name   string
+		client *http.Client
+		path   string
+		status int
+		body   string
+	}{
+		{"iv", iv, "/iv/signCommitment", http.StatusOK, "iv "},
+		{"holder on iv", holder, "/iv/signCommitment", http.StatusForbidden, ""},
+		{"cp", cp, "/CP/generateCertificate", http.StatusOK, "cp "},
+		{"iv on cp", iv, "/CP/generateCertificate", http.StatusForbidden, ""},
+		{"holder", holder, "/user/presentCertificate", http.StatusOK, "holder "},
+		{"sp", sp, "/SP/verifyPresentation", http.StatusOK, "sp "},
+		{"sp of another CN", otherSP, "/SP/verifyPresentation", http.StatusForbidden, ""},
+		{"route of the configuration", cp, "/SP/challenge", http.StatusOK, "cp "},
+		{"keys", holder, "/keys", http.StatusOK, "holder "},
+		{"unknown route", iv, "/admin", http.StatusForbidden, ""},
+		{"anonymous", anonymous, "/iv/signCommitment", http.StatusUnauthorized, ""},
+		{"anonymous on a public route", anonymous, "/people", http.StatusOK, ""},
+		{"public route", cp, "/people/1", http.StatusOK, "cp "},
+	} {
+		status, body := get(t, tc.client, server.URL+tc.path)
+		if status != tc.status || (status == http.StatusOK && body != tc.body) {
+			t.Fatalf("%s: %d %q", tc.name, status, body)
+		}
+	}
+	//the TLS handshake fails with a certificate which is not signed by the client CA
+	if status, err := get(t, forged, server.URL+"/iv/signCommitment"); status != 0 {
+		t.Fatalf("Certificate of another CA accepted: %d %s", status, err)
+	}
+}
+
+func TestDefaultRoles(t *testing.T) {
+	ca := newTestCA(t)
+	server := startServer(t, ca, `{"certFile": "server.pem", "keyFile": "server.key", "clientCAFile": "clients-ca.pem", "requireClientCert": true}`)
+	defer server.Close()
+
+	//without rules, the role is the organizational unit
+	sp := ca.client(t, ca, pkix.Name{CommonName: "any", OrganizationalUnit: []string{"sp"}})
+	if status, body := get(t, sp, server.URL+"/SP/verifyPresentation"); status != http.StatusOK || body != "sp " {
+		t.Fatalf("Default role: %d %q", status, body)
+	}
+	orchestrator := ca.client(t, ca, pkix.Name{CommonName: "orchestrator", OrganizationalUnit: []string{"orchestrator"}})
+	if status, _ := get(t, orchestrator, server.URL+"/events"); status != http.StatusOK {
+		t.Fatalf("Orchestrator: %d", status)
+	}
+	monitoring := ca.client(t, ca, pkix.Name{CommonName: "prometheus", OrganizationalUnit: []string{"monitoring"}})
+	if status, _ := get(t, monitoring, server.URL+"/metrics"); status != http.StatusOK {
+		t.Fatalf("Monitoring: %d", status)
+	}
+	if status, _ := get(t, monitoring, server.URL+"/people"); status != http.StatusForbidden {
+		t.Fatalf("Monitoring on /people: %d", status)
+	}
+	//the handshake fails without client certificate
+	if status, err := get(t, ca.client(t, ca, pkix.Name{}), server.URL+"/people"); status != 0 {
+		t.Fatalf("Client without certificate accepted: %d %s", status, err)
+	}
+}
+
+func TestTLSOnly(t *testing.T) {
+	ca := newTestCA(t)
+	server := startServer(t, ca, `{"certFile": "server.pem", "keyFile": "server.key"}`)
+	defer server.Close()
+	//without client CA, the clients are not authenticated and every route is open
+	if status, body := get(t, ca.client(t, ca, pkix.Name{}), server.URL+"/iv/signCommitment"); status != http.StatusOK || body != "" {
+		t.Fatalf("TLS without client authentication: %d %q", status, body)
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	ca := newTestCA(t)
+	certPEM, _ := ca.issue(t, pkix.Name{CommonName: "sp.example.com", OrganizationalUnit: []string{"sp"}}, false)
+	block, _ := pem.Decode(certPEM)
+	cert, _ := x509.ParseCertificate(block.Bytes)
+
+	serve := func(a *Authorizer, state *tls.ConnectionState) (string, bool) {
+		var id string
+		var ok bool
+		r := httptest.NewRequest("GET", "/SP/webhooks", nil)
+		r.TLS = state
+		a.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, ok = Identity(r)
+		})).ServeHTTP(httptest.NewRecorder(), r)
+		return id, ok
+	}
+	verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert, ca.cert}}}
+
+	//the identity is the one recorded by the chaincode for the submitter of a transaction
+	a := NewAuthorizer(nil, nil)
+	a.MSPID = "SPMSP"
+	want := "SPMSP/" + base64.StdEncoding.EncodeToString([]byte("x509::CN=sp.example.com,OU=sp::CN=aav test CA"))
+	if id, ok := serve(a, verified); !ok || id != want {
+		t.Fatalf("Wrong identity: %q", id)
+	}
+	//no identity without MSP ID
+	if _, ok := serve(NewAuthorizer(nil, nil), verified); ok {
+		t.Fatal("Identity without MSP ID")
+	}
+	//nor without a verified certificate
+	if _, ok := serve(a, &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}); ok {
+		t.Fatal("Identity of an unverified certificate")
+	}
+}
+
+func TestConfigPaths(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(path, []byte(`{"addr": ":9443", "certFile": "server.pem", "keyFile": "/etc/aav/server.key"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Addr != ":9443" || c.CertFile != filepath.Join(dir, "server.pem") || c.KeyFile != "/etc/aav/server.key" {
+		t.Fatalf("Wrong paths of the configuration: %+v", c)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	dir := t.TempDir()
+	for _, config := range []string{
+		`{"keyFile": "server.key"}`,
+		`{"certFile": "server.pem", "keyFile": "server.key", "requireClientCert": true}`,
+		`{"certFile": "server.pem", "keyFile": "server.key", "routes": [{"prefix": "/x"}]}`,
+		`{"certFile": "server.pem", "keyFile": "server.key", "roles": [{"ou": "iv"}]}`,
+		`{"certFile": `,
+	} {
+		path := filepath.Join(dir, "config.json")
+		if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadConfig(path); err == nil {
+			t.Fatalf("Invalid configuration accepted: %s", config)
+		}
+	}
+}
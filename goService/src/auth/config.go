@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+)
+
+var (
+	//ErrInvalidConfig is returned when the configuration misses the certificate of the service or has an invalid role or route
+	ErrInvalidConfig = errors.New("auth: invalid configuration")
+	//ErrClientCA is returned when the file of the client CAs contains no PEM certificate
+	ErrClientCA = errors.New("auth: no certificate in the client CA file")
+)
+
+//RoleRule gives a role to the client certificates whose subject matches it.
+//Every non-empty field must match, a rule with no field matches no certificate
+type RoleRule struct {
+	Role Role   `json:"role"`
+	OU   string `json:"ou,omitempty"` //organizational unit of the subject
+	CN   string `json:"cn,omitempty"` //common name of the subject
+}
+
+//Route restricts the paths starting with Prefix to the clients which have one of Roles.
+//A public route is also open to the clients without certificate
+type Route struct {
+	Prefix string `json:"prefix"`
+	Roles  []Role `json:"roles,omitempty"`
+	Public bool   `json:"public,omitempty"`
+}
+
+//Config is the TLS configuration of the service, read from a JSON file:
+//
+//	{
+//		"addr": ":8443",
+//		"certFile": "server.pem",
+//		"keyFile": "server.key",
+//		"clientCAFile": "clients-ca.pem",
+//		"requireClientCert": false,
+//		"mspID": "Org1MSP",
+//		"roles": [{"role": "iv", "ou": "iv"}, {"role": "sp", "cn": "sp.example.com"}],
+//		"routes": [{"prefix": "/people", "public": true}]
+//	}
+//
+//The paths of the files are relative to the configuration file. Without clientCAFile, the clients are not authenticated.
+//With it, the client certificates signed by these CAs get the roles of the matching rules, OU = role name by default,
+//and each route is restricted to its roles; the routes of the configuration are added to DefaultRoutes.
+//mspID is the MSP of the client certificates on the channel, it gives to the clients their identity on the chaincode
+type Config struct {
+	Addr              string     `json:"addr"`
+	CertFile          string     `json:"certFile"`
+	KeyFile           string     `json:"keyFile"`
+	ClientCAFile      string     `json:"clientCAFile,omitempty"`
+	RequireClientCert bool       `json:"requireClientCert,omitempty"` //refuse the TLS connections without client certificate
+	MSPID             string     `json:"mspID,omitempty"`
+	Roles             []RoleRule `json:"roles,omitempty"`
+	Routes            []Route    `json:"routes,omitempty"`
+}
+
+//LoadConfig reads the configuration file at path
+func LoadConfig(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := new(Config)
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, errors.New("auth: malformed configuration: " + err.Error())
+	}
+	dir := filepath.Dir(path)
+	for _, f := range []*string{&c.CertFile, &c.KeyFile, &c.ClientCAFile} {
+		if *f != "" && !filepath.IsAbs(*f) {
+			*f = filepath.Join(dir, *f)
+		}
+	}
+	if c.Addr == "" {
+		c.Addr = ":8443"
+	}
+	if c.CertFile == "" || c.KeyFile == "" || (c.RequireClientCert && c.ClientCAFile == "") {
+		return nil, ErrInvalidConfig
+	}
+	for _, r := range c.Roles {
+		if r.Role == "" {
+			return nil, ErrInvalidConfig
+		}
+	}
+	for _, r := range c.Routes {
+		if r.Prefix == "" || (len(r.Roles) == 0 && !r.Public) {
+			return nil, ErrInvalidConfig
+		}
+	}
+	return c, nil
+}
+
+//TLSConfig returns the TLS configuration of the server: its certificate and, with clientCAFile, the verification of
+//the client certificates, which are optional unless requireClientCert is set
+func (c *Config) TLSConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	t := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if c.ClientCAFile == "" {
+		return t, nil
+	}
+	pem, err := ioutil.ReadFile(c.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	t.ClientCAs = x509.NewCertPool()
+	if !t.ClientCAs.AppendCertsFromPEM(pem) {
+		return nil, ErrClientCA
+	}
+	t.ClientAuth = tls.VerifyClientCertIfGiven
+	if c.RequireClientCert {
+		t.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return t, nil
+}
+
+//Handler returns h behind the role middleware, or h itself when the clients are not authenticated
+func (c *Config) Handler(h http.Handler) http.Handler {
+	if c.ClientCAFile == "" {
+		return h
+	}
+	a := NewAuthorizer(c.Roles, c.Routes)
+	a.MSPID = c.MSPID
+	return a.Wrap(h)
+}
+
+//ListenAndServe serves h over TLS on the address of the configuration
+func (c *Config) ListenAndServe(h http.Handler) error {
+	t, err := c.TLSConfig()
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Addr: c.Addr, Handler: c.Handler(h), TLSConfig: t}
+	return server.ListenAndServeTLS("", "")
+}
@@ -0,0 +1,202 @@
+package cryptolib
+
+import (
+	"errors"
+	"io"
+	"math/big"
+
+	"golang.org/x/crypto/bn256"
+)
+
+//The revocation of the certificates uses a pairing based accumulator over bn256.
+//The CP owns a secret alpha and publishes Q = alpha*G2 and the accumulator value V in G1.
+//The revocation handle of a certificate is y = H(C) [Order], already certified by the certificate.
+//The witness of a non revoked certificate is W = (y+alpha)^{-1}*V, so that e(W, y*G2 + Q) == e(V, G2).
+//Revoking y' publishes V' = (y'+alpha)^{-1}*V and y'. Every other holder updates its witness with UpdateWitness,
+//the holder of y' cannot since it would need to divide by y'-y' = 0.
+
+var (
+	errRevokedHandle     = errors.New("Witness cannot be updated, the revocation handle has been revoked")
+	errMembershipSize    = sizeError("Membership proof must be 384 bytes, or 196 bytes if compressed")
+	errMembershipG1      = pointError("Cannot Unmarshal G1 point of the membership proof")
+	errMembershipG2      = pointError("Cannot Unmarshal G2 point of the membership proof")
+	errAccumulatorKey    = pointError("Cannot Unmarshal accumulator public key")
+	errAccumulatorValue  = pointError("Cannot Unmarshal accumulator value")
+	errAccumulatorSecret = errors.New("Accumulator secret is not invertible for this handle")
+)
+
+//AccumulatorKey is the secret alpha of the revocation accumulator of a CP, and its public key Q = alpha*G2
+type AccumulatorKey struct {
+	Q *bn256.G2
+	D *big.Int
+}
+
+//MembershipProof proves that the certificate of a BlindedPresentation has not been revoked,
+//for the accumulator value V and public key Q of the CP. The values are blinded by the factor b of the presentation.
+type MembershipProof struct {
+	//Witness is b*W
+	Witness *bn256.G1
+	//Accumulator is b*V
+	Accumulator *bn256.G1
+	//AccumulatorKey is b*Q
+	AccumulatorKey *bn256.G2
+	//Generator is b*G2
+	Generator *bn256.G2
+}
+
+//GenerateAccumulatorKey generates the accumulator secret of a CP and the initial value of the accumulator
+func GenerateAccumulatorKey(r io.Reader) (*AccumulatorKey, *bn256.G1, error) {
+	d, err := randomScalar(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	v, err := randomScalar(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &AccumulatorKey{Q: g2BaseMult(d), D: d}, g1BaseMult(v), nil
+}
+
+//RevocationHandle returns the revocation handle y = H(C) [Order] of the certificate of the commitment
+func RevocationHandle(commitment []byte) *big.Int {
+	y := commitmentHash(commitment)
+	return y.Mod(y, bn256.Order)
+}
+
+//divide returns (y+alpha)^{-1}*v
+func (k *AccumulatorKey) divide(y *big.Int, v *bn256.G1) (*bn256.G1, error) {
+	inv := new(big.Int).Add(y, k.D)
+	if inv.ModInverse(inv, bn256.Order) == nil {
+		return nil, errAccumulatorSecret
+	}
+	return g1Mult(v, inv), nil
+}
+
+//Witness returns the witness (y+alpha)^{-1}*V of the handle y for the accumulator value v. It is sent to the holder with the certificate
+func (k *AccumulatorKey) Witness(y *big.Int, v *bn256.G1) (*bn256.G1, error) {
+	return k.divide(y, v)
+}
+
+//Revoke returns the accumulator value (y+alpha)^{-1}*V which excludes the handle y. The CP publishes it with y
+func (k *AccumulatorKey) Revoke(y *big.Int, v *bn256.G1) (*bn256.G1, error) {
+	return k.divide(y, v)
+}
+
+//VerifyWitness verifies that the witness w of the handle y is correct for the accumulator value v and the public key q
+//ie e(W, y*G2 + Q) == e(V, G2)
+func VerifyWitness(w *bn256.G1, y *big.Int, v *bn256.G1, q *bn256.G2) bool {
+	right := g2BaseMult(y)
+	right.Add(right, q)
+	return pairEqual(w, right, v, g2BaseMult(big.NewInt(1)))
+}
+
+//VerifyAccumulatorUpdate verifies that newValue is oldValue without the revoked handle, ie it is a witness of the handle for oldValue.
+//Everybody can check an update published by a CP
+func VerifyAccumulatorUpdate(oldValue *bn256.G1, newValue *bn256.G1, revoked *big.Int, q *bn256.G2) bool {
+	return VerifyWitness(newValue, revoked, oldValue, q)
+}
+
+//UpdateWitness updates the witness w of the handle y after the revocation of the handle revoked,
+//newValue being the accumulator value published with the revocation.
+//It returns (revoked-y)^{-1}*(W - V'), and an error if y is the revoked handle.
+func UpdateWitness(w *bn256.G1, y *big.Int, revoked *big.Int, newValue *bn256.G1) (*bn256.G1, error) {
+	diff := new(big.Int).Sub(revoked, y)
+	diff.Mod(diff, bn256.Order)
+	if diff.Sign() == 0 {
+		return nil, errRevokedHandle
+	}
+	diff.ModInverse(diff, bn256.Order)
+	res := new(bn256.G1).Neg(newValue)
+	res.Add(res, w)
+	return g1Mult(res, diff), nil
+}
+
+//BlindWitness blinds the witness w with the factor of the presentation, so that the SP can check that the certificate is not revoked
+//without being able to link two presentations. v and q are the accumulator value and public key the witness is computed for.
+func (s *BlindingSecret) BlindWitness(w *bn256.G1, v *bn256.G1, q *bn256.G2) *MembershipProof {
+	return &MembershipProof{
+		Witness:        g1Mult(w, s.Factor),
+		Accumulator:    g1Mult(v, s.Factor),
+		AccumulatorKey: g2Mult(q, s.Factor),
+		Generator:      g2BaseMult(s.Factor),
+	}
+}
+
+//VerifyMembership verifies that the handle y certified in the presentation is in the accumulator value v of public key q.
+//The presentation gives b*y (Commitment) and b*G (Generator), the proof gives b*W, b*V, b*Q and b*G2. It checks that
+//e(b*G, G2) == e(G, b*G2), e(b*G, Q) == e(G, b*Q), e(b*V, G2) == e(V, b*G2) and e(b*W, b*y*G2 + b*Q) == e(b*V, b*G2)
+func (p *BlindedPresentation) VerifyMembership(m *MembershipProof, v *bn256.G1, q *bn256.G2) bool {
+	g1 := g1BaseMult(big.NewInt(1))
+	g2 := g2BaseMult(big.NewInt(1))
+	if !pairEqual(p.Generator, g2, g1, m.Generator) {
+		return false
+	}
+	if !pairEqual(p.Generator, q, g1, m.AccumulatorKey) {
+		return false
+	}
+	if !pairEqual(m.Accumulator, g2, v, m.Generator) {
+		return false
+	}
+	right := g2BaseMult(p.Commitment)
+	right.Add(right, m.AccumulatorKey)
+	return pairEqual(m.Witness, right, m.Accumulator, m.Generator)
+}
+
+//membershipProofLen is the size of a marshalled membership proof whose points have g1 and g2 bytes
+func membershipProofLen(g1, g2 int) int {
+	return 2*g1 + 2*g2
+}
+
+//Marshal returns witness (64 bytes) || accumulator (64 bytes) || accumulator key (128 bytes) || generator (128 bytes)
+func (m *MembershipProof) Marshal() []byte {
+	return m.marshal(false)
+}
+
+//MarshalCompressed returns the proof like Marshal, with compressed points: 196 bytes instead of 384
+func (m *MembershipProof) MarshalCompressed() []byte {
+	return m.marshal(true)
+}
+
+func (m *MembershipProof) marshal(compressed bool) []byte {
+	res := make([]byte, 0, membershipProofLen(g1Len, g2Len))
+	res = append(res, marshalG1(m.Witness, compressed)...)
+	res = append(res, marshalG1(m.Accumulator, compressed)...)
+	res = append(res, marshalG2(m.AccumulatorKey, compressed)...)
+	return append(res, marshalG2(m.Generator, compressed)...)
+}
+
+//Unmarshal sets m to the membership proof b, the output of Marshal or of MarshalCompressed
+func (m *MembershipProof) Unmarshal(b []byte) error {
+	g1, g2, ok := pointLens(len(b), membershipProofLen)
+	if !ok {
+		return errMembershipSize
+	}
+	var res MembershipProof
+	if res.Witness, ok = unmarshalG1(b[:g1]); !ok {
+		return errMembershipG1
+	}
+	if res.Accumulator, ok = unmarshalG1(b[g1 : 2*g1]); !ok {
+		return errMembershipG1
+	}
+	if res.AccumulatorKey, ok = unmarshalG2(b[2*g1 : 2*g1+g2]); !ok {
+		return errMembershipG2
+	}
+	if res.Generator, ok = unmarshalG2(b[2*g1+g2:]); !ok {
+		return errMembershipG2
+	}
+	*m = res
+	return nil
+}
+
+//UnmarshalAccumulator reads the accumulator value and public key published by a CP, compressed or not
+func UnmarshalAccumulator(value []byte, publicKey []byte) (*bn256.G1, *bn256.G2, error) {
+	v, ok := unmarshalG1(value)
+	if !ok {
+		return nil, nil, errAccumulatorValue
+	}
+	q, ok := unmarshalG2(publicKey)
+	if !ok {
+		return nil, nil, errAccumulatorKey
+	}
+	return v, q, nil
+}
@@ -0,0 +1,81 @@
+package cryptolib
+
+import (
+	"crypto/rand"
+	"math/big"
+	"testing"
+
+	"golang.org/x/crypto/bn256"
+)
+
+func TestRevocation(t *testing.T) {
+	issuer, err := GenerateIssuerKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc, v, err := GenerateAccumulatorKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//two holders receive a certificate and a witness
+	holders := make([]*HolderKey, 2)
+	creds := make([]*Credential, 2)
+	handles := make([]*big.Int, 2)
+	witnesses := make([]*bn256.G1, 2)
+	for i := range holders {
+		if holders[i], err = GenerateHolderKey(rand.Reader); err != nil {
+			t.Fatal(err)
+		}
+		commitment := []byte{byte(i), 1, 2, 3}
+		if creds[i], err = issuer.Issue(commitment, 1, &holders[i].HolderPublicKey); err != nil {
+			t.Fatal(err)
+		}
+		handles[i] = RevocationHandle(commitment)
+		if witnesses[i], err = acc.Witness(handles[i], v); err != nil {
+			t.Fatal(err)
+		}
+		if !VerifyWitness(witnesses[i], handles[i], v, acc.Q) {
+			t.Fatalf("Witness %d does not verify", i)
+		}
+	}
+
+	present := func(i int) bool {
+		p, secret, err := holders[i].Blind(rand.Reader, creds[i], &issuer.IssuerPublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m MembershipProof
+		if err := m.Unmarshal(secret.BlindWitness(witnesses[i], v, acc.Q).Marshal()); err != nil {
+			t.Fatal(err)
+		}
+		return p.VerifyMembership(&m, v, acc.Q)
+	}
+	if !present(0) || !present(1) {
+		t.Fatal("Membership does not verify")
+	}
+
+	//the CP revokes the second certificate
+	old := v
+	if v, err = acc.Revoke(handles[1], v); err != nil {
+		t.Fatal(err)
+	}
+	if !VerifyAccumulatorUpdate(old, v, handles[1], acc.Q) {
+		t.Fatal("Accumulator update does not verify")
+	}
+	if present(0) {
+		t.Fatal("Membership verifies with an outdated witness")
+	}
+	if witnesses[0], err = UpdateWitness(witnesses[0], handles[0], handles[1], v); err != nil {
+		t.Fatal(err)
+	}
+	if !present(0) {
+		t.Fatal("Membership does not verify after the witness update")
+	}
+	if _, err := UpdateWitness(witnesses[1], handles[1], handles[1], v); err == nil {
+		t.Fatal("Witness of a revoked handle updated")
+	}
+	if present(1) {
+		t.Fatal("Membership verifies for a revoked certificate")
+	}
+}
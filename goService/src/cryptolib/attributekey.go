@@ -0,0 +1,716 @@
+package cryptolib
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+	"time"
+
+	"golang.org/x/crypto/bn256"
+)
+
+//attributeKeyBits is the number of bits of a hashed attribute, each of them is proven by AttributeKeyProof
+const attributeKeyBits = 8 * sha256.Size
+
+//bitChallengeLen is the size in bytes of the challenges of the bit proofs. They are lower than the orders of P256 and of bn256,
+//so that the same challenge is used on both curves
+const bitChallengeLen = 16
+
+var (
+	errAttributeKeyGenerators = errors.New("Number of generators of the attribute key does not match the number of attributes")
+	errAttributeKeyProofSize  = sizeError("Attribute key proof has a wrong size")
+	errAttributeKeyProofPoint = pointError("Point of the attribute key proof is not on its curve or at infinity")
+	errAttributeKeyHolder     = errors.New("Attribute key proof does not prove the knowledge of the private key of the holder")
+	errAttributeProofSize     = sizeError("Attribute proof has a wrong size")
+	errAttributeProofPoint    = pointError("Cannot Unmarshal point of the attribute proof")
+)
+
+//Key returns the attribute key of the holder for the attributes message committed with the random r:
+//K = G~0 + pubG2User + r*S~ + H(m1)*G~1 + ... + H(mn)*G~n.
+//The CP certifies K instead of pubG2User, once the holder has proven with GenerateAttributeKeyProof that K holds the attributes of
+//the commitment. The attributes can then be disclosed from a presentation without the commitment, see HolderKey.PresentAttributes
+func (g *AttributeKeyGenerators) Key(holder *HolderPublicKey, message [][]byte, r []byte) (*HolderPublicKey, error) {
+	if len(message) != len(g.Attributes) {
+		return nil, errAttributeKeyGenerators
+	}
+	key := new(bn256.G2).Add(g.Base, holder.G2)
+	key.Add(key, g2Mult(g.Blinding, new(big.Int).SetBytes(r)))
+	for i, m := range messageToHash(message) {
+		key.Add(key, g2Mult(g.Attributes[i], new(big.Int).SetBytes(m)))
+	}
+	return &HolderPublicKey{key}, nil
+}
+
+//AttributeKeyProof proves that an attribute key holds the attributes of a commitment, without revealing them.
+//Each bit of each hashed attribute is committed on P256 as A = bit*Gi + ri*H and on bn256 as B = bit*G~i + r'i*S~,
+//with an OR proof that both commit to 0 or both commit to 1. The randoms are chosen so that the sum of the 2^j*A is the commitment
+//and the sum of the 2^j*B is K - G~0 - pubG2User.
+//The holder also proves that it knows privUser: else pubG2User could be privUser*G2 + d*G~i, and the key would hold the attribute i
+//shifted by d.
+//
+//The proof is large and slow: 256 bit proofs per attribute, 90368 bytes per attribute (74240 with compressed points, twice as many
+//hexadecimal digits), so about 0.9 MB for 10 attributes. Generating or verifying it takes one to two seconds per attribute.
+type AttributeKeyProof struct {
+	//AHolder is w*G2, the commitment of the proof of knowledge of privUser
+	AHolder *bn256.G2
+	//SHolder is w + e*privUser [Order]
+	SHolder *big.Int
+	//Bits are the proofs of the bits of the attributes, from the lowest bit of the first attribute
+	Bits []AttributeBitProof
+}
+
+//AttributeBitProof is the proof of a bit of an attribute. The branch b proves that A - b*Gi and B - b*G~i are multiples of H and S~
+type AttributeBitProof struct {
+	//A is the commitment of the bit on P256, uncompressed
+	A []byte
+	//B is the commitment of the bit on bn256
+	B *bn256.G2
+	//E are the challenges of the branches, of bitChallengeLen bytes. Their xor is the challenge of the bit
+	E [2]*big.Int
+	//ZA are the responses of the branches on P256 [N]
+	ZA [2]*big.Int
+	//ZB are the responses of the branches on bn256 [Order]
+	ZB [2]*big.Int
+}
+
+//attributeKeyStatement hashes what the attribute key proof is about: the generators, the commitment, the holder with the commitment
+//AHolder of its proof of knowledge, and the session of the verifier. Each field is prefixed by its length
+func attributeKeyStatement(secretPub *ecdsa.PublicKey, gen []ecdsa.PublicKey, commit []byte, keyGen *AttributeKeyGenerators, holder *HolderPublicKey, AHolder *bn256.G2, nonce []byte, context []byte) []byte {
+	defer observe(PrimitiveHash, time.Now())
+	c := secretPub.Curve
+	fields := [][]byte{
+		[]byte("attribute key"),
+		[]byte(c.Params().Name),
+		elliptic.Marshal(c, secretPub.X, secretPub.Y),
+	}
+	for i := range gen {
+		fields = append(fields, elliptic.Marshal(c, gen[i].X, gen[i].Y))
+	}
+	fields = append(fields, commit, keyGen.Base.Marshal(), keyGen.Blinding.Marshal())
+	for _, g := range keyGen.Attributes {
+		fields = append(fields, g.Marshal())
+	}
+	fields = append(fields, holder.Marshal(), AHolder.Marshal(), nonce, context)
+
+	h := sha256.New()
+	for _, field := range fields {
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], uint32(len(field)))
+		h.Write(size[:])
+		h.Write(field)
+	}
+	return h.Sum(nil)
+}
+
+//holderChallenge computes the challenge of the proof of knowledge of privUser [Order]
+func holderChallenge(statement []byte) *big.Int {
+	defer observe(PrimitiveHash, time.Now())
+	h := sha256.New()
+	h.Write(statement)
+	h.Write([]byte("holder key"))
+	return new(big.Int).Mod(new(big.Int).SetBytes(h.Sum(nil)), bn256.Order)
+}
+
+//bitChallenge computes the challenge of the bit j of the attribute i, of bitChallengeLen bytes
+func bitChallenge(statement []byte, i int, j int, A []byte, B *bn256.G2, TA [2][]byte, TB [2]*bn256.G2) *big.Int {
+	defer observe(PrimitiveHash, time.Now())
+	var index [8]byte
+	binary.BigEndian.PutUint32(index[0:4], uint32(i))
+	binary.BigEndian.PutUint32(index[4:8], uint32(j))
+	h := sha256.New()
+	h.Write(statement)
+	h.Write(index[:])
+	h.Write(A)
+	h.Write(B.Marshal())
+	h.Write(TA[0])
+	h.Write(TA[1])
+	h.Write(TB[0].Marshal())
+	h.Write(TB[1].Marshal())
+	return new(big.Int).SetBytes(h.Sum(nil)[:bitChallengeLen])
+}
+
+//randomBits returns a random of bitChallengeLen bytes
+func randomBits(r io.Reader) (*big.Int, error) {
+	var buf [bitChallengeLen]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(buf[:]), nil
+}
+
+//randomMod returns a random in [0, n)
+func randomMod(r io.Reader, n *big.Int) (*big.Int, error) {
+	buf := make([]byte, (n.BitLen()+7)/8+16)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return new(big.Int).Mod(new(big.Int).SetBytes(buf), n), nil
+}
+
+//splitRandom returns count randoms whose sum weighted by 2^j, j being the index of the random in its attribute, is r [n]
+func splitRandom(rd io.Reader, r *big.Int, count int, n *big.Int) ([]*big.Int, error) {
+	randoms := make([]*big.Int, count)
+	randoms[0] = new(big.Int).Set(r)
+	for k := 1; k < count; k++ {
+		rk, err := randomMod(rd, n)
+		if err != nil {
+			return nil, err
+		}
+		randoms[k] = rk
+		randoms[0].Sub(randoms[0], new(big.Int).Lsh(rk, uint(k%attributeKeyBits)))
+	}
+	randoms[0].Mod(randoms[0], n)
+	return randoms, nil
+}
+
+//g2Sub returns a - k*b
+func g2Sub(a *bn256.G2, b *bn256.G2, k *big.Int) *bn256.G2 {
+	return new(bn256.G2).Add(a, new(bn256.G2).Neg(g2Mult(b, k)))
+}
+
+//p256Sub returns a - k*b on c
+func p256Sub(c elliptic.Curve, ax, ay *big.Int, bx, by *big.Int, k *big.Int) (*big.Int, *big.Int) {
+	x, y := scalarMult(c, bx, by, k.Bytes())
+	x, y = negY(c, x, y)
+	return c.Add(ax, ay, x, y)
+}
+
+//GenerateAttributeKeyProof proves that the attribute key of holder for message and r holds the attributes of the commitment, see AttributeKeyProof.
+/*
+ * message, secretPub, gen and r are the inputs given to Commit
+ * commit is the commitment returned by Commit
+ * keyGen are the generators of the attribute key, holder is the pairing key of the holder
+ * nonce and context are the session of the verifier, the CP
+ */
+func GenerateAttributeKeyProof(rd io.Reader, message [][]byte, secretPub *ecdsa.PublicKey, gen []ecdsa.PublicKey, r []byte, commit []byte, keyGen *AttributeKeyGenerators, holder *HolderKey, nonce []byte, context []byte) (*AttributeKeyProof, error) {
+	if len(message) != len(gen) {
+		return nil, errMessageOrGeneratorSize
+	}
+	if len(message) != len(keyGen.Attributes) {
+		return nil, errAttributeKeyGenerators
+	}
+	c := secretPub.Curve
+	n := c.Params().N
+	count := len(message) * attributeKeyBits
+	randomsA, err := splitRandom(rd, new(big.Int).SetBytes(r), count, n)
+	if err != nil {
+		return nil, err
+	}
+	randomsB, err := splitRandom(rd, new(big.Int).SetBytes(r), count, bn256.Order)
+	if err != nil {
+		return nil, err
+	}
+	//AHolder = w*G2 and SHolder = w + e*privUser
+	w, err := randomMod(rd, bn256.Order)
+	if err != nil {
+		return nil, err
+	}
+	AHolder := g2BaseMult(w)
+	statement := attributeKeyStatement(secretPub, gen, commit, keyGen, &holder.HolderPublicKey, AHolder, nonce, context)
+	SHolder := new(big.Int).Mul(holderChallenge(statement), holder.D)
+	SHolder.Add(SHolder, w)
+
+	proof := &AttributeKeyProof{AHolder: AHolder, SHolder: SHolder.Mod(SHolder, bn256.Order), Bits: make([]AttributeBitProof, count)}
+	for i, m := range messageToHash(message) {
+		value := new(big.Int).SetBytes(m)
+		for j := 0; j < attributeKeyBits; j++ {
+			k := i*attributeKeyBits + j
+			bit := value.Bit(j)
+			fake := 1 - bit
+
+			//A = bit*Gi + ri*H and B = bit*G~i + r'i*S~
+			ax, ay := scalarMult(c, secretPub.X, secretPub.Y, scalarBytes(c, randomsA[k]))
+			B := g2Mult(keyGen.Blinding, randomsB[k])
+			if bit == 1 {
+				ax, ay = c.Add(ax, ay, gen[i].X, gen[i].Y)
+				B.Add(B, keyGen.Attributes[i])
+			}
+			item := AttributeBitProof{A: elliptic.Marshal(c, ax, ay), B: B}
+
+			//simulate the other branch: TA = z*H - e*(A - fake*Gi) and TB = z'*S~ - e*(B - fake*G~i)
+			var TA [2][]byte
+			var TB [2]*bn256.G2
+			if item.E[fake], err = randomBits(rd); err != nil {
+				return nil, err
+			}
+			if item.ZA[fake], err = randomMod(rd, n); err != nil {
+				return nil, err
+			}
+			if item.ZB[fake], err = randomMod(rd, bn256.Order); err != nil {
+				return nil, err
+			}
+			px, py := ax, ay
+			Q := B
+			if fake == 1 {
+				px, py = p256Sub(c, ax, ay, gen[i].X, gen[i].Y, big.NewInt(1))
+				Q = g2Sub(B, keyGen.Attributes[i], big.NewInt(1))
+			}
+			tx, ty := scalarMult(c, secretPub.X, secretPub.Y, scalarBytes(c, item.ZA[fake]))
+			tx, ty = p256Sub(c, tx, ty, px, py, item.E[fake])
+			TA[fake] = elliptic.Marshal(c, tx, ty)
+			TB[fake] = g2Sub(g2Mult(keyGen.Blinding, item.ZB[fake]), Q, item.E[fake])
+
+			//real branch: TA = kA*H and TB = kB*S~
+			kA, err := randomMod(rd, n)
+			if err != nil {
+				return nil, err
+			}
+			kB, err := randomMod(rd, bn256.Order)
+			if err != nil {
+				return nil, err
+			}
+			tx, ty = scalarMult(c, secretPub.X, secretPub.Y, scalarBytes(c, kA))
+			TA[bit] = elliptic.Marshal(c, tx, ty)
+			TB[bit] = g2Mult(keyGen.Blinding, kB)
+
+			//e_bit = e xor e_fake, z = k + e_bit*r
+			e := bitChallenge(statement, i, j, item.A, item.B, TA, TB)
+			item.E[bit] = e.Xor(e, item.E[fake])
+			item.ZA[bit] = new(big.Int).Mul(item.E[bit], randomsA[k])
+			item.ZA[bit].Add(item.ZA[bit], kA)
+			item.ZA[bit].Mod(item.ZA[bit], n)
+			item.ZB[bit] = new(big.Int).Mul(item.E[bit], randomsB[k])
+			item.ZB[bit].Add(item.ZB[bit], kB)
+			item.ZB[bit].Mod(item.ZB[bit], bn256.Order)
+			proof.Bits[k] = item
+		}
+	}
+	return proof, nil
+}
+
+//VerifyAttributeKeyProof verifies a proof computed by GenerateAttributeKeyProof, and returns the attribute key it is about.
+//The CP then issues the credential on the commitment for this key, instead of pubG2User.
+//A proof without the proof of knowledge of privUser is refused
+/*
+ * secretPub and gen are the generators of the commitment
+ * commit is the commitment
+ * keyGen are the generators of the attribute key, holder is the public key of the holder
+ * nonce and context are the session of the verifier
+ */
+func VerifyAttributeKeyProof(secretPub *ecdsa.PublicKey, gen []ecdsa.PublicKey, commit []byte, keyGen *AttributeKeyGenerators, holder *HolderPublicKey, proof *AttributeKeyProof, nonce []byte, context []byte) (*HolderPublicKey, bool, error) {
+	if len(gen) != len(keyGen.Attributes) {
+		return nil, false, errAttributeKeyGenerators
+	}
+	if len(proof.Bits) != len(gen)*attributeKeyBits {
+		return nil, false, errAttributeKeyProofSize
+	}
+	c := secretPub.Curve
+	commitX, commitY := elliptic.Unmarshal(c, commit)
+	if commitX == nil {
+		return nil, false, errAttributeKeyProofPoint
+	}
+	if proof.AHolder == nil || proof.SHolder == nil {
+		return nil, false, errAttributeKeyHolder
+	}
+	if proof.AHolder.IsInfinity() {
+		return nil, false, errAttributeKeyProofPoint
+	}
+	statement := attributeKeyStatement(secretPub, gen, commit, keyGen, holder, proof.AHolder, nonce, context)
+
+	//SHolder*G2 == AHolder + e*pubG2User
+	expected := new(bn256.G2).Add(proof.AHolder, g2Mult(holder.G2, holderChallenge(statement)))
+	if !bytes.Equal(g2BaseMult(proof.SHolder).Marshal(), expected.Marshal()) {
+		return nil, false, nil
+	}
+
+	//sum(2^j*A) and sum(2^j*B), each attribute from its highest bit
+	var sumX, sumY *big.Int
+	sumB := new(bn256.G2).ScalarBaseMult(new(big.Int))
+	two := big.NewInt(2)
+	for i := range gen {
+		var attrX, attrY *big.Int
+		attrB := new(bn256.G2).ScalarBaseMult(new(big.Int))
+		for j := attributeKeyBits - 1; j >= 0; j-- {
+			item := &proof.Bits[i*attributeKeyBits+j]
+			ax, ay := elliptic.Unmarshal(c, item.A)
+			if ax == nil || item.B == nil || item.B.IsInfinity() {
+				return nil, false, errAttributeKeyProofPoint
+			}
+
+			var TA [2][]byte
+			var TB [2]*bn256.G2
+			for branch := 0; branch < 2; branch++ {
+				px, py := ax, ay
+				Q := item.B
+				if branch == 1 {
+					px, py = p256Sub(c, ax, ay, gen[i].X, gen[i].Y, big.NewInt(1))
+					Q = g2Sub(item.B, keyGen.Attributes[i], big.NewInt(1))
+				}
+				tx, ty := scalarMult(c, secretPub.X, secretPub.Y, scalarBytes(c, item.ZA[branch]))
+				tx, ty = p256Sub(c, tx, ty, px, py, item.E[branch])
+				TA[branch] = elliptic.Marshal(c, tx, ty)
+				TB[branch] = g2Sub(g2Mult(keyGen.Blinding, item.ZB[branch]), Q, item.E[branch])
+			}
+			e := bitChallenge(statement, i, j, item.A, item.B, TA, TB)
+			if e.Cmp(new(big.Int).Xor(item.E[0], item.E[1])) != 0 {
+				return nil, false, nil
+			}
+
+			if attrX == nil {
+				attrX, attrY = ax, ay
+			} else {
+				attrX, attrY = c.Double(attrX, attrY)
+				attrX, attrY = c.Add(attrX, attrY, ax, ay)
+			}
+			attrB = g2Mult(attrB, two)
+			attrB.Add(attrB, item.B)
+		}
+		if sumX == nil {
+			sumX, sumY = attrX, attrY
+		} else {
+			sumX, sumY = c.Add(sumX, sumY, attrX, attrY)
+		}
+		sumB.Add(sumB, attrB)
+	}
+	if sumX.Cmp(commitX) != 0 || sumY.Cmp(commitY) != 0 {
+		return nil, false, nil
+	}
+	key := new(bn256.G2).Add(keyGen.Base, holder.G2)
+	return &HolderPublicKey{key.Add(key, sumB)}, true, nil
+}
+
+//attributeBitProofLen is the size of a marshalled bit proof whose G2 point has g2 bytes
+func attributeBitProofLen(g2 int) int {
+	return 65 + g2 + 2*bitChallengeLen + 4*scalarLen
+}
+
+//Marshal returns AHolder (128 bytes) || SHolder (32 bytes), then for each bit
+//A (65 bytes) || B (128 bytes) || E0 || E1 (16 bytes each) || ZA0 || ZA1 || ZB0 || ZB1 (32 bytes each)
+func (proof *AttributeKeyProof) Marshal() []byte {
+	return proof.marshal(false)
+}
+
+//MarshalCompressed returns the proof like Marshal, with compressed G2 points: 290 bytes per bit instead of 353
+func (proof *AttributeKeyProof) MarshalCompressed() []byte {
+	return proof.marshal(true)
+}
+
+func (proof *AttributeKeyProof) marshal(compressed bool) []byte {
+	res := make([]byte, 0, g2Len+scalarLen+len(proof.Bits)*attributeBitProofLen(g2Len))
+	res = append(res, marshalG2(proof.AHolder, compressed)...)
+	res = append(res, scalarToBytes(proof.SHolder)...)
+	for _, item := range proof.Bits {
+		res = append(res, item.A...)
+		res = append(res, marshalG2(item.B, compressed)...)
+		for _, e := range item.E {
+			var buf [bitChallengeLen]byte
+			res = append(res, e.FillBytes(buf[:])...)
+		}
+		for _, z := range [...]*big.Int{item.ZA[0], item.ZA[1], item.ZB[0], item.ZB[1]} {
+			res = append(res, scalarToBytes(z)...)
+		}
+	}
+	return res
+}
+
+//Unmarshal sets proof to the attribute key proof m, the output of Marshal or of MarshalCompressed.
+//The points of A are checked by VerifyAttributeKeyProof
+func (proof *AttributeKeyProof) Unmarshal(m []byte) error {
+	g2 := g2Len
+	if len(m) < g2+scalarLen || (len(m)-g2-scalarLen)%(attributeKeyBits*attributeBitProofLen(g2)) != 0 {
+		g2 = g2CompressedLen
+	}
+	itemLen := attributeBitProofLen(g2)
+	if len(m) <= g2+scalarLen || (len(m)-g2-scalarLen)%(attributeKeyBits*itemLen) != 0 {
+		return errAttributeKeyProofSize
+	}
+	AHolder, ok := unmarshalG2(m[:g2])
+	if !ok {
+		return errAttributeKeyProofPoint
+	}
+	SHolder := new(big.Int).SetBytes(m[g2 : g2+scalarLen])
+	m = m[g2+scalarLen:]
+	bits := make([]AttributeBitProof, len(m)/itemLen)
+	for k := range bits {
+		item := m[k*itemLen : (k+1)*itemLen]
+		B, ok := unmarshalG2(item[65 : 65+g2])
+		if !ok {
+			return errAttributeKeyProofPoint
+		}
+		bits[k] = AttributeBitProof{A: append([]byte(nil), item[:65]...), B: B}
+		item = item[65+g2:]
+		for branch := 0; branch < 2; branch++ {
+			bits[k].E[branch] = new(big.Int).SetBytes(item[branch*bitChallengeLen : (branch+1)*bitChallengeLen])
+		}
+		item = item[2*bitChallengeLen:]
+		for branch := 0; branch < 2; branch++ {
+			bits[k].ZA[branch] = new(big.Int).SetBytes(item[branch*scalarLen : (branch+1)*scalarLen])
+			bits[k].ZB[branch] = new(big.Int).SetBytes(item[(2+branch)*scalarLen : (3+branch)*scalarLen])
+		}
+	}
+	proof.AHolder, proof.SHolder, proof.Bits = AHolder, SHolder, bits
+	return nil
+}
+
+//AttributeProof proves that the attributes disclosed from a presentation of an attribute key K are the ones of K, and that the presenter
+//knows the blinding factor b and the hidden part of K. With D = G~0 + sum of H(mi)*G~i for the disclosed i, it is a proof of
+//b*G = b*G and b*K = b*D + (b*privUser)*G2 + (b*r)*S~ + sum of (b*H(mj))*G~j for the hidden j, bound to the nonce of the verifier.
+//Neither the commitment nor K is sent, and the proof replaces the PresentationProof of the presentation
+type AttributeProof struct {
+	//AFactor is wb*G
+	AFactor *bn256.G1
+	//AKey is wb*D + wk*G2 + wr*S~ + sum of wj*G~j
+	AKey *bn256.G2
+	//SFactor is wb + e*b [Order]
+	SFactor *big.Int
+	//SKey is wk + e*b*privUser [Order]
+	SKey *big.Int
+	//SRandom is wr + e*b*r [Order]
+	SRandom *big.Int
+	//SHidden are the wj + e*b*H(mj) [Order] of the hidden attributes, in the order of the commitment
+	SHidden []*big.Int
+	//Issuer proves that the blinded issuer key is derived from the key of the CP, see BlindedPresentation.VerifyIssuer
+	Issuer *IssuerProof
+}
+
+//Disclosure is the part of a presentation of an attribute key which reveals some of the certified attributes
+type Disclosure struct {
+	Mask DisclosureMask
+	//Attributes are the disclosed attributes, in the order of the commitment
+	Attributes [][]byte
+	Proof      *AttributeProof
+}
+
+//disclosedBase returns D = G~0 + sum of H(mi)*G~i for the disclosed i, and the hashed disclosed attributes
+func disclosedBase(gen *AttributeKeyGenerators, mask DisclosureMask, disclosed [][]byte) (*bn256.G2, [][]byte) {
+	hashedDisclosed := messageToHash(disclosed)
+	D := new(bn256.G2).Add(gen.Base, new(bn256.G2).ScalarBaseMult(new(big.Int)))
+	k := 0
+	for i := range gen.Attributes {
+		if mask.Disclosed(i) {
+			D.Add(D, g2Mult(gen.Attributes[i], new(big.Int).SetBytes(hashedDisclosed[k])))
+			k++
+		}
+	}
+	return D, hashedDisclosed
+}
+
+//attributeChallenge computes the Fiat-Shamir challenge of the attribute proof. Each field is prefixed by its length
+func attributeChallenge(p *BlindedPresentation, gen *AttributeKeyGenerators, mask DisclosureMask, hashedDisclosed [][]byte, AFactor *bn256.G1, AKey *bn256.G2, nonce []byte, context []byte) *big.Int {
+	defer observe(PrimitiveHash, time.Now())
+	var maskByte [4]byte
+	binary.BigEndian.PutUint32(maskByte[:], uint32(mask))
+	fields := [][]byte{
+		[]byte("attribute"),
+		p.Marshal(),
+		gen.Base.Marshal(),
+		gen.Blinding.Marshal(),
+	}
+	for _, g := range gen.Attributes {
+		fields = append(fields, g.Marshal())
+	}
+	fields = append(fields, maskByte[:])
+	fields = append(fields, hashedDisclosed...)
+	fields = append(fields, AFactor.Marshal(), AKey.Marshal(), nonce, context)
+
+	h := sha256.New()
+	for _, field := range fields {
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], uint32(len(field)))
+		h.Write(size[:])
+		h.Write(field)
+	}
+	e := new(big.Int).SetBytes(h.Sum(nil))
+	return e.Mod(e, bn256.Order)
+}
+
+//PresentAttributes blinds the credential issued on the attribute key of message and r, see AttributeKeyGenerators.Key,
+//and discloses the attributes selected by mask for the session (nonce, context) of the verifier.
+//The commitment of the attributes is not sent: only the presentation and the disclosure are
+func (k *HolderKey) PresentAttributes(rd io.Reader, c *Credential, issuer *IssuerPublicKey, gen *AttributeKeyGenerators, message [][]byte, r []byte, mask DisclosureMask, nonce []byte, context []byte) (*BlindedPresentation, *Disclosure, error) {
+	if len(message) != c.AttributeCount {
+		return nil, nil, errAttributeKeyGenerators
+	}
+	disclosed, err := mask.Disclose(message)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := gen.Key(&k.HolderPublicKey, message, r)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, b, err := blind(rd, c, issuer, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	D, hashedDisclosed := disclosedBase(gen, mask, disclosed)
+
+	//the secrets are b, b*privUser, b*r and the b*H(mj) of the hidden j, with their bases
+	secrets := []*big.Int{b, new(big.Int).Mul(b, k.D), new(big.Int).Mul(b, new(big.Int).SetBytes(r))}
+	bases := []*bn256.G2{D, g2BaseMult(big.NewInt(1)), gen.Blinding}
+	for i, m := range messageToHash(message) {
+		if !mask.Disclosed(i) {
+			secrets = append(secrets, new(big.Int).Mul(b, new(big.Int).SetBytes(m)))
+			bases = append(bases, gen.Attributes[i])
+		}
+	}
+	nonces := make([]*big.Int, len(secrets))
+	AKey := new(bn256.G2).ScalarBaseMult(new(big.Int))
+	for i := range nonces {
+		if nonces[i], err = randomScalar(rd); err != nil {
+			return nil, nil, err
+		}
+		AKey.Add(AKey, g2Mult(bases[i], nonces[i]))
+	}
+	proof := &AttributeProof{AFactor: g1BaseMult(nonces[0]), AKey: AKey}
+	e := attributeChallenge(p, gen, mask, hashedDisclosed, proof.AFactor, proof.AKey, nonce, context)
+
+	responses := make([]*big.Int, len(secrets))
+	for i := range secrets {
+		responses[i] = new(big.Int).Mul(e, secrets[i])
+		responses[i].Add(responses[i], nonces[i])
+		responses[i].Mod(responses[i], bn256.Order)
+	}
+	proof.SFactor, proof.SKey, proof.SRandom, proof.SHidden = responses[0], responses[1], responses[2], responses[3:]
+
+	if proof.Issuer, err = (&BlindingSecret{Factor: b}).ProveIssuer(rd, p, issuer, nonce, context); err != nil {
+		return nil, nil, err
+	}
+	return p, &Disclosure{Mask: mask, Attributes: disclosed, Proof: proof}, nil
+}
+
+//VerifyDisclosure verifies the blinded certificate and the disclosure of its attributes for the session (nonce, context),
+//ie SFactor*G == AFactor + e*(b*G) and SFactor*D + SKey*G2 + SRandom*S~ + sum of SHidden_j*G~j == AKey + e*(b*K).
+//gen are the generators of the attribute key, one per certified attribute. The issuer proof is checked by VerifyIssuer
+func (p *BlindedPresentation) VerifyDisclosure(d *Disclosure, gen *AttributeKeyGenerators, nonce []byte, context []byte) (bool, error) {
+	if len(gen.Attributes) != p.AttributeCount {
+		return false, errDisclosureGenerators
+	}
+	if err := d.Mask.check(p.AttributeCount); err != nil {
+		return false, err
+	}
+	if len(d.Attributes) != d.Mask.Count() || len(d.Proof.SHidden) != p.AttributeCount-d.Mask.Count() {
+		return false, errDisclosedCount
+	}
+	ok, err := p.Verify()
+	if err != nil || !ok {
+		return false, err
+	}
+	D, hashedDisclosed := disclosedBase(gen, d.Mask, d.Attributes)
+	proof := d.Proof
+	e := attributeChallenge(p, gen, d.Mask, hashedDisclosed, proof.AFactor, proof.AKey, nonce, context)
+
+	leftG1 := g1BaseMult(proof.SFactor)
+	rightG1 := g1Mult(p.Generator, e)
+	rightG1.Add(rightG1, proof.AFactor)
+	if !bytes.Equal(leftG1.Marshal(), rightG1.Marshal()) {
+		return false, nil
+	}
+
+	leftG2 := g2Mult(D, proof.SFactor)
+	leftG2.Add(leftG2, g2BaseMult(proof.SKey))
+	leftG2.Add(leftG2, g2Mult(gen.Blinding, proof.SRandom))
+	k := 0
+	for i := range gen.Attributes {
+		if !d.Mask.Disclosed(i) {
+			leftG2.Add(leftG2, g2Mult(gen.Attributes[i], proof.SHidden[k]))
+			k++
+		}
+	}
+	rightG2 := g2Mult(p.HolderKey, e)
+	rightG2.Add(rightG2, proof.AKey)
+	return bytes.Equal(leftG2.Marshal(), rightG2.Marshal()), nil
+}
+
+//attributeProofLen is the size of a marshalled attribute proof with hidden hidden attributes, with its issuer proof
+func attributeProofLen(g1, g2 int, hidden int) int {
+	return g1 + g2 + (3+hidden)*scalarLen + issuerProofLen(g1, g2)
+}
+
+//Marshal returns AFactor (64 bytes) || AKey (128 bytes) || SFactor || SKey || SRandom || SHidden (32 bytes each) || Issuer (160 bytes)
+func (proof *AttributeProof) Marshal() []byte {
+	return proof.marshal(false)
+}
+
+//MarshalCompressed returns the proof like Marshal, with compressed points
+func (proof *AttributeProof) MarshalCompressed() []byte {
+	return proof.marshal(true)
+}
+
+func (proof *AttributeProof) marshal(compressed bool) []byte {
+	res := make([]byte, 0, attributeProofLen(g1Len, g2Len, len(proof.SHidden)))
+	res = append(res, marshalG1(proof.AFactor, compressed)...)
+	res = append(res, marshalG2(proof.AKey, compressed)...)
+	for _, s := range append([]*big.Int{proof.SFactor, proof.SKey, proof.SRandom}, proof.SHidden...) {
+		res = append(res, scalarToBytes(s)...)
+	}
+	return append(res, proof.Issuer.marshal(compressed)...)
+}
+
+//Unmarshal sets proof to the attribute proof m, the output of Marshal or of MarshalCompressed
+func (proof *AttributeProof) Unmarshal(m []byte) error {
+	for hidden := 0; hidden <= MaxDisclosedAttributes; hidden++ {
+		g1, g2, ok := pointLens(len(m), func(g1, g2 int) int { return attributeProofLen(g1, g2, hidden) })
+		if !ok {
+			continue
+		}
+		AFactor, ok := unmarshalG1(m[:g1])
+		if !ok {
+			return errAttributeProofPoint
+		}
+		AKey, ok := unmarshalG2(m[g1 : g1+g2])
+		if !ok {
+			return errAttributeProofPoint
+		}
+		scalars := make([]*big.Int, 3+hidden)
+		for i := range scalars {
+			start := g1 + g2 + i*scalarLen
+			scalars[i] = new(big.Int).SetBytes(m[start : start+scalarLen])
+		}
+		issuer := new(IssuerProof)
+		if err := issuer.Unmarshal(m[g1+g2+len(scalars)*scalarLen:]); err != nil {
+			return err
+		}
+		*proof = AttributeProof{AFactor: AFactor, AKey: AKey, SFactor: scalars[0], SKey: scalars[1], SRandom: scalars[2], SHidden: scalars[3:], Issuer: issuer}
+		return nil
+	}
+	return errAttributeProofSize
+}
+
+//Marshal returns mask (4 bytes) || for each attribute len (4 bytes) || attribute || proof
+func (d *Disclosure) Marshal() []byte {
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(d.Mask))
+	res := append([]byte(nil), size[:]...)
+	for _, field := range d.Attributes {
+		binary.BigEndian.PutUint32(size[:], uint32(len(field)))
+		res = append(res, size[:]...)
+		res = append(res, field...)
+	}
+	return append(res, d.Proof.Marshal()...)
+}
+
+//Unmarshal sets d to the disclosure m
+func (d *Disclosure) Unmarshal(m []byte) error {
+	if len(m) < 4 {
+		return errDisclosureSize
+	}
+	mask := DisclosureMask(binary.BigEndian.Uint32(m[:4]))
+	m = m[4:]
+	attributes := make([][]byte, mask.Count())
+	for i := range attributes {
+		if len(m) < 4 {
+			return errDisclosureSize
+		}
+		size := binary.BigEndian.Uint32(m[:4])
+		m = m[4:]
+		if uint64(len(m)) < uint64(size) {
+			return errDisclosureSize
+		}
+		attributes[i] = append([]byte(nil), m[:size]...)
+		m = m[size:]
+	}
+	proof := new(AttributeProof)
+	if err := proof.Unmarshal(m); err != nil {
+		return err
+	}
+	d.Mask = mask
+	d.Attributes = attributes
+	d.Proof = proof
+	return nil
+}
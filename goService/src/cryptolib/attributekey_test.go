@@ -0,0 +1,182 @@
+package cryptolib
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"crypto/rand"
+	"math/big"
+	"testing"
+
+	"golang.org/x/crypto/bn256"
+)
+
+func TestAttributeKey(t *testing.T) {
+	curve := elliptic.P256()
+	attributes := [][]byte{[]byte("1990-01-31"), []byte("FR")}
+	h, gen, err := CommitmentGenerators(curve, len(attributes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyGen, err := DeriveAttributeKeyGenerators(len(attributes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	random := make([]byte, 32)
+	rand.Read(random)
+	commitment, err := Commit(attributes, h, gen, random)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := GenerateIssuerKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	holder, err := GenerateHolderKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//the holder proves to the CP that its attribute key holds the committed attributes
+	nonce := []byte("nonce of the CP")
+	context := []byte("issuance")
+	proof, err := GenerateAttributeKeyProof(rand.Reader, attributes, h, gen, random, commitment, keyGen, holder, nonce, context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded AttributeKeyProof
+	if err := decoded.UnmarshalWire(proof.MarshalWireCompressed()); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded.Marshal(), proof.Marshal()) {
+		t.Fatal("Wrong round trip of the attribute key proof")
+	}
+	key, ok, err := VerifyAttributeKeyProof(h, gen, commitment, keyGen, &holder.HolderPublicKey, &decoded, nonce, context)
+	if err != nil || !ok {
+		t.Fatalf("Attribute key proof does not verify: %v", err)
+	}
+	expected, err := keyGen.Key(&holder.HolderPublicKey, attributes, random)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key.Marshal(), expected.Marshal()) {
+		t.Fatal("Attribute key proof is about another key")
+	}
+	if _, ok, _ := VerifyAttributeKeyProof(h, gen, commitment, keyGen, &holder.HolderPublicKey, proof, []byte("another nonce"), context); ok {
+		t.Fatal("Attribute key proof verifies with another nonce")
+	}
+	other, err := GenerateHolderKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := VerifyAttributeKeyProof(h, gen, commitment, keyGen, &other.HolderPublicKey, proof, nonce, context); ok {
+		t.Fatal("Attribute key proof verifies for another holder")
+	}
+	otherCommitment, err := Commit([][]byte{[]byte("1990-01-31"), []byte("DE")}, h, gen, random)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := VerifyAttributeKeyProof(h, gen, otherCommitment, keyGen, &holder.HolderPublicKey, proof, nonce, context); ok {
+		t.Fatal("Attribute key proof verifies for another commitment")
+	}
+
+	//the CP certifies the key, and the holder discloses the nationality without the commitment
+	cred, err := issuer.Issue(commitment, len(attributes), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce = []byte("nonce of the SP")
+	context = []byte("nationality verification")
+	mask := DisclosureMask(1 << 1)
+	p, d, err := holder.PresentAttributes(rand.Reader, cred, &issuer.IssuerPublicKey, keyGen, attributes, random, mask, nonce, context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Attributes) != 1 || !bytes.Equal(d.Attributes[0], []byte("FR")) {
+		t.Fatalf("Wrong disclosed attributes %q", d.Attributes)
+	}
+	var received Disclosure
+	if err := received.Unmarshal(d.Marshal()); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := p.VerifyDisclosure(&received, keyGen, nonce, context); err != nil || !ok {
+		t.Fatalf("Disclosure does not verify: %v", err)
+	}
+	if !p.VerifyIssuer(received.Proof.Issuer, &issuer.IssuerPublicKey, nonce, context) {
+		t.Fatal("Issuer proof of the disclosure does not verify")
+	}
+	if ok, _ := p.VerifyDisclosure(&received, keyGen, []byte("another nonce"), context); ok {
+		t.Fatal("Disclosure verifies with another nonce")
+	}
+
+	//a disclosed attribute cannot be changed, nor the mask
+	received.Attributes[0] = []byte("DE")
+	if ok, _ := p.VerifyDisclosure(&received, keyGen, nonce, context); ok {
+		t.Fatal("Disclosure verifies with a modified attribute")
+	}
+	received.Attributes[0] = []byte("FR")
+	received.Mask = 1
+	if ok, _ := p.VerifyDisclosure(&received, keyGen, nonce, context); ok {
+		t.Fatal("Disclosure verifies with another mask")
+	}
+
+	//a credential issued on the public key of the holder cannot disclose attributes
+	plain, err := issuer.Issue(commitment, len(attributes), &holder.HolderPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := holder.PresentAttributes(rand.Reader, plain, &issuer.IssuerPublicKey, keyGen, attributes, random, mask, nonce, context); err != ErrInvalidCertificate {
+		t.Fatalf("Attributes presented from a credential of the public key: %v", err)
+	}
+}
+
+//a holder which does not know the private key of pubG2User cannot shift the attributes of its key
+func TestAttributeKeyShiftedHolder(t *testing.T) {
+	curve := elliptic.P256()
+	attributes := [][]byte{IntegerAttribute(15)}
+	h, gen, err := CommitmentGenerators(curve, len(attributes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyGen, err := DeriveAttributeKeyGenerators(len(attributes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	random := make([]byte, 32)
+	rand.Read(random)
+	commitment, err := Commit(attributes, h, gen, random)
+	if err != nil {
+		t.Fatal(err)
+	}
+	holder, err := GenerateHolderKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//pubG2User = privUser*G2 + 10*G~1: the key of int:15 would be the one of int:25 for privUser
+	shifted := &HolderKey{HolderPublicKey: HolderPublicKey{new(bn256.G2).Add(holder.G2, g2Mult(keyGen.Attributes[0], big.NewInt(10)))}, D: holder.D}
+	forged, err := keyGen.Key(&shifted.HolderPublicKey, attributes, random)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := keyGen.Key(&holder.HolderPublicKey, [][]byte{IntegerAttribute(25)}, random)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(forged.Marshal(), target.Marshal()) {
+		t.Fatal("Shifted key does not hold the shifted attribute")
+	}
+
+	nonce := []byte("nonce of the CP")
+	context := []byte("issuance")
+	proof, err := GenerateAttributeKeyProof(rand.Reader, attributes, h, gen, random, commitment, keyGen, shifted, nonce, context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := VerifyAttributeKeyProof(h, gen, commitment, keyGen, &shifted.HolderPublicKey, proof, nonce, context); ok || err != nil {
+		t.Fatalf("Attribute key proof verifies for a shifted holder key: %v", err)
+	}
+	proof.AHolder, proof.SHolder = nil, nil
+	if _, ok, err := VerifyAttributeKeyProof(h, gen, commitment, keyGen, &shifted.HolderPublicKey, proof, nonce, context); ok || err != errAttributeKeyHolder {
+		t.Fatalf("Attribute key proof without proof of the holder key: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package cryptolib
+
+import (
+	"encoding/binary"
+	"io"
+	"math/big"
+	"time"
+
+	"golang.org/x/crypto/bn256"
+)
+
+//batchExponentSize is the size in bytes of the random exponents of BatchVerify.
+//A batch containing an invalid presentation verifies with a probability of at most 2^-64
+const batchExponentSize = 8
+
+//randomExponent returns a random in [1, 2^64)
+func randomExponent(r io.Reader) (*big.Int, error) {
+	var buf [batchExponentSize]byte
+	for {
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return nil, err
+		}
+		if e := binary.BigEndian.Uint64(buf[:]); e != 0 {
+			return new(big.Int).SetUint64(e), nil
+		}
+	}
+}
+
+//BatchVerify verifies the blinded presentations at once, and returns the indices of the invalid ones in increasing order.
+//The equality of Verify is raised to a small random exponent r_i for each presentation, and the product
+//  e(r_1*L_1, C_1) * e(-r_1*G_1, H_1) * ... * e(r_N*L_N, C_N) * e(-r_N*G_N, H_N) == 1
+//is checked with 2N Miller loops and a single final exponentiation, instead of 2N pairings.
+//When the product is not 1, the batch is split in halves which are checked again with the Miller loops already computed,
+//until the invalid presentations are found. The only error is the one of r.
+func BatchVerify(r io.Reader, presentations []*BlindedPresentation) ([]int, error) {
+	invalid := []int{}
+	var indices []int
+	var millers []*bn256.GT
+	for i, p := range presentations {
+		if p == nil || p.AttributeCount < 1 || p.check() != nil {
+			invalid = append(invalid, i)
+			continue
+		}
+		e, err := randomExponent(r)
+		if err != nil {
+			return nil, err
+		}
+		left := g1Mult(p.leftG1(), e)
+		right := g1Mult(p.Generator, e)
+		start := time.Now()
+		m := bn256.Miller(left, p.Certificate)
+		m.Add(m, bn256.Miller(right.Neg(right), p.HolderKey))
+		observe(PrimitiveMillerLoop, start)
+		indices = append(indices, i)
+		millers = append(millers, m)
+	}
+	if len(indices) == 0 {
+		return invalid, nil
+	}
+	return mergeIndices(invalid, findInvalid(indices, millers)), nil
+}
+
+//findInvalid returns the indices whose Miller loops are not 1 once finalized, by bisection.
+//A single Miller loop is finalized in place, which is fine since it is not used afterwards
+func findInvalid(indices []int, millers []*bn256.GT) []int {
+	product := millers[0]
+	if len(millers) > 1 {
+		product = new(bn256.GT).Add(millers[0], millers[1])
+		for _, m := range millers[2:] {
+			product.Add(product, m)
+		}
+	}
+	start := time.Now()
+	one := product.Finalize().IsOne()
+	observe(PrimitiveFinalExponentiation, start)
+	if one {
+		return nil
+	}
+	if len(millers) == 1 {
+		return indices
+	}
+	half := len(millers) / 2
+	return append(findInvalid(indices[:half], millers[:half]), findInvalid(indices[half:], millers[half:])...)
+}
+
+//mergeIndices merges two sorted slices of indices
+func mergeIndices(a, b []int) []int {
+	res := make([]int, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		if a[0] < b[0] {
+			res, a = append(res, a[0]), a[1:]
+		} else {
+			res, b = append(res, b[0]), b[1:]
+		}
+	}
+	return append(append(res, a...), b...)
+}
@@ -0,0 +1,88 @@
+package cryptolib
+
+import (
+	"crypto/rand"
+	"reflect"
+	"testing"
+
+	"golang.org/x/crypto/bn256"
+)
+
+//blindedPresentations returns n valid blinded presentations of different holders
+func blindedPresentations(t testing.TB, n int) []*BlindedPresentation {
+	issuer, err := GenerateIssuerKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res []*BlindedPresentation
+	for i := 0; i < n; i++ {
+		holder, err := GenerateHolderKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cred, err := issuer.Issue([]byte{byte(i)}, 1+i%3, &holder.HolderPublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, _, err := holder.Blind(rand.Reader, cred, &issuer.IssuerPublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, p)
+	}
+	return res
+}
+
+func TestBatchVerify(t *testing.T) {
+	presentations := blindedPresentations(t, 7)
+	if invalid, err := BatchVerify(rand.Reader, presentations); err != nil || len(invalid) != 0 {
+		t.Fatalf("Valid batch rejected: %v %v", invalid, err)
+	}
+	if invalid, err := BatchVerify(rand.Reader, nil); err != nil || len(invalid) != 0 {
+		t.Fatalf("Empty batch rejected: %v %v", invalid, err)
+	}
+
+	//another attribute count, the certificate of another presentation, a missing point and a missing presentation
+	presentations[1].AttributeCount++
+	presentations[4].Certificate = presentations[3].Certificate
+	presentations[5] = &BlindedPresentation{Commitment: presentations[2].Commitment, AttributeCount: 1}
+	presentations = append(presentations, nil)
+	for i, p := range presentations[:5] {
+		if ok, _ := p.Verify(); ok != (i != 1 && i != 4) {
+			t.Fatalf("Wrong verification of presentation %d", i)
+		}
+	}
+	invalid, err := BatchVerify(rand.Reader, presentations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(invalid, []int{1, 4, 5, 7}) {
+		t.Fatalf("Wrong invalid presentations: %v", invalid)
+	}
+
+	//the invalid presentations of a batch cannot cancel each other out
+	a := blindedPresentations(t, 2)
+	a[0].IssuerKey = new(bn256.G1).Add(a[0].IssuerKey, a[1].Generator)
+	a[1].IssuerKey = new(bn256.G1).Add(a[1].IssuerKey, new(bn256.G1).Neg(a[1].Generator))
+	if invalid, _ := BatchVerify(rand.Reader, a); !reflect.DeepEqual(invalid, []int{0, 1}) {
+		t.Fatalf("Wrong invalid presentations: %v", invalid)
+	}
+}
+
+func BenchmarkVerify(b *testing.B) {
+	presentations := blindedPresentations(b, 16)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, p := range presentations {
+			p.Verify()
+		}
+	}
+}
+
+func BenchmarkBatchVerify(b *testing.B) {
+	presentations := blindedPresentations(b, 16)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		BatchVerify(rand.Reader, presentations)
+	}
+}
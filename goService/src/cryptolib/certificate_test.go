@@ -0,0 +1,78 @@
+package cryptolib
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+)
+
+//issueCertificate commits to the attributes with one generator per attribute and returns the commitment,
+//the certificate and the pairing keys of the CP and of the user
+func issueCertificate(t *testing.T, attributes [][]byte) (commitment, certificate, privCP, pubG1CP, privUser, pubG2User []byte) {
+	curve := elliptic.P256()
+	user, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := make([]ecdsa.PublicKey, len(attributes))
+	for i := range gen {
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gen[i] = key.PublicKey
+	}
+	random := make([]byte, 16)
+	rand.Read(random)
+	commitment, err = Commit(attributes, &user.PublicKey, gen, random)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privCP, pubG1CP, _, err = GeneratePairingKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	privUser, _, pubG2User, err = GeneratePairingKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err = GenerateCertificate(commitment, len(attributes), privCP, pubG2User)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestMultipleAttributeCertificate(t *testing.T) {
+	attributes := [][]byte{[]byte("1990-01-31"), []byte("FR"), []byte("B"), []byte("2030-12-31")}
+	commitment, certificate, _, pubG1CP, privUser, pubG2User := issueCertificate(t, attributes)
+
+	ok, err := VerifyCertificate(commitment, len(attributes), certificate, pubG1CP, pubG2User)
+	if err != nil || !ok {
+		t.Fatalf("Certificate does not verify: %v", err)
+	}
+	ok, err = VerifyCertificate(commitment, len(attributes)-1, certificate, pubG1CP, pubG2User)
+	if err != nil || ok {
+		t.Fatalf("Certificate verifies with a wrong attribute count: %v", err)
+	}
+
+	if _, _, _, _, _, err := BlindCertificate(commitment, len(attributes)+1, certificate, pubG1CP, pubG2User, privUser); err == nil {
+		t.Fatal("Certificate blinded with a wrong attribute count")
+	}
+	blindCommitment, blindCertificate, blindPubG1CP, blindPubG2User, blindGenerator, err :=
+		BlindCertificate(commitment, len(attributes), certificate, pubG1CP, pubG2User, privUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err = VerifyBlindCertificate(blindCommitment, len(attributes), blindCertificate, blindPubG1CP, blindPubG2User, blindGenerator)
+	if err != nil || !ok {
+		t.Fatalf("Blinded certificate does not verify: %v", err)
+	}
+	ok, err = VerifyBlindCertificate(blindCommitment, 1, blindCertificate, blindPubG1CP, blindPubG2User, blindGenerator)
+	if err != nil || ok {
+		t.Fatalf("Blinded certificate verifies with a wrong attribute count: %v", err)
+	}
+}
@@ -6,18 +6,51 @@ import (
 	"crypto/elliptic"
 	"crypto/sha256"
 	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var (
 	errMessageOrGeneratorSize = errors.New("Message and generator list must have the same size")
 )
 
-//hash a list a messages and return the list of hashed messages
+//IntegerAttributePrefix starts the attributes which commit an integer instead of its hash, see IntegerAttribute
+const IntegerAttributePrefix = "int:"
+
+//IntegerAttribute returns the attribute which commits value itself instead of its hash, so that GenerateRangeProof
+//can prove that it is above a threshold. It is IntegerAttributePrefix followed by the decimal value, "int:21" for 21
+func IntegerAttribute(value uint64) []byte {
+	return []byte(IntegerAttributePrefix + strconv.FormatUint(value, 10))
+}
+
+//integerAttribute returns the value of an attribute written by IntegerAttribute. Only the canonical decimal is an integer,
+//so that two attributes never commit the same value: "int:021" is hashed like any other attribute
+func integerAttribute(m []byte) (uint64, bool) {
+	s := string(m)
+	if !strings.HasPrefix(s, IntegerAttributePrefix) {
+		return 0, false
+	}
+	digits := s[len(IntegerAttributePrefix):]
+	value, err := strconv.ParseUint(digits, 10, 64)
+	if err != nil || strconv.FormatUint(value, 10) != digits {
+		return 0, false
+	}
+	return value, true
+}
+
+//hash a list a messages and return the list of hashed messages. An integer attribute is not hashed: its value is committed
 func messageToHash(message [][]byte) [][]byte {
+	defer observe(PrimitiveHash, time.Now())
 	numMess := len(message)
 	hashedMessage := make([][]byte, numMess)
 	for i := 0; i < numMess; i++ {
 		hashedMessage[i] = make([]byte, 32)
+		if value, ok := integerAttribute(message[i]); ok {
+			new(big.Int).SetUint64(value).FillBytes(hashedMessage[i])
+			continue
+		}
 		h256 := sha256.New()
 		h256.Write(message[i])
 		hashedMessage[i] = h256.Sum(nil)
@@ -25,7 +58,11 @@ func messageToHash(message [][]byte) [][]byte {
 	return hashedMessage
 }
 
-// Commit returns the commitment pedersen of a list of message
+// Commit returns the commitment pedersen of a list of message: r*secretPub + H(m1)*G1 + ... + H(mn)*Gn
+// where H(m) is the value of an integer attribute, see IntegerAttribute, and the SHA-256 hash of the other attributes.
+// The commitment is only binding if nobody knows the discrete logs between secretPub and the Gi,
+// use CommitmentGenerators to get such generators.
+// GenerateOpeningProof proves the knowledge of every attribute, GenerateDisclosureProof reveals a subset of them.
 func Commit(message [][]byte, secretPub *ecdsa.PublicKey, gen []ecdsa.PublicKey, r []byte) ([]byte, error) {
 	//check size of list, must be equal
 	if len(message) != len(gen) {
@@ -36,11 +73,11 @@ func Commit(message [][]byte, secretPub *ecdsa.PublicKey, gen []ecdsa.PublicKey,
 	hashedMessage := messageToHash(message)
 
 	//compute the rH part
-	resX, resY := secretPub.Curve.ScalarMult(secretPub.X, secretPub.Y, r)
+	resX, resY := scalarMult(secretPub.Curve, secretPub.X, secretPub.Y, r)
 
 	//compute the m1G1 + ... + mnGn
 	for i := 0; i < len(gen); i++ {
-		x, y := secretPub.Curve.ScalarMult(gen[i].X, gen[i].Y, hashedMessage[i])
+		x, y := scalarMult(secretPub.Curve, gen[i].X, gen[i].Y, hashedMessage[i])
 		resX, resY = secretPub.Curve.Add(resX, resY, x, y)
 	}
 
@@ -4,6 +4,8 @@ import (
 	"bufio"
 	"bytes"
 	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"encoding/hex"
 	"io"
 	"math/big"
@@ -229,3 +231,87 @@ func TestMultipleCommitment(t *testing.T) {
 		}
 	}
 }
+
+func TestOpeningProof(t *testing.T) {
+	curve := elliptic.P256()
+	user, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := [][]byte{[]byte("1990-01-31"), []byte("FR")}
+	gen := make([]ecdsa.PublicKey, len(message))
+	for i := range gen {
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gen[i] = key.PublicKey
+	}
+	random := make([]byte, 16)
+	rand.Read(random)
+	commitment, err := Commit(message, &user.PublicKey, gen, random)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nonce := []byte("nonce of the CP")
+	context := []byte("issuance")
+	proof, err := GenerateOpeningProof(message, &user.PublicKey, gen, random, commitment, nonce, context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err := VerifyOpeningProof(&user.PublicKey, gen, commitment, proof, nonce, context)
+	if err != nil || !ok {
+		t.Fatalf("Proof of opening does not verify: %v", err)
+	}
+
+	//a proof is bound to the session of the verifier
+	if ok, _ := VerifyOpeningProof(&user.PublicKey, gen, commitment, proof, []byte("another nonce"), context); ok {
+		t.Fatal("Proof of opening verifies with another nonce")
+	}
+	if ok, _ := VerifyOpeningProof(&user.PublicKey, gen, commitment, proof, nonce, []byte("another context")); ok {
+		t.Fatal("Proof of opening verifies with another context")
+	}
+
+	//a proof computed for other values does not verify
+	proof, err = GenerateOpeningProof([][]byte{[]byte("1990-01-31"), []byte("DE")}, &user.PublicKey, gen, random, commitment, nonce, context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err = VerifyOpeningProof(&user.PublicKey, gen, commitment, proof, nonce, context)
+	if err != nil || ok {
+		t.Fatalf("Proof of opening verifies for another message: %v", err)
+	}
+}
+
+func TestIntegerAttribute(t *testing.T) {
+	curve := elliptic.P256()
+	h, gen, err := CommitmentGenerators(curve, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	random := make([]byte, 32)
+	rand.Read(random)
+
+	//an integer attribute commits its value: 21*G1 + r*H
+	commitment, err := Commit([][]byte{IntegerAttribute(21)}, h, gen, random)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, y := curve.ScalarMult(gen[0].X, gen[0].Y, big.NewInt(21).Bytes())
+	rx, ry := curve.ScalarMult(h.X, h.Y, random)
+	x, y = curve.Add(x, y, rx, ry)
+	if !bytes.Equal(commitment, elliptic.Marshal(curve, x, y)) {
+		t.Fatal("Integer attribute does not commit its value")
+	}
+
+	//only the canonical decimal is an integer
+	for _, attribute := range []string{"int:021", "int:", "int:-1", "int:18446744073709551616", "21"} {
+		if _, ok := integerAttribute([]byte(attribute)); ok {
+			t.Fatalf("%q is an integer attribute", attribute)
+		}
+	}
+	if value, ok := integerAttribute(IntegerAttribute(0)); !ok || value != 0 {
+		t.Fatal("int:0 is not the integer attribute 0")
+	}
+}
@@ -0,0 +1,508 @@
+package cryptolib
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+	"time"
+
+	"golang.org/x/crypto/bn256"
+)
+
+//Size in bytes of the marshaled bn256 values
+const (
+	scalarLen = 32
+	g1Len     = 64
+	g2Len     = 128
+)
+
+var (
+	errKeySize          = scalarError("Private key must be between 1 and 32 bytes")
+	errKeyRange         = scalarError("Private key must be in [1, Order)")
+	errIssuerKeySize    = sizeError("Issuer public key must be a 64 bytes G1 point, or 33 bytes if compressed")
+	errHolderKeySize    = sizeError("Holder public key must be a 128 bytes G2 point, or 65 bytes if compressed")
+	errIssuerKeyPoint   = pointError("Cannot Unmarshal issuer public key")
+	errHolderKeyPoint   = pointError("Cannot Unmarshal holder public key")
+	errCredentialSize   = sizeError("Credential is too short")
+	errCertificatePoint = pointError("Cannot Unmarshal certificate")
+	errPresentationSize = sizeError("Blinded presentation has a wrong size")
+	errPresentationG1   = pointError("Cannot Unmarshal G1 point of the blinded presentation")
+	errPresentationG2   = pointError("Cannot Unmarshal G2 point of the blinded presentation")
+	errPresentationZero = pointError("Point of the blinded presentation is missing or at infinity")
+	errPresentationHash = scalarError("Blinded commitment must be in [1, Order)")
+	errBlindingSize     = sizeError("Blinding secret has a wrong size")
+	errNotInvertible    = errors.New("H(C)+H(n)+priv is not invertible")
+)
+
+//ErrInvalidCertificate is returned when a certificate given to blind or present a credential, or returned by a remote
+//signer, does not verify
+var ErrInvalidCertificate = errors.New("Certificate does not verify")
+
+//IssuerPublicKey is the public key of a certificate provider (CP). It lives in G1 (pubG1CP)
+type IssuerPublicKey struct {
+	G1 *bn256.G1
+}
+
+//IssuerKey is the pairing key of a certificate provider, used to issue credentials
+type IssuerKey struct {
+	IssuerPublicKey
+	D *big.Int
+}
+
+//HolderPublicKey is the public key of the holder of a credential. It lives in G2 (pubG2User)
+type HolderPublicKey struct {
+	G2 *bn256.G2
+}
+
+//HolderKey is the pairing key of the holder of a credential, used to blind the credential
+type HolderKey struct {
+	HolderPublicKey
+	D *big.Int
+}
+
+//Credential is a certificate issued by a CP on the commitment of attributeCount attributes of a holder
+type Credential struct {
+	Commitment     []byte
+	AttributeCount int
+	Certificate    *bn256.G2
+}
+
+//BlindedPresentation is a credential blinded by a random b, that the holder shows to a service provider (SP)
+type BlindedPresentation struct {
+	//Commitment is b*H(C) [Order]
+	Commitment     *big.Int
+	AttributeCount int
+	//Certificate is b*certificate
+	Certificate *bn256.G2
+	//IssuerKey is b*pubG1CP
+	IssuerKey *bn256.G1
+	//HolderKey is b*pubG2User
+	HolderKey *bn256.G2
+	//Generator is b*G1
+	Generator *bn256.G1
+}
+
+//BlindingSecret contains the values known by the holder only once the credential is blinded
+type BlindingSecret struct {
+	//Factor is the random b
+	Factor *big.Int
+	//HolderKey is b*privUser [Order]
+	HolderKey *big.Int
+}
+
+//randomScalar returns a random in [1, Order)
+func randomScalar(r io.Reader) (*big.Int, error) {
+	for {
+		k, err := rand.Int(r, bn256.Order)
+		if err != nil {
+			return nil, err
+		}
+		if k.Sign() != 0 {
+			return k, nil
+		}
+	}
+}
+
+//pairEqual returns true if e(a, b) == e(c, d), ie e(a, b) * e(-c, d) == 1 with a single final exponentiation
+func pairEqual(a *bn256.G1, b *bn256.G2, c *bn256.G1, d *bn256.G2) bool {
+	defer observe(PrimitivePairing, time.Now())
+	return bn256.PairingCheck([]*bn256.G1{a, new(bn256.G1).Neg(c)}, []*bn256.G2{b, d})
+}
+
+//scalarToBytes writes k on exactly 32 bytes
+func scalarToBytes(k *big.Int) []byte {
+	res := make([]byte, scalarLen)
+	k.FillBytes(res)
+	return res
+}
+
+//privateKeyFromBytes reads a private key written by GeneratePairingKey or by the Marshal functions
+func privateKeyFromBytes(m []byte) (*big.Int, error) {
+	if len(m) == 0 || len(m) > scalarLen {
+		return nil, errKeySize
+	}
+	d := new(big.Int).SetBytes(m)
+	if d.Sign() == 0 || d.Cmp(bn256.Order) >= 0 {
+		return nil, errKeyRange
+	}
+	return d, nil
+}
+
+//commitmentHash returns H(C) as an integer
+func commitmentHash(commitment []byte) *big.Int {
+	defer observe(PrimitiveHash, time.Now())
+	h := sha256.New()
+	h.Write(commitment)
+	return new(big.Int).SetBytes(h.Sum(nil))
+}
+
+//GenerateIssuerKey generates the pairing key of a certificate provider
+func GenerateIssuerKey(r io.Reader) (*IssuerKey, error) {
+	d, err := randomScalar(r)
+	if err != nil {
+		return nil, err
+	}
+	return &IssuerKey{IssuerPublicKey{g1BaseMult(d)}, d}, nil
+}
+
+//GenerateHolderKey generates the pairing key of the holder of a credential
+func GenerateHolderKey(r io.Reader) (*HolderKey, error) {
+	d, err := randomScalar(r)
+	if err != nil {
+		return nil, err
+	}
+	return &HolderKey{HolderPublicKey{g2BaseMult(d)}, d}, nil
+}
+
+//Marshal returns the private key on 32 bytes
+func (k *IssuerKey) Marshal() []byte {
+	return scalarToBytes(k.D)
+}
+
+//Unmarshal sets k to the private key m and recomputes its public key
+func (k *IssuerKey) Unmarshal(m []byte) error {
+	d, err := privateKeyFromBytes(m)
+	if err != nil {
+		return err
+	}
+	k.D = d
+	k.G1 = g1BaseMult(d)
+	return nil
+}
+
+//Marshal returns the public key as a 64 bytes G1 point
+func (k *IssuerPublicKey) Marshal() []byte {
+	return k.G1.Marshal()
+}
+
+//MarshalCompressed returns the public key as a 33 bytes compressed G1 point
+func (k *IssuerPublicKey) MarshalCompressed() []byte {
+	return k.G1.MarshalCompressed()
+}
+
+//Unmarshal sets k to the G1 point m, compressed or not
+func (k *IssuerPublicKey) Unmarshal(m []byte) error {
+	if len(m) != g1Len && len(m) != g1CompressedLen {
+		return errIssuerKeySize
+	}
+	p, ok := unmarshalG1(m)
+	if !ok {
+		return errIssuerKeyPoint
+	}
+	k.G1 = p
+	return nil
+}
+
+//Marshal returns the private key on 32 bytes
+func (k *HolderKey) Marshal() []byte {
+	return scalarToBytes(k.D)
+}
+
+//Unmarshal sets k to the private key m and recomputes its public key
+func (k *HolderKey) Unmarshal(m []byte) error {
+	d, err := privateKeyFromBytes(m)
+	if err != nil {
+		return err
+	}
+	k.D = d
+	k.G2 = g2BaseMult(d)
+	return nil
+}
+
+//Marshal returns the public key as a 128 bytes G2 point
+func (k *HolderPublicKey) Marshal() []byte {
+	return k.G2.Marshal()
+}
+
+//MarshalCompressed returns the public key as a 65 bytes compressed G2 point
+func (k *HolderPublicKey) MarshalCompressed() []byte {
+	return k.G2.MarshalCompressed()
+}
+
+//Unmarshal sets k to the G2 point m, compressed or not
+func (k *HolderPublicKey) Unmarshal(m []byte) error {
+	if len(m) != g2Len && len(m) != g2CompressedLen {
+		return errHolderKeySize
+	}
+	p, ok := unmarshalG2(m)
+	if !ok {
+		return errHolderKeyPoint
+	}
+	k.G2 = p
+	return nil
+}
+
+//Issue generates the credential of the holder for the commitment of attributeCount attributes
+//ie certificate = (H(C)+H(n)+priv)^{-1}*pubG2User
+func (k *IssuerKey) Issue(commitment []byte, attributeCount int, holder *HolderPublicKey) (*Credential, error) {
+	if attributeCount < 1 {
+		return nil, errAttributeCount
+	}
+	certInt := commitmentHash(commitment)
+	certInt.Add(certInt, k.D)
+	certInt.Add(certInt, attributeCountHash(attributeCount))
+	if certInt.ModInverse(certInt, bn256.Order) == nil {
+		return nil, errNotInvertible
+	}
+	cert := g2Mult(holder.G2, certInt)
+	return &Credential{Commitment: commitment, AttributeCount: attributeCount, Certificate: cert}, nil
+}
+
+//NewCredential builds the credential from the certificate returned by the CP, compressed or not
+func NewCredential(commitment []byte, attributeCount int, certificate []byte) (*Credential, error) {
+	if attributeCount < 1 {
+		return nil, errAttributeCount
+	}
+	cert, ok := unmarshalG2(certificate)
+	if !ok {
+		return nil, errCertificatePoint
+	}
+	return &Credential{Commitment: commitment, AttributeCount: attributeCount, Certificate: cert}, nil
+}
+
+//Verify verifies that the credential has been issued by issuer for holder
+//ie e(H(C)*G + H(n)*G + pubG1CP, certificate) == e(G, pubG2User)
+func (c *Credential) Verify(issuer *IssuerPublicKey, holder *HolderPublicKey) (bool, error) {
+	if c.AttributeCount < 1 {
+		return false, errAttributeCount
+	}
+	//We compute the G1 term on the left equality ie (H(C)+H(n))*G + pubG1CP
+	hashInt := commitmentHash(c.Commitment)
+	hashInt.Add(hashInt, attributeCountHash(c.AttributeCount))
+	leftG1 := g1BaseMult(hashInt)
+	leftG1.Add(leftG1, issuer.G1)
+
+	return pairEqual(leftG1, c.Certificate, g1BaseMult(big.NewInt(1)), holder.G2), nil
+}
+
+//credentialCompressed is set in the attribute count of a marshalled credential whose certificate is compressed.
+//The commitment has no fixed size, so the size of the credential does not tell it
+const credentialCompressed = 1 << 31
+
+//Marshal returns attributeCount (4 bytes) || certificate (128 bytes) || commitment
+func (c *Credential) Marshal() []byte {
+	return c.marshal(false)
+}
+
+//MarshalCompressed returns the credential like Marshal, with a 65 bytes compressed certificate and the top bit of attributeCount set
+func (c *Credential) MarshalCompressed() []byte {
+	return c.marshal(true)
+}
+
+func (c *Credential) marshal(compressed bool) []byte {
+	res := make([]byte, 4, 4+g2Len+len(c.Commitment))
+	count := uint32(c.AttributeCount)
+	if compressed {
+		count |= credentialCompressed
+	}
+	binary.BigEndian.PutUint32(res, count)
+	res = append(res, marshalG2(c.Certificate, compressed)...)
+	return append(res, c.Commitment...)
+}
+
+//Unmarshal sets c to the credential m, the output of Marshal or of MarshalCompressed
+func (c *Credential) Unmarshal(m []byte) error {
+	if len(m) < 4 {
+		return errCredentialSize
+	}
+	count := binary.BigEndian.Uint32(m[:4])
+	certLen := g2Len
+	if count&credentialCompressed != 0 {
+		certLen = g2CompressedLen
+	}
+	count &^= credentialCompressed
+	if len(m) <= 4+certLen {
+		return errCredentialSize
+	}
+	if count < 1 {
+		return errAttributeCount
+	}
+	cert, ok := unmarshalG2(m[4 : 4+certLen])
+	if !ok {
+		return errCertificatePoint
+	}
+	c.AttributeCount = int(count)
+	c.Certificate = cert
+	c.Commitment = append([]byte(nil), m[4+certLen:]...)
+	return nil
+}
+
+//Blind blinds the credential of the holder with a random b, so that the SP cannot link two presentations of the same credential.
+//The credential is checked before being blinded.
+func (k *HolderKey) Blind(r io.Reader, c *Credential, issuer *IssuerPublicKey) (*BlindedPresentation, *BlindingSecret, error) {
+	p, b, err := blind(r, c, issuer, &k.HolderPublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	blindPriv := new(big.Int).Mul(k.D, b)
+	blindPriv.Mod(blindPriv, bn256.Order)
+	return p, &BlindingSecret{Factor: b, HolderKey: blindPriv}, nil
+}
+
+//blind checks that the credential has been issued by issuer for the key holder and blinds it with a random b, which is returned
+func blind(r io.Reader, c *Credential, issuer *IssuerPublicKey, holder *HolderPublicKey) (*BlindedPresentation, *big.Int, error) {
+	ok, err := c.Verify(issuer, holder)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		return nil, nil, ErrInvalidCertificate
+	}
+	b, err := randomScalar(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	commitment := commitmentHash(c.Commitment)
+	commitment.Mul(commitment, b)
+	commitment.Mod(commitment, bn256.Order)
+
+	p := &BlindedPresentation{
+		Commitment:     commitment,
+		AttributeCount: c.AttributeCount,
+		Certificate:    g2Mult(c.Certificate, b),
+		IssuerKey:      g1Mult(issuer.G1, b),
+		HolderKey:      g2Mult(holder.G2, b),
+		Generator:      g1BaseMult(b),
+	}
+	return p, b, nil
+}
+
+//NewBlindedPresentation builds the blinded presentation from the values returned by BlindCertificate.
+//Each point may be compressed or not
+func NewBlindedPresentation(blindCommitment []byte, attributeCount int, blindCertificate []byte, blindPubG1Byte []byte, blindPubG2Byte []byte, blindGenerator []byte) (*BlindedPresentation, error) {
+	var ok bool
+	p := BlindedPresentation{Commitment: new(big.Int).SetBytes(blindCommitment), AttributeCount: attributeCount}
+	if p.Certificate, ok = unmarshalG2(blindCertificate); !ok {
+		return nil, errPresentationG2
+	}
+	if p.IssuerKey, ok = unmarshalG1(blindPubG1Byte); !ok {
+		return nil, errPresentationG1
+	}
+	if p.HolderKey, ok = unmarshalG2(blindPubG2Byte); !ok {
+		return nil, errPresentationG2
+	}
+	if p.Generator, ok = unmarshalG1(blindGenerator); !ok {
+		return nil, errPresentationG1
+	}
+	if err := p.check(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+//check verifies that the values of the presentation can be blinded with b != 0: b*H(C) in [1, Order) and no point at infinity.
+//With b = 0 every point is at infinity, and both the equality of Verify and the issuer proof would hold for any CP and any nonce
+func (p *BlindedPresentation) check() error {
+	if p.Commitment == nil || p.Commitment.Sign() == 0 || p.Commitment.Cmp(bn256.Order) >= 0 {
+		return errPresentationHash
+	}
+	if p.Certificate == nil || p.IssuerKey == nil || p.HolderKey == nil || p.Generator == nil ||
+		p.Certificate.IsInfinity() || p.IssuerKey.IsInfinity() || p.HolderKey.IsInfinity() || p.Generator.IsInfinity() {
+		return errPresentationZero
+	}
+	return nil
+}
+
+//Verify verifies the blinded presentation
+//ie e(b*H(C)*G + H(n)*b*G + b*pubG1CP, b*certificate) == e(b*G, b*pubG2User)
+func (p *BlindedPresentation) Verify() (bool, error) {
+	if p.AttributeCount < 1 {
+		return false, errAttributeCount
+	}
+	if err := p.check(); err != nil {
+		return false, err
+	}
+	return pairEqual(p.leftG1(), p.Certificate, p.Generator, p.HolderKey), nil
+}
+
+//leftG1 returns the G1 term on the left of the equality of Verify ie b*H(C)*G + H(n)*b*G + b*pubG1CP
+func (p *BlindedPresentation) leftG1() *bn256.G1 {
+	leftG1 := g1BaseMult(p.Commitment)
+	leftG1.Add(leftG1, p.IssuerKey)
+	countG1 := g1Mult(p.Generator, attributeCountHash(p.AttributeCount))
+	return leftG1.Add(leftG1, countG1)
+}
+
+//blindedPresentationLen is the size of a marshalled presentation whose points have g1 and g2 bytes
+func blindedPresentationLen(g1, g2 int) int {
+	return 4 + scalarLen + 2*g1 + 2*g2
+}
+
+//Marshal returns attributeCount (4 bytes) || commitment (32 bytes) || certificate (128 bytes) || issuer key (64 bytes) || holder key (128 bytes) || generator (64 bytes)
+func (p *BlindedPresentation) Marshal() []byte {
+	return p.marshal(false)
+}
+
+//MarshalCompressed returns the presentation like Marshal, with compressed points: 232 bytes instead of 420
+func (p *BlindedPresentation) MarshalCompressed() []byte {
+	return p.marshal(true)
+}
+
+func (p *BlindedPresentation) marshal(compressed bool) []byte {
+	res := make([]byte, 4, blindedPresentationLen(g1Len, g2Len))
+	binary.BigEndian.PutUint32(res, uint32(p.AttributeCount))
+	res = append(res, scalarToBytes(p.Commitment)...)
+	res = append(res, marshalG2(p.Certificate, compressed)...)
+	res = append(res, marshalG1(p.IssuerKey, compressed)...)
+	res = append(res, marshalG2(p.HolderKey, compressed)...)
+	return append(res, marshalG1(p.Generator, compressed)...)
+}
+
+//Digest returns the SHA-256 hash of the marshalled presentation, with uncompressed points whatever its encoding.
+//It identifies a presentation, for instance in the set of the presentations already verified by the chaincode
+func (p *BlindedPresentation) Digest() []byte {
+	defer observe(PrimitiveHash, time.Now())
+	h := sha256.Sum256(p.Marshal())
+	return h[:]
+}
+
+//Unmarshal sets p to the blinded presentation m, the output of Marshal or of MarshalCompressed
+func (p *BlindedPresentation) Unmarshal(m []byte) error {
+	g1, g2, ok := pointLens(len(m), blindedPresentationLen)
+	if !ok {
+		return errPresentationSize
+	}
+	offset := 4 + scalarLen
+	var res BlindedPresentation
+	res.AttributeCount = int(binary.BigEndian.Uint32(m[:4]))
+	res.Commitment = new(big.Int).SetBytes(m[4:offset])
+	if res.Certificate, ok = unmarshalG2(m[offset : offset+g2]); !ok {
+		return errPresentationG2
+	}
+	offset += g2
+	if res.IssuerKey, ok = unmarshalG1(m[offset : offset+g1]); !ok {
+		return errPresentationG1
+	}
+	offset += g1
+	if res.HolderKey, ok = unmarshalG2(m[offset : offset+g2]); !ok {
+		return errPresentationG2
+	}
+	offset += g2
+	if res.Generator, ok = unmarshalG1(m[offset:]); !ok {
+		return errPresentationG1
+	}
+	if err := res.check(); err != nil {
+		return err
+	}
+	*p = res
+	return nil
+}
+
+//Marshal returns factor (32 bytes) || blinded private key (32 bytes)
+func (s *BlindingSecret) Marshal() []byte {
+	return append(scalarToBytes(s.Factor), scalarToBytes(s.HolderKey)...)
+}
+
+//Unmarshal sets s to the blinding secret m
+func (s *BlindingSecret) Unmarshal(m []byte) error {
+	if len(m) != 2*scalarLen {
+		return errBlindingSize
+	}
+	s.Factor = new(big.Int).SetBytes(m[:scalarLen])
+	s.HolderKey = new(big.Int).SetBytes(m[scalarLen:])
+	return nil
+}
@@ -0,0 +1,245 @@
+package cryptolib
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"testing"
+
+	"golang.org/x/crypto/bn256"
+)
+
+func TestCredential(t *testing.T) {
+	issuer, err := GenerateIssuerKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	holder, err := GenerateHolderKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitment := []byte("commitment of the attributes")
+
+	cred, err := issuer.Issue(commitment, 3, &holder.HolderPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//every value goes through its wire format, like between the CP, the user and the SP
+	var issuerPub IssuerPublicKey
+	if err := issuerPub.Unmarshal(issuer.IssuerPublicKey.Marshal()); err != nil {
+		t.Fatal(err)
+	}
+	var holderKey HolderKey
+	if err := holderKey.Unmarshal(holder.Marshal()); err != nil {
+		t.Fatal(err)
+	}
+	var received Credential
+	if err := received.Unmarshal(cred.Marshal()); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := received.Verify(&issuerPub, &holderKey.HolderPublicKey); err != nil || !ok {
+		t.Fatalf("Credential does not verify: %v", err)
+	}
+
+	p, secret, err := holderKey.Blind(rand.Reader, &received, &issuerPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var shown BlindedPresentation
+	if err := shown.Unmarshal(p.Marshal()); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := shown.Verify(); err != nil || !ok {
+		t.Fatalf("Blinded presentation does not verify: %v", err)
+	}
+	var s BlindingSecret
+	if err := s.Unmarshal(secret.Marshal()); err != nil || s.Factor.Cmp(secret.Factor) != 0 {
+		t.Fatalf("Blinding secret does not round trip: %v", err)
+	}
+
+	shown.AttributeCount = 2
+	if ok, _ := shown.Verify(); ok {
+		t.Fatal("Blinded presentation verifies with a wrong attribute count")
+	}
+
+	//the public keys of the CP and of the user live in different groups and cannot be swapped
+	var wrongIssuer IssuerPublicKey
+	if err := wrongIssuer.Unmarshal(holder.HolderPublicKey.Marshal()); err == nil {
+		t.Fatal("G2 point accepted as issuer public key")
+	}
+	var wrongHolder HolderPublicKey
+	if err := wrongHolder.Unmarshal(issuer.IssuerPublicKey.Marshal()); err == nil {
+		t.Fatal("G1 point accepted as holder public key")
+	}
+
+	//a holder cannot blind the credential of another holder
+	other, err := GenerateHolderKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := other.Blind(rand.Reader, cred, &issuer.IssuerPublicKey); err == nil {
+		t.Fatal("Credential of another holder blinded")
+	}
+}
+
+//a credential is unmarshalled with a compressed certificate, and refused without attributes
+func TestCredentialUnmarshal(t *testing.T) {
+	issuer, err := GenerateIssuerKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	holder, err := GenerateHolderKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred, err := issuer.Issue([]byte("commitment of the attributes"), 2, &holder.HolderPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := cred.MarshalCompressed()
+	if len(m) != len(cred.Marshal())-g2Len+g2CompressedLen {
+		t.Fatalf("Compressed credential of %d bytes", len(m))
+	}
+	var received Credential
+	if err := received.Unmarshal(m); err != nil {
+		t.Fatal(err)
+	}
+	if received.AttributeCount != 2 || !bytes.Equal(received.Marshal(), cred.Marshal()) {
+		t.Fatal("Compressed credential changed by its encoding")
+	}
+	if ok, err := received.Verify(&issuer.IssuerPublicKey, &holder.HolderPublicKey); err != nil || !ok {
+		t.Fatalf("Compressed credential does not verify: %v", err)
+	}
+
+	//the compressed certificate is checked to be a point of G2
+	m[4+1] ^= 1
+	if err := received.Unmarshal(m); !errors.Is(err, ErrInvalidPoint) {
+		t.Fatalf("Invalid compressed certificate accepted: %v", err)
+	}
+
+	empty := &Credential{Commitment: cred.Commitment, Certificate: cred.Certificate}
+	for _, m := range [][]byte{empty.Marshal(), empty.MarshalCompressed()} {
+		if err := received.Unmarshal(m); err != errAttributeCount {
+			t.Fatalf("Credential without attributes accepted: %v", err)
+		}
+	}
+}
+
+func TestPresentation(t *testing.T) {
+	issuer, err := GenerateIssuerKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	holder, err := GenerateHolderKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred, err := issuer.Issue([]byte("commitment of the attributes"), 2, &holder.HolderPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := []byte("nonce of the verifier")
+	context := []byte("age verification")
+
+	p, proof, err := holder.Present(rand.Reader, cred, &issuer.IssuerPublicKey, nonce, context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received PresentationProof
+	if err := received.Unmarshal(proof.Marshal()); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := p.VerifyPresentation(&received, nonce, context); err != nil || !ok {
+		t.Fatalf("Presentation does not verify: %v", err)
+	}
+	if !p.VerifyIssuer(received.Issuer, &issuer.IssuerPublicKey, nonce, context) {
+		t.Fatal("Issuer proof does not verify")
+	}
+	otherIssuer, err := GenerateIssuerKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.VerifyIssuer(received.Issuer, &otherIssuer.IssuerPublicKey, nonce, context) {
+		t.Fatal("Issuer proof verifies for another issuer")
+	}
+	if p.VerifyIssuer(received.Issuer, &issuer.IssuerPublicKey, []byte("another nonce"), context) {
+		t.Fatal("Issuer proof verifies for another nonce")
+	}
+
+	//the presentation cannot be replayed in another session
+	if ok, _ := p.VerifyPresentation(&received, []byte("another nonce"), context); ok {
+		t.Fatal("Presentation verifies with another nonce")
+	}
+	if ok, _ := p.VerifyPresentation(&received, nonce, []byte("another context")); ok {
+		t.Fatal("Presentation verifies with another context")
+	}
+
+	//the proof is bound to the presentation it has been computed for
+	other, _, err := holder.Present(rand.Reader, cred, &issuer.IssuerPublicKey, nonce, context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := other.VerifyPresentation(&received, nonce, context); ok {
+		t.Fatal("Proof verifies for another presentation")
+	}
+}
+
+//A presentation blinded with b = 0 has every point at infinity: it satisfies the pairing equality and an issuer proof
+//with AGenerator = w*G, AIssuer = w*pubG1CP and S = w for any CP, so it must be refused
+func TestIdentityPresentation(t *testing.T) {
+	issuer, err := GenerateIssuerKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g1 := make([]byte, g1Len)
+	g2 := make([]byte, g2Len)
+	commitment := make([]byte, scalarLen)
+	commitment[scalarLen-1] = 1
+	if _, err := NewBlindedPresentation(commitment, 1, g2, g1, g2, g1); !errors.Is(err, ErrInvalidPoint) {
+		t.Fatalf("Presentation at infinity accepted: %v", err)
+	}
+	identity := &BlindedPresentation{
+		Commitment:     big.NewInt(1),
+		AttributeCount: 1,
+		Certificate:    new(bn256.G2).ScalarBaseMult(big.NewInt(0)),
+		IssuerKey:      new(bn256.G1).ScalarBaseMult(big.NewInt(0)),
+		HolderKey:      new(bn256.G2).ScalarBaseMult(big.NewInt(0)),
+		Generator:      new(bn256.G1).ScalarBaseMult(big.NewInt(0)),
+	}
+	var received BlindedPresentation
+	if err := received.Unmarshal(identity.Marshal()); !errors.Is(err, ErrInvalidPoint) {
+		t.Fatalf("Marshalled presentation at infinity accepted: %v", err)
+	}
+	if ok, err := identity.Verify(); ok || err == nil {
+		t.Fatal("Presentation at infinity verifies")
+	}
+	w := big.NewInt(12345)
+	proof := &IssuerProof{AGenerator: new(bn256.G1).ScalarBaseMult(w), AIssuer: new(bn256.G1).ScalarMult(issuer.G1, w), S: w}
+	if identity.VerifyIssuer(proof, &issuer.IssuerPublicKey, []byte("nonce"), []byte("context")) {
+		t.Fatal("Issuer proof of a presentation at infinity verifies")
+	}
+	if invalid, err := BatchVerify(rand.Reader, []*BlindedPresentation{identity}); err != nil || len(invalid) != 1 {
+		t.Fatalf("Batch with a presentation at infinity: %v %v", invalid, err)
+	}
+
+	//a null blinded commitment is refused even with valid points
+	holder, err := GenerateHolderKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred, err := issuer.Issue([]byte("commitment of the attributes"), 1, &holder.HolderPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _, err := holder.Blind(rand.Reader, cred, &issuer.IssuerPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Commitment = big.NewInt(0)
+	if err := received.Unmarshal(p.Marshal()); !errors.Is(err, ErrInvalidScalar) {
+		t.Fatalf("Null blinded commitment accepted: %v", err)
+	}
+}
@@ -0,0 +1,226 @@
+package cryptolib
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"math/bits"
+	"time"
+)
+
+//MaxDisclosedAttributes is the maximum number of attributes a DisclosureMask can describe
+const MaxDisclosedAttributes = 32
+
+var (
+	errDisclosureMask       = errors.New("Disclosure mask refers to an attribute which is not in the commitment")
+	errDisclosedCount       = errors.New("Number of disclosed attributes does not match the disclosure mask")
+	errDisclosureProofSize  = sizeError("Disclosure proof has a wrong size")
+	errDisclosurePoint      = pointError("Point of the disclosure proof is not on the curve")
+	errDisclosureSize       = sizeError("Disclosure is too short")
+	errDisclosureGenerators = errors.New("Number of generators does not match the attribute count of the presentation")
+)
+
+//DisclosureMask tells which committed attributes are revealed: the bit i is set if the attribute i is disclosed
+type DisclosureMask uint32
+
+//Disclosed returns true if the attribute i is disclosed
+func (mask DisclosureMask) Disclosed(i int) bool {
+	return i >= 0 && i < MaxDisclosedAttributes && mask&(1<<uint(i)) != 0
+}
+
+//Count returns the number of disclosed attributes
+func (mask DisclosureMask) Count() int {
+	return bits.OnesCount32(uint32(mask))
+}
+
+//check verifies that the mask only refers to the n attributes of the commitment
+func (mask DisclosureMask) check(n int) error {
+	if n > MaxDisclosedAttributes || (n < MaxDisclosedAttributes && uint32(mask)>>uint(n) != 0) {
+		return errDisclosureMask
+	}
+	return nil
+}
+
+//Disclose returns the attributes of message selected by the mask, in the order of the commitment
+func (mask DisclosureMask) Disclose(message [][]byte) ([][]byte, error) {
+	if err := mask.check(len(message)); err != nil {
+		return nil, err
+	}
+	disclosed := make([][]byte, 0, mask.Count())
+	for i := range message {
+		if mask.Disclosed(i) {
+			disclosed = append(disclosed, message[i])
+		}
+	}
+	return disclosed, nil
+}
+
+//disclosureChallenge computes the Fiat-Shamir challenge of the disclosure proof.
+//It binds the generators, the commitment, the mask, the disclosed attributes, A and the session of the verifier. Each field is prefixed by its length.
+func disclosureChallenge(secretPub *ecdsa.PublicKey, gen []ecdsa.PublicKey, commit []byte, mask DisclosureMask, hashedDisclosed [][]byte, A []byte, nonce []byte, context []byte) *big.Int {
+	defer observe(PrimitiveHash, time.Now())
+	c := secretPub.Curve
+	var maskByte [4]byte
+	binary.BigEndian.PutUint32(maskByte[:], uint32(mask))
+	fields := [][]byte{
+		[]byte(c.Params().Name),
+		elliptic.Marshal(c, secretPub.X, secretPub.Y),
+	}
+	for i := range gen {
+		fields = append(fields, elliptic.Marshal(c, gen[i].X, gen[i].Y))
+	}
+	fields = append(fields, commit, maskByte[:])
+	fields = append(fields, hashedDisclosed...)
+	fields = append(fields, A, nonce, context)
+
+	h := sha256.New()
+	for _, field := range fields {
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], uint32(len(field)))
+		h.Write(size[:])
+		h.Write(field)
+	}
+	e := new(big.Int).SetBytes(h.Sum(nil))
+	return e.Mod(e, c.Params().N)
+}
+
+//GenerateDisclosureProof generates a zero knowledge proof that the attributes selected by mask are committed in commit,
+//and that the prover knows the hidden attributes and the random of the commitment.
+/*
+ * message, secretPub, gen and r are the inputs given to Commit
+ * commit is the commitment returned by Commit
+ * mask selects the disclosed attributes, sent in clear to the verifier
+ * nonce is the challenge sent by the verifier for this session
+ * context is the application context the proof is computed for
+ *
+ * With C' = commit - sum of H(mi)*Gi for the disclosed i, the proof shows the knowledge of r and of the hidden H(mj)
+ * such that C' = r*secretPub + sum of H(mj)*Gj for the hidden j.
+ *
+ * The function output the proof: A || s_r || s_j for each hidden j in increasing order
+ */
+func GenerateDisclosureProof(message [][]byte, secretPub *ecdsa.PublicKey, gen []ecdsa.PublicKey, r []byte, commit []byte, mask DisclosureMask, nonce []byte, context []byte) ([]byte, error) {
+	if len(message) != len(gen) {
+		return nil, errMessageOrGeneratorSize
+	}
+	if err := mask.check(len(gen)); err != nil {
+		return nil, err
+	}
+	c := secretPub.Curve
+	n := c.Params().N
+	hashedMessage := messageToHash(message)
+
+	//the secrets are r then the hidden attributes, with their generators
+	secrets := []*big.Int{new(big.Int).SetBytes(r)}
+	bases := []*ecdsa.PublicKey{secretPub}
+	var hashedDisclosed [][]byte
+	for i := range gen {
+		if mask.Disclosed(i) {
+			hashedDisclosed = append(hashedDisclosed, hashedMessage[i])
+			continue
+		}
+		secrets = append(secrets, new(big.Int).SetBytes(hashedMessage[i]))
+		bases = append(bases, &gen[i])
+	}
+
+	//A = k_r*secretPub + sum of k_j*Gj
+	nonces := make([]*big.Int, len(secrets))
+	var Ax, Ay *big.Int
+	for i := range nonces {
+		k, err := rand.Int(rand.Reader, n)
+		if err != nil {
+			return nil, err
+		}
+		nonces[i] = k
+		x, y := scalarMult(c, bases[i].X, bases[i].Y, scalarBytes(c, k))
+		if i == 0 {
+			Ax, Ay = x, y
+		} else {
+			Ax, Ay = c.Add(Ax, Ay, x, y)
+		}
+	}
+	AByte := elliptic.Marshal(c, Ax, Ay)
+	e := disclosureChallenge(secretPub, gen, commit, mask, hashedDisclosed, AByte, nonce, context)
+
+	proof := AByte
+	for i := range secrets {
+		s := new(big.Int).Mul(e, secrets[i])
+		s.Add(s, nonces[i])
+		proof = append(proof, scalarBytes(c, s)...)
+	}
+	return proof, nil
+}
+
+//VerifyDisclosureProof verifies a proof computed by GenerateDisclosureProof.
+/*
+ * secretPub and gen are the generators used to compute the commitment
+ * commit is the commitment
+ * mask selects the disclosed attributes
+ * disclosed are the disclosed attributes, in the order of the commitment
+ * proof is the disclosure proof
+ * nonce and context are the session of the verifier
+ *
+ * It checks that s_r*secretPub + sum of s_j*Gj == A + e*C'
+ */
+func VerifyDisclosureProof(secretPub *ecdsa.PublicKey, gen []ecdsa.PublicKey, commit []byte, mask DisclosureMask, disclosed [][]byte, proof []byte, nonce []byte, context []byte) (bool, error) {
+	if err := mask.check(len(gen)); err != nil {
+		return false, err
+	}
+	if len(disclosed) != mask.Count() {
+		return false, errDisclosedCount
+	}
+	c := secretPub.Curve
+	ps := pointSize(c)
+	ss := scalarSize(c)
+	hidden := len(gen) - mask.Count()
+	if len(proof) != ps+(hidden+1)*ss {
+		return false, errDisclosureProofSize
+	}
+	commitX, commitY := elliptic.Unmarshal(c, commit)
+	if commitX == nil {
+		return false, errDisclosurePoint
+	}
+	AByte := proof[:ps]
+	Ax, Ay := elliptic.Unmarshal(c, AByte)
+	if Ax == nil {
+		return false, errDisclosurePoint
+	}
+
+	//C' = commit - sum of H(mi)*Gi for the disclosed i
+	hashedDisclosed := messageToHash(disclosed)
+	reducedX, reducedY := commitX, commitY
+	bases := []*ecdsa.PublicKey{secretPub}
+	k := 0
+	for i := range gen {
+		if !mask.Disclosed(i) {
+			bases = append(bases, &gen[i])
+			continue
+		}
+		x, y := scalarMult(c, gen[i].X, gen[i].Y, hashedDisclosed[k])
+		x, y = negY(c, x, y)
+		reducedX, reducedY = c.Add(reducedX, reducedY, x, y)
+		k++
+	}
+	e := disclosureChallenge(secretPub, gen, commit, mask, hashedDisclosed, AByte, nonce, context)
+
+	var leftX, leftY *big.Int
+	for i := range bases {
+		x, y := scalarMult(c, bases[i].X, bases[i].Y, proof[ps+i*ss:ps+(i+1)*ss])
+		if i == 0 {
+			leftX, leftY = x, y
+		} else {
+			leftX, leftY = c.Add(leftX, leftY, x, y)
+		}
+	}
+
+	rightX, rightY := scalarMult(c, reducedX, reducedY, e.Bytes())
+	rightX, rightY = c.Add(rightX, rightY, Ax, Ay)
+
+	if leftX.Cmp(rightX) != 0 || leftY.Cmp(rightY) != 0 {
+		return false, nil
+	}
+	return true, nil
+}
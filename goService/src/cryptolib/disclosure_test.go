@@ -0,0 +1,65 @@
+package cryptolib
+
+import (
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+)
+
+func TestDisclosureProof(t *testing.T) {
+	curve := elliptic.P256()
+	attributes := [][]byte{[]byte("1990-01-31"), []byte("FR"), []byte("B"), []byte("2030-12-31")}
+	h, gen, err := CommitmentGenerators(curve, len(attributes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	random := make([]byte, 32)
+	rand.Read(random)
+	commitment, err := Commit(attributes, h, gen, random)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := []byte("nonce of the verifier")
+	context := []byte("nationality verification")
+
+	//disclose the nationality and the driving licence category
+	mask := DisclosureMask(1<<1 | 1<<2)
+	disclosed, err := mask.Disclose(attributes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := GenerateDisclosureProof(attributes, h, gen, random, commitment, mask, nonce, context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := VerifyDisclosureProof(h, gen, commitment, mask, disclosed, proof, nonce, context); err != nil || !ok {
+		t.Fatalf("Disclosure proof does not verify: %v", err)
+	}
+	if ok, _ := VerifyDisclosureProof(h, gen, commitment, mask, disclosed, proof, []byte("another nonce"), context); ok {
+		t.Fatal("Disclosure proof verifies with another nonce")
+	}
+
+	//a disclosed attribute cannot be changed
+	if ok, _ := VerifyDisclosureProof(h, gen, commitment, mask, [][]byte{[]byte("DE"), []byte("B")}, proof, nonce, context); ok {
+		t.Fatal("Disclosure proof verifies with a modified attribute")
+	}
+
+	//the mask cannot be changed to hide or reveal other attributes
+	if ok, _ := VerifyDisclosureProof(h, gen, commitment, DisclosureMask(1<<1|1<<3), disclosed, proof, nonce, context); ok {
+		t.Fatal("Disclosure proof verifies with another mask")
+	}
+
+	//the proof is about its commitment only
+	rand.Read(random)
+	other, err := Commit(attributes, h, gen, random)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := VerifyDisclosureProof(h, gen, other, mask, disclosed, proof, nonce, context); ok {
+		t.Fatal("Disclosure proof verifies for another commitment")
+	}
+
+	if _, err := DisclosureMask(1 << 4).Disclose(attributes); err == nil {
+		t.Fatal("Mask refering to a missing attribute accepted")
+	}
+}
@@ -0,0 +1,164 @@
+package cryptolib
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"time"
+
+	"golang.org/x/crypto/bn256"
+)
+
+//Domain labels of the generators used by the service. Changing a label changes every commitment computed with it.
+const (
+	//AttributeGeneratorLabel is the label of the generators G1, ..., Gn, one per committed attribute
+	AttributeGeneratorLabel = "attribute generator"
+	//BlindingGeneratorLabel is the label of the generator H multiplied by the random of the commitment
+	BlindingGeneratorLabel = "commitment blinding generator"
+	//AttributeKeyBaseLabel is the label of the bn256 generator G~0 added to every attribute key
+	AttributeKeyBaseLabel = "attribute key base"
+	//AttributeKeyBlindingLabel is the label of the bn256 generator S~ multiplied by the random of the attribute key
+	AttributeKeyBlindingLabel = "attribute key blinding generator"
+	//AttributeKeyGeneratorLabel is the label of the bn256 generators G~1, ..., G~n, one per attribute of the key
+	AttributeKeyGeneratorLabel = "attribute key generator"
+)
+
+var (
+	errGeneratorCount = errors.New("Number of generators must be strictly positive")
+	errGeneratorCurve = errors.New("Generator derivation only supports curves of equation y^2 = x^3 - 3x + b")
+)
+
+//hashToField hashes label || index || counter into an integer of the size of the field of the curve
+func hashToField(c elliptic.Curve, label string, index uint32, counter uint32) *big.Int {
+	defer observe(PrimitiveHash, time.Now())
+	size := (c.Params().BitSize + 7) / 8
+	out := make([]byte, 0, size+sha256.Size)
+	var block uint32
+	for len(out) < size {
+		var buf [12]byte
+		binary.BigEndian.PutUint32(buf[0:4], index)
+		binary.BigEndian.PutUint32(buf[4:8], counter)
+		binary.BigEndian.PutUint32(buf[8:12], block)
+		h := sha256.New()
+		h.Write([]byte(label))
+		h.Write(buf[:])
+		out = h.Sum(out)
+		block++
+	}
+	x := new(big.Int).SetBytes(out[:size])
+	//keep only BitSize bits, for P521 the last byte is not full
+	excess := uint(size*8 - c.Params().BitSize)
+	return x.Rsh(x, excess)
+}
+
+//hashToCurve maps (label, index) to a point of the curve by try and increment:
+//x = H(label || index || counter) is incremented until x^3 - 3x + b is a square, then the even y is kept.
+//The discrete log of the point in any base is unknown, which is what makes the commitments binding.
+func hashToCurve(c elliptic.Curve, label string, index uint32) (*big.Int, *big.Int) {
+	params := c.Params()
+	three := big.NewInt(3)
+	for counter := uint32(0); ; counter++ {
+		x := hashToField(c, label, index, counter)
+		if x.Cmp(params.P) >= 0 {
+			continue
+		}
+		//y^2 = x^3 - 3x + b
+		y2 := new(big.Int).Exp(x, three, params.P)
+		y2.Sub(y2, new(big.Int).Mul(x, three))
+		y2.Add(y2, params.B)
+		y2.Mod(y2, params.P)
+		y := new(big.Int).ModSqrt(y2, params.P)
+		if y == nil {
+			continue
+		}
+		if y.Bit(0) == 1 {
+			y.Sub(params.P, y)
+		}
+		return x, y
+	}
+}
+
+//DeriveGenerators returns n independent generators of the curve derived from the domain label.
+//The i-th generator only depends on the label and on i, so DeriveGenerators(c, l, n) is a prefix of DeriveGenerators(c, l, n+1).
+func DeriveGenerators(c elliptic.Curve, label string, n int) ([]ecdsa.PublicKey, error) {
+	if n < 1 {
+		return nil, errGeneratorCount
+	}
+	//the square root computation assumes a = -3, like the NIST curves of crypto/elliptic
+	if x, y := hashToCurve(c, label, 0); !c.IsOnCurve(x, y) {
+		return nil, errGeneratorCurve
+	}
+	gen := make([]ecdsa.PublicKey, n)
+	for i := 0; i < n; i++ {
+		x, y := hashToCurve(c, label, uint32(i))
+		gen[i] = ecdsa.PublicKey{Curve: c, X: x, Y: y}
+	}
+	return gen, nil
+}
+
+//CommitmentGenerators returns the generators to use with Commit for n attributes:
+//the blinding generator H and the attribute generators G1, ..., Gn
+func CommitmentGenerators(c elliptic.Curve, n int) (*ecdsa.PublicKey, []ecdsa.PublicKey, error) {
+	gen, err := DeriveGenerators(c, AttributeGeneratorLabel, n)
+	if err != nil {
+		return nil, nil, err
+	}
+	h, err := DeriveGenerators(c, BlindingGeneratorLabel, 1)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &h[0], gen, nil
+}
+
+//hashToG2 maps (label, index) to a point of G2 by try and increment: the 64 bytes H(label || index || counter || 0) || H(label || index || counter || 1)
+//are the abscissa of a point of the twist, whose cofactor is cleared, for the first counter where they are one.
+//Like hashToCurve, nobody knows the discrete log of the point in any base
+func hashToG2(label string, index uint32) *bn256.G2 {
+	defer observe(PrimitiveHash, time.Now())
+	for counter := uint32(0); ; counter++ {
+		x := make([]byte, 0, 2*sha256.Size)
+		for block := uint32(0); block < 2; block++ {
+			var buf [12]byte
+			binary.BigEndian.PutUint32(buf[0:4], index)
+			binary.BigEndian.PutUint32(buf[4:8], counter)
+			binary.BigEndian.PutUint32(buf[8:12], block)
+			h := sha256.New()
+			h.Write([]byte(label))
+			h.Write(buf[:])
+			x = h.Sum(x)
+		}
+		if g, ok := bn256.MapToG2(x); ok {
+			return g
+		}
+	}
+}
+
+//AttributeKeyGenerators are the generators of G2 of the attribute keys of n attributes, see NewAttributeKey
+type AttributeKeyGenerators struct {
+	//Base is G~0
+	Base *bn256.G2
+	//Blinding is S~
+	Blinding *bn256.G2
+	//Attributes are G~1, ..., G~n
+	Attributes []*bn256.G2
+}
+
+//DeriveAttributeKeyGenerators returns the generators of the attribute keys of n attributes.
+//Like with DeriveGenerators, the generators of n attributes are a prefix of the ones of n+1 attributes
+func DeriveAttributeKeyGenerators(n int) (*AttributeKeyGenerators, error) {
+	if n < 1 {
+		return nil, errGeneratorCount
+	}
+	gen := &AttributeKeyGenerators{
+		Base:       hashToG2(AttributeKeyBaseLabel, 0),
+		Blinding:   hashToG2(AttributeKeyBlindingLabel, 0),
+		Attributes: make([]*bn256.G2, n),
+	}
+	for i := range gen.Attributes {
+		gen.Attributes[i] = hashToG2(AttributeKeyGeneratorLabel, uint32(i))
+	}
+	return gen, nil
+}
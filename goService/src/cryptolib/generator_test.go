@@ -0,0 +1,87 @@
+package cryptolib
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"testing"
+
+	"golang.org/x/crypto/bn256"
+)
+
+func TestDeriveGenerators(t *testing.T) {
+	for _, curve := range []elliptic.Curve{elliptic.P224(), elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		gen, err := DeriveGenerators(curve, AttributeGeneratorLabel, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen := make(map[string]bool)
+		for i := range gen {
+			if !curve.IsOnCurve(gen[i].X, gen[i].Y) {
+				t.Fatalf("%s: generator %d is not on the curve", curve.Params().Name, i)
+			}
+			key := string(elliptic.Marshal(curve, gen[i].X, gen[i].Y))
+			if seen[key] {
+				t.Fatalf("%s: generator %d is repeated", curve.Params().Name, i)
+			}
+			seen[key] = true
+		}
+
+		//the derivation is deterministic and does not depend on the number of generators asked
+		again, err := DeriveGenerators(curve, AttributeGeneratorLabel, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range again {
+			if again[i].X.Cmp(gen[i].X) != 0 || again[i].Y.Cmp(gen[i].Y) != 0 {
+				t.Fatalf("%s: generator %d is not deterministic", curve.Params().Name, i)
+			}
+		}
+
+		//another label gives other generators
+		h, gen, err := CommitmentGenerators(curve, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.X.Cmp(gen[0].X) == 0 {
+			t.Fatalf("%s: blinding generator equals the attribute generator", curve.Params().Name)
+		}
+	}
+
+	if _, err := DeriveGenerators(elliptic.P256(), AttributeGeneratorLabel, 0); err == nil {
+		t.Fatal("Zero generators derived")
+	}
+}
+
+func TestDeriveAttributeKeyGenerators(t *testing.T) {
+	gen, err := DeriveAttributeKeyGenerators(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for i, g := range append([]*bn256.G2{gen.Base, gen.Blinding}, gen.Attributes...) {
+		if g.IsInfinity() {
+			t.Fatalf("generator %d is at infinity", i)
+		}
+		if _, ok := new(bn256.G2).UnmarshalCompressed(g.MarshalCompressed()); !ok {
+			t.Fatalf("generator %d is not in G2", i)
+		}
+		key := string(g.Marshal())
+		if seen[key] {
+			t.Fatalf("generator %d is repeated", i)
+		}
+		seen[key] = true
+	}
+
+	//the derivation is deterministic and does not depend on the number of generators asked
+	again, err := DeriveAttributeKeyGenerators(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again.Base.Marshal(), gen.Base.Marshal()) || !bytes.Equal(again.Attributes[0].Marshal(), gen.Attributes[0].Marshal()) {
+		t.Fatal("Attribute key generators are not deterministic")
+	}
+
+	if _, err := DeriveAttributeKeyGenerators(0); err == nil {
+		t.Fatal("Zero generators derived")
+	}
+}
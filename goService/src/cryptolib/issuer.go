@@ -0,0 +1,135 @@
+package cryptolib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"time"
+
+	"golang.org/x/crypto/bn256"
+)
+
+var (
+	errIssuerProofSize = sizeError("Issuer proof must be 160 bytes, or 98 bytes if compressed")
+	errIssuerProofG1   = pointError("Cannot Unmarshal G1 point of the issuer proof")
+)
+
+//IssuerProof proves that the blinded issuer key b*pubG1CP of a presentation is derived from the registered key pubG1CP of the CP,
+//with the same b as the blinded generator b*G, without revealing b. It is a Chaum-Pedersen proof of equality of discrete logs.
+//It is bound to the presentation and to the nonce of the verifier, so that it cannot be replayed with another challenge.
+type IssuerProof struct {
+	//AGenerator is w*G
+	AGenerator *bn256.G1
+	//AIssuer is w*pubG1CP
+	AIssuer *bn256.G1
+	//S is w + e*b [Order]
+	S *big.Int
+}
+
+//issuerChallenge computes the Fiat-Shamir challenge of the issuer proof of the presentation p. Each field is prefixed by its length.
+//It must stay identical to the one of the verify chaincode
+func issuerChallenge(issuer *bn256.G1, p *BlindedPresentation, AGenerator *bn256.G1, AIssuer *bn256.G1, nonce []byte, context []byte) *big.Int {
+	defer observe(PrimitiveHash, time.Now())
+	h := sha256.New()
+	fields := [][]byte{
+		[]byte("issuer"),
+		g1BaseMult(big.NewInt(1)).Marshal(),
+		issuer.Marshal(),
+		p.Digest(),
+		AGenerator.Marshal(),
+		AIssuer.Marshal(),
+		nonce,
+		context,
+	}
+	for _, field := range fields {
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], uint32(len(field)))
+		h.Write(size[:])
+		h.Write(field)
+	}
+	e := new(big.Int).SetBytes(h.Sum(nil))
+	return e.Mod(e, bn256.Order)
+}
+
+//ProveIssuer proves that the presentation p, blinded with s, has been issued by issuer, for the session (nonce, context) of the verifier
+func (s *BlindingSecret) ProveIssuer(r io.Reader, p *BlindedPresentation, issuer *IssuerPublicKey, nonce []byte, context []byte) (*IssuerProof, error) {
+	w, err := randomScalar(r)
+	if err != nil {
+		return nil, err
+	}
+	proof := &IssuerProof{
+		AGenerator: g1BaseMult(w),
+		AIssuer:    g1Mult(issuer.G1, w),
+	}
+	e := issuerChallenge(issuer.G1, p, proof.AGenerator, proof.AIssuer, nonce, context)
+	proof.S = new(big.Int).Mul(e, s.Factor)
+	proof.S.Add(proof.S, w)
+	proof.S.Mod(proof.S, bn256.Order)
+	return proof, nil
+}
+
+//VerifyIssuer verifies that the blinded issuer key of the presentation is derived from the key of issuer, for the session (nonce, context)
+//ie S*G == AGenerator + e*(b*G) and S*pubG1CP == AIssuer + e*(b*pubG1CP).
+//A presentation blinded with b = 0 is refused, since the proof then holds for any issuer
+func (p *BlindedPresentation) VerifyIssuer(proof *IssuerProof, issuer *IssuerPublicKey, nonce []byte, context []byte) bool {
+	if p.check() != nil {
+		return false
+	}
+	e := issuerChallenge(issuer.G1, p, proof.AGenerator, proof.AIssuer, nonce, context)
+
+	left := g1BaseMult(proof.S)
+	right := g1Mult(p.Generator, e)
+	right.Add(right, proof.AGenerator)
+	if !bytes.Equal(left.Marshal(), right.Marshal()) {
+		return false
+	}
+
+	left = g1Mult(issuer.G1, proof.S)
+	right = g1Mult(p.IssuerKey, e)
+	right.Add(right, proof.AIssuer)
+	return bytes.Equal(left.Marshal(), right.Marshal())
+}
+
+//issuerProofLen is the size of a marshalled issuer proof whose points have g1 bytes
+func issuerProofLen(g1, g2 int) int {
+	return 2*g1 + scalarLen
+}
+
+//Marshal returns AGenerator (64 bytes) || AIssuer (64 bytes) || S (32 bytes)
+func (proof *IssuerProof) Marshal() []byte {
+	return proof.marshal(false)
+}
+
+//MarshalCompressed returns the proof like Marshal, with compressed points: 98 bytes instead of 160
+func (proof *IssuerProof) MarshalCompressed() []byte {
+	return proof.marshal(true)
+}
+
+func (proof *IssuerProof) marshal(compressed bool) []byte {
+	res := make([]byte, 0, issuerProofLen(g1Len, g2Len))
+	res = append(res, marshalG1(proof.AGenerator, compressed)...)
+	res = append(res, marshalG1(proof.AIssuer, compressed)...)
+	return append(res, scalarToBytes(proof.S)...)
+}
+
+//Unmarshal sets proof to the issuer proof m, the output of Marshal or of MarshalCompressed
+func (proof *IssuerProof) Unmarshal(m []byte) error {
+	g1, _, ok := pointLens(len(m), issuerProofLen)
+	if !ok {
+		return errIssuerProofSize
+	}
+	AGenerator, ok := unmarshalG1(m[:g1])
+	if !ok {
+		return errIssuerProofG1
+	}
+	AIssuer, ok := unmarshalG1(m[g1 : 2*g1])
+	if !ok {
+		return errIssuerProofG1
+	}
+	proof.AGenerator = AGenerator
+	proof.AIssuer = AIssuer
+	proof.S = new(big.Int).SetBytes(m[2*g1:])
+	return nil
+}
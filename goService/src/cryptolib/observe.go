@@ -0,0 +1,66 @@
+package cryptolib
+
+import (
+	"crypto/elliptic"
+	"math/big"
+	"time"
+
+	"golang.org/x/crypto/bn256"
+)
+
+//Primitives whose durations are reported to the observer of SetObserver
+const (
+	//PrimitivePairing is a pairing check e(a, b) == e(c, d)
+	PrimitivePairing = "pairing"
+	//PrimitiveMillerLoop is the two Miller loops of a presentation in BatchVerify, without their final exponentiation
+	PrimitiveMillerLoop = "miller_loop"
+	//PrimitiveFinalExponentiation is a final exponentiation of BatchVerify
+	PrimitiveFinalExponentiation = "final_exponentiation"
+	//PrimitiveScalarMult is a scalar multiplication on P256 or bn256
+	PrimitiveScalarMult = "scalar_mult"
+	//PrimitiveHash is a hash to a scalar: a challenge, a hashed attribute or a hash to the curve
+	PrimitiveHash = "hash"
+)
+
+//observer receives the duration of each primitive computed by cryptolib, nil when nobody observes them
+var observer func(primitive string, elapsed time.Duration)
+
+//SetObserver makes cryptolib report to o the duration of each primitive it computes.
+//o is called by every goroutine using cryptolib, and must be set before them.
+//The durations are all cryptolib reports: it takes no context and starts no span, the caller traces its calls
+func SetObserver(o func(primitive string, elapsed time.Duration)) {
+	observer = o
+}
+
+//observe reports the duration of primitive, started at start
+func observe(primitive string, start time.Time) {
+	if observer != nil {
+		observer(primitive, time.Since(start))
+	}
+}
+
+func g1BaseMult(k *big.Int) *bn256.G1 {
+	defer observe(PrimitiveScalarMult, time.Now())
+	return new(bn256.G1).ScalarBaseMult(k)
+}
+
+func g1Mult(a *bn256.G1, k *big.Int) *bn256.G1 {
+	defer observe(PrimitiveScalarMult, time.Now())
+	return new(bn256.G1).ScalarMult(a, k)
+}
+
+func g2BaseMult(k *big.Int) *bn256.G2 {
+	defer observe(PrimitiveScalarMult, time.Now())
+	return new(bn256.G2).ScalarBaseMult(k)
+}
+
+func g2Mult(a *bn256.G2, k *big.Int) *bn256.G2 {
+	defer observe(PrimitiveScalarMult, time.Now())
+	return new(bn256.G2).ScalarMult(a, k)
+}
+
+//scalarMult returns k*(x, y) on c
+func scalarMult(c elliptic.Curve, x, y *big.Int, k []byte) (*big.Int, *big.Int) {
+	defer observe(PrimitiveScalarMult, time.Now())
+	return c.ScalarMult(x, y, k)
+}
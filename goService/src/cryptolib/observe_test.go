@@ -0,0 +1,39 @@
+package cryptolib
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+)
+
+func TestObserver(t *testing.T) {
+	observed := make(map[string]int)
+	SetObserver(func(primitive string, elapsed time.Duration) {
+		if elapsed < 0 {
+			t.Errorf("Negative duration of %s", primitive)
+		}
+		observed[primitive]++
+	})
+	defer SetObserver(nil)
+
+	issuer, err := GenerateIssuerKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	holder, err := GenerateHolderKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred, err := issuer.Issue([]byte("commitment of the attributes"), 3, &holder.HolderPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := cred.Verify(&issuer.IssuerPublicKey, &holder.HolderPublicKey); err != nil || !ok {
+		t.Fatalf("Credential does not verify: %v", err)
+	}
+	for _, primitive := range []string{PrimitivePairing, PrimitiveScalarMult, PrimitiveHash} {
+		if observed[primitive] == 0 {
+			t.Errorf("%s not observed", primitive)
+		}
+	}
+}
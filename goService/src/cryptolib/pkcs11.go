@@ -0,0 +1,180 @@
+package cryptolib
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+
+	"github.com/miekg/pkcs11"
+)
+
+//oidP256 is the DER encoding of the OID of the curve P-256 (prime256v1), the CKA_EC_PARAMS of the keys of the IV
+var oidP256 = []byte{0x06, 0x08, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07}
+
+var (
+	errPKCS11Module    = errors.New("Cannot load the PKCS#11 module")
+	errPKCS11Token     = errors.New("No PKCS#11 token has this label")
+	errPKCS11Key       = errors.New("The PKCS#11 token must contain one private key and one public key with this label")
+	errPKCS11Signature = errors.New("The PKCS#11 signature must be 64 bytes")
+)
+
+//PKCS11Config locates the key of a signer in a PKCS#11 token
+type PKCS11Config struct {
+	//Module is the path of the PKCS#11 library, such as /usr/lib/softhsm/libsofthsm2.so
+	Module string
+	//Token is the label of the token
+	Token string
+	//PIN is the PIN of the user of the token
+	PIN string
+	//Key is the label (CKA_LABEL) of the key pair
+	Key string
+}
+
+//PKCS11Signer is a Signer whose P-256 key is kept in a PKCS#11 token, a HSM or SoftHSM.
+//The private key never leaves the token, which computes the signatures
+type PKCS11Signer struct {
+	ctx     *pkcs11.Ctx
+	mu      sync.Mutex //a PKCS#11 session cannot be used by two goroutines at once
+	session pkcs11.SessionHandle
+	key     pkcs11.ObjectHandle
+	public  *ecdsa.PublicKey
+}
+
+//OpenPKCS11Signer opens a session on the token of config and finds the key pair of the signer. Close releases the session
+func OpenPKCS11Signer(config PKCS11Config) (*PKCS11Signer, error) {
+	ctx := pkcs11.New(config.Module)
+	if ctx == nil {
+		return nil, errPKCS11Module
+	}
+	if err := ctx.Initialize(); err != nil && err != pkcs11.Error(pkcs11.CKR_CRYPTOKI_ALREADY_INITIALIZED) {
+		ctx.Destroy()
+		return nil, err
+	}
+	s := &PKCS11Signer{ctx: ctx}
+	if err := s.open(config); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *PKCS11Signer) open(config PKCS11Config) error {
+	slots, err := s.ctx.GetSlotList(true)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, slot := range slots {
+		info, err := s.ctx.GetTokenInfo(slot)
+		if err != nil || info.Label != config.Token {
+			continue
+		}
+		if s.session, err = s.ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION); err != nil {
+			return err
+		}
+		found = true
+		break
+	}
+	if !found {
+		return errPKCS11Token
+	}
+	if err := s.ctx.Login(s.session, pkcs11.CKU_USER, config.PIN); err != nil && err != pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN) {
+		return err
+	}
+	if s.key, err = s.findKey(pkcs11.CKO_PRIVATE_KEY, config.Key); err != nil {
+		return err
+	}
+	pub, err := s.findKey(pkcs11.CKO_PUBLIC_KEY, config.Key)
+	if err != nil {
+		return err
+	}
+	attrs, err := s.ctx.GetAttributeValue(s.session, pub, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, nil),
+		pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+	})
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(attrs[0].Value, oidP256) {
+		return errSignerCurve
+	}
+	s.public, err = ecPoint(attrs[1].Value)
+	return err
+}
+
+//findKey returns the only EC key of class with the label
+func (s *PKCS11Signer) findKey(class uint, label string) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_EC),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	}
+	if err := s.ctx.FindObjectsInit(s.session, template); err != nil {
+		return 0, err
+	}
+	objects, _, err := s.ctx.FindObjects(s.session, 2)
+	s.ctx.FindObjectsFinal(s.session)
+	if err != nil {
+		return 0, err
+	}
+	if len(objects) != 1 {
+		return 0, errPKCS11Key
+	}
+	return objects[0], nil
+}
+
+//ecPoint converts the CKA_EC_POINT of a public key, an uncompressed point in a DER OCTET STRING.
+//Some tokens omit the OCTET STRING
+func ecPoint(m []byte) (*ecdsa.PublicKey, error) {
+	var point []byte
+	if rest, err := asn1.Unmarshal(m, &point); err != nil || len(rest) != 0 {
+		point = m
+	}
+	x, y := elliptic.Unmarshal(elliptic.P256(), point)
+	if x == nil {
+		return nil, fmt.Errorf("Cannot Unmarshal the CKA_EC_POINT of the PKCS#11 key (%d bytes)", len(m))
+	}
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+}
+
+//Public returns the public key of the signer
+func (s *PKCS11Signer) Public() *ecdsa.PublicKey {
+	return s.public
+}
+
+//Sign asks the token for the ECDSA signature (CKM_ECDSA) of digest. The randomness r is not used, the token draws its own
+func (s *PKCS11Signer) Sign(r io.Reader, digest []byte) (*big.Int, *big.Int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.ctx.SignInit(s.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)}, s.key); err != nil {
+		return nil, nil, err
+	}
+	sig, err := s.ctx.Sign(s.session, digest)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(sig) != 64 {
+		return nil, nil, errPKCS11Signature
+	}
+	return new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:]), nil
+}
+
+//Close logs out and closes the session of the signer
+func (s *PKCS11Signer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.session != 0 {
+		s.ctx.Logout(s.session)
+		s.ctx.CloseSession(s.session)
+		s.session = 0
+	}
+	err := s.ctx.Finalize()
+	s.ctx.Destroy()
+	return err
+}
@@ -0,0 +1,128 @@
+package cryptolib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/miekg/pkcs11"
+)
+
+//softHSMModule returns the path of the SoftHSM library: SOFTHSM2_MODULE or the path of the softhsm2 package of the distribution
+func softHSMModule() string {
+	if m := os.Getenv("SOFTHSM2_MODULE"); m != "" {
+		return m
+	}
+	for _, m := range []string{
+		"/usr/lib/softhsm/libsofthsm2.so",
+		"/usr/lib/x86_64-linux-gnu/softhsm/libsofthsm2.so",
+		"/usr/lib64/pkcs11/libsofthsm2.so",
+		"/usr/local/lib/softhsm/libsofthsm2.so",
+	} {
+		if _, err := os.Stat(m); err == nil {
+			return m
+		}
+	}
+	return ""
+}
+
+//initSoftHSM initializes a token of label in a new SoftHSM directory and generates the P-256 key pair keyLabel in it
+func initSoftHSM(t *testing.T, module, label, pin, keyLabel string) {
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "softhsm2.conf")
+	if err := os.Mkdir(filepath.Join(dir, "tokens"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(conf, []byte("directories.tokendir = "+filepath.Join(dir, "tokens")+"\nobjectstore.backend = file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SOFTHSM2_CONF", conf)
+
+	ctx := pkcs11.New(module)
+	if ctx == nil {
+		t.Fatalf("Cannot load %s", module)
+	}
+	defer ctx.Destroy()
+	if err := ctx.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.Finalize()
+	slots, err := ctx.GetSlotList(true)
+	if err != nil || len(slots) == 0 {
+		t.Fatalf("No free SoftHSM slot: %v", err)
+	}
+	if err := ctx.InitToken(slots[0], "so-"+pin, label); err != nil {
+		t.Fatal(err)
+	}
+	//SoftHSM moves the initialized token to a new slot
+	slots, err = ctx.GetSlotList(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var session pkcs11.SessionHandle
+	for _, slot := range slots {
+		if info, err := ctx.GetTokenInfo(slot); err == nil && info.Label == label {
+			session, err = ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if session == 0 {
+		t.Fatal("Initialized token not found")
+	}
+	defer ctx.CloseSession(session)
+	if err := ctx.Login(session, pkcs11.CKU_SO, "so-"+pin); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.InitPIN(session, pin); err != nil {
+		t.Fatal(err)
+	}
+	ctx.Logout(session)
+	if err := ctx.Login(session, pkcs11.CKU_USER, pin); err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.Logout(session)
+	_, _, err = ctx.GenerateKeyPair(session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_EC_KEY_PAIR_GEN, nil)},
+		[]*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+			pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+			pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, oidP256),
+			pkcs11.NewAttribute(pkcs11.CKA_LABEL, keyLabel),
+		},
+		[]*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+			pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+			pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+			pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+			pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+			pkcs11.NewAttribute(pkcs11.CKA_LABEL, keyLabel),
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+//TestPKCS11Signer runs against SoftHSM (apt install softhsm2), in a token created by the test.
+//It is skipped when SoftHSM is not installed
+func TestPKCS11Signer(t *testing.T) {
+	module := softHSMModule()
+	if module == "" {
+		t.Skip("SoftHSM is not installed, set SOFTHSM2_MODULE to the path of libsofthsm2.so")
+	}
+	initSoftHSM(t, module, "aav", "1234", "iv")
+
+	if _, err := OpenPKCS11Signer(PKCS11Config{Module: module, Token: "aav", PIN: "1234", Key: "unknown"}); err != errPKCS11Key {
+		t.Fatalf("Unknown key: %v", err)
+	}
+	if _, err := OpenPKCS11Signer(PKCS11Config{Module: module, Token: "unknown", PIN: "1234", Key: "iv"}); err != errPKCS11Token {
+		t.Fatalf("Unknown token: %v", err)
+	}
+	s, err := OpenPKCS11Signer(PKCS11Config{Module: module, Token: "aav", PIN: "1234", Key: "iv"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	testSigner(t, s)
+}
@@ -0,0 +1,95 @@
+package cryptolib
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/bn256"
+)
+
+//Kinds of the errors on the values given to cryptolib: the errors of the values which cannot be unmarshalled wrap one
+//of them, so that the callers can tell a malformed value apart with errors.Is
+var (
+	//ErrInvalidSize is the kind of the errors on a value which has a wrong size
+	ErrInvalidSize = errors.New("Value has a wrong size")
+	//ErrInvalidPoint is the kind of the errors on a point which is not on its curve or not in its group
+	ErrInvalidPoint = errors.New("Point is not on the curve or not in its group")
+	//ErrInvalidScalar is the kind of the errors on a scalar, or a private key, which is not in [1, Order)
+	ErrInvalidScalar = errors.New("Scalar is not in [1, Order)")
+)
+
+//valueError is an error on a value given to cryptolib, of the kind of one of the errors above
+type valueError struct {
+	kind error
+	msg  string
+}
+
+func (e *valueError) Error() string {
+	return e.msg
+}
+
+func (e *valueError) Unwrap() error {
+	return e.kind
+}
+
+func sizeError(msg string) error {
+	return &valueError{ErrInvalidSize, msg}
+}
+
+func pointError(msg string) error {
+	return &valueError{ErrInvalidPoint, msg}
+}
+
+func scalarError(msg string) error {
+	return &valueError{ErrInvalidScalar, msg}
+}
+
+//Size in bytes of the compressed bn256 points: the sign of y followed by x
+const (
+	g1CompressedLen = 33
+	g2CompressedLen = 65
+)
+
+//marshalG1 returns the G1 point p, compressed or not
+func marshalG1(p *bn256.G1, compressed bool) []byte {
+	if compressed {
+		return p.MarshalCompressed()
+	}
+	return p.Marshal()
+}
+
+//marshalG2 returns the G2 point p, compressed or not
+func marshalG2(p *bn256.G2, compressed bool) []byte {
+	if compressed {
+		return p.MarshalCompressed()
+	}
+	return p.Marshal()
+}
+
+//unmarshalG1 converts a G1 point of g1Len bytes, or of g1CompressedLen bytes if it is compressed
+func unmarshalG1(m []byte) (*bn256.G1, bool) {
+	if len(m) == g1CompressedLen {
+		return new(bn256.G1).UnmarshalCompressed(m)
+	}
+	return new(bn256.G1).Unmarshal(m)
+}
+
+//unmarshalG2 converts a G2 point of g2Len bytes, or of g2CompressedLen bytes if it is compressed.
+//A compressed point is also checked to be in G2
+func unmarshalG2(m []byte) (*bn256.G2, bool) {
+	if len(m) == g2CompressedLen {
+		return new(bn256.G2).UnmarshalCompressed(m)
+	}
+	return new(bn256.G2).Unmarshal(m)
+}
+
+//pointLens returns the sizes of the G1 and G2 points of a marshalled value of n bytes whose size is layout(g1, g2).
+//The points of a value are either all uncompressed or all compressed
+func pointLens(n int, layout func(g1, g2 int) int) (int, int, bool) {
+	if n == layout(g1Len, g2Len) {
+		return g1Len, g2Len, true
+	}
+	if n == layout(g1CompressedLen, g2CompressedLen) {
+		return g1CompressedLen, g2CompressedLen, true
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,152 @@
+package cryptolib
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"wire"
+)
+
+//compressedValue is an object of cryptolib with a compressed form
+type compressedValue interface {
+	Marshal() []byte
+	MarshalCompressed() []byte
+	MarshalWireCompressed() []byte
+	Unmarshal([]byte) error
+	UnmarshalWire([]byte) error
+}
+
+func TestCompressed(t *testing.T) {
+	issuer, err := GenerateIssuerKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	holder, err := GenerateHolderKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred, err := issuer.Issue([]byte("commitment of the attributes"), 2, &holder.HolderPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, secret, err := holder.Blind(rand.Reader, cred, &issuer.IssuerPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, proof, err := holder.Present(rand.Reader, cred, &issuer.IssuerPublicKey, []byte("nonce"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc, v, err := GenerateAccumulatorKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := acc.Witness(RevocationHandle(cred.Commitment), v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := secret.BlindWitness(w, v, acc.Q)
+
+	for _, tc := range []struct {
+		value, decoded compressedValue
+		size           int
+	}{
+		{&issuer.IssuerPublicKey, new(IssuerPublicKey), 33},
+		{&holder.HolderPublicKey, new(HolderPublicKey), 65},
+		{p, new(BlindedPresentation), 232},
+		{proof, new(PresentationProof), 260},
+		{proof.Issuer, new(IssuerProof), 98},
+		{m, new(MembershipProof), 196},
+	} {
+		c := tc.value.MarshalCompressed()
+		if len(c) != tc.size {
+			t.Fatalf("%T: compressed form of %d bytes, expecting %d", tc.value, len(c), tc.size)
+		}
+		if err := tc.decoded.Unmarshal(c); err != nil {
+			t.Fatalf("%T: %v", tc.value, err)
+		}
+		if !bytes.Equal(tc.decoded.Marshal(), tc.value.Marshal()) {
+			t.Fatalf("%T: wrong round trip", tc.value)
+		}
+		if err := tc.decoded.UnmarshalWire(tc.value.MarshalWireCompressed()); err != nil {
+			t.Fatalf("%T: %v", tc.value, err)
+		}
+		if !bytes.Equal(tc.decoded.Marshal(), tc.value.Marshal()) {
+			t.Fatalf("%T: wrong round trip of the versioned format", tc.value)
+		}
+		//a compressed point among uncompressed ones has a wrong size
+		if err := tc.decoded.Unmarshal(append(c, 0)); err == nil {
+			t.Fatalf("%T: wrong size accepted", tc.value)
+		}
+	}
+
+	//the digest, which identifies the presentation, does not depend on its encoding
+	decoded := new(BlindedPresentation)
+	if err := decoded.Unmarshal(p.MarshalCompressed()); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded.Digest(), p.Digest()) {
+		t.Fatal("Digest depends on the encoding")
+	}
+
+	//the points given separately may be compressed or not
+	fromArgs, err := NewBlindedPresentation(scalarToBytes(p.Commitment), p.AttributeCount, p.Certificate.MarshalCompressed(),
+		p.IssuerKey.Marshal(), p.HolderKey.MarshalCompressed(), p.Generator.MarshalCompressed())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := fromArgs.Verify(); err != nil || !ok {
+		t.Fatal("Presentation from compressed points does not verify")
+	}
+	if _, _, err := UnmarshalAccumulator(v.MarshalCompressed(), acc.Q.MarshalCompressed()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wire.Marshal(wire.BlindedPresentation, p.MarshalCompressed()); err != nil {
+		t.Fatal(err)
+	}
+
+	//a compressed point which is not on the curve
+	bad := p.MarshalCompressed()
+	bad[4+scalarLen] = 7
+	if err := decoded.Unmarshal(bad); err != errPresentationG2 {
+		t.Fatalf("Wrong prefix of a compressed point: %v", err)
+	}
+}
+
+//outsideG2 is a point of the twist of bn256 which is not in G2
+const outsideG2 = "0000000000000000000000000000000000000000000000000000000000000003" +
+	"0000000000000000000000000000000000000000000000000000000000000002" +
+	"6a48cf4edaf92dc5dc18b79be57db4155eca171c69a5351a99a8c75cad50286a" +
+	"4b3e6ae54885e14b099193266551bced2befff067e096895bad1cd6cae80a57f"
+
+func TestValueErrors(t *testing.T) {
+	holder, err := GenerateHolderKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outside, _ := hex.DecodeString(outsideG2)
+	offCurve := holder.HolderPublicKey.Marshal()
+	offCurve[127] ^= 1
+	presentation := make([]byte, 4+32+2*64+2*128)
+	presentation[3] = 1
+	copy(presentation[4+32:], outside)
+
+	for _, tc := range []struct {
+		name string
+		err  error
+		kind error
+	}{
+		{"off the curve", new(HolderPublicKey).Unmarshal(offCurve), ErrInvalidPoint},
+		{"outside of G2", new(HolderPublicKey).Unmarshal(outside), ErrInvalidPoint},
+		{"presentation outside of G2", new(BlindedPresentation).Unmarshal(presentation), ErrInvalidPoint},
+		{"size", new(HolderPublicKey).Unmarshal(outside[:100]), ErrInvalidSize},
+		{"scalar", new(HolderKey).Unmarshal(make([]byte, 32)), ErrInvalidScalar},
+	} {
+		if !errors.Is(tc.err, tc.kind) {
+			t.Errorf("%s: %v is not %v", tc.name, tc.err, tc.kind)
+		}
+	}
+}
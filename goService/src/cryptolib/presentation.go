@@ -0,0 +1,172 @@
+package cryptolib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"time"
+
+	"golang.org/x/crypto/bn256"
+)
+
+//presentationProofLen is the size in bytes of the proof of knowledge of the blinding secret whose points have g1 and g2 bytes,
+//without the issuer proof
+func presentationProofLen(g1, g2 int) int {
+	return g1 + g2 + 2*scalarLen
+}
+
+var (
+	errPresentationProofSize = sizeError("Presentation proof has a wrong size")
+	errPresentationProofG1   = pointError("Cannot Unmarshal G1 point of the presentation proof")
+	errPresentationProofG2   = pointError("Cannot Unmarshal G2 point of the presentation proof")
+)
+
+//PresentationProof proves that the presenter of a BlindedPresentation knows the blinding factor b and the blinded private key b*privUser,
+//without revealing them. It is a Schnorr proof in G1 for the blinded generator b*G and one in G2 for the blinded key b*pubG2User,
+//bound to the nonce of the verifier so that a presentation cannot be replayed.
+type PresentationProof struct {
+	//AFactor is wb*G
+	AFactor *bn256.G1
+	//AKey is wk*G2
+	AKey *bn256.G2
+	//SFactor is wb + e*b [Order]
+	SFactor *big.Int
+	//SKey is wk + e*b*privUser [Order]
+	SKey *big.Int
+	//Issuer proves that the blinded issuer key is derived from the key of the CP, see BlindedPresentation.VerifyIssuer
+	Issuer *IssuerProof
+}
+
+//presentationChallenge computes the Fiat-Shamir challenge of the presentation proof.
+//Each field is prefixed by its length.
+func presentationChallenge(p *BlindedPresentation, AFactor *bn256.G1, AKey *bn256.G2, nonce []byte, context []byte) *big.Int {
+	defer observe(PrimitiveHash, time.Now())
+	h := sha256.New()
+	fields := [][]byte{
+		[]byte("presentation"),
+		p.Marshal(),
+		AFactor.Marshal(),
+		AKey.Marshal(),
+		nonce,
+		context,
+	}
+	for _, field := range fields {
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], uint32(len(field)))
+		h.Write(size[:])
+		h.Write(field)
+	}
+	e := new(big.Int).SetBytes(h.Sum(nil))
+	return e.Mod(e, bn256.Order)
+}
+
+//Present blinds the credential and proves the knowledge of the blinding secret for the session (nonce, context) of the verifier,
+//and that the blinded issuer key is derived from the key of issuer.
+//Unlike Blind, the blinding secret is not returned: only the presentation and the proof are meant to be sent.
+func (k *HolderKey) Present(r io.Reader, c *Credential, issuer *IssuerPublicKey, nonce []byte, context []byte) (*BlindedPresentation, *PresentationProof, error) {
+	p, secret, err := k.Blind(r, c, issuer)
+	if err != nil {
+		return nil, nil, err
+	}
+	wFactor, err := randomScalar(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	wKey, err := randomScalar(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	proof := &PresentationProof{
+		AFactor: g1BaseMult(wFactor),
+		AKey:    g2BaseMult(wKey),
+	}
+	e := presentationChallenge(p, proof.AFactor, proof.AKey, nonce, context)
+
+	proof.SFactor = new(big.Int).Mul(e, secret.Factor)
+	proof.SFactor.Add(proof.SFactor, wFactor)
+	proof.SFactor.Mod(proof.SFactor, bn256.Order)
+
+	proof.SKey = new(big.Int).Mul(e, secret.HolderKey)
+	proof.SKey.Add(proof.SKey, wKey)
+	proof.SKey.Mod(proof.SKey, bn256.Order)
+
+	if proof.Issuer, err = secret.ProveIssuer(r, p, issuer, nonce, context); err != nil {
+		return nil, nil, err
+	}
+	return p, proof, nil
+}
+
+//VerifyPresentation verifies the blinded certificate and the proof of knowledge of its blinding secret for the session (nonce, context)
+//ie SFactor*G == AFactor + e*(b*G) and SKey*G2 == AKey + e*(b*pubG2User)
+func (p *BlindedPresentation) VerifyPresentation(proof *PresentationProof, nonce []byte, context []byte) (bool, error) {
+	ok, err := p.Verify()
+	if err != nil || !ok {
+		return false, err
+	}
+	e := presentationChallenge(p, proof.AFactor, proof.AKey, nonce, context)
+
+	leftG1 := g1BaseMult(proof.SFactor)
+	rightG1 := g1Mult(p.Generator, e)
+	rightG1.Add(rightG1, proof.AFactor)
+	if !bytes.Equal(leftG1.Marshal(), rightG1.Marshal()) {
+		return false, nil
+	}
+
+	leftG2 := g2BaseMult(proof.SKey)
+	rightG2 := g2Mult(p.HolderKey, e)
+	rightG2.Add(rightG2, proof.AKey)
+	return bytes.Equal(leftG2.Marshal(), rightG2.Marshal()), nil
+}
+
+//fullPresentationProofLen is the size of a marshalled presentation proof, with its issuer proof
+func fullPresentationProofLen(g1, g2 int) int {
+	return presentationProofLen(g1, g2) + issuerProofLen(g1, g2)
+}
+
+//Marshal returns AFactor (64 bytes) || AKey (128 bytes) || SFactor (32 bytes) || SKey (32 bytes) || Issuer (160 bytes)
+func (proof *PresentationProof) Marshal() []byte {
+	return proof.marshal(false)
+}
+
+//MarshalCompressed returns the proof like Marshal, with compressed points: 260 bytes instead of 416
+func (proof *PresentationProof) MarshalCompressed() []byte {
+	return proof.marshal(true)
+}
+
+func (proof *PresentationProof) marshal(compressed bool) []byte {
+	res := make([]byte, 0, fullPresentationProofLen(g1Len, g2Len))
+	res = append(res, marshalG1(proof.AFactor, compressed)...)
+	res = append(res, marshalG2(proof.AKey, compressed)...)
+	res = append(res, scalarToBytes(proof.SFactor)...)
+	res = append(res, scalarToBytes(proof.SKey)...)
+	return append(res, proof.Issuer.marshal(compressed)...)
+}
+
+//Unmarshal sets proof to the presentation proof m, the output of Marshal or of MarshalCompressed
+func (proof *PresentationProof) Unmarshal(m []byte) error {
+	g1, g2, ok := pointLens(len(m), fullPresentationProofLen)
+	if !ok {
+		return errPresentationProofSize
+	}
+	end := presentationProofLen(g1, g2)
+	issuer := new(IssuerProof)
+	if err := issuer.Unmarshal(m[end:]); err != nil {
+		return err
+	}
+	AFactor, ok := unmarshalG1(m[:g1])
+	if !ok {
+		return errPresentationProofG1
+	}
+	AKey, ok := unmarshalG2(m[g1 : g1+g2])
+	if !ok {
+		return errPresentationProofG2
+	}
+	proof.AFactor = AFactor
+	proof.AKey = AKey
+	proof.SFactor = new(big.Int).SetBytes(m[g1+g2 : g1+g2+scalarLen])
+	proof.SKey = new(big.Int).SetBytes(m[g1+g2+scalarLen : end])
+	proof.Issuer = issuer
+	return nil
+}
@@ -0,0 +1,338 @@
+package cryptolib
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"time"
+)
+
+var (
+	errRangeBitLen    = errors.New("Bit length of the range must be between 1 and 64")
+	errValueOutRange  = errors.New("Value minus threshold is not in the range [0, 2^bitLen)")
+	errRangeProofSize = sizeError("Range proof has a wrong size")
+	errRangePoint     = pointError("Point of the range proof is not on the curve")
+	errRangeIndex     = errors.New("Index of the attribute is not in the commitment")
+	errRangeAttribute = errors.New("Attribute of the range proof is not an integer attribute")
+)
+
+//scalarSize returns the number of bytes used to write a scalar of the group
+func scalarSize(c elliptic.Curve) int {
+	return (c.Params().N.BitLen() + 7) / 8
+}
+
+//pointSize returns the number of bytes of an uncompressed point
+func pointSize(c elliptic.Curve) int {
+	return 1 + 2*((c.Params().BitSize+7)/8)
+}
+
+//scalarBytes writes k mod N on exactly scalarSize bytes
+func scalarBytes(c elliptic.Curve, k *big.Int) []byte {
+	res := make([]byte, scalarSize(c))
+	new(big.Int).Mod(k, c.Params().N).FillBytes(res)
+	return res
+}
+
+//negY returns the opposite of the point (x, y)
+func negY(c elliptic.Curve, x *big.Int, y *big.Int) (*big.Int, *big.Int) {
+	if y.Sign() == 0 {
+		return x, y
+	}
+	return x, new(big.Int).Sub(c.Params().P, y)
+}
+
+//rangeChallenge computes a Fiat-Shamir challenge of the range proof. It binds the generators, the commitment, the index
+//of the attribute, the threshold and the session of the verifier, then the fields of the step. Each field is prefixed by its length.
+func rangeChallenge(secretPub *ecdsa.PublicKey, gen []ecdsa.PublicKey, commit []byte, index int, threshold *big.Int, nonce []byte, context []byte, step ...[]byte) *big.Int {
+	defer observe(PrimitiveHash, time.Now())
+	c := secretPub.Curve
+	var indexByte [4]byte
+	binary.BigEndian.PutUint32(indexByte[:], uint32(index))
+	fields := [][]byte{
+		[]byte(c.Params().Name),
+		elliptic.Marshal(c, secretPub.X, secretPub.Y),
+	}
+	for i := range gen {
+		fields = append(fields, elliptic.Marshal(c, gen[i].X, gen[i].Y))
+	}
+	fields = append(fields, commit, indexByte[:], scalarBytes(c, threshold), nonce, context)
+	fields = append(fields, step...)
+
+	h := sha256.New()
+	for _, field := range fields {
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], uint32(len(field)))
+		h.Write(size[:])
+		h.Write(field)
+	}
+	e := new(big.Int).SetBytes(h.Sum(nil))
+	return e.Mod(e, c.Params().N)
+}
+
+//GenerateRangeProof proves that the integer attribute index of a commitment computed by Commit is greater or equal to threshold
+/*
+ * message, secretPub, gen and r are the inputs given to Commit, message[index] is written by IntegerAttribute
+ * commit is the commitment returned by Commit
+ * threshold is the lower bound chosen by the verifier
+ * bitLen is the size of the range: value - threshold must be in [0, 2^bitLen)
+ * nonce is the challenge sent by the verifier for this session
+ * context is the application context the proof is computed for
+ *
+ * value - threshold is decomposed in bits b_j, each bit is committed as C_j = b_j*Gk + r_j*H with the generators
+ * of the attribute and of the random, and an OR proof shows that C_j is a commitment to 0 or to 1.
+ * With V = sum(2^j*C_j) and rho = sum(2^j*r_j), D = commit - V - threshold*Gk = (r - rho)*H + sum of H(mi)*Gi for i != k,
+ * and a proof of the opening of D shows that the value of V is the one of the attribute, without revealing any attribute.
+ *
+ * The function output the proof: for each bit, C_j || e0 || e1 || z0 || z1, then A || s_r || s_i for each i != k in increasing order
+ */
+func GenerateRangeProof(message [][]byte, secretPub *ecdsa.PublicKey, gen []ecdsa.PublicKey, r []byte, commit []byte, index int, threshold *big.Int, bitLen int, nonce []byte, context []byte) ([]byte, error) {
+	if len(message) != len(gen) {
+		return nil, errMessageOrGeneratorSize
+	}
+	if index < 0 || index >= len(gen) {
+		return nil, errRangeIndex
+	}
+	if bitLen < 1 || bitLen > 64 {
+		return nil, errRangeBitLen
+	}
+	value, ok := integerAttribute(message[index])
+	if !ok {
+		return nil, errRangeAttribute
+	}
+	c := secretPub.Curve
+	n := c.Params().N
+	diff := new(big.Int).Sub(new(big.Int).SetUint64(value), threshold)
+	if diff.Sign() < 0 || diff.BitLen() > bitLen {
+		return nil, errValueOutRange
+	}
+	g := &gen[index]
+	h := secretPub
+
+	proof := make([]byte, 0, bitLen*(pointSize(c)+4*scalarSize(c))+pointSize(c)+len(gen)*scalarSize(c))
+	bitCommitments := make([][]byte, bitLen)
+	rho := new(big.Int)
+	for j := 0; j < bitLen; j++ {
+		bit := diff.Bit(j)
+		rj, err := rand.Int(rand.Reader, n)
+		if err != nil {
+			return nil, err
+		}
+		rho.Add(rho, new(big.Int).Lsh(rj, uint(j)))
+
+		//C_j = b_j*Gk + r_j*H
+		cx, cy := scalarMult(c, h.X, h.Y, scalarBytes(c, rj))
+		if bit == 1 {
+			cx, cy = c.Add(cx, cy, g.X, g.Y)
+		}
+		bitCommitments[j] = elliptic.Marshal(c, cx, cy)
+
+		//P_0 = C_j and P_1 = C_j - Gk, the prover knows the discrete log in base H of P_bit
+		px := [2]*big.Int{cx, nil}
+		py := [2]*big.Int{cy, nil}
+		gx, gy := negY(c, g.X, g.Y)
+		px[1], py[1] = c.Add(cx, cy, gx, gy)
+
+		//simulate the proof of the other branch: A_f = z_f*H - e_f*P_f
+		fake := 1 - bit
+		eFake, err := rand.Int(rand.Reader, n)
+		if err != nil {
+			return nil, err
+		}
+		zFake, err := rand.Int(rand.Reader, n)
+		if err != nil {
+			return nil, err
+		}
+		ax, ay := scalarMult(c, h.X, h.Y, scalarBytes(c, zFake))
+		ex, ey := scalarMult(c, px[fake], py[fake], scalarBytes(c, eFake))
+		ex, ey = negY(c, ex, ey)
+		ax, ay = c.Add(ax, ay, ex, ey)
+
+		//real branch: A_b = k*H
+		k, err := rand.Int(rand.Reader, n)
+		if err != nil {
+			return nil, err
+		}
+		kx, ky := scalarMult(c, h.X, h.Y, scalarBytes(c, k))
+
+		var a [2][]byte
+		a[fake] = elliptic.Marshal(c, ax, ay)
+		a[bit] = elliptic.Marshal(c, kx, ky)
+
+		//e = H(...), e_b = e - e_f and z_b = k + e_b*r_j
+		e := rangeChallenge(secretPub, gen, commit, index, threshold, nonce, context, []byte{byte(j)}, bitCommitments[j], a[0], a[1])
+		eReal := new(big.Int).Sub(e, eFake)
+		eReal.Mod(eReal, n)
+		zReal := new(big.Int).Mul(eReal, rj)
+		zReal.Add(zReal, k)
+		zReal.Mod(zReal, n)
+
+		var eBranch, zBranch [2]*big.Int
+		eBranch[bit], zBranch[bit] = eReal, zReal
+		eBranch[fake], zBranch[fake] = eFake, zFake
+
+		proof = append(proof, bitCommitments[j]...)
+		proof = append(proof, scalarBytes(c, eBranch[0])...)
+		proof = append(proof, scalarBytes(c, eBranch[1])...)
+		proof = append(proof, scalarBytes(c, zBranch[0])...)
+		proof = append(proof, scalarBytes(c, zBranch[1])...)
+	}
+
+	//the secrets of D are r - rho then the other attributes, with their generators
+	hashedMessage := messageToHash(message)
+	secret := new(big.Int).Sub(new(big.Int).SetBytes(r), rho)
+	secrets := []*big.Int{secret.Mod(secret, n)}
+	bases := []*ecdsa.PublicKey{h}
+	for i := range gen {
+		if i != index {
+			secrets = append(secrets, new(big.Int).SetBytes(hashedMessage[i]))
+			bases = append(bases, &gen[i])
+		}
+	}
+
+	//A = k_r*H + sum of k_i*Gi
+	nonces := make([]*big.Int, len(secrets))
+	var Ax, Ay *big.Int
+	for i := range nonces {
+		k, err := rand.Int(rand.Reader, n)
+		if err != nil {
+			return nil, err
+		}
+		nonces[i] = k
+		x, y := scalarMult(c, bases[i].X, bases[i].Y, scalarBytes(c, k))
+		if i == 0 {
+			Ax, Ay = x, y
+		} else {
+			Ax, Ay = c.Add(Ax, Ay, x, y)
+		}
+	}
+	AByte := elliptic.Marshal(c, Ax, Ay)
+	e := rangeChallenge(secretPub, gen, commit, index, threshold, nonce, context, append(bitCommitments, AByte)...)
+
+	proof = append(proof, AByte...)
+	for i := range secrets {
+		s := new(big.Int).Mul(e, secrets[i])
+		s.Add(s, nonces[i])
+		proof = append(proof, scalarBytes(c, s)...)
+	}
+	return proof, nil
+}
+
+//VerifyRangeProof verifies that the integer attribute index of commit is greater or equal to threshold
+/*
+ * secretPub and gen are the generators used to compute the commitment
+ * commit is the commitment
+ * index is the index of the integer attribute
+ * threshold is the lower bound chosen by the verifier
+ * proof is the proof computed by GenerateRangeProof
+ * nonce and context are the session of the verifier
+ */
+func VerifyRangeProof(secretPub *ecdsa.PublicKey, gen []ecdsa.PublicKey, commit []byte, index int, threshold *big.Int, proof []byte, nonce []byte, context []byte) (bool, error) {
+	if index < 0 || index >= len(gen) {
+		return false, errRangeIndex
+	}
+	c := secretPub.Curve
+	n := c.Params().N
+	ps := pointSize(c)
+	ss := scalarSize(c)
+	itemSize := ps + 4*ss
+	openingSize := ps + len(gen)*ss
+	if len(proof) <= openingSize || (len(proof)-openingSize)%itemSize != 0 {
+		return false, errRangeProofSize
+	}
+	bitLen := (len(proof) - openingSize) / itemSize
+	if bitLen > 64 {
+		return false, errRangeBitLen
+	}
+	commitX, commitY := elliptic.Unmarshal(c, commit)
+	if commitX == nil {
+		return false, errRangePoint
+	}
+	g := &gen[index]
+	h := secretPub
+
+	gx, gy := negY(c, g.X, g.Y)
+	bitCommitments := make([][]byte, bitLen)
+	var sumX, sumY *big.Int
+	for j := 0; j < bitLen; j++ {
+		item := proof[j*itemSize : (j+1)*itemSize]
+		bitCommitments[j] = item[:ps]
+		cx, cy := elliptic.Unmarshal(c, bitCommitments[j])
+		if cx == nil {
+			return false, errRangePoint
+		}
+		e0 := item[ps : ps+ss]
+		e1 := item[ps+ss : ps+2*ss]
+		z0 := item[ps+2*ss : ps+3*ss]
+		z1 := item[ps+3*ss:]
+
+		//V = sum(2^j*C_j)
+		wx, wy := scalarMult(c, cx, cy, new(big.Int).Lsh(big.NewInt(1), uint(j)).Bytes())
+		if j == 0 {
+			sumX, sumY = wx, wy
+		} else {
+			sumX, sumY = c.Add(sumX, sumY, wx, wy)
+		}
+
+		//A_0 = z_0*H - e_0*C_j
+		a0x, a0y := scalarMult(c, h.X, h.Y, z0)
+		tx, ty := scalarMult(c, cx, cy, e0)
+		tx, ty = negY(c, tx, ty)
+		a0x, a0y = c.Add(a0x, a0y, tx, ty)
+
+		//A_1 = z_1*H - e_1*(C_j - Gk)
+		p1x, p1y := c.Add(cx, cy, gx, gy)
+		a1x, a1y := scalarMult(c, h.X, h.Y, z1)
+		tx, ty = scalarMult(c, p1x, p1y, e1)
+		tx, ty = negY(c, tx, ty)
+		a1x, a1y = c.Add(a1x, a1y, tx, ty)
+
+		//e_0 + e_1 = H(...)
+		e := rangeChallenge(secretPub, gen, commit, index, threshold, nonce, context, []byte{byte(j)}, bitCommitments[j], elliptic.Marshal(c, a0x, a0y), elliptic.Marshal(c, a1x, a1y))
+		sum := new(big.Int).SetBytes(e0)
+		sum.Add(sum, new(big.Int).SetBytes(e1))
+		sum.Mod(sum, n)
+		if sum.Cmp(e) != 0 {
+			return false, nil
+		}
+	}
+
+	//D = commit - V - threshold*Gk
+	tx, ty := scalarMult(c, g.X, g.Y, scalarBytes(c, threshold))
+	tx, ty = c.Add(tx, ty, sumX, sumY)
+	tx, ty = negY(c, tx, ty)
+	dx, dy := c.Add(commitX, commitY, tx, ty)
+
+	//s_r*H + sum of s_i*Gi == A + e*D
+	opening := proof[bitLen*itemSize:]
+	AByte := opening[:ps]
+	Ax, Ay := elliptic.Unmarshal(c, AByte)
+	if Ax == nil {
+		return false, errRangePoint
+	}
+	e := rangeChallenge(secretPub, gen, commit, index, threshold, nonce, context, append(bitCommitments, AByte)...)
+	bases := []*ecdsa.PublicKey{h}
+	for i := range gen {
+		if i != index {
+			bases = append(bases, &gen[i])
+		}
+	}
+	var leftX, leftY *big.Int
+	for i, base := range bases {
+		x, y := scalarMult(c, base.X, base.Y, opening[ps+i*ss:ps+(i+1)*ss])
+		if i == 0 {
+			leftX, leftY = x, y
+		} else {
+			leftX, leftY = c.Add(leftX, leftY, x, y)
+		}
+	}
+	rightX, rightY := scalarMult(c, dx, dy, e.Bytes())
+	rightX, rightY = c.Add(rightX, rightY, Ax, Ay)
+	if leftX.Cmp(rightX) != 0 || leftY.Cmp(rightY) != 0 {
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,113 @@
+package cryptolib
+
+import (
+	"crypto/elliptic"
+	"crypto/rand"
+	"math/big"
+	"testing"
+)
+
+func TestRangeProof(t *testing.T) {
+	curve := elliptic.P256()
+	h, gen, err := CommitmentGenerators(curve, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	random := make([]byte, 32)
+	rand.Read(random)
+	nonce := []byte("nonce of the CP")
+	context := []byte("age verification")
+
+	for _, age := range []uint64{18, 21, 99} {
+		message := [][]byte{[]byte("FR"), IntegerAttribute(age), []byte("B")}
+		commitment, err := Commit(message, h, gen, random)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proof, err := GenerateRangeProof(message, h, gen, random, commitment, 1, big.NewInt(18), 8, nonce, context)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ok, err := VerifyRangeProof(h, gen, commitment, 1, big.NewInt(18), proof, nonce, context)
+		if err != nil || !ok {
+			t.Fatalf("Range proof does not verify for age %d: %v", age, err)
+		}
+		//the proof is bound to the threshold
+		ok, err = VerifyRangeProof(h, gen, commitment, 1, big.NewInt(17), proof, nonce, context)
+		if err != nil || ok {
+			t.Fatalf("Range proof verifies with another threshold for age %d: %v", age, err)
+		}
+		//to the attribute
+		ok, err = VerifyRangeProof(h, gen, commitment, 0, big.NewInt(18), proof, nonce, context)
+		if err != nil || ok {
+			t.Fatalf("Range proof verifies for another attribute for age %d: %v", age, err)
+		}
+		//to the commitment
+		other, err := Commit([][]byte{[]byte("DE"), IntegerAttribute(age), []byte("B")}, h, gen, random)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ok, err = VerifyRangeProof(h, gen, other, 1, big.NewInt(18), proof, nonce, context)
+		if err != nil || ok {
+			t.Fatalf("Range proof verifies for another commitment for age %d: %v", age, err)
+		}
+		//and to the session of the verifier
+		ok, err = VerifyRangeProof(h, gen, commitment, 1, big.NewInt(18), proof, []byte("another nonce"), context)
+		if err != nil || ok {
+			t.Fatalf("Range proof verifies with another nonce for age %d: %v", age, err)
+		}
+		ok, err = VerifyRangeProof(h, gen, commitment, 1, big.NewInt(18), proof, nonce, []byte("another context"))
+		if err != nil || ok {
+			t.Fatalf("Range proof verifies in another context for age %d: %v", age, err)
+		}
+	}
+
+	message := [][]byte{[]byte("FR"), IntegerAttribute(17), []byte("B")}
+	commitment, err := Commit(message, h, gen, random)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GenerateRangeProof(message, h, gen, random, commitment, 1, big.NewInt(18), 8, nonce, context); err == nil {
+		t.Fatal("Range proof generated for a value under the threshold")
+	}
+	if _, err := GenerateRangeProof(message, h, gen, random, commitment, 0, big.NewInt(0), 8, nonce, context); err == nil {
+		t.Fatal("Range proof generated for an attribute which is not an integer")
+	}
+
+	//a proof for another value of the attribute does not verify: the bits are tied to the commitment
+	proof, err := GenerateRangeProof([][]byte{[]byte("FR"), IntegerAttribute(18), []byte("B")}, h, gen, random, commitment, 1, big.NewInt(18), 8, nonce, context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := VerifyRangeProof(h, gen, commitment, 1, big.NewInt(18), proof, nonce, context); ok {
+		t.Fatal("Range proof verifies for a value which is not committed")
+	}
+}
+
+func TestRangeProofTampered(t *testing.T) {
+	curve := elliptic.P256()
+	h, gen, err := CommitmentGenerators(curve, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	random := make([]byte, 32)
+	rand.Read(random)
+	message := [][]byte{IntegerAttribute(30)}
+	commitment, err := Commit(message, h, gen, random)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proof, err := GenerateRangeProof(message, h, gen, random, commitment, 0, big.NewInt(18), 8, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof[len(proof)-1] ^= 1
+	ok, err := VerifyRangeProof(h, gen, commitment, 0, big.NewInt(18), proof, nil, nil)
+	if err != nil || ok {
+		t.Fatalf("Tampered range proof verifies: %v", err)
+	}
+	if _, err := VerifyRangeProof(h, gen, commitment, 0, big.NewInt(18), proof[1:], nil, nil); err == nil {
+		t.Fatal("Truncated range proof accepted")
+	}
+}
@@ -0,0 +1,82 @@
+package cryptolib
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+var errRemoteCertificate = errors.New("The remote signer refused to issue the certificate")
+
+//RemoteIssuer is an Issuer whose pairing key is kept by a remote signer, another goService with a keystore.
+//Issue posts the commitment to its /CP/generateCertificate route with the ID of the key, and checks the returned
+//certificate against the public key of the CP, so that a remote signer using another key is detected
+type RemoteIssuer struct {
+	//URL is the URL of the /CP/generateCertificate route of the remote signer
+	URL string
+	//KeyID is the ID of the pairing key in the keystore of the remote signer
+	KeyID string
+	//Key is the public key of the CP, registered in the chaincode
+	Key *IssuerPublicKey
+	//Client sends the requests, http.DefaultClient if nil. Its transport authenticates the service to the remote signer
+	Client *http.Client
+}
+
+//Public returns the public key of the CP
+func (i *RemoteIssuer) Public() *IssuerPublicKey {
+	return i.Key
+}
+
+//Issue asks the remote signer for the credential of the holder for the commitment of attributeCount attributes
+func (i *RemoteIssuer) Issue(commitment []byte, attributeCount int, holder *HolderPublicKey) (*Credential, error) {
+	if attributeCount < 1 {
+		return nil, errAttributeCount
+	}
+	type Input struct {
+		Commitment     string `json:"commitment"`
+		AttributeCount int    `json:"attributeCount"`
+		PubG2          string `json:"pubG2User"`
+		KeyID          string `json:"keyID"`
+	}
+	body, _ := json.Marshal(Input{Commitment: hex.EncodeToString(commitment), AttributeCount: attributeCount,
+		PubG2: hex.EncodeToString(holder.Marshal()), KeyID: i.KeyID})
+	client := i.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Post(i.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Remote signer: %s: %s", resp.Status, bytes.TrimSpace(respBody))
+	}
+	var ret struct {
+		Certificate string `json:"certificate"`
+	}
+	if err := json.Unmarshal(respBody, &ret); err != nil {
+		return nil, err
+	}
+	//a remote signer of a previous version answers "false" when it cannot issue the certificate
+	certificate, err := hex.DecodeString(ret.Certificate)
+	if err != nil {
+		return nil, errRemoteCertificate
+	}
+	cred, err := NewCredential(commitment, attributeCount, certificate)
+	if err != nil {
+		return nil, err
+	}
+	if ok, err := cred.Verify(i.Key, holder); err != nil || !ok {
+		return nil, ErrInvalidCertificate
+	}
+	return cred, nil
+}
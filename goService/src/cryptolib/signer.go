@@ -0,0 +1,115 @@
+package cryptolib
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"strings"
+
+	"wire"
+)
+
+var (
+	errSignerPEM   = errors.New("Signer file must contain a PEM \"EC PRIVATE KEY\" or \"PRIVATE KEY\" block")
+	errSignerCurve = errors.New("Signer key must be an ECDSA P-256 key")
+)
+
+//Signer signs the commitments of the users with the ECDSA P-256 key of an identity verifier (IV).
+//The private key may be kept outside of the process, in a HSM for instance
+type Signer interface {
+	//Public returns the public key of the signer
+	Public() *ecdsa.PublicKey
+	//Sign returns the signature (r, s) of the digest of a commitment
+	Sign(r io.Reader, digest []byte) (*big.Int, *big.Int, error)
+}
+
+//Issuer issues the certificates of a certificate provider (CP) with its pairing key.
+//Pairing keys are not supported by HSMs: an Issuer keeps the key in the process, as IssuerKey does, or calls a remote signer
+type Issuer interface {
+	//Public returns the public key of the CP
+	Public() *IssuerPublicKey
+	//Issue generates the credential of the holder for the commitment of attributeCount attributes
+	Issue(commitment []byte, attributeCount int, holder *HolderPublicKey) (*Credential, error)
+}
+
+//Public returns the public key of the CP, so that an IssuerKey is an Issuer
+func (k *IssuerKey) Public() *IssuerPublicKey {
+	return &k.IssuerPublicKey
+}
+
+//MemorySigner is a Signer whose private key is in memory
+type MemorySigner struct {
+	Key *ecdsa.PrivateKey
+}
+
+//NewMemorySigner generates a signer with a new P-256 key, for the tests and the demos
+func NewMemorySigner(r io.Reader) (*MemorySigner, error) {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), r)
+	if err != nil {
+		return nil, err
+	}
+	return &MemorySigner{Key: k}, nil
+}
+
+//Public returns the public key of the signer
+func (s *MemorySigner) Public() *ecdsa.PublicKey {
+	return &s.Key.PublicKey
+}
+
+//Sign returns the ECDSA signature of digest
+func (s *MemorySigner) Sign(r io.Reader, digest []byte) (*big.Int, *big.Int, error) {
+	return ecdsa.Sign(r, s.Key, digest)
+}
+
+//LoadFileSigner reads the P-256 key of a signer from a PEM file, in the SEC 1 ("EC PRIVATE KEY") or PKCS #8 ("PRIVATE KEY") form,
+//as written by openssl ecparam -name prime256v1 -genkey
+func LoadFileSigner(path string) (*MemorySigner, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			return nil, errSignerPEM
+		}
+		var k interface{}
+		switch block.Type {
+		case "EC PRIVATE KEY":
+			k, err = x509.ParseECPrivateKey(block.Bytes)
+		case "PRIVATE KEY":
+			k, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		default:
+			//openssl writes the parameters of the curve before the key
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		ec, ok := k.(*ecdsa.PrivateKey)
+		if !ok || ec.Curve != elliptic.P256() {
+			return nil, errSignerCurve
+		}
+		return &MemorySigner{Key: ec}, nil
+	}
+}
+
+//LoadFileIssuer reads the pairing key of a CP from a file containing its hexadecimal form, like the privCP of /CP/generateCertificate
+func LoadFileIssuer(path string) (*IssuerKey, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := wire.Parse(strings.TrimSpace(string(b)), wire.IssuerKey)
+	if err != nil {
+		return nil, err
+	}
+	k := new(IssuerKey)
+	return k, k.Unmarshal(m)
+}
@@ -0,0 +1,147 @@
+package cryptolib
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+//testSigner checks that the signatures of s verify with its public key
+func testSigner(t *testing.T, s Signer) {
+	digest := sha256.Sum256([]byte("commitment"))
+	r, sig, err := s.Sign(rand.Reader, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ecdsa.Verify(s.Public(), digest[:], r, sig) {
+		t.Fatalf("%T: signature does not verify", s)
+	}
+}
+
+func TestSigner(t *testing.T) {
+	memory, err := NewMemorySigner(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSigner(t, memory)
+
+	dir := t.TempDir()
+	sec1, err := x509.MarshalECPrivateKey(memory.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(memory.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string][]byte{
+		//openssl ecparam -genkey writes the parameters of the curve first
+		"sec1.pem":  append(pem.EncodeToMemory(&pem.Block{Type: "EC PARAMETERS", Bytes: oidP256}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1})...),
+		"pkcs8.pem": pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}),
+	} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, content, 0600); err != nil {
+			t.Fatal(err)
+		}
+		s, err := LoadFileSigner(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if s.Key.D.Cmp(memory.Key.D) != 0 {
+			t.Fatalf("%s: wrong key", name)
+		}
+		testSigner(t, s)
+	}
+	path := filepath.Join(dir, "cert.pem")
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte{1}}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFileSigner(path); err != errSignerPEM {
+		t.Fatalf("File without key: %v", err)
+	}
+
+	issuer, err := GenerateIssuerKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path = filepath.Join(dir, "cp.key")
+	if err := ioutil.WriteFile(path, []byte(hex.EncodeToString(issuer.Marshal())+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadFileIssuer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.D.Cmp(issuer.D) != 0 {
+		t.Fatal("Wrong issuer key loaded from the file")
+	}
+}
+
+func TestRemoteIssuer(t *testing.T) {
+	issuer, err := GenerateIssuerKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := GenerateIssuerKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	holder, err := GenerateHolderKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//the remote signer answers like /CP/generateCertificate, with the key of its keystore
+	remoteKeys := map[string]*IssuerKey{"cp": issuer, "other": other}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in struct {
+			Commitment     string `json:"commitment"`
+			AttributeCount int    `json:"attributeCount"`
+			PubG2          string `json:"pubG2User"`
+			KeyID          string `json:"keyID"`
+		}
+		json.NewDecoder(r.Body).Decode(&in)
+		k := remoteKeys[in.KeyID]
+		if k == nil {
+			http.Error(w, "keystore: unknown key", http.StatusNotFound)
+			return
+		}
+		commitment, _ := hex.DecodeString(in.Commitment)
+		pub, _ := hex.DecodeString(in.PubG2)
+		var h HolderPublicKey
+		h.Unmarshal(pub)
+		cred, _ := k.Issue(commitment, in.AttributeCount, &h)
+		json.NewEncoder(w).Encode(map[string]string{"certificate": hex.EncodeToString(cred.Certificate.Marshal())})
+	}))
+	defer server.Close()
+
+	var remote Issuer = &RemoteIssuer{URL: server.URL, KeyID: "cp", Key: &issuer.IssuerPublicKey}
+	commitment := []byte("commitment of the attributes")
+	cred, err := remote.Issue(commitment, 2, &holder.HolderPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, _ := issuer.Issue(commitment, 2, &holder.HolderPublicKey)
+	if !bytes.Equal(cred.Certificate.Marshal(), local.Certificate.Marshal()) {
+		t.Fatal("Remote certificate differs from the local one")
+	}
+
+	//a certificate issued with another key than the registered one is refused
+	wrongKey := &RemoteIssuer{URL: server.URL, KeyID: "other", Key: &issuer.IssuerPublicKey}
+	if _, err := wrongKey.Issue(commitment, 2, &holder.HolderPublicKey); err != ErrInvalidCertificate {
+		t.Fatalf("Certificate of another key: %v", err)
+	}
+	unknown := &RemoteIssuer{URL: server.URL, KeyID: "unknown", Key: &issuer.IssuerPublicKey}
+	if _, err := unknown.Issue(commitment, 2, &holder.HolderPublicKey); err == nil {
+		t.Fatal("Error of the remote signer ignored")
+	}
+}
@@ -0,0 +1,153 @@
+package cryptolib
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"testing"
+
+	"golang.org/x/crypto/bn256"
+)
+
+//chaincodeVectors is the file in which TestChaincodeVectors writes the presentations used by the tests of the aav chaincode:
+//  go test -run TestChaincodeVectors -chaincode-vectors ../../../blockchain/chaincode/aav/go/testdata/vectors.json
+var chaincodeVectors = flag.String("chaincode-vectors", "", "file in which the test vectors of the aav chaincode are written")
+
+//presentationVector contains the arguments of verify for a presentation, hex encoded
+type presentationVector struct {
+	ChallengeTxID   string `json:"challengeTxID"` //transaction of issueChallenge whose nonce is bound into the issuer proof
+	Nonce           string `json:"nonce"`
+	Commitment      string `json:"blindCommitment"`
+	Certificate     string `json:"blindCertificate"`
+	IssuerKey       string `json:"blindPubG1CP"`
+	HolderKey       string `json:"blindPubG2User"`
+	Generator       string `json:"blindGenerator"`
+	AttributeCount  int    `json:"attributeCount"`
+	IssuerProof     string `json:"issuerProof"`
+	MembershipProof string `json:"membershipProof"`
+}
+
+//chaincodeVectorSet is a CP with an accumulator, a valid presentation and a presentation of a revoked certificate
+type chaincodeVectorSet struct {
+	Issuer      string `json:"issuer"`      //pubG1CP of the CP
+	OtherIssuer string `json:"otherIssuer"` //pubG1CP of another CP
+	Context     string `json:"context"`     //context of the challenges
+	Accumulator struct {
+		PublicKey    string `json:"publicKey"`
+		Value        string `json:"value"`        //initial value
+		Revoked      string `json:"revoked"`      //handle of the revoked certificate
+		UpdatedValue string `json:"updatedValue"` //value once it is revoked
+	} `json:"accumulator"`
+	Valid   presentationVector `json:"valid"`
+	Revoked presentationVector `json:"revoked"`
+}
+
+//challengeNonce returns the nonce issued by the issueChallenge function of the chaincode in the transaction txID
+func challengeNonce(txID string) []byte {
+	nonce := sha256.Sum256([]byte("challenge" + txID))
+	return nonce[:]
+}
+
+func TestChaincodeVectors(t *testing.T) {
+	issuer, err := GenerateIssuerKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := GenerateIssuerKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc, v0, err := GenerateAccumulatorKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var set chaincodeVectorSet
+	set.Issuer = hex.EncodeToString(issuer.IssuerPublicKey.G1.Marshal())
+	set.OtherIssuer = hex.EncodeToString(other.IssuerPublicKey.G1.Marshal())
+	set.Context = "age verification"
+	set.Accumulator.PublicKey = hex.EncodeToString(acc.Q.Marshal())
+	set.Accumulator.Value = hex.EncodeToString(v0.Marshal())
+
+	//two holders, the certificate of the second one is revoked
+	var holders []*HolderKey
+	var credentials []*Credential
+	var witnesses []*bn256.G1
+	for i := 0; i < 2; i++ {
+		holder, err := GenerateHolderKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := issuer.Issue([]byte{byte(i), 'c'}, 2, &holder.HolderPublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, err := acc.Witness(RevocationHandle(c.Commitment), v0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		holders = append(holders, holder)
+		credentials = append(credentials, c)
+		witnesses = append(witnesses, w)
+	}
+	revoked := RevocationHandle(credentials[1].Commitment)
+	v1, err := acc.Revoke(revoked, v0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	witnesses[0], err = UpdateWitness(witnesses[0], RevocationHandle(credentials[0].Commitment), revoked, v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set.Accumulator.Revoked = hex.EncodeToString(revoked.Bytes())
+	set.Accumulator.UpdatedValue = hex.EncodeToString(v1.Marshal())
+
+	for i, vector := range []*presentationVector{&set.Valid, &set.Revoked} {
+		vector.ChallengeTxID = []string{"challenge-valid", "challenge-revoked"}[i]
+		nonce := challengeNonce(vector.ChallengeTxID)
+		p, s, err := holders[i].Blind(rand.Reader, credentials[i], &issuer.IssuerPublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proof, err := s.ProveIssuer(rand.Reader, p, &issuer.IssuerPublicKey, nonce, []byte(set.Context))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := s.BlindWitness(witnesses[i], v1, acc.Q)
+
+		//only the certificate which is not revoked is a member of the updated accumulator
+		if ok, err := p.Verify(); err != nil || !ok {
+			t.Fatal("Blinded presentation does not verify")
+		}
+		if !p.VerifyIssuer(proof, &issuer.IssuerPublicKey, nonce, []byte(set.Context)) {
+			t.Fatal("Issuer proof does not verify")
+		}
+		if p.VerifyMembership(m, v1, acc.Q) != (i == 0) {
+			t.Fatalf("Wrong membership of presentation %d", i)
+		}
+
+		vector.Nonce = hex.EncodeToString(nonce)
+		vector.Commitment = hex.EncodeToString(scalarToBytes(p.Commitment))
+		vector.Certificate = hex.EncodeToString(p.Certificate.Marshal())
+		vector.IssuerKey = hex.EncodeToString(p.IssuerKey.Marshal())
+		vector.HolderKey = hex.EncodeToString(p.HolderKey.Marshal())
+		vector.Generator = hex.EncodeToString(p.Generator.Marshal())
+		vector.AttributeCount = p.AttributeCount
+		vector.IssuerProof = hex.EncodeToString(proof.Marshal())
+		vector.MembershipProof = hex.EncodeToString(m.Marshal())
+	}
+
+	if *chaincodeVectors == "" {
+		return
+	}
+	b, err := json.MarshalIndent(&set, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(*chaincodeVectors, append(b, '\n'), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
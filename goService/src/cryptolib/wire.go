@@ -0,0 +1,232 @@
+package cryptolib
+
+import "wire"
+
+//marshalWire encodes the binary form m of a value of type t in the versioned format of the wire package.
+//The Marshal and MarshalCompressed functions always return a binary form of the size of its type
+func marshalWire(t wire.Type, m []byte) []byte {
+	res, _ := wire.Marshal(t, m)
+	return res
+}
+
+//MarshalWire returns the private key in the versioned format
+func (k *IssuerKey) MarshalWire() []byte {
+	return marshalWire(wire.IssuerKey, k.Marshal())
+}
+
+//UnmarshalWire sets k to the private key m, in the versioned format
+func (k *IssuerKey) UnmarshalWire(m []byte) error {
+	payload, err := wire.Unmarshal(m, wire.IssuerKey)
+	if err != nil {
+		return err
+	}
+	return k.Unmarshal(payload)
+}
+
+//MarshalWire returns the public key in the versioned format
+func (k *IssuerPublicKey) MarshalWire() []byte {
+	return marshalWire(wire.IssuerPublicKey, k.Marshal())
+}
+
+//MarshalWireCompressed returns the public key in the versioned format, with compressed points
+func (k *IssuerPublicKey) MarshalWireCompressed() []byte {
+	return marshalWire(wire.IssuerPublicKey, k.MarshalCompressed())
+}
+
+//UnmarshalWire sets k to the public key m, in the versioned format
+func (k *IssuerPublicKey) UnmarshalWire(m []byte) error {
+	payload, err := wire.Unmarshal(m, wire.IssuerPublicKey)
+	if err != nil {
+		return err
+	}
+	return k.Unmarshal(payload)
+}
+
+//MarshalWire returns the private key in the versioned format
+func (k *HolderKey) MarshalWire() []byte {
+	return marshalWire(wire.HolderKey, k.Marshal())
+}
+
+//UnmarshalWire sets k to the private key m, in the versioned format
+func (k *HolderKey) UnmarshalWire(m []byte) error {
+	payload, err := wire.Unmarshal(m, wire.HolderKey)
+	if err != nil {
+		return err
+	}
+	return k.Unmarshal(payload)
+}
+
+//MarshalWire returns the public key in the versioned format
+func (k *HolderPublicKey) MarshalWire() []byte {
+	return marshalWire(wire.HolderPublicKey, k.Marshal())
+}
+
+//MarshalWireCompressed returns the public key in the versioned format, with compressed points
+func (k *HolderPublicKey) MarshalWireCompressed() []byte {
+	return marshalWire(wire.HolderPublicKey, k.MarshalCompressed())
+}
+
+//UnmarshalWire sets k to the public key m, in the versioned format
+func (k *HolderPublicKey) UnmarshalWire(m []byte) error {
+	payload, err := wire.Unmarshal(m, wire.HolderPublicKey)
+	if err != nil {
+		return err
+	}
+	return k.Unmarshal(payload)
+}
+
+//MarshalWire returns the credential in the versioned format
+func (c *Credential) MarshalWire() []byte {
+	return marshalWire(wire.Credential, c.Marshal())
+}
+
+//UnmarshalWire sets c to the credential m, in the versioned format
+func (c *Credential) UnmarshalWire(m []byte) error {
+	payload, err := wire.Unmarshal(m, wire.Credential)
+	if err != nil {
+		return err
+	}
+	return c.Unmarshal(payload)
+}
+
+//MarshalWire returns the blinded presentation in the versioned format
+func (p *BlindedPresentation) MarshalWire() []byte {
+	return marshalWire(wire.BlindedPresentation, p.Marshal())
+}
+
+//MarshalWireCompressed returns the blinded presentation in the versioned format, with compressed points
+func (p *BlindedPresentation) MarshalWireCompressed() []byte {
+	return marshalWire(wire.BlindedPresentation, p.MarshalCompressed())
+}
+
+//UnmarshalWire sets p to the blinded presentation m, in the versioned format
+func (p *BlindedPresentation) UnmarshalWire(m []byte) error {
+	payload, err := wire.Unmarshal(m, wire.BlindedPresentation)
+	if err != nil {
+		return err
+	}
+	return p.Unmarshal(payload)
+}
+
+//MarshalWire returns the blinding secret in the versioned format
+func (s *BlindingSecret) MarshalWire() []byte {
+	return marshalWire(wire.BlindingSecret, s.Marshal())
+}
+
+//UnmarshalWire sets s to the blinding secret m, in the versioned format
+func (s *BlindingSecret) UnmarshalWire(m []byte) error {
+	payload, err := wire.Unmarshal(m, wire.BlindingSecret)
+	if err != nil {
+		return err
+	}
+	return s.Unmarshal(payload)
+}
+
+//MarshalWire returns the proof in the versioned format
+func (proof *PresentationProof) MarshalWire() []byte {
+	return marshalWire(wire.PresentationProof, proof.Marshal())
+}
+
+//MarshalWireCompressed returns the proof in the versioned format, with compressed points
+func (proof *PresentationProof) MarshalWireCompressed() []byte {
+	return marshalWire(wire.PresentationProof, proof.MarshalCompressed())
+}
+
+//UnmarshalWire sets proof to the presentation proof m, in the versioned format
+func (proof *PresentationProof) UnmarshalWire(m []byte) error {
+	payload, err := wire.Unmarshal(m, wire.PresentationProof)
+	if err != nil {
+		return err
+	}
+	return proof.Unmarshal(payload)
+}
+
+//MarshalWire returns the proof in the versioned format
+func (proof *IssuerProof) MarshalWire() []byte {
+	return marshalWire(wire.IssuerProof, proof.Marshal())
+}
+
+//MarshalWireCompressed returns the proof in the versioned format, with compressed points
+func (proof *IssuerProof) MarshalWireCompressed() []byte {
+	return marshalWire(wire.IssuerProof, proof.MarshalCompressed())
+}
+
+//UnmarshalWire sets proof to the issuer proof m, in the versioned format
+func (proof *IssuerProof) UnmarshalWire(m []byte) error {
+	payload, err := wire.Unmarshal(m, wire.IssuerProof)
+	if err != nil {
+		return err
+	}
+	return proof.Unmarshal(payload)
+}
+
+//MarshalWire returns the proof in the versioned format
+func (m *MembershipProof) MarshalWire() []byte {
+	return marshalWire(wire.MembershipProof, m.Marshal())
+}
+
+//MarshalWireCompressed returns the proof in the versioned format, with compressed points
+func (m *MembershipProof) MarshalWireCompressed() []byte {
+	return marshalWire(wire.MembershipProof, m.MarshalCompressed())
+}
+
+//UnmarshalWire sets m to the membership proof b, in the versioned format
+func (m *MembershipProof) UnmarshalWire(b []byte) error {
+	payload, err := wire.Unmarshal(b, wire.MembershipProof)
+	if err != nil {
+		return err
+	}
+	return m.Unmarshal(payload)
+}
+
+//MarshalWire returns the proof in the versioned format
+func (proof *AttributeKeyProof) MarshalWire() []byte {
+	return marshalWire(wire.AttributeKeyProof, proof.Marshal())
+}
+
+//MarshalWireCompressed returns the proof in the versioned format, with compressed points
+func (proof *AttributeKeyProof) MarshalWireCompressed() []byte {
+	return marshalWire(wire.AttributeKeyProof, proof.MarshalCompressed())
+}
+
+//UnmarshalWire sets proof to the attribute key proof m, in the versioned format
+func (proof *AttributeKeyProof) UnmarshalWire(m []byte) error {
+	payload, err := wire.Unmarshal(m, wire.AttributeKeyProof)
+	if err != nil {
+		return err
+	}
+	return proof.Unmarshal(payload)
+}
+
+//MarshalWire returns the proof in the versioned format
+func (proof *AttributeProof) MarshalWire() []byte {
+	return marshalWire(wire.AttributeProof, proof.Marshal())
+}
+
+//MarshalWireCompressed returns the proof in the versioned format, with compressed points
+func (proof *AttributeProof) MarshalWireCompressed() []byte {
+	return marshalWire(wire.AttributeProof, proof.MarshalCompressed())
+}
+
+//UnmarshalWire sets proof to the attribute proof m, in the versioned format
+func (proof *AttributeProof) UnmarshalWire(m []byte) error {
+	payload, err := wire.Unmarshal(m, wire.AttributeProof)
+	if err != nil {
+		return err
+	}
+	return proof.Unmarshal(payload)
+}
+
+//MarshalWire returns the disclosure in the versioned format
+func (d *Disclosure) MarshalWire() []byte {
+	return marshalWire(wire.Disclosure, d.Marshal())
+}
+
+//UnmarshalWire sets d to the disclosure m, in the versioned format
+func (d *Disclosure) UnmarshalWire(m []byte) error {
+	payload, err := wire.Unmarshal(m, wire.Disclosure)
+	if err != nil {
+		return err
+	}
+	return d.Unmarshal(payload)
+}
@@ -0,0 +1,112 @@
+package cryptolib
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+
+	"wire"
+)
+
+//wireValue is an object of cryptolib in its versioned format
+type wireValue interface {
+	Marshal() []byte
+	MarshalWire() []byte
+	UnmarshalWire([]byte) error
+}
+
+func TestWire(t *testing.T) {
+	issuer, err := GenerateIssuerKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	holder, err := GenerateHolderKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred, err := issuer.Issue([]byte("commitment of the attributes"), 2, &holder.HolderPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, secret, err := holder.Blind(rand.Reader, cred, &issuer.IssuerPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, proof, err := holder.Present(rand.Reader, cred, &issuer.IssuerPublicKey, []byte("nonce"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attributes := [][]byte{[]byte("1990-01-31"), []byte("FR")}
+	keyGen, err := DeriveAttributeKeyGenerators(len(attributes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := keyGen.Key(&holder.HolderPublicKey, attributes, []byte("random"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyCred, err := issuer.Issue([]byte("commitment of the attributes"), len(attributes), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, d, err := holder.PresentAttributes(rand.Reader, keyCred, &issuer.IssuerPublicKey, keyGen, attributes, []byte("random"), 1<<1, []byte("nonce"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc, v, err := GenerateAccumulatorKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := acc.Witness(RevocationHandle(cred.Commitment), v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		value, decoded wireValue
+		t              wire.Type
+	}{
+		{issuer, new(IssuerKey), wire.IssuerKey},
+		{&issuer.IssuerPublicKey, new(IssuerPublicKey), wire.IssuerPublicKey},
+		{holder, new(HolderKey), wire.HolderKey},
+		{&holder.HolderPublicKey, new(HolderPublicKey), wire.HolderPublicKey},
+		{cred, new(Credential), wire.Credential},
+		{p, new(BlindedPresentation), wire.BlindedPresentation},
+		{secret, new(BlindingSecret), wire.BlindingSecret},
+		{proof, new(PresentationProof), wire.PresentationProof},
+		{proof.Issuer, new(IssuerProof), wire.IssuerProof},
+		{secret.BlindWitness(w, v, acc.Q), new(MembershipProof), wire.MembershipProof},
+		{d.Proof, new(AttributeProof), wire.AttributeProof},
+		{d, new(Disclosure), wire.Disclosure},
+	} {
+		m := tc.value.MarshalWire()
+		if err := tc.decoded.UnmarshalWire(m); err != nil {
+			t.Fatalf("%v: %v", tc.t, err)
+		}
+		if !bytes.Equal(tc.decoded.Marshal(), tc.value.Marshal()) {
+			t.Fatalf("%v: wrong round trip", tc.t)
+		}
+
+		//the chaincode and the go service accept both forms of the value
+		legacy, err := wire.Parse(hex.EncodeToString(tc.value.Marshal()), tc.t)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded, err := wire.Parse(hex.EncodeToString(m), tc.t)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(legacy, encoded) {
+			t.Fatalf("%v: legacy and versioned forms differ", tc.t)
+		}
+	}
+
+	//the type of the value is checked
+	if err := new(IssuerPublicKey).UnmarshalWire(p.MarshalWire()); err == nil {
+		t.Fatal("Blinded presentation accepted as an issuer key")
+	}
+	if err := new(HolderKey).UnmarshalWire(issuer.MarshalWire()); err == nil {
+		t.Fatal("Issuer key accepted as a holder key")
+	}
+}
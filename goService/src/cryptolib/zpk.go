@@ -3,38 +3,75 @@ package cryptolib
 import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/sha256"
+	"encoding/binary"
 	"math/big"
+	"time"
 )
 
+var (
+	errOpeningProofSize = sizeError("Proof of opening has a wrong size")
+	errOpeningPoint     = pointError("Point of the proof of opening is not on the curve")
+)
+
+//proofChallenge computes the Fiat-Shamir challenge of the proof.
+//It binds the curve, the generator, the public value, the commitment A, the nonce of the verifier and the application context
+//so that a proof computed for a session cannot be replayed in another one. Each field is prefixed by its length.
+func proofChallenge(c elliptic.Curve, generator *ecdsa.PublicKey, pubSecret *ecdsa.PublicKey, A *ecdsa.PublicKey, nonce []byte, context []byte) *big.Int {
+	defer observe(PrimitiveHash, time.Now())
+	h := sha256.New()
+	fields := [][]byte{
+		[]byte(c.Params().Name),
+		elliptic.Marshal(c, generator.X, generator.Y),
+		elliptic.Marshal(c, pubSecret.X, pubSecret.Y),
+		elliptic.Marshal(c, A.X, A.Y),
+		nonce,
+		context,
+	}
+	for _, field := range fields {
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], uint32(len(field)))
+		h.Write(size[:])
+		h.Write(field)
+	}
+	s := new(big.Int).SetBytes(h.Sum(nil))
+	return s.Mod(s, c.Params().N)
+}
+
 //GenerateProof generates a zero knownledge proof for the r value
 /*
  * c is the elliptic curve used
  * w random value to be sure that the proof is unique
  * (x, y) is the public generator known by the participant
  * r the secret value we want to proove the knownledge
+ * nonce is the challenge sent by the verifier for this session
+ * context is the application context the proof is computed for
  *
  * The function output:
  * A random value used to compute and verify the proof
  * The proof
  */
-func GenerateProof(c elliptic.Curve, w []byte, x *big.Int, y *big.Int, r []byte) (*ecdsa.PublicKey, []byte) {
+func GenerateProof(c elliptic.Curve, w []byte, x *big.Int, y *big.Int, r []byte, nonce []byte, context []byte) (*ecdsa.PublicKey, []byte) {
 	//A = w*(x,y)
-	Ax, Ay := c.ScalarMult(x, y, w)
+	Ax, Ay := scalarMult(c, x, y, w)
 	A := ecdsa.PublicKey{Curve: c, X: Ax, Y: Ay}
-	AByte := elliptic.Marshal(c, Ax, Ay)
-	h := sha256.New()
-	h.Write(AByte)
-	//s = H(A)
-	s := h.Sum(nil)
+
+	//pubSecret = r*(x,y)
+	pubX, pubY := scalarMult(c, x, y, r)
+	generator := ecdsa.PublicKey{Curve: c, X: x, Y: y}
+	pubSecret := ecdsa.PublicKey{Curve: c, X: pubX, Y: pubY}
+
+	//s = H(curve, generator, pubSecret, A, nonce, context)
+	sInt := proofChallenge(c, &generator, &pubSecret, &A, nonce, context)
 
 	//t = s*r + w [q]
-	sInt := new(big.Int).SetBytes(s)
 	rInt := new(big.Int).SetBytes(r)
 	wInt := new(big.Int).SetBytes(w)
 
 	t := new(big.Int).Mul(sInt, rInt)
 	t.Add(t, wInt)
+	t.Mod(t, c.Params().N)
 	tByte := t.Bytes()
 
 	return &A, tByte
@@ -46,16 +83,15 @@ func GenerateProof(c elliptic.Curve, w []byte, x *big.Int, y *big.Int, r []byte)
  * A the random value used to compute the proof
  * generator the public generator known by the participant
  * pubSecret the public key multiplied by the random. It has been computed during the proof generation.
+ * nonce the challenge sent by the verifier for this session
+ * context the application context expected by the verifier
  */
-func VerifyProof(c elliptic.Curve, t []byte, A *ecdsa.PublicKey, generator *ecdsa.PublicKey, pubSecret *ecdsa.PublicKey) bool {
-	leftX, leftY := c.ScalarMult(generator.X, generator.Y, t)
+func VerifyProof(c elliptic.Curve, t []byte, A *ecdsa.PublicKey, generator *ecdsa.PublicKey, pubSecret *ecdsa.PublicKey, nonce []byte, context []byte) bool {
+	leftX, leftY := scalarMult(c, generator.X, generator.Y, t)
 
-	AByte := elliptic.Marshal(c, A.X, A.Y)
-	h := sha256.New()
-	h.Write(AByte)
-	s := h.Sum(nil)
+	s := proofChallenge(c, generator, pubSecret, A, nonce, context)
 
-	rightX, rightY := c.ScalarMult(pubSecret.X, pubSecret.Y, s)
+	rightX, rightY := scalarMult(c, pubSecret.X, pubSecret.Y, s.Bytes())
 	rightX, rightY = c.Add(rightX, rightY, A.X, A.Y)
 
 	if leftX.Cmp(rightX) != 0 {
@@ -67,3 +103,137 @@ func VerifyProof(c elliptic.Curve, t []byte, A *ecdsa.PublicKey, generator *ecds
 
 	return true
 }
+
+//openingChallenge computes the challenge of the proof of opening. Like proofChallenge, it binds the generators, the commitment,
+//A, the nonce of the verifier and the application context, each field being prefixed by its length
+func openingChallenge(c elliptic.Curve, secretPub *ecdsa.PublicKey, gen []ecdsa.PublicKey, commit []byte, A []byte, nonce []byte, context []byte) *big.Int {
+	defer observe(PrimitiveHash, time.Now())
+	fields := [][]byte{
+		[]byte("opening"),
+		[]byte(c.Params().Name),
+		elliptic.Marshal(c, secretPub.X, secretPub.Y),
+	}
+	for i := range gen {
+		fields = append(fields, elliptic.Marshal(c, gen[i].X, gen[i].Y))
+	}
+	fields = append(fields, commit, A, nonce, context)
+
+	h := sha256.New()
+	for _, field := range fields {
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], uint32(len(field)))
+		h.Write(size[:])
+		h.Write(field)
+	}
+	e := new(big.Int).SetBytes(h.Sum(nil))
+	return e.Mod(e, c.Params().N)
+}
+
+//GenerateOpeningProof generates a zero knowledge proof of knowledge of the opening of a commitment computed by Commit.
+/*
+ * message, secretPub, gen and r are the inputs given to Commit
+ * commit is the commitment returned by Commit
+ * nonce and context are the session of the verifier
+ *
+ * The proof shows the knowledge of (H(m1), ..., H(mn), r) such that commit = r*secretPub + H(m1)*G1 + ... + H(mn)*Gn
+ * without revealing any of them, neither the points r*secretPub and H(mi)*Gi.
+ *
+ * The function output the proof: A || s_r || s_1 || ... || s_n
+ * with A = k_r*secretPub + k_1*G1 + ... + k_n*Gn, e = H(A, commit, nonce, context, ...) and s_i = k_i + e*m_i [q]
+ */
+func GenerateOpeningProof(message [][]byte, secretPub *ecdsa.PublicKey, gen []ecdsa.PublicKey, r []byte, commit []byte, nonce []byte, context []byte) ([]byte, error) {
+	if len(message) != len(gen) {
+		return nil, errMessageOrGeneratorSize
+	}
+	c := secretPub.Curve
+	n := c.Params().N
+	hashedMessage := messageToHash(message)
+
+	secrets := make([]*big.Int, len(gen)+1)
+	secrets[0] = new(big.Int).SetBytes(r)
+	for i := 0; i < len(gen); i++ {
+		secrets[i+1] = new(big.Int).SetBytes(hashedMessage[i])
+	}
+
+	//A = k_r*secretPub + k_1*G1 + ... + k_n*Gn
+	nonces := make([]*big.Int, len(secrets))
+	var Ax, Ay *big.Int
+	for i := range nonces {
+		k, err := rand.Int(rand.Reader, n)
+		if err != nil {
+			return nil, err
+		}
+		nonces[i] = k
+		base := secretPub
+		if i > 0 {
+			base = &gen[i-1]
+		}
+		x, y := scalarMult(c, base.X, base.Y, scalarBytes(c, k))
+		if i == 0 {
+			Ax, Ay = x, y
+		} else {
+			Ax, Ay = c.Add(Ax, Ay, x, y)
+		}
+	}
+	AByte := elliptic.Marshal(c, Ax, Ay)
+	e := openingChallenge(c, secretPub, gen, commit, AByte, nonce, context)
+
+	proof := AByte
+	for i := range secrets {
+		s := new(big.Int).Mul(e, secrets[i])
+		s.Add(s, nonces[i])
+		proof = append(proof, scalarBytes(c, s)...)
+	}
+	return proof, nil
+}
+
+//VerifyOpeningProof verifies a proof of opening computed by GenerateOpeningProof.
+/*
+ * secretPub and gen are the generators used to compute the commitment
+ * commit is the commitment
+ * proof is the proof of opening
+ * nonce and context are the session of the verifier
+ *
+ * It checks that s_r*secretPub + s_1*G1 + ... + s_n*Gn == A + e*commit
+ */
+func VerifyOpeningProof(secretPub *ecdsa.PublicKey, gen []ecdsa.PublicKey, commit []byte, proof []byte, nonce []byte, context []byte) (bool, error) {
+	c := secretPub.Curve
+	ps := pointSize(c)
+	ss := scalarSize(c)
+	if len(proof) != ps+(len(gen)+1)*ss {
+		return false, errOpeningProofSize
+	}
+	commitX, commitY := elliptic.Unmarshal(c, commit)
+	if commitX == nil {
+		return false, errOpeningPoint
+	}
+	AByte := proof[:ps]
+	Ax, Ay := elliptic.Unmarshal(c, AByte)
+	if Ax == nil {
+		return false, errOpeningPoint
+	}
+	e := openingChallenge(c, secretPub, gen, commit, AByte, nonce, context)
+
+	var leftX, leftY *big.Int
+	for i := 0; i <= len(gen); i++ {
+		s := proof[ps+i*ss : ps+(i+1)*ss]
+		base := secretPub
+		if i > 0 {
+			base = &gen[i-1]
+		}
+		x, y := scalarMult(c, base.X, base.Y, s)
+		if i == 0 {
+			leftX, leftY = x, y
+		} else {
+			leftX, leftY = c.Add(leftX, leftY, x, y)
+		}
+	}
+
+	rightX, rightY := scalarMult(c, commitX, commitY, e.Bytes())
+	rightX, rightY = c.Add(rightX, rightY, Ax, Ay)
+
+	if leftX.Cmp(rightX) != 0 || leftY.Cmp(rightY) != 0 {
+		return false, nil
+	}
+	return true, nil
+}
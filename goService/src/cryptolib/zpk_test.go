@@ -0,0 +1,43 @@
+package cryptolib
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+)
+
+func TestProofBoundToSession(t *testing.T) {
+	curve := elliptic.P256()
+	gen, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := rand.Int(rand.Reader, curve.Params().N)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := rand.Int(rand.Reader, curve.Params().N)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := []byte("nonce of the verifier")
+	context := []byte("/CP/verifyProof/random")
+
+	A, proof := GenerateProof(curve, w.Bytes(), gen.X, gen.Y, secret.Bytes(), nonce, context)
+	pubX, pubY := curve.ScalarMult(gen.X, gen.Y, secret.Bytes())
+	pubSecret := ecdsa.PublicKey{Curve: curve, X: pubX, Y: pubY}
+
+	if !VerifyProof(curve, proof, A, &gen.PublicKey, &pubSecret, nonce, context) {
+		t.Fatal("Proof does not verify")
+	}
+	if VerifyProof(curve, proof, A, &gen.PublicKey, &pubSecret, []byte("another nonce"), context) {
+		t.Fatal("Proof verifies with another nonce")
+	}
+	if VerifyProof(curve, proof, A, &gen.PublicKey, &pubSecret, nonce, []byte("/CP/verifyProof/age")) {
+		t.Fatal("Proof verifies with another context")
+	}
+	if VerifyProof(curve, proof, A, &pubSecret, &gen.PublicKey, nonce, context) {
+		t.Fatal("Proof verifies with another generator")
+	}
+}
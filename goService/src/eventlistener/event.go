@@ -0,0 +1,64 @@
+//Package eventlistener receives the chaincode events of the aav chaincode and forwards them to the webhooks registered by the SPs
+package eventlistener
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+//Names of the events emitted by the aav chaincode, see blockchain/chaincode/aav/go/events.go
+const (
+	AavCreated          = "aav.aavCreated"
+	Verified            = "aav.verified"
+	IssuerRegistered    = "aav.issuerRegistered"
+	IssuerUpdated       = "aav.issuerUpdated"
+	IssuerDeactivated   = "aav.issuerDeactivated"
+	AccumulatorCreated  = "aav.accumulatorCreated"
+	CertificateRevoked  = "aav.certificateRevoked"
+	RoleMSPsUpdated     = "aav.roleMSPsUpdated"
+)
+
+//ErrUnknownEvent is returned when the name of an event is not one of the aav chaincode
+var ErrUnknownEvent = errors.New("eventlistener: unknown event")
+
+//ErrMalformedEvent is returned when the payload of an event cannot be decoded
+var ErrMalformedEvent = errors.New("eventlistener: malformed event payload")
+
+//Event is the payload of a chaincode event
+type Event struct {
+	Type      string `json:"type"`
+	TxID      string `json:"txID"`
+	Timestamp string `json:"timestamp"`
+	Submitter string `json:"submitter"` //MSP ID and client ID of the submitter, the SP for aav.verified
+	Subject   string `json:"subject"`   //aavKey, issuerID, accumulatorID or role, empty for aav.verified
+	Verify    string `json:"verify,omitempty"`
+	Version   int    `json:"version,omitempty"`
+}
+
+//Source delivers the events committed on the channel
+type Source interface {
+	//Events returns the channel of the events. It is closed when ctx is done or when the source stops
+	Events(ctx context.Context) (<-chan Event, error)
+}
+
+//isKnown returns true if name is an event of the aav chaincode
+func isKnown(name string) bool {
+	switch name {
+	case AavCreated, Verified, IssuerRegistered, IssuerUpdated, IssuerDeactivated, AccumulatorCreated, CertificateRevoked, RoleMSPsUpdated:
+		return true
+	}
+	return false
+}
+
+//ParseEvent decodes the payload of the chaincode event name
+func ParseEvent(name string, payload []byte) (Event, error) {
+	var e Event
+	if !isKnown(name) {
+		return e, ErrUnknownEvent
+	}
+	if err := json.Unmarshal(payload, &e); err != nil || e.Type != name || e.TxID == "" {
+		return e, ErrMalformedEvent
+	}
+	return e, nil
+}
@@ -0,0 +1,135 @@
+package eventlistener
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"auth"
+
+	"github.com/gorilla/mux"
+)
+
+//identity returns the identity of the SP calling the route, the one recorded by the chaincode for its verifications
+func identity(w http.ResponseWriter, r *http.Request) (string, bool) {
+	sp, ok := auth.Identity(r)
+	if !ok {
+		http.Error(w, ErrUnauthenticated.Error(), http.StatusForbidden)
+	}
+	return sp, ok
+}
+
+/**
+ * @api {post} /SP/webhooks Register a webhook
+ *
+ * @apiName RegisterWebhook
+ * @apiGroup SP
+ *
+ * @apiDescription Register an URL to which the chaincode events are posted once their transaction is committed.
+ * The body of the post is the event, its name is in the header X-Aav-Event. A post which does not get a 2xx answer is retried 3 times.
+ * An aav.verified event is only posted to the webhooks of the SP which submitted the verification.
+ * The SP of the webhook is the client: its MSP ID and client ID are taken from its certificate, so the service must
+ * authenticate its clients and know their MSP (mspID of AAV_TLS_CONFIG), else the route answers 403
+ *
+ * @apiParam {String} url URL of the webhook, http or https
+ * @apiParam {String} [sp] MSP ID and client ID of the SP, as in the verification records ("Org1MSP/eDUwOTo6..."). If set, it must be the identity of the client
+ * @apiParam {String[]} [types] Events to forward, all of them if empty
+ * @apiParam {String} [secret] Key of the HMAC-SHA256 of the body, sent in the header X-Aav-Signature as "sha256=<hex>"
+ *
+ * @apiParamExample {json} Request-Example:
+ *   {
+ *		"url": "https://sp.example.com/aav/events",
+ *		"sp": "Org1MSP/eDUwOTo6Q049c3Au...",
+ *		"types": ["aav.verified", "aav.issuerDeactivated"],
+ *		"secret": "s3cr3t"
+ *	 }
+ *
+ * @apiSuccess {String} id ID of the webhook, to unregister it
+ *
+ * @apiSuccessExample Success-Response:
+ *	HTTP/1.1 200 OK
+ *		{
+ *	 		"id": "0123ABC...",
+ *	 		"url": "https://sp.example.com/aav/events",
+ *	 		"sp": "Org1MSP/eDUwOTo6Q049c3Au...",
+ *	 		"types": ["aav.verified", "aav.issuerDeactivated"]
+ *		}
+ *
+ */
+func (l *Listener) RegisterWebhook(w http.ResponseWriter, r *http.Request) {
+	sp, ok := identity(w, r)
+	if !ok {
+		return
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	var in Webhook
+	if err := json.Unmarshal(body, &in); err != nil {
+		http.Error(w, ErrInvalidWebhook.Error(), http.StatusBadRequest)
+		return
+	}
+	if in.SP != "" && in.SP != sp {
+		http.Error(w, ErrForeignSP.Error(), http.StatusForbidden)
+		return
+	}
+	in.SP = sp
+	h, err := l.Register(in)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.Secret = ""
+	retByte, _ := json.Marshal(h)
+	w.Header().Set("content-type", "application/json")
+	w.Write(retByte)
+}
+
+/**
+ * @api {get} /SP/webhooks List the webhooks
+ *
+ * @apiName GetWebhooks
+ * @apiGroup SP
+ *
+ * @apiDescription Return the webhooks of the SP calling the route
+ *
+ * @apiSuccessExample Success-Response:
+ *	HTTP/1.1 200 OK
+ *		[{"id": "0123ABC...", "url": "https://sp.example.com/aav/events", "sp": "Org1MSP/eDUwOTo6Q049c3Au..."}]
+ *
+ */
+func (l *Listener) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	sp, ok := identity(w, r)
+	if !ok {
+		return
+	}
+	hooks := l.Webhooks(sp)
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+	retByte, _ := json.Marshal(hooks)
+	w.Header().Set("content-type", "application/json")
+	w.Write(retByte)
+}
+
+/**
+ * @api {delete} /SP/webhooks/:id Unregister a webhook
+ *
+ * @apiName UnregisterWebhook
+ * @apiGroup SP
+ *
+ * @apiDescription A SP only unregisters its own webhooks, the ID of another webhook answers 404
+ *
+ * @apiSuccessExample Success-Response:
+ *	HTTP/1.1 204 No Content
+ *
+ */
+func (l *Listener) UnregisterWebhook(w http.ResponseWriter, r *http.Request) {
+	sp, ok := identity(w, r)
+	if !ok {
+		return
+	}
+	if err := l.Unregister(mux.Vars(r)["id"], sp); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
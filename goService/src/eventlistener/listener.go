@@ -0,0 +1,227 @@
+package eventlistener
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+//ErrInvalidWebhook is returned when a webhook has no SP, no valid http(s) URL or subscribes to an unknown event
+var ErrInvalidWebhook = errors.New("eventlistener: invalid webhook")
+
+//ErrUnknownWebhook is returned when no webhook of the SP has the given ID
+var ErrUnknownWebhook = errors.New("eventlistener: unknown webhook")
+
+//ErrUnauthenticated is returned when the service does not authenticate its clients, or the client has no identity:
+//the webhooks of a SP are only managed by the SP itself, and the events only posted by the orchestrator
+var ErrUnauthenticated = errors.New("eventlistener: the client is not authenticated")
+
+//ErrForeignSP is returned when a SP registers a webhook for another SP
+var ErrForeignSP = errors.New("eventlistener: the SP of the webhook is not the client")
+
+//Webhook is an URL of a SP to which the events are posted
+type Webhook struct {
+	ID     string   `json:"id"`
+	URL    string   `json:"url"`
+	SP     string   `json:"sp"`              //MSP ID and client ID of the SP, it only receives its own aav.verified events
+	Types  []string `json:"types,omitempty"` //events forwarded to the webhook, all of them if empty
+	Secret string   `json:"secret,omitempty"` //if set, the body is signed with HMAC-SHA256 in the header X-Aav-Signature
+}
+
+//matches returns true if the event must be posted to the webhook.
+//A verification is only sent to the SP which submitted it, it must not learn when other SPs verify presentations
+func (h *Webhook) matches(e Event) bool {
+	if e.Type == Verified && e.Submitter != h.SP {
+		return false
+	}
+	if len(h.Types) == 0 {
+		return true
+	}
+	for _, t := range h.Types {
+		if t == e.Type {
+			return true
+		}
+	}
+	return false
+}
+
+//Listener forwards the events of a Source to the registered webhooks
+type Listener struct {
+	source Source
+	client *http.Client
+
+	//Attempts is the number of posts of an event to a webhook before it is dropped
+	Attempts int
+	//Backoff is the delay before the second post, it doubles after each failure
+	Backoff time.Duration
+	//OnDrop, if set, is called with the type of each event dropped for a webhook, for instance to count them
+	OnDrop func(eventType string)
+
+	mu       sync.RWMutex
+	webhooks map[string]Webhook
+	wg       sync.WaitGroup
+}
+
+//NewListener returns a listener of source without webhook
+func NewListener(source Source) *Listener {
+	return &Listener{
+		source:   source,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		Attempts: 3,
+		Backoff:  time.Second,
+		webhooks: make(map[string]Webhook),
+	}
+}
+
+//Register adds a webhook and returns it with its ID
+func (l *Listener) Register(h Webhook) (Webhook, error) {
+	u, err := url.Parse(h.URL)
+	if err != nil || h.SP == "" || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return h, ErrInvalidWebhook
+	}
+	for _, t := range h.Types {
+		if !isKnown(t) {
+			return h, ErrInvalidWebhook
+		}
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return h, err
+	}
+	h.ID = hex.EncodeToString(id)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.webhooks[h.ID] = h
+	return h, nil
+}
+
+//Unregister removes the webhook id of sp
+func (l *Listener) Unregister(id string, sp string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if h, ok := l.webhooks[id]; !ok || h.SP != sp {
+		return ErrUnknownWebhook
+	}
+	delete(l.webhooks, id)
+	return nil
+}
+
+//Webhooks returns the registered webhooks of sp, or all of them if sp is empty
+func (l *Listener) Webhooks(sp string) []Webhook {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	res := []Webhook{}
+	for _, h := range l.webhooks {
+		if sp == "" || h.SP == sp {
+			res = append(res, h)
+		}
+	}
+	return res
+}
+
+//Run forwards the events until ctx is done or the source stops, then waits for the pending posts
+func (l *Listener) Run(ctx context.Context) error {
+	events, err := l.source.Events(ctx)
+	if err != nil {
+		return err
+	}
+	for e := range events {
+		l.dispatch(ctx, e)
+	}
+	l.wg.Wait()
+	return ctx.Err()
+}
+
+//dispatch posts e to every matching webhook, each in its own goroutine so that a slow SP does not delay the others
+func (l *Listener) dispatch(ctx context.Context, e Event) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		log.Println("eventlistener: dropped", e.Type, e.TxID, ":", err)
+		l.dropped(e.Type)
+		return
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, h := range l.webhooks {
+		if !h.matches(e) {
+			continue
+		}
+		l.wg.Add(1)
+		go func(h Webhook) {
+			defer l.wg.Done()
+			if err := l.deliver(ctx, h, e.Type, body); err != nil {
+				log.Println("eventlistener: dropped", e.Type, e.TxID, "for", h.URL, ":", err)
+				l.dropped(e.Type)
+			}
+		}(h)
+	}
+}
+
+//dropped reports an event of eventType dropped for a webhook to OnDrop
+func (l *Listener) dropped(eventType string) {
+	if l.OnDrop != nil {
+		l.OnDrop(eventType)
+	}
+}
+
+//deliver posts body to the webhook until it answers with a 2xx status, at most Attempts times
+func (l *Listener) deliver(ctx context.Context, h Webhook, eventType string, body []byte) error {
+	backoff := l.Backoff
+	var err error
+	for attempt := 0; attempt < l.Attempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			backoff *= 2
+		}
+		if err = l.post(ctx, h, eventType, body); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+//post sends a single request to the webhook
+func (l *Listener) post(ctx context.Context, h Webhook, eventType string, body []byte) error {
+	req, err := http.NewRequest("POST", h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("content-type", "application/json")
+	req.Header.Set("X-Aav-Event", eventType)
+	if h.Secret != "" {
+		req.Header.Set("X-Aav-Signature", "sha256="+Sign(h.Secret, body))
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("eventlistener: webhook answered %d", resp.StatusCode)
+	}
+	return nil
+}
+
+//Sign returns the hex encoded HMAC-SHA256 of body with secret, the SP compares it to the header X-Aav-Signature
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
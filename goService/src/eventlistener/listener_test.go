@@ -0,0 +1,300 @@
+package eventlistener
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"auth"
+
+	"github.com/gorilla/mux"
+)
+
+//receiver is a webhook of a SP, it records the events posted to it
+type receiver struct {
+	mu       sync.Mutex
+	events   []Event
+	failures int //number of posts answered with 503 before accepting them
+	secret   string
+	server   *httptest.Server
+}
+
+func newReceiver(t *testing.T, failures int, secret string) *receiver {
+	rc := &receiver{failures: failures, secret: secret}
+	rc.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		rc.mu.Lock()
+		defer rc.mu.Unlock()
+		if rc.failures > 0 {
+			rc.failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if rc.secret != "" && r.Header.Get("X-Aav-Signature") != "sha256="+Sign(rc.secret, body) {
+			t.Error("Wrong signature of the event")
+		}
+		var e Event
+		if err := json.Unmarshal(body, &e); err != nil || r.Header.Get("X-Aav-Event") != e.Type {
+			t.Errorf("Malformed event: %s", body)
+		}
+		rc.events = append(rc.events, e)
+	}))
+	return rc
+}
+
+func (rc *receiver) received() []Event {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]Event(nil), rc.events...)
+}
+
+func TestListener(t *testing.T) {
+	source := NewMemorySource()
+	l := NewListener(source)
+	l.Backoff = time.Millisecond
+
+	sp1 := newReceiver(t, 2, "s3cr3t")
+	defer sp1.server.Close()
+	sp2 := newReceiver(t, 0, "")
+	defer sp2.server.Close()
+	if _, err := l.Register(Webhook{URL: sp1.server.URL, SP: "SPMSP/sp1", Secret: "s3cr3t"}); err != nil {
+		t.Fatal(err)
+	}
+	hook2, err := l.Register(Webhook{URL: sp2.server.URL, SP: "SPMSP/sp2", Types: []string{Verified}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Register(Webhook{URL: "ftp://sp.example.com", SP: "SPMSP/sp1"}); err != ErrInvalidWebhook {
+		t.Fatal("Webhook with a non http URL accepted")
+	}
+	if _, err := l.Register(Webhook{URL: sp2.server.URL, SP: "SPMSP/sp2", Types: []string{"aav.unknown"}}); err != ErrInvalidWebhook {
+		t.Fatal("Webhook of an unknown event accepted")
+	}
+	if _, err := l.Register(Webhook{URL: sp2.server.URL}); err != ErrInvalidWebhook {
+		t.Fatal("Webhook without SP accepted")
+	}
+	if len(l.Webhooks("SPMSP/sp2")) != 1 || len(l.Webhooks("")) != 2 {
+		t.Fatal("Wrong list of webhooks")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- l.Run(ctx) }()
+	//wait for the subscription, events published before are not delivered
+	for {
+		source.mu.Lock()
+		n := len(source.subs)
+		source.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	source.Publish(Event{Type: Verified, TxID: "tx1", Submitter: "SPMSP/sp1", Verify: "true"})
+	source.Publish(Event{Type: Verified, TxID: "tx2", Submitter: "SPMSP/sp2", Verify: "true"})
+	source.Publish(Event{Type: IssuerDeactivated, TxID: "tx3", Submitter: "AdminMSP/admin", Subject: "cpX"})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(sp1.received()) < 2 || len(sp2.received()) < 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Events not delivered: %v %v", sp1.received(), sp2.received())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatal(err)
+	}
+
+	//sp1 gets its verification, after 2 failed posts, and the deactivation, never the verification of sp2
+	for _, e := range sp1.received() {
+		if e.TxID == "tx2" {
+			t.Fatal("Verification forwarded to another SP")
+		}
+	}
+	if got := sp2.received(); len(got) != 1 || got[0].TxID != "tx2" {
+		t.Fatalf("Wrong events for sp2: %v", got)
+	}
+
+	if err := l.Unregister(hook2.ID, "SPMSP/sp1"); err != ErrUnknownWebhook {
+		t.Fatal("Webhook unregistered by another SP")
+	}
+	if err := l.Unregister(hook2.ID, "SPMSP/sp2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Unregister(hook2.ID, "SPMSP/sp2"); err != ErrUnknownWebhook {
+		t.Fatal("Webhook unregistered twice")
+	}
+}
+
+func TestListenerDropsAfterAttempts(t *testing.T) {
+	source := NewMemorySource()
+	l := NewListener(source)
+	l.Backoff = time.Millisecond
+	var dropped []string
+	l.OnDrop = func(eventType string) {
+		dropped = append(dropped, eventType)
+	}
+	sp := newReceiver(t, 3, "")
+	defer sp.server.Close()
+	if _, err := l.Register(Webhook{URL: sp.server.URL, SP: "SPMSP/sp1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, _ := source.Events(ctx)
+	source.Publish(Event{Type: Verified, TxID: "tx1", Submitter: "SPMSP/sp1", Verify: "true"})
+	l.dispatch(ctx, <-events)
+	l.wg.Wait()
+	cancel()
+	if len(sp.received()) != 0 {
+		t.Fatal("Event delivered after the last attempt")
+	}
+	if sp.failures != 0 {
+		t.Fatalf("%d attempts instead of %d", 3-sp.failures, l.Attempts)
+	}
+	if len(dropped) != 1 || dropped[0] != Verified {
+		t.Fatalf("Dropped events reported: %v", dropped)
+	}
+}
+
+//client calls the handlers behind the authorizer of the service with its certificate, or without authorizer if a is nil
+type client struct {
+	a    *auth.Authorizer
+	cert *x509.Certificate
+}
+
+//newClient returns a client with a certificate of subject, or without certificate if subject is empty
+func newClient(t *testing.T, a *auth.Authorizer, subject pkix.Name) *client {
+	if subject.CommonName == "" {
+		return &client{a: a}
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: subject, NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &client{a: a, cert: cert}
+}
+
+//call serves the request with h and returns the status and the body of the answer
+func (c *client) call(h http.Handler, method string, path string, body string) (int, string) {
+	router := mux.NewRouter()
+	router.Handle("/SP/webhooks/{id}", h)
+	router.PathPrefix("/").Handler(h)
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if c.cert != nil {
+		r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{c.cert}}}
+	}
+	w := httptest.NewRecorder()
+	if c.a == nil {
+		router.ServeHTTP(w, r)
+	} else {
+		c.a.Wrap(router).ServeHTTP(w, r)
+	}
+	return w.Code, w.Body.String()
+}
+
+func TestWebhookHandlers(t *testing.T) {
+	l := NewListener(NewMemorySource())
+	a := auth.NewAuthorizer(nil, nil)
+	a.MSPID = "SPMSP"
+	sp1 := newClient(t, a, pkix.Name{CommonName: "sp1", OrganizationalUnit: []string{"sp"}})
+	sp2 := newClient(t, a, pkix.Name{CommonName: "sp2", OrganizationalUnit: []string{"sp"}})
+	register, list, unregister := http.HandlerFunc(l.RegisterWebhook), http.HandlerFunc(l.GetWebhooks), http.HandlerFunc(l.UnregisterWebhook)
+
+	//the SP of the webhook is the identity of the client, not the one of the body
+	status, body := sp1.call(register, "POST", "/SP/webhooks", `{"url": "https://sp1.example.com/events"}`)
+	var hook1 Webhook
+	if status != http.StatusOK || json.Unmarshal([]byte(body), &hook1) != nil || !strings.HasPrefix(hook1.SP, "SPMSP/") {
+		t.Fatalf("Registration: %d %s", status, body)
+	}
+	if status, _ := sp2.call(register, "POST", "/SP/webhooks", `{"url": "https://sp2.example.com/events", "sp": "`+hook1.SP+`"}`); status != http.StatusForbidden {
+		t.Fatalf("Webhook registered for another SP: %d", status)
+	}
+	if status, _ := sp2.call(register, "POST", "/SP/webhooks", `{"url": "https://sp2.example.com/events"}`); status != http.StatusOK {
+		t.Fatalf("Registration of sp2: %d", status)
+	}
+
+	//each SP only lists and unregisters its own webhooks
+	status, body = sp2.call(list, "GET", "/SP/webhooks?sp="+hook1.SP, "")
+	var hooks []Webhook
+	if status != http.StatusOK || json.Unmarshal([]byte(body), &hooks) != nil || len(hooks) != 1 || hooks[0].SP == hook1.SP {
+		t.Fatalf("Webhooks of sp2: %d %s", status, body)
+	}
+	if status, _ := sp2.call(unregister, "DELETE", "/SP/webhooks/"+hook1.ID, ""); status != http.StatusNotFound {
+		t.Fatalf("Webhook of sp1 unregistered by sp2: %d", status)
+	}
+	if status, _ := sp1.call(unregister, "DELETE", "/SP/webhooks/"+hook1.ID, ""); status != http.StatusNoContent {
+		t.Fatalf("Webhook of sp1 not unregistered: %d", status)
+	}
+
+	//the webhooks are refused when the service does not authenticate its clients, or does not know their MSP
+	anonymous := newClient(t, nil, pkix.Name{})
+	noMSP := newClient(t, auth.NewAuthorizer(nil, nil), pkix.Name{CommonName: "sp1", OrganizationalUnit: []string{"sp"}})
+	for _, c := range []*client{anonymous, noMSP} {
+		for _, h := range []http.Handler{register, list, unregister} {
+			if status, _ := c.call(h, "POST", "/SP/webhooks/x", `{"url": "https://sp1.example.com/events"}`); status != http.StatusForbidden {
+				t.Fatalf("Webhooks without identity: %d", status)
+			}
+		}
+	}
+	if len(l.Webhooks("")) != 1 {
+		t.Fatal("Wrong list of webhooks")
+	}
+}
+
+func TestRelay(t *testing.T) {
+	relay := NewRelay()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, _ := relay.Events(ctx)
+	orchestrator := newClient(t, auth.NewAuthorizer(nil, nil), pkix.Name{CommonName: "orchestrator", OrganizationalUnit: []string{"orchestrator"}})
+
+	payload, _ := json.Marshal(Event{Type: CertificateRevoked, TxID: "tx1", Submitter: "CPMSP/cp", Subject: "cp1", Version: 1})
+	body, _ := json.Marshal(map[string]string{"eventName": CertificateRevoked, "payload": string(payload)})
+	if status, _ := newClient(t, nil, pkix.Name{}).call(relay, "POST", "/events", string(body)); status != http.StatusForbidden {
+		t.Fatalf("Event relayed without authentication: %d", status)
+	}
+	if status, body := orchestrator.call(relay, "POST", "/events", string(body)); status != http.StatusAccepted {
+		t.Fatal(body)
+	}
+	if e := <-events; e.Subject != "cp1" || e.Version != 1 {
+		t.Fatalf("Wrong event relayed: %v", e)
+	}
+
+	//the name must be an event of the chaincode and match the payload
+	for _, in := range []string{
+		`{"eventName":"aav.unknown","payload":"{}"}`,
+		`{"eventName":"aav.verified","payload":` + string(mustQuote(payload)) + `}`,
+		`not json`,
+	} {
+		if status, _ := orchestrator.call(relay, "POST", "/events", in); status != http.StatusBadRequest {
+			t.Fatalf("Event accepted: %s", in)
+		}
+	}
+}
+
+func mustQuote(b []byte) []byte {
+	q, _ := json.Marshal(string(b))
+	return q
+}
@@ -0,0 +1,109 @@
+package eventlistener
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"auth"
+)
+
+//MemorySource is an in-process Source: the events given to Publish are delivered to the subscribers.
+//It stands in for the channel in the tests, and is the buffer of the Relay
+type MemorySource struct {
+	mu   sync.Mutex
+	subs map[chan Event]context.Context
+}
+
+//NewMemorySource returns a source without subscriber
+func NewMemorySource() *MemorySource {
+	return &MemorySource{subs: make(map[chan Event]context.Context)}
+}
+
+//Events subscribes to the events published from now on
+func (s *MemorySource) Events(ctx context.Context) (<-chan Event, error) {
+	ch := make(chan Event, 64)
+	s.mu.Lock()
+	s.subs[ch] = ctx
+	s.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		s.mu.Lock()
+		delete(s.subs, ch)
+		s.mu.Unlock()
+		close(ch)
+	}()
+	return ch, nil
+}
+
+//Publish delivers e to every subscriber. It blocks while the buffer of a subscriber is full, unless it unsubscribes
+func (s *MemorySource) Publish(e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch, ctx := range s.subs {
+		select {
+		case ch <- e:
+		case <-ctx.Done():
+		}
+	}
+}
+
+//Relay is the Source of the service: the orchestrator, which is connected to the peers with the Fabric SDK,
+//listens to the chaincode events and posts each of them to the relay once its transaction is committed
+type Relay struct {
+	*MemorySource
+}
+
+//NewRelay returns a relay without subscriber
+func NewRelay() *Relay {
+	return &Relay{NewMemorySource()}
+}
+
+/**
+ * @api {post} /events Relay a chaincode event
+ *
+ * @apiName RelayEvent
+ * @apiGroup Events
+ *
+ * @apiDescription Called by the orchestrator for each chaincode event of the aav chaincode, once the transaction is valid.
+ * The event is forwarded to the matching webhooks. The route is refused when the service does not authenticate its clients,
+ * anyone could else forge the events posted to the SPs
+ *
+ * @apiParam {String} eventName Name of the chaincode event
+ * @apiParam {String} payload Payload of the chaincode event, the JSON emitted by the chaincode
+ *
+ * @apiParamExample {json} Request-Example:
+ *   {
+ *		"eventName": "aav.verified",
+ *		"payload": "{\"type\":\"aav.verified\",\"txID\":\"...\",...}"
+ *	 }
+ *
+ * @apiSuccessExample Success-Response:
+ *	HTTP/1.1 202 Accepted
+ *
+ */
+func (r *Relay) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if _, ok := auth.Roles(req); !ok {
+		http.Error(w, ErrUnauthenticated.Error(), http.StatusForbidden)
+		return
+	}
+	type Input struct {
+		EventName string `json:"eventName"`
+		Payload   string `json:"payload"`
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	var in Input
+	if err := json.Unmarshal(body, &in); err != nil {
+		http.Error(w, ErrMalformedEvent.Error(), http.StatusBadRequest)
+		return
+	}
+	e, err := ParseEvent(in.EventName, []byte(in.Payload))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.Publish(e)
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,184 @@
+package keystore
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"auth"
+
+	"github.com/gorilla/mux"
+)
+
+//Status returns the HTTP status of an error of the keystore
+func Status(err error) int {
+	switch err {
+	case ErrUnknownKey:
+		return http.StatusNotFound
+	case ErrKeyExists:
+		return http.StatusConflict
+	case ErrInvalidKey:
+		return http.StatusBadRequest
+	case ErrWrongOwner:
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+//WriteError answers a request with the error of the keystore err and its HTTP status
+func WriteError(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), Status(err))
+}
+
+//owned returns true if the client of the request may manage the keys of owner: it has the role owner,
+//or the service does not authenticate its clients
+func owned(r *http.Request, owner Role) bool {
+	return auth.HasRole(r, auth.Role(owner))
+}
+
+func writeInfo(w http.ResponseWriter, v interface{}) {
+	retByte, _ := json.Marshal(v)
+	w.Header().Set("content-type", "application/json")
+	w.Write(retByte)
+}
+
+/**
+ * @api {post} /keys Generate a key
+ *
+ * @apiName GenerateKey
+ * @apiGroup Keys
+ *
+ * @apiDescription Generate a private key in the keystore. Only its public key is returned: the routes using the key
+ * take its ID in their keyID parameter, and the key is only given to the routes of its owner.
+ * When the service authenticates its clients, a client only manages the keys of its roles
+ *
+ * @apiParam {String} [id] ID of the key, letters, digits, ".", "_" and "-". A random ID is chosen if it is empty
+ * @apiParam {String} type "ecdsa-p256" for the key of an IV, "bn256-issuer" for the pairing key of a CP, "bn256-holder" for the pairing key of a user
+ * @apiParam {String} owner Role using the key: "iv", "cp", "sp" or "holder"
+ *
+ * @apiParamExample {json} Request-Example:
+ *   {
+ *		"id": "cp-2024",
+ *		"type": "bn256-issuer",
+ *		"owner": "cp"
+ *	 }
+ *
+ * @apiSuccess {String} id ID of the key
+ * @apiSuccess {Number} version Current version of the key
+ * @apiSuccess {String} public Public key of the current version: the uncompressed P-256 point, the G1 point of a CP or the G2 point of a user
+ * @apiSuccess {Object[]} versions The versions of the key, with their public key and their creation and retirement dates
+ *
+ * @apiSuccessExample Success-Response:
+ *	HTTP/1.1 200 OK
+ *		{
+ *	 		"id": "cp-2024",
+ *	 		"type": "bn256-issuer",
+ *	 		"owner": "cp",
+ *	 		"version": 1,
+ *	 		"public": "01234ABC...",
+ *	 		"versions": [{"version": 1, "public": "01234ABC...", "created": "2024-05-02T10:00:00Z"}]
+ *		}
+ *
+ */
+func (s *Store) GenerateKey(w http.ResponseWriter, r *http.Request) {
+	type Input struct {
+		ID    string  `json:"id"`
+		Type  KeyType `json:"type"`
+		Owner Role    `json:"owner"`
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	var in Input
+	if err := json.Unmarshal(body, &in); err != nil {
+		WriteError(w, ErrInvalidKey)
+		return
+	}
+	if !owned(r, in.Owner) {
+		WriteError(w, ErrWrongOwner)
+		return
+	}
+	info, err := s.Generate(in.ID, in.Type, in.Owner)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	writeInfo(w, info)
+}
+
+/**
+ * @api {get} /keys List the keys
+ *
+ * @apiName GetKeys
+ * @apiGroup Keys
+ *
+ * @apiParam {String} [owner] Query parameter, only return the keys of this role
+ *
+ * @apiSuccessExample Success-Response:
+ *	HTTP/1.1 200 OK
+ *		[{"id": "cp-2024", "type": "bn256-issuer", "owner": "cp", "version": 1, "public": "01234ABC...", "versions": [...]}]
+ *
+ */
+func (s *Store) GetKeys(w http.ResponseWriter, r *http.Request) {
+	res := []KeyInfo{}
+	for _, k := range s.List(Role(r.URL.Query().Get("owner"))) {
+		if owned(r, k.Owner) {
+			res = append(res, k)
+		}
+	}
+	writeInfo(w, res)
+}
+
+/**
+ * @api {get} /keys/:id Get a key
+ *
+ * @apiName GetKey
+ * @apiGroup Keys
+ *
+ * @apiDescription Return the public keys of the versions of a key
+ *
+ * @apiSuccessExample Success-Response:
+ *	HTTP/1.1 200 OK
+ *		{"id": "cp-2024", "type": "bn256-issuer", "owner": "cp", "version": 1, "public": "01234ABC...", "versions": [...]}
+ *
+ */
+func (s *Store) GetKey(w http.ResponseWriter, r *http.Request) {
+	info, err := s.Info(mux.Vars(r)["id"])
+	if err == nil && !owned(r, info.Owner) {
+		err = ErrWrongOwner
+	}
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	writeInfo(w, info)
+}
+
+/**
+ * @api {post} /keys/:id/rotate Rotate a key
+ *
+ * @apiName RotateKey
+ * @apiGroup Keys
+ *
+ * @apiDescription Generate a new version of the key, used from now on by the routes given the ID of the key.
+ * The previous versions are retired but stay usable with the keyID "id@version", for instance to present a
+ * certificate issued for a previous holder key. The new public key of a CP must be registered in the chaincode
+ *
+ * @apiSuccessExample Success-Response:
+ *	HTTP/1.1 200 OK
+ *		{"id": "cp-2024", "type": "bn256-issuer", "owner": "cp", "version": 2, "public": "01234ABC...", "versions": [...]}
+ *
+ */
+func (s *Store) RotateKey(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	info, err := s.Info(id)
+	if err == nil && !owned(r, info.Owner) {
+		err = ErrWrongOwner
+	}
+	if err == nil {
+		info, err = s.Rotate(id)
+	}
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	writeInfo(w, info)
+}
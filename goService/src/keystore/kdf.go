@@ -0,0 +1,32 @@
+package keystore
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+//pbkdf2 derives a key of keyLen bytes from the passphrase with PBKDF2-HMAC-SHA256 (RFC 8018)
+func pbkdf2(passphrase, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, passphrase)
+	var res []byte
+	var block [4]byte
+	for i := uint32(1); len(res) < keyLen; i++ {
+		binary.BigEndian.PutUint32(block[:], i)
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(block[:])
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for n := 1; n < iterations; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		res = append(res, t...)
+	}
+	return res[:keyLen]
+}
@@ -0,0 +1,560 @@
+//Package keystore keeps the private keys of the service, so that the routes reference them by ID and the key material
+//never leaves the process: it is neither sent in the requests nor returned in the responses.
+//
+//The keys are stored in a JSON file, encrypted with AES-256-GCM under a key derived from a passphrase with
+//PBKDF2-HMAC-SHA256. The ID, type, owner and version of a key are authenticated with its ciphertext, so that an entry
+//of the file cannot be given to another owner or swapped with another one. A key is owned by a role and is only
+//given to the routes of this role. Rotating a key adds a version, which becomes the current one; the previous versions
+//stay usable with the reference "id@version", for instance to present a credential issued to a previous holder key.
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cryptolib"
+)
+
+//Role is the role of the actor owning a key
+type Role string
+
+//Roles of the protocol
+const (
+	RoleIV     Role = "iv"
+	RoleCP     Role = "cp"
+	RoleSP     Role = "sp"
+	RoleHolder Role = "holder"
+)
+
+//KeyType is the kind of a key
+type KeyType string
+
+//Types of the keys
+const (
+	//ECDSA is a P-256 signature key, such as the key of the IV signing the commitments
+	ECDSA KeyType = "ecdsa-p256"
+	//IssuerKey is the bn256 pairing key of a CP issuing certificates
+	IssuerKey KeyType = "bn256-issuer"
+	//HolderKey is the bn256 pairing key of the holder of a credential
+	HolderKey KeyType = "bn256-holder"
+)
+
+var (
+	//ErrPassphrase is returned when the keystore cannot be decrypted with the passphrase
+	ErrPassphrase = errors.New("keystore: wrong passphrase or corrupted keystore")
+	//ErrUnknownKey is returned when no key has the given ID or version
+	ErrUnknownKey = errors.New("keystore: unknown key")
+	//ErrKeyExists is returned when a key is created with the ID of another key
+	ErrKeyExists = errors.New("keystore: key already exists")
+	//ErrInvalidKey is returned when a key has an invalid ID, type or owner
+	ErrInvalidKey = errors.New("keystore: invalid key ID, type or owner")
+	//ErrWrongOwner is returned when a key is used by another role than its owner, or as another type
+	ErrWrongOwner = errors.New("keystore: key is not owned by this role or has another type")
+)
+
+//Iterations is the number of iterations of PBKDF2 of the new keystores
+var Iterations = 600000
+
+const (
+	fileVersion = 1
+	saltLen     = 16
+	//check is encrypted in the keystore to detect a wrong passphrase before decrypting any key
+	check = "aav keystore"
+)
+
+var validID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+//VersionInfo describes a version of a key. Public is its public key, hexadecimal
+type VersionInfo struct {
+	Version int        `json:"version"`
+	Public  string     `json:"public"`
+	Created time.Time  `json:"created"`
+	Retired *time.Time `json:"retired,omitempty"` //set when the key is rotated
+}
+
+//KeyInfo describes a key and its versions, without its private material
+type KeyInfo struct {
+	ID       string        `json:"id"`
+	Type     KeyType       `json:"type"`
+	Owner    Role          `json:"owner"`
+	Version  int           `json:"version"` //current version
+	Public   string        `json:"public"`  //public key of the current version
+	Versions []VersionInfo `json:"versions"`
+}
+
+//sealed is a value encrypted with AES-GCM
+type sealed struct {
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+type storedVersion struct {
+	VersionInfo
+	Secret sealed `json:"secret"`
+}
+
+type storedKey struct {
+	ID       string           `json:"id"`
+	Type     KeyType          `json:"type"`
+	Owner    Role             `json:"owner"`
+	Versions []*storedVersion `json:"versions"`
+}
+
+type kdfParams struct {
+	Name       string `json:"name"`
+	Iterations int    `json:"iterations"`
+	Salt       string `json:"salt"`
+}
+
+//storeFile is the content of the keystore file
+type storeFile struct {
+	Version int          `json:"version"`
+	KDF     kdfParams    `json:"kdf"`
+	Check   sealed       `json:"check"`
+	Keys    []*storedKey `json:"keys"`
+}
+
+//Store is a keystore file opened with its passphrase
+type Store struct {
+	path string
+	mu   sync.RWMutex
+	aead cipher.AEAD
+	file storeFile
+	keys map[string]*storedKey
+	rand io.Reader
+}
+
+//Create creates an empty keystore at path, which must not exist, encrypted with a key derived from passphrase
+func Create(path string, passphrase string) (*Store, error) {
+	if passphrase == "" {
+		return nil, errors.New("keystore: empty passphrase")
+	}
+	salt := make([]byte, saltLen)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	s := &Store{path: path, keys: make(map[string]*storedKey), rand: rand.Reader}
+	s.file = storeFile{
+		Version: fileVersion,
+		KDF:     kdfParams{Name: "pbkdf2-sha256", Iterations: Iterations, Salt: hex.EncodeToString(salt)},
+		Keys:    []*storedKey{},
+	}
+	var err error
+	if s.aead, err = newAEAD(passphrase, salt, Iterations); err != nil {
+		return nil, err
+	}
+	if s.file.Check, err = s.seal([]byte(check), []byte(check)); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	return s, s.save()
+}
+
+//Open opens the keystore at path with its passphrase
+func Open(path string, passphrase string) (*Store, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{path: path, keys: make(map[string]*storedKey), rand: rand.Reader}
+	if err := json.Unmarshal(b, &s.file); err != nil {
+		return nil, errors.New("keystore: malformed keystore: " + err.Error())
+	}
+	if s.file.Version != fileVersion || s.file.KDF.Name != "pbkdf2-sha256" || s.file.KDF.Iterations < 1 {
+		return nil, errors.New("keystore: unsupported keystore version or key derivation")
+	}
+	salt, err := hex.DecodeString(s.file.KDF.Salt)
+	if err != nil {
+		return nil, ErrPassphrase
+	}
+	if s.aead, err = newAEAD(passphrase, salt, s.file.KDF.Iterations); err != nil {
+		return nil, err
+	}
+	if plain, err := s.open(s.file.Check, []byte(check)); err != nil || string(plain) != check {
+		return nil, ErrPassphrase
+	}
+	for _, k := range s.file.Keys {
+		if len(k.Versions) == 0 || s.keys[k.ID] != nil {
+			return nil, errors.New("keystore: malformed keystore")
+		}
+		s.keys[k.ID] = k
+	}
+	return s, nil
+}
+
+//OpenOrCreate opens the keystore at path, or creates it if it does not exist
+func OpenOrCreate(path string, passphrase string) (*Store, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return Create(path, passphrase)
+	}
+	return Open(path, passphrase)
+}
+
+func newAEAD(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(pbkdf2([]byte(passphrase), salt, iterations, 32))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+//additionalData binds a secret to the ID, type, owner and version of its key
+func additionalData(k *storedKey, version int) []byte {
+	return []byte(strings.Join([]string{"aav keystore", k.ID, string(k.Type), string(k.Owner), strconv.Itoa(version)}, "\x00"))
+}
+
+func (s *Store) seal(plain []byte, ad []byte) (sealed, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := io.ReadFull(s.rand, nonce); err != nil {
+		return sealed{}, err
+	}
+	return sealed{Nonce: hex.EncodeToString(nonce), Ciphertext: hex.EncodeToString(s.aead.Seal(nil, nonce, plain, ad))}, nil
+}
+
+func (s *Store) open(v sealed, ad []byte) ([]byte, error) {
+	nonce, err := hex.DecodeString(v.Nonce)
+	if err != nil || len(nonce) != s.aead.NonceSize() {
+		return nil, ErrPassphrase
+	}
+	ciphertext, err := hex.DecodeString(v.Ciphertext)
+	if err != nil {
+		return nil, ErrPassphrase
+	}
+	plain, err := s.aead.Open(nil, nonce, ciphertext, ad)
+	if err != nil {
+		return nil, ErrPassphrase
+	}
+	return plain, nil
+}
+
+//save writes the keystore to a temporary file which replaces the previous one, readable by the owner only
+func (s *Store) save() error {
+	b, err := json.MarshalIndent(&s.file, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+//newKeyMaterial generates a private key of type t and returns it with its public key
+func newKeyMaterial(r io.Reader, t KeyType) ([]byte, []byte, error) {
+	switch t {
+	case ECDSA:
+		k, err := ecdsa.GenerateKey(elliptic.P256(), r)
+		if err != nil {
+			return nil, nil, err
+		}
+		priv := make([]byte, 32)
+		d := k.D.Bytes()
+		copy(priv[32-len(d):], d)
+		return priv, elliptic.Marshal(k.Curve, k.X, k.Y), nil
+	case IssuerKey:
+		k, err := cryptolib.GenerateIssuerKey(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return k.Marshal(), k.IssuerPublicKey.Marshal(), nil
+	case HolderKey:
+		k, err := cryptolib.GenerateHolderKey(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return k.Marshal(), k.HolderPublicKey.Marshal(), nil
+	}
+	return nil, nil, ErrInvalidKey
+}
+
+//publicKey checks the private key priv of type t and returns its public key
+func publicKey(t KeyType, priv []byte) ([]byte, error) {
+	switch t {
+	case ECDSA:
+		k, err := ecdsaKey(priv)
+		if err != nil {
+			return nil, err
+		}
+		return elliptic.Marshal(k.Curve, k.X, k.Y), nil
+	case IssuerKey:
+		var k cryptolib.IssuerKey
+		if err := k.Unmarshal(priv); err != nil {
+			return nil, err
+		}
+		return k.IssuerPublicKey.Marshal(), nil
+	case HolderKey:
+		var k cryptolib.HolderKey
+		if err := k.Unmarshal(priv); err != nil {
+			return nil, err
+		}
+		return k.HolderPublicKey.Marshal(), nil
+	}
+	return nil, ErrInvalidKey
+}
+
+func ecdsaKey(priv []byte) (*ecdsa.PrivateKey, error) {
+	c := elliptic.P256()
+	d := new(big.Int).SetBytes(priv)
+	if d.Sign() == 0 || d.Cmp(c.Params().N) >= 0 {
+		return nil, errors.New("keystore: ECDSA private key must be in [1, N)")
+	}
+	k := &ecdsa.PrivateKey{D: d}
+	k.Curve = c
+	k.X, k.Y = c.ScalarBaseMult(priv)
+	return k, nil
+}
+
+func validOwner(owner Role) bool {
+	return owner == RoleIV || owner == RoleCP || owner == RoleSP || owner == RoleHolder
+}
+
+//Generate creates the key id of type t owned by owner, and returns its description.
+//A random ID is chosen if id is empty
+func (s *Store) Generate(id string, t KeyType, owner Role) (KeyInfo, error) {
+	priv, _, err := newKeyMaterial(s.rand, t)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	return s.add(id, t, owner, priv)
+}
+
+//Import adds the existing private key priv, in the binary form of its type, as the key id.
+//It is meant to move the keys used before the keystore into it
+func (s *Store) Import(id string, t KeyType, owner Role, priv []byte) (KeyInfo, error) {
+	if _, err := publicKey(t, priv); err != nil {
+		return KeyInfo{}, err
+	}
+	return s.add(id, t, owner, priv)
+}
+
+func (s *Store) add(id string, t KeyType, owner Role, priv []byte) (KeyInfo, error) {
+	if id == "" {
+		b := make([]byte, 8)
+		if _, err := io.ReadFull(s.rand, b); err != nil {
+			return KeyInfo{}, err
+		}
+		id = hex.EncodeToString(b)
+	}
+	if !validID.MatchString(id) || !validOwner(owner) {
+		return KeyInfo{}, ErrInvalidKey
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keys[id] != nil {
+		return KeyInfo{}, ErrKeyExists
+	}
+	k := &storedKey{ID: id, Type: t, Owner: owner}
+	if err := s.addVersion(k, priv); err != nil {
+		return KeyInfo{}, err
+	}
+	s.keys[id] = k
+	s.file.Keys = append(s.file.Keys, k)
+	if err := s.save(); err != nil {
+		delete(s.keys, id)
+		s.file.Keys = s.file.Keys[:len(s.file.Keys)-1]
+		return KeyInfo{}, err
+	}
+	return k.info(), nil
+}
+
+//addVersion encrypts priv as the new current version of k
+func (s *Store) addVersion(k *storedKey, priv []byte) error {
+	pub, err := publicKey(k.Type, priv)
+	if err != nil {
+		return err
+	}
+	v := &storedVersion{VersionInfo: VersionInfo{Version: len(k.Versions) + 1, Public: hex.EncodeToString(pub), Created: time.Now().UTC()}}
+	if v.Secret, err = s.seal(priv, additionalData(k, v.Version)); err != nil {
+		return err
+	}
+	k.Versions = append(k.Versions, v)
+	return nil
+}
+
+//Rotate generates a new version of the key id, which becomes its current version. The previous version is retired
+func (s *Store) Rotate(id string) (KeyInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := s.keys[id]
+	if k == nil {
+		return KeyInfo{}, ErrUnknownKey
+	}
+	priv, _, err := newKeyMaterial(s.rand, k.Type)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	previous := k.Versions[len(k.Versions)-1]
+	if err := s.addVersion(k, priv); err != nil {
+		return KeyInfo{}, err
+	}
+	now := time.Now().UTC()
+	previous.Retired = &now
+	if err := s.save(); err != nil {
+		previous.Retired = nil
+		k.Versions = k.Versions[:len(k.Versions)-1]
+		return KeyInfo{}, err
+	}
+	return k.info(), nil
+}
+
+//ChangePassphrase encrypts the keystore with a key derived from a new passphrase and a new salt
+func (s *Store) ChangePassphrase(passphrase string) error {
+	if passphrase == "" {
+		return errors.New("keystore: empty passphrase")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	salt := make([]byte, saltLen)
+	if _, err := io.ReadFull(s.rand, salt); err != nil {
+		return err
+	}
+	aead, err := newAEAD(passphrase, salt, Iterations)
+	if err != nil {
+		return err
+	}
+	next := &Store{path: s.path, aead: aead, rand: s.rand}
+	next.file = storeFile{Version: fileVersion, KDF: kdfParams{Name: "pbkdf2-sha256", Iterations: Iterations, Salt: hex.EncodeToString(salt)}}
+	if next.file.Check, err = next.seal([]byte(check), []byte(check)); err != nil {
+		return err
+	}
+	for _, k := range s.file.Keys {
+		copied := &storedKey{ID: k.ID, Type: k.Type, Owner: k.Owner}
+		for _, v := range k.Versions {
+			ad := additionalData(k, v.Version)
+			priv, err := s.open(v.Secret, ad)
+			if err != nil {
+				return err
+			}
+			c := &storedVersion{VersionInfo: v.VersionInfo}
+			if c.Secret, err = next.seal(priv, ad); err != nil {
+				return err
+			}
+			copied.Versions = append(copied.Versions, c)
+		}
+		next.file.Keys = append(next.file.Keys, copied)
+	}
+	if err := next.save(); err != nil {
+		return err
+	}
+	s.aead = aead
+	s.file = next.file
+	for _, k := range s.file.Keys {
+		s.keys[k.ID] = k
+	}
+	return nil
+}
+
+func (k *storedKey) info() KeyInfo {
+	res := KeyInfo{ID: k.ID, Type: k.Type, Owner: k.Owner}
+	for _, v := range k.Versions {
+		res.Versions = append(res.Versions, v.VersionInfo)
+	}
+	current := k.Versions[len(k.Versions)-1]
+	res.Version = current.Version
+	res.Public = current.Public
+	return res
+}
+
+//Info returns the description of the key id
+func (s *Store) Info(id string) (KeyInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	k := s.keys[id]
+	if k == nil {
+		return KeyInfo{}, ErrUnknownKey
+	}
+	return k.info(), nil
+}
+
+//List returns the description of the keys owned by owner, or of all of them if owner is empty, ordered by ID
+func (s *Store) List(owner Role) []KeyInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	res := []KeyInfo{}
+	for _, k := range s.keys {
+		if owner == "" || k.Owner == owner {
+			res = append(res, k.info())
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res
+}
+
+//private decrypts the private key referenced by ref, "id" for the current version or "id@version",
+//which must be of type t and owned by owner
+func (s *Store) private(ref string, t KeyType, owner Role) ([]byte, error) {
+	id, version := ref, 0
+	if i := strings.LastIndex(ref, "@"); i >= 0 {
+		var err error
+		id = ref[:i]
+		if version, err = strconv.Atoi(ref[i+1:]); err != nil || version < 1 {
+			return nil, ErrUnknownKey
+		}
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	k := s.keys[id]
+	if k == nil {
+		return nil, ErrUnknownKey
+	}
+	if k.Type != t || k.Owner != owner {
+		return nil, ErrWrongOwner
+	}
+	if version == 0 {
+		version = len(k.Versions)
+	}
+	if version > len(k.Versions) {
+		return nil, ErrUnknownKey
+	}
+	return s.open(k.Versions[version-1].Secret, additionalData(k, version))
+}
+
+//ECDSAKey returns the ECDSA key referenced by ref, owned by owner
+func (s *Store) ECDSAKey(ref string, owner Role) (*ecdsa.PrivateKey, error) {
+	priv, err := s.private(ref, ECDSA, owner)
+	if err != nil {
+		return nil, err
+	}
+	return ecdsaKey(priv)
+}
+
+//IssuerKey returns the pairing key of a CP referenced by ref, owned by owner
+func (s *Store) IssuerKey(ref string, owner Role) (*cryptolib.IssuerKey, error) {
+	priv, err := s.private(ref, IssuerKey, owner)
+	if err != nil {
+		return nil, err
+	}
+	k := new(cryptolib.IssuerKey)
+	return k, k.Unmarshal(priv)
+}
+
+//HolderKey returns the pairing key of a holder referenced by ref, owned by owner
+func (s *Store) HolderKey(ref string, owner Role) (*cryptolib.HolderKey, error) {
+	priv, err := s.private(ref, HolderKey, owner)
+	if err != nil {
+		return nil, err
+	}
+	k := new(cryptolib.HolderKey)
+	return k, k.Unmarshal(priv)
+}
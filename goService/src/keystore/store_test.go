@@ -0,0 +1,309 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"auth"
+	"cryptolib"
+
+	"github.com/gorilla/mux"
+)
+
+func init() {
+	//the keystores of the tests do not need a slow key derivation
+	Iterations = 1000
+}
+
+func newStore(t *testing.T) (*Store, string) {
+	path := filepath.Join(t.TempDir(), "keystore.json")
+	s, err := Create(path, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, path
+}
+
+func TestPBKDF2(t *testing.T) {
+	//RFC 7914, section 11
+	want := "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"
+	if got := hex.EncodeToString(pbkdf2([]byte("passwd"), []byte("salt"), 1, 64)); got != want {
+		t.Fatalf("Wrong PBKDF2-HMAC-SHA256: %s", got)
+	}
+}
+
+func TestStore(t *testing.T) {
+	s, path := newStore(t)
+	iv, err := s.Generate("iv", ECDSA, RoleIV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp, err := s.Generate("cp", IssuerKey, RoleCP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	holder, err := s.Generate("", HolderKey, RoleHolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Generate("cp", IssuerKey, RoleCP); err != ErrKeyExists {
+		t.Fatalf("Duplicated ID: %v", err)
+	}
+	if _, err := s.Generate("a/b", IssuerKey, RoleCP); err != ErrInvalidKey {
+		t.Fatalf("Invalid ID: %v", err)
+	}
+	if _, err := s.Generate("x", IssuerKey, "admin"); err != ErrInvalidKey {
+		t.Fatalf("Invalid owner: %v", err)
+	}
+
+	//the file does not contain the private keys in clear, and is only readable by its owner
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := s.IssuerKey("cp", RoleCP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, []byte(hex.EncodeToString(k.Marshal()))) {
+		t.Fatal("Private key stored in clear")
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0600 {
+		t.Fatalf("Wrong permissions of the keystore: %v", fi.Mode())
+	}
+	if hex.EncodeToString(k.IssuerPublicKey.Marshal()) != cp.Public {
+		t.Fatal("Wrong public key of the CP")
+	}
+
+	//the keys are only given to their owner, as their type
+	if _, err := s.IssuerKey("cp", RoleHolder); err != ErrWrongOwner {
+		t.Fatalf("Key given to another role: %v", err)
+	}
+	if _, err := s.HolderKey("cp", RoleCP); err != ErrWrongOwner {
+		t.Fatalf("Key given as another type: %v", err)
+	}
+	if _, err := s.ECDSAKey("unknown", RoleIV); err != ErrUnknownKey {
+		t.Fatalf("Unknown key: %v", err)
+	}
+
+	//the keys are the same once the keystore is reopened
+	reopened, err := Open(path, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := reopened.ECDSAKey("iv", RoleIV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256([]byte("commitment"))
+	r, sig, err := ecdsa.Sign(rand.Reader, signer, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, _ := hex.DecodeString(iv.Public)
+	x, y := elliptic.Unmarshal(elliptic.P256(), pub)
+	if !ecdsa.Verify(&ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, hash[:], r, sig) {
+		t.Fatal("Signature of the reopened key does not verify")
+	}
+	h, err := reopened.HolderKey(holder.ID, RoleHolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(h.HolderPublicKey.Marshal()) != holder.Public {
+		t.Fatal("Wrong public key of the holder")
+	}
+	if list := reopened.List(RoleCP); len(list) != 1 || list[0].ID != "cp" {
+		t.Fatalf("Wrong list of the keys of the CP: %v", list)
+	}
+	if list := reopened.List(""); len(list) != 3 {
+		t.Fatalf("Wrong list of the keys: %v", list)
+	}
+
+	if _, err := Open(path, "wrong"); err != ErrPassphrase {
+		t.Fatalf("Wrong passphrase: %v", err)
+	}
+	if err := s.ChangePassphrase("new passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path, "passphrase"); err != ErrPassphrase {
+		t.Fatalf("Previous passphrase: %v", err)
+	}
+	reopened, err = Open(path, "new passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k2, err := reopened.IssuerKey("cp", RoleCP); err != nil || !bytes.Equal(k2.Marshal(), k.Marshal()) {
+		t.Fatalf("Key lost by the change of passphrase: %v", err)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	s, path := newStore(t)
+	first, err := s.Generate("holder", HolderKey, RoleHolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := s.Rotate("holder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.Version != 2 || rotated.Public == first.Public || len(rotated.Versions) != 2 ||
+		rotated.Versions[0].Retired == nil || rotated.Versions[1].Retired != nil {
+		t.Fatalf("Wrong rotation: %+v", rotated)
+	}
+	s, err = Open(path, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := s.HolderKey("holder", RoleHolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous, err := s.HolderKey("holder@1", RoleHolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(current.HolderPublicKey.Marshal()) != rotated.Public ||
+		hex.EncodeToString(previous.HolderPublicKey.Marshal()) != first.Public {
+		t.Fatal("Wrong versions after the rotation")
+	}
+	for _, ref := range []string{"holder@3", "holder@0", "holder@x"} {
+		if _, err := s.HolderKey(ref, RoleHolder); err != ErrUnknownKey {
+			t.Fatalf("%s: %v", ref, err)
+		}
+	}
+	if _, err := s.Rotate("unknown"); err != ErrUnknownKey {
+		t.Fatalf("Rotation of an unknown key: %v", err)
+	}
+}
+
+func TestImport(t *testing.T) {
+	s, _ := newStore(t)
+	k, err := cryptolib.GenerateIssuerKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := s.Import("cp", IssuerKey, RoleCP, k.Marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Public != hex.EncodeToString(k.IssuerPublicKey.Marshal()) {
+		t.Fatal("Wrong public key of the imported key")
+	}
+	if _, err := s.Import("iv", ECDSA, RoleIV, make([]byte, 32)); err == nil {
+		t.Fatal("Null ECDSA key imported")
+	}
+}
+
+func TestTampered(t *testing.T) {
+	s, path := newStore(t)
+	if _, err := s.Generate("cp", IssuerKey, RoleCP); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//the owner is authenticated with the key: the key of the CP cannot be given to another role
+	if err := ioutil.WriteFile(path, bytes.Replace(b, []byte(`"owner": "cp"`), []byte(`"owner": "holder"`), 1), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s, err = Open(path, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.IssuerKey("cp", RoleHolder); err != ErrPassphrase {
+		t.Fatalf("Tampered owner accepted: %v", err)
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	s, _ := newStore(t)
+	router := mux.NewRouter()
+	router.HandleFunc("/keys", s.GenerateKey).Methods("POST")
+	router.HandleFunc("/keys", s.GetKeys).Methods("GET")
+	router.HandleFunc("/keys/{id}", s.GetKey).Methods("GET")
+	router.HandleFunc("/keys/{id}/rotate", s.RotateKey).Methods("POST")
+
+	for _, tc := range []struct {
+		method, url, body string
+		status            int
+		contains          string
+	}{
+		{"POST", "/keys", `{"id": "cp", "type": "bn256-issuer", "owner": "cp"}`, http.StatusOK, `"version":1`},
+		{"POST", "/keys", `{"id": "cp", "type": "bn256-issuer", "owner": "cp"}`, http.StatusConflict, ErrKeyExists.Error()},
+		{"POST", "/keys", `{"id": "x", "type": "rsa", "owner": "cp"}`, http.StatusBadRequest, ErrInvalidKey.Error()},
+		{"POST", "/keys/cp/rotate", ``, http.StatusOK, `"version":2`},
+		{"GET", "/keys/cp", ``, http.StatusOK, `"retired"`},
+		{"GET", "/keys/unknown", ``, http.StatusNotFound, ErrUnknownKey.Error()},
+		{"GET", "/keys?owner=holder", ``, http.StatusOK, `[]`},
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.body)))
+		if rec.Code != tc.status || !strings.Contains(rec.Body.String(), tc.contains) {
+			t.Fatalf("%s %s: %d %s", tc.method, tc.url, rec.Code, rec.Body.String())
+		}
+		if strings.Contains(rec.Body.String(), "secret") {
+			t.Fatalf("%s %s: secret returned", tc.method, tc.url)
+		}
+	}
+}
+
+func TestHandlersRoles(t *testing.T) {
+	s, _ := newStore(t)
+	if _, err := s.Generate("cp", IssuerKey, RoleCP); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Generate("alice", HolderKey, RoleHolder); err != nil {
+		t.Fatal(err)
+	}
+	router := mux.NewRouter()
+	router.HandleFunc("/keys", s.GenerateKey).Methods("POST")
+	router.HandleFunc("/keys", s.GetKeys).Methods("GET")
+	router.HandleFunc("/keys/{id}", s.GetKey).Methods("GET")
+	router.HandleFunc("/keys/{id}/rotate", s.RotateKey).Methods("POST")
+	handler := auth.NewAuthorizer(nil, nil).Wrap(router)
+
+	//the client is a holder, authenticated by the OU of its certificate
+	holder := &x509.Certificate{Subject: pkix.Name{CommonName: "alice", OrganizationalUnit: []string{"holder"}}}
+	for _, tc := range []struct {
+		method, url, body string
+		status            int
+	}{
+		{"POST", "/keys", `{"type": "bn256-holder", "owner": "holder"}`, http.StatusOK},
+		{"POST", "/keys", `{"type": "bn256-issuer", "owner": "cp"}`, http.StatusForbidden},
+		{"POST", "/keys/cp/rotate", ``, http.StatusForbidden},
+		{"POST", "/keys/alice/rotate", ``, http.StatusOK},
+		{"GET", "/keys/cp", ``, http.StatusForbidden},
+		{"GET", "/keys/alice", ``, http.StatusOK},
+	} {
+		req := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{holder}}}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tc.status {
+			t.Fatalf("%s %s: %d %s", tc.method, tc.url, rec.Code, rec.Body.String())
+		}
+	}
+	req := httptest.NewRequest("GET", "/keys", nil)
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{holder}}}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if strings.Contains(rec.Body.String(), `"cp"`) || !strings.Contains(rec.Body.String(), `"alice"`) {
+		t.Fatalf("Keys of the other roles listed: %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,92 @@
+//Package telemetry measures the service: Prometheus metrics of the routes and of the cryptographic primitives,
+//served on /metrics, and OpenTelemetry spans of the requests and of the cryptolib calls of their handlers, exported over OTLP.
+//cryptolib itself starts no span: the primitives computed inside a call are only measured by the metrics
+package telemetry
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+//Outcomes of a request, by class of its status
+const (
+	OutcomeSuccess     = "success"
+	OutcomeClientError = "client_error"
+	OutcomeServerError = "server_error"
+)
+
+//registry holds the metrics served by Handler
+var registry = prometheus.NewRegistry()
+
+var (
+	requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "aav",
+		Name:      "http_requests_total",
+		Help:      "Requests answered by the service, by route, method and outcome.",
+	}, []string{"route", "method", "outcome"})
+
+	//the routes take from a few hundred microseconds (a commitment) to tens of milliseconds (several pairings),
+	//and up to seconds for a batch
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "aav",
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of the requests, by route, method and outcome.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 16),
+	}, []string{"route", "method", "outcome"})
+
+	inFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "aav",
+		Name:      "http_requests_in_flight",
+		Help:      "Requests being answered, by route.",
+	}, []string{"route"})
+
+	//a hash takes about a microsecond, a scalar multiplication tens of microseconds to a few milliseconds on G2,
+	//a pairing check several milliseconds
+	primitiveDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "aav",
+		Name:      "crypto_primitive_duration_seconds",
+		Help:      "Duration of the cryptographic primitives computed by cryptolib: pairing, miller_loop, final_exponentiation, scalar_mult and hash.",
+		Buckets:   prometheus.ExponentialBuckets(0.000001, 2, 16),
+	}, []string{"primitive"})
+
+	droppedEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "aav",
+		Name:      "webhook_events_dropped_total",
+		Help:      "Chaincode events not delivered to a webhook after its last attempt, by event type.",
+	}, []string{"event"})
+)
+
+func init() {
+	registry.MustRegister(requests, requestDuration, inFlight, primitiveDuration, droppedEvents,
+		collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+}
+
+//Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+//ObservePrimitive records the duration of a primitive of cryptolib. It is the observer given to cryptolib.SetObserver
+func ObservePrimitive(primitive string, elapsed time.Duration) {
+	primitiveDuration.WithLabelValues(primitive).Observe(elapsed.Seconds())
+}
+
+//CountDroppedEvent counts an event of eventType dropped for a webhook. It is the OnDrop of the event listener
+func CountDroppedEvent(eventType string) {
+	droppedEvents.WithLabelValues(eventType).Inc()
+}
+
+//outcome returns the outcome of a request answered with status
+func outcome(status int) string {
+	switch {
+	case status >= 500:
+		return OutcomeServerError
+	case status >= 400:
+		return OutcomeClientError
+	}
+	return OutcomeSuccess
+}
@@ -0,0 +1,62 @@
+package telemetry
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//statusWriter keeps the status answered by a handler
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+//route returns the path template of the route of r, such as /keys/{id}, so that the metrics of a route are not split by
+//the values of its parameters
+func route(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return r.URL.Path
+}
+
+//Middleware measures the requests of the routes of a router and answers each of them in a span, child of the span of the
+//caller when the request carries a trace context. It is given to the Use method of the router, so that the routes are known
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := route(r)
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := Start(ctx, r.Method+" "+path, trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attribute.String("http.request.method", r.Method), attribute.String("http.route", path)))
+		defer span.End()
+
+		inFlight.WithLabelValues(path).Inc()
+		defer inFlight.WithLabelValues(path).Dec()
+
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+		result := outcome(sw.status)
+		requests.WithLabelValues(path, r.Method, result).Inc()
+		requestDuration.WithLabelValues(path, r.Method, result).Observe(time.Since(start).Seconds())
+
+		span.SetAttributes(attribute.Int("http.response.status_code", sw.status))
+		if result == OutcomeServerError {
+			span.SetStatus(codes.Error, http.StatusText(sw.status))
+		}
+	})
+}
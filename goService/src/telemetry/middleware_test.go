@@ -0,0 +1,62 @@
+package telemetry
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestMiddleware(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(Middleware)
+	router.HandleFunc("/keys/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if mux.Vars(r)["id"] == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}).Methods("GET")
+	router.Handle("/metrics", Handler()).Methods("GET")
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	for _, id := range []string{"iv", "cp", "missing"} {
+		resp, err := http.Get(server.URL + "/keys/" + id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	CountDroppedEvent("aav.verified")
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//the requests are counted by route template, not by path
+	for _, line := range []string{
+		`aav_http_requests_total{method="GET",outcome="success",route="/keys/{id}"} 2`,
+		`aav_http_requests_total{method="GET",outcome="client_error",route="/keys/{id}"} 1`,
+		`aav_http_requests_in_flight{route="/keys/{id}"} 0`,
+		`aav_webhook_events_dropped_total{event="aav.verified"} 1`,
+	} {
+		if !strings.Contains(string(body), line) {
+			t.Errorf("Metrics without %s", line)
+		}
+	}
+}
+
+func TestOutcome(t *testing.T) {
+	for status, expected := range map[int]string{200: OutcomeSuccess, 204: OutcomeSuccess, 400: OutcomeClientError, 404: OutcomeClientError, 500: OutcomeServerError, 502: OutcomeServerError} {
+		if result := outcome(status); result != expected {
+			t.Errorf("Outcome of %d: %s instead of %s", status, result, expected)
+		}
+	}
+}